@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"log"
+	"time"
 
 	logger "github.com/sirupsen/logrus"
 	"github.com/vapor-ware/synse-sdk/examples/device_actions/devices"
@@ -44,6 +45,12 @@ func deviceSetupAction(_ *sdk.Plugin, d *sdk.Device) error {
 	return nil
 }
 
+// devicePeriodicAction defines a function we will use as a device periodic action.
+func devicePeriodicAction(_ *sdk.Plugin, d *sdk.Device) error {
+	logger.Debugf("devicePeriodicAction -> refreshing device %v", d.GetID())
+	return nil
+}
+
 func main() {
 	// Set the metadata for the plugin.
 	sdk.SetPluginInfo(
@@ -95,6 +102,20 @@ func main() {
 		log.Fatal(err)
 	}
 
+	// Register a device periodic action, which is run for the matching devices
+	// every 30 seconds while the plugin is running.
+	err = plugin.RegisterDevicePeriodicActions(
+		&sdk.DeviceAction{
+			Name:     "example periodic action",
+			Filter:   map[string][]string{"type": {"temperature"}},
+			Interval: 30 * time.Second,
+			Action:   devicePeriodicAction,
+		},
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	// Run the plugin.
 	if err := plugin.Run(); err != nil {
 		log.Fatal(err)
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/binary"
 	"fmt"
 	"log"
@@ -34,7 +35,7 @@ var (
 	// pusherHandler defines the listen behavior for the "pusher" device kind.
 	pusherHandler = sdk.DeviceHandler{
 		Name: "pusher",
-		Listen: func(device *sdk.Device, data chan *sdk.ReadContext) error {
+		Subscribe: func(ctx context.Context, device *sdk.Device, emit sdk.Emitter) error {
 			// The device data defines the host/port to listen on.
 			address := device.Data["address"].(string)
 
@@ -46,9 +47,21 @@ var (
 			if err != nil {
 				return err
 			}
+
+			// Close the connection when the subscription is cancelled, which
+			// unblocks the pending read below.
+			go func() {
+				<-ctx.Done()
+				conn.Close()
+			}()
+
 			buffer := make([]byte, 4)
 			for {
 				size, err := conn.Read(buffer)
+				if ctx.Err() != nil {
+					// The subscription was cancelled, stop listening.
+					return nil
+				}
 				if err != nil {
 					// failed read, try again
 					continue
@@ -64,7 +77,9 @@ var (
 				if err != nil {
 					return err
 				}
-				data <- sdk.NewReadContext(device, []*output.Reading{reading})
+				if err := emit(reading); err != nil {
+					return err
+				}
 			}
 		},
 	}
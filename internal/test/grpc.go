@@ -17,6 +17,7 @@
 package test
 
 import (
+	"context"
 	"fmt"
 
 	synse "github.com/vapor-ware/synse-server-grpc/go"
@@ -96,6 +97,7 @@ func (mock *MockReadStreamErr) Send(reading *synse.V3Reading) error {
 // MockReadCachedStream mocks the stream for the ReadCached request, with no error.
 type MockReadCachedStream struct {
 	grpc.ServerStream
+	Ctx     context.Context
 	Results []*synse.V3Reading
 }
 
@@ -106,6 +108,15 @@ func NewMockReadCachedStream() *MockReadCachedStream {
 	}
 }
 
+// Context fulfils the stream interface for the mock grpc stream. It returns the
+// mock's context, if set.
+func (mock *MockReadCachedStream) Context() context.Context {
+	if mock.Ctx != nil {
+		return mock.Ctx
+	}
+	return context.Background()
+}
+
 // Send fulfils the stream interface for the mock grpc stream.
 func (mock *MockReadCachedStream) Send(reading *synse.V3Reading) error {
 	mock.Results = append(mock.Results, reading)
@@ -115,6 +126,16 @@ func (mock *MockReadCachedStream) Send(reading *synse.V3Reading) error {
 // MockReadCachedStreamErr mocks the stream for a ReadCached request, with error.
 type MockReadCachedStreamErr struct {
 	grpc.ServerStream
+	Ctx context.Context
+}
+
+// Context fulfils the stream interface for the mock grpc stream. It returns the
+// mock's context, if set.
+func (mock *MockReadCachedStreamErr) Context() context.Context {
+	if mock.Ctx != nil {
+		return mock.Ctx
+	}
+	return context.Background()
 }
 
 // Send fulfils the stream interface for the mock grpc stream.
@@ -129,6 +150,7 @@ func (mock *MockReadCachedStreamErr) Send(reading *synse.V3Reading) error {
 // MockReadStreamStream mocks the stream for the ReadCached request, with no error.
 type MockReadStreamStream struct {
 	grpc.ServerStream
+	Ctx     context.Context
 	Results []*synse.V3Reading
 }
 
@@ -139,6 +161,15 @@ func NewMockReadStreamStream() *MockReadStreamStream {
 	}
 }
 
+// Context fulfils the stream interface for the mock grpc stream. It returns the
+// mock's context, if set.
+func (mock *MockReadStreamStream) Context() context.Context {
+	if mock.Ctx != nil {
+		return mock.Ctx
+	}
+	return context.Background()
+}
+
 // Send fulfils the stream interface for the mock grpc stream.
 func (mock *MockReadStreamStream) Send(reading *synse.V3Reading) error {
 	mock.Results = append(mock.Results, reading)
@@ -148,6 +179,16 @@ func (mock *MockReadStreamStream) Send(reading *synse.V3Reading) error {
 // MockReadStreamStreamErr mocks the stream for a ReadCached request, with error.
 type MockReadStreamStreamErr struct {
 	grpc.ServerStream
+	Ctx context.Context
+}
+
+// Context fulfils the stream interface for the mock grpc stream. It returns the
+// mock's context, if set.
+func (mock *MockReadStreamStreamErr) Context() context.Context {
+	if mock.Ctx != nil {
+		return mock.Ctx
+	}
+	return context.Background()
 }
 
 // Send fulfils the stream interface for the mock grpc stream.
@@ -162,6 +203,7 @@ func (mock *MockReadStreamStreamErr) Send(reading *synse.V3Reading) error {
 // MockWriteAsyncStream mocks the stream for the AsyncWrite request, with no error.
 type MockWriteAsyncStream struct {
 	grpc.ServerStream
+	Ctx     context.Context
 	Results map[string]*synse.V3WriteTransaction
 }
 
@@ -172,6 +214,15 @@ func NewMockWriteAsyncStream() *MockWriteAsyncStream {
 	}
 }
 
+// Context fulfils the stream interface for the mock grpc stream. It returns the
+// mock's context, if set.
+func (mock *MockWriteAsyncStream) Context() context.Context {
+	if mock.Ctx != nil {
+		return mock.Ctx
+	}
+	return context.Background()
+}
+
 // Send fulfils the stream interface for the mock grpc stream.
 func (mock *MockWriteAsyncStream) Send(write *synse.V3WriteTransaction) error {
 	mock.Results[write.Id] = write
@@ -183,6 +234,11 @@ type MockWriteAsyncStreamErr struct {
 	grpc.ServerStream
 }
 
+// Context fulfils the stream interface for the mock grpc stream.
+func (mock *MockWriteAsyncStreamErr) Context() context.Context {
+	return context.Background()
+}
+
 // Send fulfils the stream interface for the mock grpc stream.
 func (mock *MockWriteAsyncStreamErr) Send(write *synse.V3WriteTransaction) error {
 	return fmt.Errorf("grpc error")
@@ -195,6 +251,7 @@ func (mock *MockWriteAsyncStreamErr) Send(write *synse.V3WriteTransaction) error
 // MockWriteSyncStream mocks the stream for the SyncWrite request, with no error.
 type MockWriteSyncStream struct {
 	grpc.ServerStream
+	Ctx     context.Context
 	Results map[string]*synse.V3TransactionStatus
 }
 
@@ -205,6 +262,15 @@ func NewMockWriteSyncStream() *MockWriteSyncStream {
 	}
 }
 
+// Context fulfils the stream interface for the mock grpc stream. It returns the
+// mock's context, if set.
+func (mock *MockWriteSyncStream) Context() context.Context {
+	if mock.Ctx != nil {
+		return mock.Ctx
+	}
+	return context.Background()
+}
+
 // Send fulfils the stream interface for the mock grpc stream.
 func (mock *MockWriteSyncStream) Send(write *synse.V3TransactionStatus) error {
 	mock.Results[write.Id] = write
@@ -216,6 +282,11 @@ type MockWriteSyncStreamErr struct {
 	grpc.ServerStream
 }
 
+// Context fulfils the stream interface for the mock grpc stream.
+func (mock *MockWriteSyncStreamErr) Context() context.Context {
+	return context.Background()
+}
+
 // Send fulfils the stream interface for the mock grpc stream.
 func (mock *MockWriteSyncStreamErr) Send(write *synse.V3TransactionStatus) error {
 	return fmt.Errorf("grpc error")
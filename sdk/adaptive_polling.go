@@ -0,0 +1,191 @@
+// Synse SDK
+// Copyright (c) 2017-2020 Vapor IO
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package sdk
+
+import (
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/vapor-ware/synse-sdk/sdk/config"
+	"github.com/vapor-ware/synse-sdk/sdk/output"
+)
+
+// metadataReadInterval is the device metadata key which holds the device's
+// effective read interval, if the device is polled adaptively.
+const metadataReadInterval = metadataPrefix + "read_interval"
+
+// defaultAdaptiveFactor is the factor by which a device's read interval grows
+// when its adaptive polling settings do not specify one.
+const defaultAdaptiveFactor = 2
+
+// adaptivePoller tracks the effective read interval of a device which is read
+// individually. If adaptive polling is enabled for the device, the interval
+// grows while the device's readings are unchanged; otherwise, it is always the
+// device's base read interval. The zero value is ready to use.
+type adaptivePoller struct {
+	lock sync.Mutex
+
+	// base is the device's configured read interval, and current is its
+	// effective read interval.
+	base    time.Duration
+	current time.Duration
+
+	// last holds the values of the device's most recent readings.
+	last []readingValue
+
+	// wake is signalled when the effective read interval snaps back to the
+	// base interval, so a read loop waiting on the longer interval can read
+	// sooner. When the device's reads are scheduled by the read timers rather
+	// than a read loop, snapBack is called instead.
+	wake     chan struct{}
+	snapBack func()
+}
+
+// readingValue holds the parts of a reading which are compared to determine
+// whether a device's readings have changed.
+type readingValue struct {
+	Type    string
+	Unit    *output.Unit
+	Value   interface{}
+	Context map[string]string
+}
+
+// newReadingValues gets the values of the given readings which are compared to
+// determine whether a device's readings have changed.
+func newReadingValues(readings []*output.Reading) []readingValue {
+	values := make([]readingValue, len(readings))
+	for i, r := range readings {
+		values[i] = readingValue{Type: r.Type, Unit: r.Unit, Value: r.Value, Context: r.Context}
+	}
+	return values
+}
+
+// start resets the poller for a read loop with the given base interval.
+func (poller *adaptivePoller) start(base time.Duration) {
+	poller.lock.Lock()
+	defer poller.lock.Unlock()
+
+	poller.base = base
+	poller.current = base
+	poller.last = nil
+}
+
+// interval gets the effective read interval, given the base interval. If the
+// poller is nil or has not been started, this is the base interval.
+func (poller *adaptivePoller) interval(base time.Duration) time.Duration {
+	if poller == nil {
+		return base
+	}
+
+	poller.lock.Lock()
+	defer poller.lock.Unlock()
+
+	if poller.current == 0 {
+		return base
+	}
+	return poller.current
+}
+
+// getCurrent gets the effective read interval, or 0 if the poller has not
+// been started, e.g. because the device is read in bulk.
+func (poller *adaptivePoller) getCurrent() time.Duration {
+	poller.lock.Lock()
+	defer poller.lock.Unlock()
+	return poller.current
+}
+
+// observe records the device's latest readings. If adaptive polling is enabled
+// and the readings are unchanged, the effective read interval grows; if they
+// changed, it snaps back to the base interval. It returns the effective read
+// interval and whether it changed.
+func (poller *adaptivePoller) observe(readings []*output.Reading, conf *config.AdaptivePollingSettings) (time.Duration, bool) {
+	poller.lock.Lock()
+	defer poller.lock.Unlock()
+
+	if conf == nil || poller.base <= 0 || conf.MaxInterval <= poller.base {
+		return poller.current, false
+	}
+
+	values := newReadingValues(readings)
+
+	previous := poller.current
+	if poller.last != nil && reflect.DeepEqual(poller.last, values) {
+		factor := conf.Factor
+		if factor <= 1 {
+			factor = defaultAdaptiveFactor
+		}
+		next := time.Duration(float64(poller.current) * factor)
+		if next > conf.MaxInterval || next < poller.current {
+			next = conf.MaxInterval
+		}
+		poller.current = next
+	} else {
+		poller.current = poller.base
+	}
+	poller.last = values
+	return poller.current, poller.current != previous
+}
+
+// reset snaps the effective read interval back to the base interval, e.g. when
+// the device is written to, and wakes the read loop if it was waiting on a
+// longer interval.
+func (poller *adaptivePoller) reset() {
+	poller.lock.Lock()
+	if poller.current == poller.base {
+		poller.lock.Unlock()
+		return
+	}
+	poller.current = poller.base
+	if poller.wake == nil {
+		poller.wake = make(chan struct{}, 1)
+	}
+	select {
+	case poller.wake <- struct{}{}:
+	default:
+	}
+	snapBack := poller.snapBack
+	poller.lock.Unlock()
+
+	if snapBack != nil {
+		snapBack()
+	}
+}
+
+// onReset sets the function which is called when the effective read interval
+// snaps back to the base interval. A nil function clears it.
+func (poller *adaptivePoller) onReset(fn func()) {
+	poller.lock.Lock()
+	defer poller.lock.Unlock()
+	poller.snapBack = fn
+}
+
+// woken gets the channel which is signalled when the effective read interval
+// snaps back to the base interval. If the poller is nil, the channel is nil.
+func (poller *adaptivePoller) woken() <-chan struct{} {
+	if poller == nil {
+		return nil
+	}
+
+	poller.lock.Lock()
+	defer poller.lock.Unlock()
+
+	if poller.wake == nil {
+		poller.wake = make(chan struct{}, 1)
+	}
+	return poller.wake
+}
@@ -0,0 +1,157 @@
+// Synse SDK
+// Copyright (c) 2017-2020 Vapor IO
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package sdk
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vapor-ware/synse-sdk/sdk/config"
+	"github.com/vapor-ware/synse-sdk/sdk/output"
+)
+
+func TestAdaptivePoller_observe(t *testing.T) {
+	conf := &config.AdaptivePollingSettings{MaxInterval: 5 * time.Second}
+	readings := func(v interface{}) []*output.Reading {
+		return []*output.Reading{{Type: "state", Value: v, Timestamp: time.Now().String()}}
+	}
+
+	var poller adaptivePoller
+	poller.start(time.Second)
+	assert.Equal(t, time.Second, poller.interval(time.Second))
+
+	// The first reading has nothing to compare to.
+	interval, changed := poller.observe(readings("open"), conf)
+	assert.Equal(t, time.Second, interval)
+	assert.False(t, changed)
+
+	// The interval grows while readings are unchanged, up to the max.
+	for _, expected := range []time.Duration{2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		interval, _ = poller.observe(readings("open"), conf)
+		assert.Equal(t, expected, interval)
+	}
+	assert.Equal(t, 5*time.Second, poller.interval(time.Second))
+
+	// A changed reading snaps the interval back.
+	interval, changed = poller.observe(readings("closed"), conf)
+	assert.Equal(t, time.Second, interval)
+	assert.True(t, changed)
+}
+
+func TestAdaptivePoller_observe_factor(t *testing.T) {
+	conf := &config.AdaptivePollingSettings{MaxInterval: time.Minute, Factor: 3}
+	r := []*output.Reading{{Type: "version", Value: "1.0"}}
+
+	var poller adaptivePoller
+	poller.start(time.Second)
+	poller.observe(r, conf)
+	interval, _ := poller.observe(r, conf)
+	assert.Equal(t, 3*time.Second, interval)
+}
+
+func TestAdaptivePoller_observe_disabled(t *testing.T) {
+	r := []*output.Reading{{Type: "version", Value: "1.0"}}
+
+	cases := []*config.AdaptivePollingSettings{
+		nil,
+		{MaxInterval: time.Second},
+		{MaxInterval: 500 * time.Millisecond},
+	}
+	for _, conf := range cases {
+		var poller adaptivePoller
+		poller.start(time.Second)
+		poller.observe(r, conf)
+		interval, changed := poller.observe(r, conf)
+		assert.Equal(t, time.Second, interval)
+		assert.False(t, changed)
+	}
+}
+
+func TestAdaptivePoller_reset(t *testing.T) {
+	conf := &config.AdaptivePollingSettings{MaxInterval: time.Minute}
+	r := []*output.Reading{{Type: "state", Value: 1}}
+
+	var poller adaptivePoller
+	poller.start(time.Second)
+	poller.observe(r, conf)
+	poller.observe(r, conf)
+	assert.Equal(t, 2*time.Second, poller.interval(time.Second))
+
+	poller.reset()
+	assert.Equal(t, time.Second, poller.interval(time.Second))
+	assert.Len(t, poller.woken(), 1)
+
+	// Resetting at the base interval does not wake the read loop again.
+	poller.reset()
+	assert.Len(t, poller.woken(), 1)
+}
+
+func TestAdaptivePoller_nil(t *testing.T) {
+	var poller *adaptivePoller
+	assert.Equal(t, time.Second, poller.interval(time.Second))
+	assert.Nil(t, poller.woken())
+}
+
+func TestScheduler_readLoop_adaptive(t *testing.T) {
+	s := scheduler{
+		config: &config.PluginSettings{
+			Read: &config.ReadSettings{},
+		},
+		stateManager: &stateManager{
+			readChan: make(chan *ReadContext, 100),
+		},
+		stop: make(chan struct{}),
+	}
+
+	var reads int32
+	device := &Device{
+		id:              "123",
+		AdaptivePolling: &config.AdaptivePollingSettings{MaxInterval: time.Hour},
+		handler: &DeviceHandler{
+			Read: func(device *Device) ([]*output.Reading, error) {
+				atomic.AddInt32(&reads, 1)
+				return []*output.Reading{{Type: "state", Value: 1}}, nil
+			},
+		},
+	}
+
+	interval := 10 * time.Millisecond
+	device.poller.start(interval)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.readLoop("device/123", interval, &device.poller, stop, func() { s.read(device) })
+	}()
+
+	// Since the readings never change, the interval backs off quickly, so
+	// there are far fewer reads than at the base interval.
+	time.Sleep(200 * time.Millisecond)
+	n := atomic.LoadInt32(&reads)
+	assert.Less(t, n, int32(10))
+	assert.Greater(t, int64(device.Stats().ReadInterval), int64(interval))
+
+	// A write snaps the interval back and wakes the read loop.
+	device.poller.reset()
+	time.Sleep(50 * time.Millisecond)
+	assert.Greater(t, atomic.LoadInt32(&reads), n)
+
+	close(stop)
+	<-done
+}
@@ -18,6 +18,7 @@ package sdk
 
 import (
 	"errors"
+	"sync"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -26,10 +27,14 @@ import (
 // aliases registered by the device.
 type AliasCache struct {
 	// cache is a simple map which serves as the lookup table for device
-	// aliases. Since device aliases will not change for the duration of
-	// the plugin run (as they are statically configured), this does
-	// not need any form of invalidation.
+	// aliases. Aliases only change when devices are added to or removed
+	// from the plugin, so entries are explicitly removed rather than
+	// invalidated.
 	cache map[string]*Device
+
+	// lock guards the cache, as devices may be added and removed while the
+	// plugin is running.
+	lock sync.RWMutex
 }
 
 // NewAliasCache creates a new AliasCache instance.
@@ -44,6 +49,9 @@ func (cache *AliasCache) Add(alias string, device *Device) error {
 	// If the alias already exists, return an error. It is up to the
 	// configurer to ensure all aliased devices have unique aliases for
 	// the plugin.
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
 	if _, ok := cache.cache[alias]; ok {
 		log.WithFields(log.Fields{
 			"alias":  alias,
@@ -59,5 +67,20 @@ func (cache *AliasCache) Add(alias string, device *Device) error {
 // Get gets the device associated with the specified alias. If the given
 // alias is not associated with a device, this returns nil.
 func (cache *AliasCache) Get(alias string) *Device {
+	cache.lock.RLock()
+	defer cache.lock.RUnlock()
+
 	return cache.cache[alias]
 }
+
+// Remove removes a device alias mapping from the cache. The mapping is only
+// removed if the alias is associated with the given device, so removing a
+// device does not remove an alias which has since been claimed by another.
+func (cache *AliasCache) Remove(alias string, device *Device) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	if d, ok := cache.cache[alias]; ok && d.GetID() == device.GetID() {
+		delete(cache.cache, alias)
+	}
+}
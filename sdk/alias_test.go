@@ -76,3 +76,29 @@ func TestAliasCache_Get_noMatch(t *testing.T) {
 	device := c.Get("alias-unknown")
 	assert.Nil(t, device)
 }
+
+func TestAliasCache_Remove(t *testing.T) {
+	d := &Device{id: "123"}
+	c := AliasCache{
+		cache: map[string]*Device{
+			"alias-1": d,
+			"alias-2": {id: "456"},
+		},
+	}
+
+	c.Remove("alias-1", d)
+	assert.Nil(t, c.Get("alias-1"))
+	assert.NotNil(t, c.Get("alias-2"))
+}
+
+func TestAliasCache_Remove_otherDevice(t *testing.T) {
+	c := AliasCache{
+		cache: map[string]*Device{
+			"alias-1": {id: "123"},
+		},
+	}
+
+	// The alias is held by a different device, so it should not be removed.
+	c.Remove("alias-1", &Device{id: "456"})
+	assert.NotNil(t, c.Get("alias-1"))
+}
@@ -0,0 +1,44 @@
+// Synse SDK
+// Copyright (c) 2017-2020 Vapor IO
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package sdk
+
+import (
+	"math"
+	"time"
+)
+
+// exponentialBackoff gets the time to wait after the nth consecutive failure,
+// where n starts at 1. The backoff starts at the base backoff and doubles for
+// each subsequent failure, up to the max backoff. If the max backoff is 0, the
+// backoff is not capped.
+func exponentialBackoff(base, max time.Duration, n int) time.Duration {
+	backoff := base
+	for i := 1; i < n && backoff > 0; i++ {
+		if max > 0 && backoff >= max {
+			break
+		}
+		if backoff > math.MaxInt64/2 {
+			backoff = math.MaxInt64
+			break
+		}
+		backoff *= 2
+	}
+	if max > 0 && backoff > max {
+		backoff = max
+	}
+	return backoff
+}
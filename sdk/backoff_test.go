@@ -0,0 +1,49 @@
+// Synse SDK
+// Copyright (c) 2017-2020 Vapor IO
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package sdk
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExponentialBackoff(t *testing.T) {
+	cases := []struct {
+		base     time.Duration
+		max      time.Duration
+		n        int
+		expected time.Duration
+	}{
+		{base: time.Second, max: 10 * time.Second, n: 0, expected: time.Second},
+		{base: time.Second, max: 10 * time.Second, n: 1, expected: time.Second},
+		{base: time.Second, max: 10 * time.Second, n: 2, expected: 2 * time.Second},
+		{base: time.Second, max: 10 * time.Second, n: 4, expected: 8 * time.Second},
+		{base: time.Second, max: 10 * time.Second, n: 5, expected: 10 * time.Second},
+		{base: time.Second, max: 10 * time.Second, n: 1000, expected: 10 * time.Second},
+		{base: 20 * time.Second, max: 10 * time.Second, n: 1, expected: 10 * time.Second},
+		{base: time.Second, max: 0, n: 5, expected: 16 * time.Second},
+		{base: time.Second, max: 0, n: 1000, expected: math.MaxInt64},
+		{base: 0, max: 10 * time.Second, n: 5, expected: 0},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.expected, exponentialBackoff(c.base, c.max, c.n), "%+v", c)
+	}
+}
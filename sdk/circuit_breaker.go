@@ -0,0 +1,352 @@
+// Synse SDK
+// Copyright (c) 2017-2020 Vapor IO
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package sdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/vapor-ware/synse-sdk/sdk/config"
+	sdkError "github.com/vapor-ware/synse-sdk/sdk/errors"
+	"github.com/vapor-ware/synse-sdk/sdk/health"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Circuit breaker states.
+const (
+	circuitClosed   = "closed"
+	circuitOpen     = "open"
+	circuitHalfOpen = "half-open"
+)
+
+// metadataCircuitState is the device metadata key which holds the state of
+// the device's circuit breaker, if it has one.
+const metadataCircuitState = metadataPrefix + "circuit_breaker"
+
+// ErrCircuitOpen is the error for writes which are rejected because the
+// device's circuit breaker is open.
+var ErrCircuitOpen = errors.New("device circuit breaker is open")
+
+// circuitBreaker tracks consecutive read and write failures for a device, so that
+// a persistently failing device stops being accessed on every read interval. A
+// handler which reads its devices in bulk has a circuit breaker of its own, which
+// tracks its bulk reads in the same way.
+//
+// While closed, the device is accessed as normal. Once the device fails the
+// configured number of consecutive times, the circuit opens and the device is not
+// accessed until its next probe is due. A probe is a single read or write which
+// is allowed through (the half-open state). If the probe succeeds, the circuit
+// closes; if it fails, the circuit re-opens and the backoff until the next probe
+// doubles, up to the configured maximum.
+//
+// As a bulk read covers all of a handler's devices at once, the reads of devices
+// which are read in bulk are guarded by their handler's circuit breaker, and bulk
+// read failures do not count towards the devices' own circuits. The devices' own
+// circuit breakers only guard their writes.
+type circuitBreaker struct {
+	// device is the ID of the device which the circuit breaker guards. It is
+	// empty for the circuit breaker of a handler's bulk reads.
+	device  string
+	handler string
+	conf    config.CircuitBreakerSettings
+
+	// check is the device's circuit breaker health check. It is registered
+	// with the health manager the first time the circuit opens.
+	check      *health.ReportedHealthCheck
+	health     *health.Manager
+	registered bool
+
+	lock      sync.Mutex
+	state     string
+	failures  int
+	trips     int
+	lastErr   error
+	nextProbe time.Time
+
+	// closed is set once the circuit breaker is released, after which it
+	// no longer updates the state metric.
+	closed bool
+}
+
+// newCircuitBreaker creates a new closed circuit breaker for the device with
+// the given ID, which uses the named handler.
+func newCircuitBreaker(device, handler string, conf config.CircuitBreakerSettings, manager *health.Manager) *circuitBreaker {
+	return &circuitBreaker{
+		device:  device,
+		handler: handler,
+		conf:    conf,
+		check:   health.NewReportedHealthCheck("device circuit breaker: " + device),
+		health:  manager,
+		state:   circuitClosed,
+	}
+}
+
+// newBulkReadCircuitBreaker creates a new closed circuit breaker for the bulk
+// reads of the named handler.
+func newBulkReadCircuitBreaker(handler string, conf config.CircuitBreakerSettings, manager *health.Manager) *circuitBreaker {
+	return &circuitBreaker{
+		handler: handler,
+		conf:    conf,
+		check:   health.NewReportedHealthCheck("bulk read circuit breaker: " + handler),
+		health:  manager,
+		state:   circuitClosed,
+	}
+}
+
+// fields gets the log fields which identify what the circuit breaker guards.
+func (breaker *circuitBreaker) fields() log.Fields {
+	if breaker.device == "" {
+		return log.Fields{"handler": breaker.handler}
+	}
+	return log.Fields{"device": breaker.device}
+}
+
+// allow checks whether the device may be accessed. If the circuit is open and
+// the next probe is due, the circuit becomes half-open and the access is allowed
+// as the probe.
+func (breaker *circuitBreaker) allow() bool {
+	breaker.lock.Lock()
+	defer breaker.lock.Unlock()
+
+	if breaker.state == circuitClosed {
+		return true
+	}
+	if time.Now().Before(breaker.nextProbe) {
+		return false
+	}
+
+	// If the probe does not report a result, e.g. because it was skipped, allow
+	// another probe after the same backoff.
+	breaker.setState(circuitHalfOpen)
+	breaker.nextProbe = time.Now().Add(breaker.backoff())
+	log.WithFields(breaker.fields()).Debug("[circuit] probing device")
+	return true
+}
+
+// success records a successful read or write of the device, closing the circuit.
+func (breaker *circuitBreaker) success() {
+	breaker.lock.Lock()
+	defer breaker.lock.Unlock()
+
+	if breaker.state != circuitClosed {
+		log.WithFields(breaker.fields()).WithField("failures", breaker.failures).Info("[circuit] device recovered, closing circuit")
+		breaker.check.Report("circuit closed", nil)
+	}
+
+	breaker.setState(circuitClosed)
+	breaker.failures = 0
+	breaker.trips = 0
+	breaker.lastErr = nil
+}
+
+// failure records a failed read or write of the device. The circuit opens if the
+// failure threshold is reached or if the failure was a probe.
+func (breaker *circuitBreaker) failure(err error) {
+	breaker.lock.Lock()
+	defer breaker.lock.Unlock()
+
+	breaker.failures++
+	breaker.lastErr = err
+
+	switch breaker.state {
+	case circuitClosed:
+		if breaker.failures >= breaker.conf.Threshold {
+			breaker.trip()
+		}
+	case circuitHalfOpen:
+		breaker.trip()
+	}
+}
+
+// trip opens the circuit. This should be called with the lock held.
+func (breaker *circuitBreaker) trip() {
+	breaker.trips++
+	backoff := breaker.backoff()
+	breaker.nextProbe = time.Now().Add(backoff)
+	breaker.setState(circuitOpen)
+	metricCircuitTrips.WithLabelValues(breaker.handler).Inc()
+
+	log.WithFields(breaker.fields()).WithFields(log.Fields{
+		"failures": breaker.failures,
+		"error":    breaker.lastErr,
+		"backoff":  backoff,
+	}).Warn("[circuit] device is failing, opening circuit")
+
+	if !breaker.registered && breaker.health != nil {
+		if err := breaker.health.Register(breaker.check); err != nil {
+			log.WithField("error", err).Error("[circuit] failed to register device health check")
+		}
+		breaker.registered = true
+	}
+	breaker.check.Report("", fmt.Errorf(
+		"circuit open after %d consecutive failures (last error: %v)", breaker.failures, breaker.lastErr,
+	))
+}
+
+// backoff gets the time to wait before the next probe of the device, based on
+// the number of times the circuit has opened without the device recovering.
+// This should be called with the lock held.
+func (breaker *circuitBreaker) backoff() time.Duration {
+	return exponentialBackoff(breaker.conf.Backoff, breaker.conf.MaxBackoff, breaker.trips)
+}
+
+// setState sets the state of the circuit and updates the state metric, which
+// counts the devices whose circuits are not closed. This should be called with
+// the lock held.
+func (breaker *circuitBreaker) setState(state string) {
+	if breaker.state == state {
+		return
+	}
+	if !breaker.closed {
+		if breaker.state != circuitClosed {
+			metricCircuitState.WithLabelValues(breaker.handler, breaker.state).Dec()
+		}
+		if state != circuitClosed {
+			metricCircuitState.WithLabelValues(breaker.handler, state).Inc()
+		}
+	}
+	breaker.state = state
+}
+
+// getState gets the current state of the circuit.
+func (breaker *circuitBreaker) getState() string {
+	breaker.lock.Lock()
+	defer breaker.lock.Unlock()
+	return breaker.state
+}
+
+// openError gets the error for an access which was rejected because the circuit
+// is open, describing the device's failures and when it will next be probed.
+func (breaker *circuitBreaker) openError() error {
+	breaker.lock.Lock()
+	defer breaker.lock.Unlock()
+
+	return fmt.Errorf(
+		"%w: device %s failed %d consecutive times (last error: %v), next probe in %s",
+		ErrCircuitOpen, breaker.device, breaker.failures, breaker.lastErr,
+		time.Until(breaker.nextProbe).Round(time.Millisecond),
+	)
+}
+
+// close releases the circuit breaker's health check and metrics, e.g. when
+// its device is removed from the plugin.
+func (breaker *circuitBreaker) close() {
+	breaker.lock.Lock()
+	defer breaker.lock.Unlock()
+
+	if breaker.registered && breaker.health != nil {
+		breaker.health.Unregister(breaker.check.GetName())
+		breaker.registered = false
+	}
+	if !breaker.closed && breaker.state != circuitClosed {
+		metricCircuitState.WithLabelValues(breaker.handler, breaker.state).Dec()
+	}
+	breaker.closed = true
+}
+
+// isDeviceFailure checks whether the error from a device read or write means
+// that the device is failing, as opposed to the operation being unsupported,
+// invalid, or cancelled by the plugin. Only device failures count towards
+// opening a device's circuit.
+func isDeviceFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var unsupported *sdkError.UnsupportedCommandError
+	if errors.As(err, &unsupported) {
+		return false
+	}
+	if errors.Is(err, ErrDeviceReadHung) || errors.Is(err, ErrDeviceWriteCancelled) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	return status.Code(err) != codes.InvalidArgument
+}
+
+// circuitBreaker gets the circuit breaker for the device, creating it if it does
+// not yet exist. If circuit breakers are not enabled, nil is returned. Devices
+// which are read in bulk only use their circuit breaker for their writes (see
+// bulkReadCircuitBreaker).
+func (scheduler *scheduler) circuitBreaker(device *Device) *circuitBreaker {
+	conf := scheduler.config.CircuitBreaker
+	if conf == nil || conf.Threshold <= 0 {
+		return nil
+	}
+
+	if breaker := device.circuitBreaker(); breaker != nil {
+		return breaker
+	}
+
+	scheduler.breakerLock.Lock()
+	defer scheduler.breakerLock.Unlock()
+
+	if breaker := device.circuitBreaker(); breaker != nil {
+		return breaker
+	}
+	breaker := newCircuitBreaker(device.id, device.Handler, *conf, scheduler.health)
+	device.breaker.Store(breaker)
+	return breaker
+}
+
+// removeCircuitBreaker releases the resources of the device's circuit breaker,
+// if it has one.
+func (scheduler *scheduler) removeCircuitBreaker(device *Device) {
+	if breaker := device.circuitBreaker(); breaker != nil {
+		breaker.close()
+	}
+}
+
+// bulkReadCircuitBreaker gets the circuit breaker for the bulk reads of the given
+// handler, creating it if it does not yet exist. If circuit breakers are not
+// enabled, nil is returned.
+func (scheduler *scheduler) bulkReadCircuitBreaker(handler *DeviceHandler) *circuitBreaker {
+	conf := scheduler.config.CircuitBreaker
+	if conf == nil || conf.Threshold <= 0 {
+		return nil
+	}
+
+	scheduler.breakerLock.Lock()
+	defer scheduler.breakerLock.Unlock()
+
+	if breaker, exists := scheduler.bulkBreakers[handler.Name]; exists {
+		return breaker
+	}
+	if scheduler.bulkBreakers == nil {
+		scheduler.bulkBreakers = make(map[string]*circuitBreaker)
+	}
+	breaker := newBulkReadCircuitBreaker(handler.Name, *conf, scheduler.health)
+	scheduler.bulkBreakers[handler.Name] = breaker
+	return breaker
+}
+
+// removeBulkReadCircuitBreaker releases the resources of the circuit breaker for
+// the bulk reads of the given handler, if it has one.
+func (scheduler *scheduler) removeBulkReadCircuitBreaker(handler *DeviceHandler) {
+	scheduler.breakerLock.Lock()
+	breaker, exists := scheduler.bulkBreakers[handler.Name]
+	delete(scheduler.bulkBreakers, handler.Name)
+	scheduler.breakerLock.Unlock()
+
+	if exists {
+		breaker.close()
+	}
+}
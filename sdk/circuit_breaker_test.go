@@ -0,0 +1,278 @@
+// Synse SDK
+// Copyright (c) 2017-2020 Vapor IO
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package sdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/vapor-ware/synse-sdk/sdk/config"
+	sdkError "github.com/vapor-ware/synse-sdk/sdk/errors"
+	"github.com/vapor-ware/synse-sdk/sdk/health"
+	"github.com/vapor-ware/synse-sdk/sdk/output"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCircuitBreaker_trip(t *testing.T) {
+	manager := health.NewManager(&config.HealthSettings{})
+	breaker := newCircuitBreaker("cb-trip", "cb-trip", config.CircuitBreakerSettings{
+		Threshold: 2,
+		Backoff:   time.Minute,
+	}, manager)
+	trips := testutil.ToFloat64(metricCircuitTrips.WithLabelValues("cb-trip"))
+
+	assert.True(t, breaker.allow())
+	breaker.failure(errors.New("test error"))
+	assert.Equal(t, circuitClosed, breaker.getState())
+	assert.True(t, breaker.allow())
+	assert.Equal(t, 0, manager.Count())
+
+	breaker.failure(errors.New("test error"))
+	assert.Equal(t, circuitOpen, breaker.getState())
+	assert.False(t, breaker.allow())
+	assert.Equal(t, trips+1, testutil.ToFloat64(metricCircuitTrips.WithLabelValues("cb-trip")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metricCircuitState.WithLabelValues("cb-trip", circuitOpen)))
+
+	// The open circuit is reported via the health manager.
+	assert.Equal(t, 1, manager.Count())
+	s := breaker.check.Status()
+	assert.False(t, s.Ok)
+	assert.Contains(t, s.Message, "2 consecutive failures")
+	assert.Contains(t, s.Message, "test error")
+
+	// Releasing the breaker removes its device from the state metric.
+	breaker.close()
+	assert.Equal(t, 0, manager.Count())
+	assert.Equal(t, float64(0), testutil.ToFloat64(metricCircuitState.WithLabelValues("cb-trip", circuitOpen)))
+}
+
+func TestCircuitBreaker_successResets(t *testing.T) {
+	breaker := newCircuitBreaker("cb-reset", "cb-reset", config.CircuitBreakerSettings{
+		Threshold: 2,
+		Backoff:   time.Minute,
+	}, nil)
+
+	breaker.failure(errors.New("test error"))
+	breaker.success()
+	breaker.failure(errors.New("test error"))
+	assert.Equal(t, circuitClosed, breaker.getState())
+}
+
+func TestCircuitBreaker_probe(t *testing.T) {
+	manager := health.NewManager(&config.HealthSettings{})
+	breaker := newCircuitBreaker("cb-probe", "cb-probe", config.CircuitBreakerSettings{
+		Threshold: 1,
+		Backoff:   10 * time.Millisecond,
+	}, manager)
+
+	breaker.failure(errors.New("test error"))
+	assert.False(t, breaker.allow())
+
+	// Once the backoff elapses, a single probe is allowed.
+	time.Sleep(15 * time.Millisecond)
+	assert.True(t, breaker.allow())
+	assert.Equal(t, circuitHalfOpen, breaker.getState())
+	assert.False(t, breaker.allow())
+	assert.Equal(t, float64(0), testutil.ToFloat64(metricCircuitState.WithLabelValues("cb-probe", circuitOpen)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metricCircuitState.WithLabelValues("cb-probe", circuitHalfOpen)))
+
+	// A failed probe re-opens the circuit with a longer backoff.
+	breaker.failure(errors.New("test error"))
+	assert.Equal(t, circuitOpen, breaker.getState())
+	assert.Equal(t, 2, breaker.trips)
+	assert.Equal(t, 20*time.Millisecond, breaker.backoff())
+
+	// A successful probe closes the circuit.
+	time.Sleep(25 * time.Millisecond)
+	assert.True(t, breaker.allow())
+	breaker.success()
+	assert.Equal(t, circuitClosed, breaker.getState())
+	assert.True(t, breaker.check.Status().Ok)
+	assert.Equal(t, float64(0), testutil.ToFloat64(metricCircuitState.WithLabelValues("cb-probe", circuitOpen)))
+	assert.Equal(t, float64(0), testutil.ToFloat64(metricCircuitState.WithLabelValues("cb-probe", circuitHalfOpen)))
+}
+
+func TestCircuitBreaker_backoff(t *testing.T) {
+	breaker := circuitBreaker{
+		conf: config.CircuitBreakerSettings{
+			Backoff:    time.Second,
+			MaxBackoff: 5 * time.Second,
+		},
+	}
+
+	for trips, expected := range []time.Duration{
+		time.Second, time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second,
+	} {
+		breaker.trips = trips
+		assert.Equal(t, expected, breaker.backoff(), fmt.Sprintf("trips: %d", trips))
+	}
+}
+
+func TestIsDeviceFailure(t *testing.T) {
+	cases := []struct {
+		err      error
+		expected bool
+	}{
+		{err: nil, expected: false},
+		{err: errors.New("test error"), expected: true},
+		{err: ErrDeviceReadTimeout, expected: true},
+		{err: ErrDeviceReadHung, expected: false},
+		{err: fmt.Errorf("%w: stopping", ErrDeviceWriteCancelled), expected: false},
+		{err: context.Canceled, expected: false},
+		{err: &sdkError.UnsupportedCommandError{}, expected: false},
+		{err: status.Error(codes.InvalidArgument, "bad data"), expected: false},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.expected, isDeviceFailure(c.err), fmt.Sprintf("%v", c.err))
+	}
+}
+
+func TestScheduler_circuitBreaker_disabled(t *testing.T) {
+	s := scheduler{
+		config: &config.PluginSettings{CircuitBreaker: &config.CircuitBreakerSettings{}},
+	}
+	assert.Nil(t, s.circuitBreaker(&Device{id: "123"}))
+}
+
+func TestScheduler_circuitBreaker(t *testing.T) {
+	s := newTestScheduler()
+	s.config.CircuitBreaker = &config.CircuitBreakerSettings{Threshold: 1, Backoff: time.Minute, MaxBackoff: time.Minute}
+	device := &Device{id: "123"}
+
+	breaker := s.circuitBreaker(device)
+	assert.NotNil(t, breaker)
+	assert.Equal(t, breaker, s.circuitBreaker(device))
+	assert.Equal(t, breaker, device.circuitBreaker())
+}
+
+func TestScheduler_read_circuitOpen(t *testing.T) {
+	s := newTestScheduler()
+	s.config.CircuitBreaker = &config.CircuitBreakerSettings{Threshold: 2, Backoff: time.Minute, MaxBackoff: time.Minute}
+
+	var reads int
+	device := &Device{
+		id: "cb-read",
+		handler: &DeviceHandler{
+			Name: "failing",
+			Read: func(device *Device) ([]*output.Reading, error) {
+				reads++
+				return nil, errors.New("test error")
+			},
+		},
+	}
+
+	// Once the threshold is reached, the device is no longer read.
+	for i := 0; i < 4; i++ {
+		s.read(device)
+	}
+	assert.Equal(t, 2, reads)
+	assert.Equal(t, circuitOpen, device.circuitBreaker().getState())
+	assert.Equal(t, 1, s.health.Count())
+}
+
+func TestScheduler_read_circuitUnsupported(t *testing.T) {
+	s := newTestScheduler()
+	s.config.CircuitBreaker = &config.CircuitBreakerSettings{Threshold: 1, Backoff: time.Minute, MaxBackoff: time.Minute}
+
+	device := &Device{
+		id:      "cb-unsupported",
+		handler: &DeviceHandler{Name: "writeonly"},
+	}
+
+	// Unsupported reads do not count as device failures.
+	s.read(device)
+	s.read(device)
+	assert.Equal(t, circuitClosed, device.circuitBreaker().getState())
+}
+
+func TestScheduler_write_circuitOpen(t *testing.T) {
+	s := newTestScheduler()
+	s.config.CircuitBreaker = &config.CircuitBreakerSettings{Threshold: 1, Backoff: time.Minute, MaxBackoff: time.Minute}
+
+	var writes int
+	w := newWriteTestContext(&DeviceHandler{
+		Write: func(device *Device, data *WriteData) error {
+			writes++
+			return errors.New("test error")
+		},
+	}, time.Second)
+	w.device.id = "cb-write"
+
+	s.write(w)
+	assert.Equal(t, statusError, w.transaction.status)
+	assert.Equal(t, 1, writes)
+
+	// The circuit is open, so the next write fails fast.
+	w2 := newWriteTestContext(w.device.handler, time.Second)
+	w2.device = w.device
+	s.write(w2)
+	assert.Equal(t, statusError, w2.transaction.status)
+	assert.Equal(t, 1, writes)
+	assert.Contains(t, w2.transaction.message, "circuit breaker is open")
+	assert.Contains(t, w2.transaction.message, "test error")
+	assert.Contains(t, w2.transaction.message, "next probe in")
+}
+
+func TestScheduler_bulkRead_circuitOpen(t *testing.T) {
+	var reads int
+	handler := &DeviceHandler{
+		Name: "failing-bulk",
+		BulkRead: func(devices []*Device) ([]*ReadContext, error) {
+			reads++
+			return nil, errors.New("test error")
+		},
+	}
+	device := &Device{id: "cb-bulk", Handler: handler.Name, handler: handler}
+	s := newTestScheduler(device)
+	s.config.CircuitBreaker = &config.CircuitBreakerSettings{Threshold: 2, Backoff: time.Minute, MaxBackoff: time.Minute}
+
+	// Once the threshold is reached, the handler's devices are no longer read.
+	for i := 0; i < 4; i++ {
+		s.bulkRead(handler)
+	}
+	assert.Equal(t, 2, reads)
+	assert.Equal(t, circuitOpen, s.bulkReadCircuitBreaker(handler).getState())
+	assert.Equal(t, 1, s.health.Count())
+
+	// Bulk read failures do not count towards the device's own circuit.
+	assert.Nil(t, device.circuitBreaker())
+
+	// The circuit breaker is released when the handler's devices are no
+	// longer read.
+	s.removeBulkReadCircuitBreaker(handler)
+	assert.Empty(t, s.bulkBreakers)
+	assert.Equal(t, 0, s.health.Count())
+}
+
+func TestScheduler_bulkReadCircuitBreaker(t *testing.T) {
+	s := newTestScheduler()
+	handler := &DeviceHandler{Name: "bulk"}
+	assert.Nil(t, s.bulkReadCircuitBreaker(handler))
+
+	s.config.CircuitBreaker = &config.CircuitBreakerSettings{Threshold: 1, Backoff: time.Minute, MaxBackoff: time.Minute}
+	breaker := s.bulkReadCircuitBreaker(handler)
+	assert.NotNil(t, breaker)
+	assert.Equal(t, breaker, s.bulkReadCircuitBreaker(handler))
+	assert.NotEqual(t, breaker, s.bulkReadCircuitBreaker(&DeviceHandler{Name: "other"}))
+}
@@ -73,6 +73,53 @@ type DeviceProto struct {
 	// back to the default value of 30s.
 	WriteTimeout time.Duration `yaml:"writeTimeout,omitempty"`
 
+	// ReadInterval defines a custom read interval for all instances of the
+	// device prototype. This is the time to wait between reads of a device.
+	// If left unspecified, the read interval of the device's handler is used,
+	// falling back to the global read interval from the plugin config.
+	ReadInterval time.Duration `yaml:"readInterval,omitempty"`
+
+	// ReadTimeout defines a custom read timeout for all instances of the device
+	// prototype. This is the time within which a read of the device must complete
+	// before it is abandoned. If left unspecified, the read timeout of the device's
+	// handler is used, falling back to the global read timeout from the plugin config.
+	ReadTimeout time.Duration `yaml:"readTimeout,omitempty"`
+
+	// WriteRetry defines a custom write retry policy for all instances of the
+	// device prototype. Any fields which are left unspecified fall back to the
+	// write retry settings from the plugin config.
+	WriteRetry *DeviceRetrySettings `yaml:"writeRetry,omitempty"`
+
+	// LockGroup is the name of the lock group for all instances of the device
+	// prototype. Reads and writes of devices in the same lock group are
+	// serialized, while different lock groups are accessed concurrently. If
+	// left unspecified, the lock group of the device's handler is used,
+	// falling back to the lock group data key from the plugin config.
+	LockGroup string `yaml:"lockGroup,omitempty"`
+
+	// Limiter defines a rate limiter for each instance of the device prototype.
+	// The limiter applies to reads and writes of the device, within the bounds
+	// of the global rate limiter. Instances which define their own limiter do
+	// not inherit the prototype's.
+	Limiter *LimiterSettings `yaml:"limiter,omitempty"`
+
+	// AdaptivePolling enables adaptive polling for all instances of the device
+	// prototype. While a device's readings are unchanged, the interval between
+	// its reads grows, up to a maximum. This does not apply to devices which
+	// are read in bulk.
+	AdaptivePolling *AdaptivePollingSettings `yaml:"adaptivePolling,omitempty"`
+
+	// Staleness defines when the readings of each instance of the device prototype
+	// are considered stale, and how stale readings are handled. Instances which
+	// define their own staleness settings do not inherit the prototype's.
+	Staleness *StalenessSettings `yaml:"staleness,omitempty"`
+
+	// Deadband enables change-only delivery of the readings of all instances of
+	// the device prototype. Readings which have not changed by more than the
+	// deadband are not sent to read streams or added to the readings cache,
+	// though they are still returned by Read.
+	Deadband *DeadbandSettings `yaml:"deadband,omitempty"`
+
 	// Context defines any context information which should be associated
 	// with a device instance's reading(s). If specified here, all prototype
 	// instances will inherit the context, unless inheritance is disabled.
@@ -170,6 +217,29 @@ type DeviceInstance struct {
 	// unspecified, it will fall back to the default value of 30s.
 	WriteTimeout time.Duration `yaml:"writeTimeout,omitempty"`
 
+	// ReadInterval defines a custom read interval for the device instance. This
+	// is the time to wait between reads of the device. If left unspecified, the
+	// prototype's read interval is used, if inherited; otherwise, the read interval
+	// of the device's handler, falling back to the global read interval from the
+	// plugin config.
+	ReadInterval time.Duration `yaml:"readInterval,omitempty"`
+
+	// ReadTimeout defines a custom read timeout for the device instance. If left
+	// unspecified, the prototype's read timeout is used, if inherited.
+	ReadTimeout time.Duration `yaml:"readTimeout,omitempty"`
+
+	// LockGroup is the name of the lock group for the device instance. If left
+	// unspecified, the prototype's lock group is used, if inherited.
+	LockGroup string `yaml:"lockGroup,omitempty"`
+
+	// Limiter defines a rate limiter for the device instance. If left unspecified,
+	// the prototype's limiter settings are used, if inherited.
+	Limiter *LimiterSettings `yaml:"limiter,omitempty"`
+
+	// Staleness defines the staleness settings for the device instance. If left
+	// unspecified, the prototype's staleness settings are used, if inherited.
+	Staleness *StalenessSettings `yaml:"staleness,omitempty"`
+
 	// DisableInheritance determines whether the device instance should inherit
 	// from its device prototype.
 	DisableInheritance bool `default:"false" yaml:"disableInheritance,omitempty"`
@@ -233,3 +303,103 @@ func (c *TransformConfig) Validate() error {
 	}
 	return nil
 }
+
+// AdaptivePollingSettings are the settings for adaptive polling of a device.
+//
+// Each time a device's readings are unchanged from its previous readings, its
+// read interval is multiplied by the factor, up to the maximum interval. The
+// read interval snaps back to the device's base read interval as soon as its
+// readings change or it is written to.
+type AdaptivePollingSettings struct {
+	// MaxInterval is the maximum interval between reads of the device. If it
+	// is not greater than the device's base read interval, adaptive polling
+	// is disabled.
+	MaxInterval time.Duration `yaml:"maxInterval,omitempty"`
+
+	// Factor is the multiplier applied to the read interval each time the
+	// readings are unchanged. If left unspecified, or not greater than 1,
+	// the interval doubles.
+	Factor float64 `yaml:"factor,omitempty"`
+}
+
+// StalenessSettings are the settings for detecting stale device readings.
+//
+// A device's readings are stale once the time since they were read exceeds a
+// multiple of the device's expected read interval, e.g. if the device stops
+// responding. Stale readings are either marked as stale, via the "synse.stale"
+// key of their context, or dropped.
+type StalenessSettings struct {
+	// Multiple is the multiple of the device's expected read interval after
+	// which its readings are stale. If left unspecified, or not greater than
+	// 1, readings are stale after three read intervals.
+	Multiple float64 `yaml:"multiple,omitempty"`
+
+	// Action is how stale readings are handled: "mark" returns them with a
+	// staleness marker in their context, and "drop" does not return them at
+	// all. If left unspecified, stale readings are marked.
+	Action string `yaml:"action,omitempty"`
+}
+
+// DeadbandSettings are the settings for change-only delivery of device readings.
+//
+// A device's readings are only delivered to read streams and the readings cache
+// when they have changed since the readings last delivered. Numeric values must
+// change by more than the deadband, given either as an absolute change or as a
+// percentage of the last delivered value; other values must differ. With no
+// deadband, any change is delivered. Unchanged readings are still delivered once
+// the max silence has passed since the device's readings were last delivered.
+type DeadbandSettings struct {
+	// Absolute is the absolute change in a numeric value which must be
+	// exceeded for a reading to be delivered.
+	Absolute float64 `yaml:"absolute,omitempty"`
+
+	// Percent is the change in a numeric value, as a percentage of the last
+	// delivered value, which must be exceeded for a reading to be delivered.
+	// Only one of Absolute and Percent may be set.
+	Percent float64 `yaml:"percent,omitempty"`
+
+	// MaxSilence is the longest time for which a device's readings may go
+	// undelivered while they are unchanged, as a heartbeat. As readings are
+	// delivered when the device is read, this is effectively rounded up to
+	// the device's read interval. If left unspecified, unchanged readings are
+	// never delivered.
+	MaxSilence time.Duration `yaml:"maxSilence,omitempty"`
+}
+
+// DeviceRetrySettings override the plugin's write retry settings (see RetrySettings)
+// for a device. Fields which are left unspecified fall back to the plugin's write
+// retry settings. Since only unspecified fields fall back, a device may set a field
+// to zero, e.g. to retry without backoff or jitter.
+type DeviceRetrySettings struct {
+	// MaxAttempts is the maximum number of times a write is attempted,
+	// including the first attempt.
+	MaxAttempts *int `yaml:"maxAttempts,omitempty"`
+
+	// Backoff is the time to wait before the first retry.
+	Backoff *time.Duration `yaml:"backoff,omitempty"`
+
+	// MaxBackoff is the maximum time to wait between retries.
+	MaxBackoff *time.Duration `yaml:"maxBackoff,omitempty"`
+
+	// Jitter is the fraction (0 to 1) by which each backoff is randomly varied.
+	Jitter *float64 `yaml:"jitter,omitempty"`
+}
+
+// Apply applies the device's overrides to the given write retry settings.
+func (conf *DeviceRetrySettings) Apply(settings *RetrySettings) {
+	if conf == nil {
+		return
+	}
+	if conf.MaxAttempts != nil {
+		settings.MaxAttempts = *conf.MaxAttempts
+	}
+	if conf.Backoff != nil {
+		settings.Backoff = *conf.Backoff
+	}
+	if conf.MaxBackoff != nil {
+		settings.MaxBackoff = *conf.MaxBackoff
+	}
+	if conf.Jitter != nil {
+		settings.Jitter = *conf.Jitter
+	}
+}
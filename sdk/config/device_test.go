@@ -2,6 +2,7 @@ package config
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -47,3 +48,38 @@ func TestTransformConfig_Validate_Error(t *testing.T) {
 	assert.Error(t, err)
 	assert.Equal(t, ErrInvalidTransform, err)
 }
+
+func TestDeviceRetrySettings_Apply(t *testing.T) {
+	settings := RetrySettings{MaxAttempts: 3, Backoff: time.Second, MaxBackoff: 5 * time.Second, Jitter: 0.2}
+
+	var conf *DeviceRetrySettings
+	conf.Apply(&settings)
+	assert.Equal(t, RetrySettings{MaxAttempts: 3, Backoff: time.Second, MaxBackoff: 5 * time.Second, Jitter: 0.2}, settings)
+
+	// Fields which are set override the settings, even if they are zero.
+	var backoff time.Duration
+	var jitter float64
+	conf = &DeviceRetrySettings{Backoff: &backoff, Jitter: &jitter}
+	conf.Apply(&settings)
+	assert.Equal(t, RetrySettings{MaxAttempts: 3, MaxBackoff: 5 * time.Second}, settings)
+}
+
+func TestDeviceRetrySettings_Scan(t *testing.T) {
+	proto := &DeviceProto{}
+
+	loader := Loader{}
+	loader.merged = map[string]interface{}{
+		"writeRetry": map[string]interface{}{
+			"backoff": "0s",
+			"jitter":  0,
+		},
+	}
+
+	err := loader.Scan(proto)
+	assert.NoError(t, err)
+	assert.NotNil(t, proto.WriteRetry)
+	assert.Nil(t, proto.WriteRetry.MaxAttempts)
+	assert.Nil(t, proto.WriteRetry.MaxBackoff)
+	assert.Equal(t, time.Duration(0), *proto.WriteRetry.Backoff)
+	assert.Equal(t, float64(0), *proto.WriteRetry.Jitter)
+}
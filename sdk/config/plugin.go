@@ -124,6 +124,10 @@ func (conf *MetricsSettings) Log() {
 type PluginSettings struct {
 	// Mode is the run mode of the read and write loops. This can either
 	// be "serial" or "parallel".
+	//
+	// In serial mode, reads and writes for devices which are not in a lock
+	// group are serialized with each other. Devices in a lock group are always
+	// serialized within their group, regardless of mode. See LockGroups.
 	Mode string `default:"parallel" yaml:"mode,omitempty"`
 
 	// Listen contains the settings to configure listener behavior.
@@ -140,11 +144,31 @@ type PluginSettings struct {
 	Transaction *TransactionSettings `default:"{}" yaml:"transaction,omitempty"`
 
 	// Limiter specifies settings for rate limiting for reads/writes.
+	//
+	// This is the global rate limiter, which bounds all reads and writes.
+	// Device handlers, device configs, and lock groups may define their own
+	// rate limiters, which apply within the bounds of the global limiter.
 	Limiter *LimiterSettings `default:"{}" yaml:"limiter,omitempty"`
 
 	// Cache contains the settings to configure local data caching
 	// by the plugin.
 	Cache *CacheSettings `default:"{}" yaml:"cache,omitempty"`
+
+	// Reload contains the settings to configure reloading of device
+	// configuration while the plugin is running.
+	Reload *ReloadSettings `default:"{}" yaml:"reload,omitempty"`
+
+	// LockGroups contains the settings to configure the lock groups which
+	// serialize access to devices, e.g. those sharing a bus.
+	LockGroups *LockGroupSettings `default:"{}" yaml:"lockGroups,omitempty"`
+
+	// CircuitBreaker contains the settings to configure the per-device circuit
+	// breakers which stop reads and writes to persistently failing devices.
+	CircuitBreaker *CircuitBreakerSettings `default:"{}" yaml:"circuitBreaker,omitempty"`
+
+	// Stream contains the settings to configure how readings are buffered
+	// for the clients of ReadStream requests.
+	Stream *StreamSettings `default:"{}" yaml:"stream,omitempty"`
 }
 
 // Log logs out the config at INFO level.
@@ -160,6 +184,142 @@ func (conf *PluginSettings) Log() {
 		conf.Transaction.Log()
 		conf.Limiter.Log()
 		conf.Cache.Log()
+		conf.Reload.Log()
+		conf.LockGroups.Log()
+		conf.CircuitBreaker.Log()
+		conf.Stream.Log()
+	}
+}
+
+// LockGroupSettings are the settings for the lock groups which serialize access
+// to devices.
+//
+// Reads and writes of devices in the same lock group are serialized, while
+// different lock groups are accessed concurrently. This allows devices sharing
+// a resource, such as a serial bus, to be serialized without serializing all
+// of the plugin's devices.
+type LockGroupSettings struct {
+	// DataKey is the key of a device Data field whose value is used as the
+	// name of the device's lock group, e.g. "bus". It applies to devices which
+	// do not otherwise specify a lock group, either in their config or via
+	// their handler. Devices without the field are not in a lock group.
+	DataKey string `yaml:"dataKey,omitempty"`
+
+	// Delays specifies the read and write delays for lock groups, keyed by
+	// group name. A group's delays replace the global read and write delays
+	// for its devices. Groups without delays configured here use the global
+	// read and write delays.
+	Delays map[string]*LockGroupDelays `yaml:"delays,omitempty"`
+
+	// Limiters specifies rate limiters for lock groups, keyed by group name.
+	// A group's rate limiter applies to all reads and writes of its devices,
+	// within the bounds of the global rate limiter.
+	Limiters map[string]*LimiterSettings `yaml:"limiters,omitempty"`
+}
+
+// Log logs out the config at INFO level.
+func (conf *LockGroupSettings) Log() {
+	if conf == nil {
+		log.Infof("    LockGroups: nil")
+	} else {
+		log.Infof("    LockGroups:")
+		log.Infof("      DataKey: %v", conf.DataKey)
+		log.Infof("      Delays:")
+		for name, delays := range conf.Delays {
+			if delays == nil {
+				continue
+			}
+			log.Infof("        %s: read=%v, write=%v", name, delays.Read, delays.Write)
+		}
+		log.Infof("      Limiters:")
+		for name, limiter := range conf.Limiters {
+			if limiter == nil {
+				continue
+			}
+			log.Infof("        %s: rate=%d, burst=%d", name, limiter.Rate, limiter.Burst)
+		}
+	}
+}
+
+// LockGroupDelays are the delays for a lock group.
+type LockGroupDelays struct {
+	// Read is the delay between successive reads of devices in the group.
+	Read time.Duration `yaml:"read,omitempty"`
+
+	// Write is the delay between successive writes to devices in the group.
+	Write time.Duration `yaml:"write,omitempty"`
+}
+
+// CircuitBreakerSettings are the settings for the per-device circuit breakers.
+//
+// Once a device fails a number of consecutive reads or writes, its circuit opens:
+// the device is no longer read on its read interval and writes to it fail fast.
+// Instead, the device is probed with a single read or write after a backoff, which
+// doubles after each failed probe. Once a probe succeeds, the circuit closes and
+// the device is accessed as normal.
+//
+// As a bulk read covers all of a handler's devices at once, a handler which reads
+// its devices in bulk has a circuit breaker for its bulk reads instead: once its
+// bulk reads fail a number of consecutive times, its devices are no longer read
+// until a probe succeeds. Bulk read failures do not open the devices' own circuits,
+// which only guard their writes.
+type CircuitBreakerSettings struct {
+	// Threshold is the number of consecutive failed reads or writes after
+	// which a device's circuit opens. A threshold of 0 (the default) disables
+	// the circuit breakers.
+	Threshold int `default:"0" yaml:"threshold,omitempty"`
+
+	// Backoff is the time to wait after a device's circuit opens before
+	// probing the device.
+	Backoff time.Duration `default:"5s" yaml:"backoff,omitempty"`
+
+	// MaxBackoff is the maximum time to wait between probes of a device
+	// whose circuit is open.
+	MaxBackoff time.Duration `default:"5m" yaml:"maxBackoff,omitempty"`
+}
+
+// Log logs out the config at INFO level.
+func (conf *CircuitBreakerSettings) Log() {
+	if conf == nil {
+		log.Infof("    CircuitBreaker: nil")
+	} else {
+		log.Infof("    CircuitBreaker:")
+		log.Infof("      Threshold:  %d", conf.Threshold)
+		log.Infof("      Backoff:    %v", conf.Backoff)
+		log.Infof("      MaxBackoff: %v", conf.MaxBackoff)
+	}
+}
+
+// StreamSettings are the settings for the read streams which send readings to
+// the clients of ReadStream requests.
+//
+// New readings are passed to each stream without waiting on its client. Each
+// stream buffers the readings its client has yet to receive; once the buffer is
+// full, the stream's overflow policy applies, so a slow client does not hold up
+// reading devices.
+type StreamSettings struct {
+	// Buffer is the number of readings buffered for each stream.
+	Buffer int `default:"128" yaml:"buffer,omitempty"`
+
+	// Overflow specifies what happens when a new reading is passed to a stream
+	// whose buffer is full. This can be one of:
+	//  - dropOldest: the oldest buffered reading is dropped to make room for
+	//    the new reading.
+	//  - dropNewest: the new reading is dropped.
+	//  - disconnect: the stream is ended, so the client is disconnected with
+	//    an error.
+	// By default, the oldest reading is dropped.
+	Overflow string `default:"dropOldest" yaml:"overflow,omitempty"`
+}
+
+// Log logs out the config at INFO level.
+func (conf *StreamSettings) Log() {
+	if conf == nil {
+		log.Infof("    Stream: nil")
+	} else {
+		log.Infof("    Stream:")
+		log.Infof("      Buffer:   %d", conf.Buffer)
+		log.Infof("      Overflow: %s", conf.Overflow)
 	}
 }
 
@@ -168,6 +328,20 @@ type ListenSettings struct {
 	// Disable can be used to globally disable listening for the plugin.
 	// By default, plugin listening is enabled.
 	Disable bool `default:"false" yaml:"disable,omitempty"`
+
+	// Backoff is the time to wait before restarting a listener which failed.
+	// The wait doubles for each consecutive failure, up to MaxBackoff.
+	Backoff time.Duration `default:"1s" yaml:"backoff,omitempty"`
+
+	// MaxBackoff is the maximum time to wait before restarting a failed listener.
+	// A listener which runs for at least this long before failing is considered
+	// to have recovered, so its backoff starts over.
+	MaxBackoff time.Duration `default:"1m" yaml:"maxBackoff,omitempty"`
+
+	// MaxRestarts is the number of consecutive times a failed listener is
+	// restarted before it is given up on. A value of 0 means that failed
+	// listeners are always restarted.
+	MaxRestarts int `default:"0" yaml:"maxRestarts,omitempty"`
 }
 
 // Log logs out the config at INFO level.
@@ -176,7 +350,10 @@ func (conf *ListenSettings) Log() {
 		log.Infof("    Listen: nil")
 	} else {
 		log.Infof("    Listen:")
-		log.Infof("      Disable: %v", conf.Disable)
+		log.Infof("      Disable:     %v", conf.Disable)
+		log.Infof("      Backoff:     %v", conf.Backoff)
+		log.Infof("      MaxBackoff:  %v", conf.MaxBackoff)
+		log.Infof("      MaxRestarts: %v", conf.MaxRestarts)
 	}
 }
 
@@ -189,6 +366,10 @@ type ReadSettings struct {
 	// Interval specifies the duration that the read loop should
 	// sleep between iterations. By default, no interval is specified.
 	//
+	// Each device (or bulk-read handler) is read on its own schedule. This
+	// interval is used for any device whose config and handler do not set
+	// their own read interval.
+	//
 	// An interval may be useful for tuning the performance of a plugin. In
 	// particular, it can be useful for serial protocols to introduce a
 	// bit of a delay so the serial bus is not constantly hammered.
@@ -199,13 +380,48 @@ type ReadSettings struct {
 	Interval time.Duration `default:"1s" yaml:"interval,omitempty"`
 
 	// Delay specifies a plugin-global delay between successive reads.
-	// By default, no delay is specified.
+	// By default, no delay is specified. Lock groups may configure their
+	// own read delay, which replaces this delay for the group's devices.
 	//
 	// A delay can be useful for tuning the performance of a plugin. In
 	// particular, it can be useful for serial protocols to introduce a
 	// bit of a delay so the serial bus is not constantly hammered.
 	Delay time.Duration `default:"0s" yaml:"delay,omitempty"`
 
+	// Timeout specifies the time within which a device read (or bulk read)
+	// must complete. A read which does not complete in time is abandoned and
+	// recorded as a timeout error for the device, so that a hung device does
+	// not stall other reads. Device handlers and device prototypes may set
+	// their own read timeout. By default, reads do not time out.
+	Timeout time.Duration `default:"0s" yaml:"timeout,omitempty"`
+
+	// Schedule specifies how device reads are scheduled within the read
+	// interval. This can be one of:
+	//  - immediate: every device (or bulk-read handler) is first read as soon
+	//    as reading starts.
+	//  - staggered: the first read of each device (or bulk-read handler) is
+	//    delayed by an offset within its read interval. The offset is derived
+	//    from the device ID (or handler name), so it is the same every time the
+	//    plugin runs, and reads are spread evenly across the interval.
+	// By default, reads are scheduled immediately.
+	Schedule string `default:"immediate" yaml:"schedule,omitempty"`
+
+	// Jitter is the fraction of the read interval by which the wait between
+	// reads is randomly varied. For example, a jitter of 0.1 with an interval
+	// of 1s waits between 0.9s and 1.1s between reads. This prevents reads from
+	// synchronizing, e.g. across many plugin instances polling shared services.
+	// It must be between 0 and 1. By default, there is no jitter.
+	Jitter float64 `default:"0" yaml:"jitter,omitempty"`
+
+	// MaxConcurrency is the maximum number of device reads (and bulk reads)
+	// which may run at once. Reads are run by a pool of this many workers, and all
+	// device read schedules are driven by a single timer which queues each read
+	// as it becomes due. Workers take queued reads from each device handler in
+	// turn. Device handlers may further limit the number of concurrent reads of
+	// their devices. By default (0), reads are unbounded and each device is read
+	// by its own read loop.
+	MaxConcurrency int `default:"0" yaml:"maxConcurrency,omitempty"`
+
 	// QueueSize defines the size of the read queue. This will be the
 	// size of the channel that queues up and passes along readings as
 	// they are collected.
@@ -221,10 +437,14 @@ func (conf *ReadSettings) Log() {
 		log.Infof("    Read: nil")
 	} else {
 		log.Infof("    Read:")
-		log.Infof("      Disable:   %v", conf.Disable)
-		log.Infof("      QueueSize: %d", conf.QueueSize)
-		log.Infof("      Interval:  %v", conf.Interval)
-		log.Infof("      Delay:     %v", conf.Delay)
+		log.Infof("      Disable:        %v", conf.Disable)
+		log.Infof("      QueueSize:      %d", conf.QueueSize)
+		log.Infof("      Interval:       %v", conf.Interval)
+		log.Infof("      Delay:          %v", conf.Delay)
+		log.Infof("      Timeout:        %v", conf.Timeout)
+		log.Infof("      Schedule:       %s", conf.Schedule)
+		log.Infof("      Jitter:         %v", conf.Jitter)
+		log.Infof("      MaxConcurrency: %d", conf.MaxConcurrency)
 	}
 }
 
@@ -247,7 +467,8 @@ type WriteSettings struct {
 	Interval time.Duration `default:"1s" yaml:"interval,omitempty"`
 
 	// Delay specifies a plugin-global delay between successive writes.
-	// By default, no delay is specified.
+	// By default, no delay is specified. Lock groups may configure their
+	// own write delay, which replaces this delay for the group's devices.
 	//
 	// A delay can be useful for tuning the performance of a plugin. In
 	// particular, it can be useful for serial protocols to introduce a
@@ -256,6 +477,8 @@ type WriteSettings struct {
 
 	// QueueSize defines the size of the write queue. This will be the
 	// size of the channel that queues up and passes along write requests.
+	// It also bounds the number of writes waiting in each device's write
+	// queue; a write for a device whose queue is full is failed.
 	//
 	// Generally this does not need to be set, but can be used to tune
 	// performance for write-intensive plugins.
@@ -267,6 +490,26 @@ type WriteSettings struct {
 	// Generally, this does not need to be set, but can be used to tune
 	// performance particularly for slow writing serial plugins.
 	BatchSize int `default:"128" yaml:"batchSize,omitempty"`
+
+	// Retry defines the policy for retrying failed device writes. By default,
+	// failed writes are not retried. The policy can be overridden for the
+	// devices of a device prototype via the prototype's writeRetry config.
+	Retry *RetrySettings `default:"{}" yaml:"retry,omitempty"`
+
+	// Coalesce lists the write actions for which queued writes are coalesced.
+	// When a write for one of these actions is queued for a device which
+	// already has a write for the same action waiting, the waiting write is
+	// superseded by the newer one and never reaches the device. Writes for
+	// other actions are always run. By default, no writes are coalesced.
+	//
+	// Coalescing is useful for actions where only the most recent value
+	// matters, such as setting a fan speed.
+	Coalesce []string `yaml:"coalesce,omitempty"`
+
+	// ScheduleFile is the path of the file which scheduled writes are saved
+	// to, so that writes which are not yet due survive a plugin restart. By
+	// default, no file is set and scheduled writes are only held in memory.
+	ScheduleFile string `yaml:"scheduleFile,omitempty"`
 }
 
 // Log logs out the config at INFO level.
@@ -275,11 +518,51 @@ func (conf *WriteSettings) Log() {
 		log.Infof("    Write: nil")
 	} else {
 		log.Infof("    Write:")
-		log.Infof("      Disable:   %v", conf.Disable)
-		log.Infof("      QueueSize: %d", conf.QueueSize)
-		log.Infof("      BatchSize: %d", conf.BatchSize)
-		log.Infof("      Interval:  %v", conf.Interval)
-		log.Infof("      Delay:     %v", conf.Delay)
+		log.Infof("      Disable:      %v", conf.Disable)
+		log.Infof("      QueueSize:    %d", conf.QueueSize)
+		log.Infof("      BatchSize:    %d", conf.BatchSize)
+		log.Infof("      Interval:     %v", conf.Interval)
+		log.Infof("      Delay:        %v", conf.Delay)
+		log.Infof("      Coalesce:     %v", conf.Coalesce)
+		log.Infof("      ScheduleFile: %s", conf.ScheduleFile)
+		conf.Retry.Log()
+	}
+}
+
+// RetrySettings are the settings for retrying failed device writes.
+//
+// All retries for a write happen within the device's write timeout. If the
+// next retry could not start before the timeout, the write fails with the
+// error of its last attempt.
+type RetrySettings struct {
+	// MaxAttempts is the maximum number of times a write is attempted,
+	// including the first attempt. A value of 1 (the default) disables
+	// retries.
+	MaxAttempts int `default:"1" yaml:"maxAttempts,omitempty"`
+
+	// Backoff is the time to wait before the first retry. The backoff
+	// doubles for each subsequent retry, up to MaxBackoff.
+	Backoff time.Duration `default:"100ms" yaml:"backoff,omitempty"`
+
+	// MaxBackoff is the maximum time to wait between retries.
+	MaxBackoff time.Duration `default:"5s" yaml:"maxBackoff,omitempty"`
+
+	// Jitter is the fraction (0 to 1) by which each backoff is randomly
+	// varied, so writes which fail together do not retry in lockstep. For
+	// example, a jitter of 0.2 varies a backoff of 1s between 0.8s and 1.2s.
+	Jitter float64 `default:"0" yaml:"jitter,omitempty"`
+}
+
+// Log logs out the config at INFO level.
+func (conf *RetrySettings) Log() {
+	if conf == nil {
+		log.Infof("      Retry: nil")
+	} else {
+		log.Infof("      Retry:")
+		log.Infof("        MaxAttempts: %d", conf.MaxAttempts)
+		log.Infof("        Backoff:     %v", conf.Backoff)
+		log.Infof("        MaxBackoff:  %v", conf.MaxBackoff)
+		log.Infof("        Jitter:      %v", conf.Jitter)
 	}
 }
 
@@ -330,8 +613,25 @@ type CacheSettings struct {
 
 	// TTL is the time-to-live for a reading in the readings cache. This will
 	// only be used if the cache is enabled. Once a reading exceeds this TTL,
-	// it is removed from the cache.
+	// it is no longer returned from the cache, and it is removed from the cache
+	// when its device is next read or when the cache is next swept, which is
+	// done once per TTL.
 	TTL time.Duration `default:"3m" yaml:"ttl,omitempty"`
+
+	// Depth is the maximum number of readings kept in the cache for each
+	// device. Once a device's readings reach this depth, its oldest reading
+	// is removed from the cache when a new one is added.
+	Depth int `default:"256" yaml:"depth,omitempty"`
+
+	// MaxBytes is the approximate maximum memory, in bytes, used by the cached
+	// readings of all devices, including the buffers which hold each device's
+	// readings. Once the cache reaches this size, the oldest readings are removed
+	// from the cache, regardless of their device. A value of 0 does not cap the
+	// cache's memory.
+	MaxBytes int `default:"33554432" yaml:"maxBytes,omitempty"`
+
+	// History are the settings for the on-disk readings history.
+	History *HistorySettings `default:"{}" yaml:"history,omitempty"`
 }
 
 // Log logs out the config at INFO level.
@@ -340,8 +640,87 @@ func (conf *CacheSettings) Log() {
 		log.Infof("    Cache: nil")
 	} else {
 		log.Infof("    Cache:")
-		log.Infof("      Enabled: %v", conf.Enabled)
-		log.Infof("      TTL:     %v", conf.TTL)
+		log.Infof("      Enabled:  %v", conf.Enabled)
+		log.Infof("      TTL:      %v", conf.TTL)
+		log.Infof("      Depth:    %d", conf.Depth)
+		log.Infof("      MaxBytes: %d", conf.MaxBytes)
+		conf.History.Log()
+	}
+}
+
+// HistorySettings are the settings for an on-disk history of plugin readings.
+// Unlike the in-memory readings cache, the history survives a plugin restart.
+type HistorySettings struct {
+	// Enabled determines whether a plugin will keep a history of its readings
+	// on disk. It is disabled by default.
+	Enabled bool `default:"false" yaml:"enabled,omitempty"`
+
+	// Dir is the directory which the readings history is kept in. It is
+	// created if it does not exist.
+	Dir string `default:"/var/lib/synse/plugin/history" yaml:"dir,omitempty"`
+
+	// MaxAge is the maximum age of a reading in the history. Readings older
+	// than this are removed from the history. A value of 0 does not limit the
+	// age of the readings.
+	MaxAge time.Duration `default:"24h" yaml:"maxAge,omitempty"`
+
+	// MaxSize is the maximum size, in bytes, of the history on disk. Once the
+	// history exceeds this size, its oldest readings are removed. A value of 0
+	// does not limit the size of the history.
+	MaxSize int64 `default:"268435456" yaml:"maxSize,omitempty"`
+
+	// SegmentSize is the size, in bytes, at which the history starts a new
+	// segment file. Readings are removed from the history a segment at a time.
+	SegmentSize int64 `default:"8388608" yaml:"segmentSize,omitempty"`
+
+	// QueueSize is the number of readings which may wait to be written to the
+	// history. Readings are written to the history in the background, so a slow
+	// disk does not hold up the plugin's readings. If the queue is full, readings
+	// are dropped from the history.
+	QueueSize int `default:"1024" yaml:"queueSize,omitempty"`
+}
+
+// Log logs out the config at INFO level.
+func (conf *HistorySettings) Log() {
+	if conf == nil {
+		log.Infof("      History: nil")
+	} else {
+		log.Infof("      History:")
+		log.Infof("        Enabled:     %v", conf.Enabled)
+		log.Infof("        Dir:         %s", conf.Dir)
+		log.Infof("        MaxAge:      %v", conf.MaxAge)
+		log.Infof("        MaxSize:     %d", conf.MaxSize)
+		log.Infof("        SegmentSize: %d", conf.SegmentSize)
+		log.Infof("        QueueSize:   %d", conf.QueueSize)
+	}
+}
+
+// ReloadSettings are the settings for reloading device configuration while
+// the plugin is running.
+type ReloadSettings struct {
+	// Disable can be used to disable device config reloading for the plugin.
+	// By default, device config is reloaded when the plugin receives SIGHUP.
+	Disable bool `default:"false" yaml:"disable,omitempty"`
+
+	// Watch enables watching the device config search paths for file
+	// changes. When a change is detected, device config is reloaded. It
+	// is disabled by default.
+	Watch bool `default:"false" yaml:"watch,omitempty"`
+
+	// Interval is the interval at which the device config search paths
+	// are checked for changes. This is only used if Watch is enabled.
+	Interval time.Duration `default:"5s" yaml:"interval,omitempty"`
+}
+
+// Log logs out the config at INFO level.
+func (conf *ReloadSettings) Log() {
+	if conf == nil {
+		log.Infof("    Reload: nil")
+	} else {
+		log.Infof("    Reload:")
+		log.Infof("      Disable:  %v", conf.Disable)
+		log.Infof("      Watch:    %v", conf.Watch)
+		log.Infof("      Interval: %v", conf.Interval)
 	}
 }
 
@@ -408,6 +787,12 @@ type DynamicRegistrationSettings struct {
 	// the plugin/protocol/device-specific data which will be used to register
 	// devices at runtime, e.g. a server address and port.
 	Config []map[string]interface{} `default:"[]" yaml:"config,omitempty"`
+
+	// Interval is the interval at which dynamic registration is re-run while the
+	// plugin is running, so that devices which appear or disappear after startup
+	// are registered or retired. A zero interval (the default) disables periodic
+	// re-registration; registration is then only done once, on startup.
+	Interval time.Duration `default:"0s" yaml:"interval,omitempty"`
 }
 
 // Log logs out the config at INFO level.
@@ -423,7 +808,8 @@ func (conf *DynamicRegistrationSettings) Log() (err error) {
 		}
 
 		log.Infof("  DynamicRegistration:")
-		log.Infof("    Config: %v", redacted)
+		log.Infof("    Config:   %v", redacted)
+		log.Infof("    Interval: %v", conf.Interval)
 	}
 	return
 }
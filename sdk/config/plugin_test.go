@@ -19,6 +19,7 @@ package config
 import (
 	"bytes"
 	"testing"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
@@ -103,6 +104,56 @@ func TestWriteSettings_Log(t *testing.T) {
 	c.Log()
 }
 
+func TestRetrySettings_Log_nil(t *testing.T) {
+	var c *RetrySettings
+	c.Log()
+}
+
+func TestRetrySettings_Log(t *testing.T) {
+	c := RetrySettings{}
+	c.Log()
+}
+
+func TestLockGroupSettings_Log_nil(t *testing.T) {
+	var c *LockGroupSettings
+	c.Log()
+}
+
+func TestLockGroupSettings_Log(t *testing.T) {
+	c := LockGroupSettings{
+		DataKey: "bus",
+		Delays: map[string]*LockGroupDelays{
+			"1": {Read: time.Second},
+			"2": nil,
+		},
+		Limiters: map[string]*LimiterSettings{
+			"1": {Rate: 10},
+			"2": nil,
+		},
+	}
+	c.Log()
+}
+
+func TestCircuitBreakerSettings_Log_nil(t *testing.T) {
+	var c *CircuitBreakerSettings
+	c.Log()
+}
+
+func TestCircuitBreakerSettings_Log(t *testing.T) {
+	c := CircuitBreakerSettings{}
+	c.Log()
+}
+
+func TestStreamSettings_Log_nil(t *testing.T) {
+	var c *StreamSettings
+	c.Log()
+}
+
+func TestStreamSettings_Log(t *testing.T) {
+	c := StreamSettings{}
+	c.Log()
+}
+
 func TestTransactionSettings_Log_nil(t *testing.T) {
 	var c *TransactionSettings
 	c.Log()
@@ -133,6 +184,26 @@ func TestCacheSettings_Log(t *testing.T) {
 	c.Log()
 }
 
+func TestHistorySettings_Log_nil(t *testing.T) {
+	var c *HistorySettings
+	c.Log()
+}
+
+func TestHistorySettings_Log(t *testing.T) {
+	c := HistorySettings{}
+	c.Log()
+}
+
+func TestReloadSettings_Log_nil(t *testing.T) {
+	var c *ReloadSettings
+	c.Log()
+}
+
+func TestReloadSettings_Log(t *testing.T) {
+	c := ReloadSettings{}
+	c.Log()
+}
+
 func TestNetworkSettings_Log_nil(t *testing.T) {
 	var c *NetworkSettings
 	c.Log()
@@ -171,7 +242,8 @@ func TestDynamicRegistrationSettings_Log(t *testing.T) {
 	c.Log()
 
 	assert.Contains(t, out.String(), "msg=\"  DynamicRegistration:\"\n")
-	assert.Contains(t, out.String(), "msg=\"    Config: []\"\n")
+	assert.Contains(t, out.String(), "msg=\"    Config:   []\"\n")
+	assert.Contains(t, out.String(), "msg=\"    Interval: 0s\"\n")
 }
 
 func TestDynamicRegistrationSettings_Log_withPass(t *testing.T) {
@@ -188,7 +260,7 @@ func TestDynamicRegistrationSettings_Log_withPass(t *testing.T) {
 	c.Log()
 
 	assert.Contains(t, out.String(), "msg=\"  DynamicRegistration:\"\n")
-	assert.Contains(t, out.String(), "msg=\"    Config: [map[authenticationPassphrase:REDACTED]]\"\n")
+	assert.Contains(t, out.String(), "msg=\"    Config:   [map[authenticationPassphrase:REDACTED]]\"\n")
 }
 
 func TestHealthSettings_Log_nil(t *testing.T) {
@@ -0,0 +1,86 @@
+// Synse SDK
+// Copyright (c) 2017-2020 Vapor IO
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package sdk
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCron_error(t *testing.T) {
+	cases := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"5/10 * * * *",
+		"a * * * *",
+		"1-a * * * *",
+		"@every",
+	}
+
+	for _, c := range cases {
+		_, err := parseCron(c)
+		assert.Error(t, err, c)
+	}
+}
+
+func TestCronSchedule_next(t *testing.T) {
+	// 2020-01-01 is a Wednesday.
+	from := time.Date(2020, 1, 1, 10, 30, 15, 0, time.UTC)
+
+	cases := []struct {
+		spec     string
+		expected time.Time
+	}{
+		{spec: "* * * * *", expected: time.Date(2020, 1, 1, 10, 31, 0, 0, time.UTC)},
+		{spec: "*/15 * * * *", expected: time.Date(2020, 1, 1, 10, 45, 0, 0, time.UTC)},
+		{spec: "0 * * * *", expected: time.Date(2020, 1, 1, 11, 0, 0, 0, time.UTC)},
+		{spec: "@hourly", expected: time.Date(2020, 1, 1, 11, 0, 0, 0, time.UTC)},
+		{spec: "0 2 * * *", expected: time.Date(2020, 1, 2, 2, 0, 0, 0, time.UTC)},
+		{spec: "@daily", expected: time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{spec: "30 10 * * *", expected: time.Date(2020, 1, 2, 10, 30, 0, 0, time.UTC)},
+		{spec: "0,45 9-17 * * *", expected: time.Date(2020, 1, 1, 10, 45, 0, 0, time.UTC)},
+		{spec: "0 0 * * 0", expected: time.Date(2020, 1, 5, 0, 0, 0, 0, time.UTC)},
+		{spec: "0 0 * * 7", expected: time.Date(2020, 1, 5, 0, 0, 0, 0, time.UTC)},
+		{spec: "0 0 * * 1-5", expected: time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{spec: "0 0 15 * *", expected: time.Date(2020, 1, 15, 0, 0, 0, 0, time.UTC)},
+		{spec: "0 0 1 3 *", expected: time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{spec: "0 0 29 2 *", expected: time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{spec: "@yearly", expected: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)},
+
+		// If both the day of month and day of week are restricted, either may match.
+		{spec: "0 0 15 * 5", expected: time.Date(2020, 1, 3, 0, 0, 0, 0, time.UTC)},
+
+		// Never matches.
+		{spec: "0 0 30 2 *", expected: time.Time{}},
+	}
+
+	for _, c := range cases {
+		schedule, err := parseCron(c.spec)
+		assert.NoError(t, err, c.spec)
+		assert.Equal(t, c.expected, schedule.next(from), c.spec)
+	}
+}
@@ -0,0 +1,120 @@
+// Synse SDK
+// Copyright (c) 2017-2020 Vapor IO
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package sdk
+
+import (
+	"math"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/vapor-ware/synse-sdk/sdk/config"
+	"github.com/vapor-ware/synse-sdk/sdk/output"
+	"github.com/vapor-ware/synse-sdk/sdk/utils"
+)
+
+// deadbandFilter decides whether a device's readings are delivered to read streams
+// and the readings cache, by comparing them to the readings it last delivered. The
+// zero value is ready to use.
+type deadbandFilter struct {
+	lock sync.Mutex
+
+	// last holds the values of the device's last delivered readings, and
+	// delivered is the time they were delivered.
+	last      []readingValue
+	delivered time.Time
+}
+
+// observe records the device's latest readings and checks whether they should be
+// delivered. They are delivered if they are the first readings observed, if they
+// changed by more than the deadband since the last delivered readings, or if the
+// max silence has passed since then.
+func (filter *deadbandFilter) observe(readings []*output.Reading, conf *config.DeadbandSettings, now time.Time) bool {
+	filter.lock.Lock()
+	defer filter.lock.Unlock()
+
+	values := newReadingValues(readings)
+	if filter.last != nil && !deadbandChanged(filter.last, values, conf) {
+		if conf.MaxSilence <= 0 || now.Sub(filter.delivered) < conf.MaxSilence {
+			return false
+		}
+	}
+	filter.last = values
+	filter.delivered = now
+	return true
+}
+
+// deadbandChanged checks whether a device's readings changed by more than the
+// deadband. Changes to anything other than the reading values, e.g. a reading
+// being added or its unit changing, are always a change.
+func deadbandChanged(last, values []readingValue, conf *config.DeadbandSettings) bool {
+	if len(last) != len(values) {
+		return true
+	}
+	for i := range values {
+		a, b := last[i], values[i]
+		if a.Type != b.Type || !reflect.DeepEqual(a.Unit, b.Unit) || !reflect.DeepEqual(a.Context, b.Context) {
+			return true
+		}
+		if deadbandExceeded(a.Value, b.Value, conf) {
+			return true
+		}
+	}
+	return false
+}
+
+// deadbandExceeded checks whether a reading value changed by more than the deadband.
+// Values which are not numeric change if they are not equal.
+func deadbandExceeded(last, value interface{}, conf *config.DeadbandSettings) bool {
+	x, ok := deadbandNumber(last)
+	y, ok2 := deadbandNumber(value)
+	if !ok || !ok2 {
+		return !reflect.DeepEqual(last, value)
+	}
+	if math.IsNaN(x) || math.IsNaN(y) {
+		return math.IsNaN(x) != math.IsNaN(y)
+	}
+
+	delta := math.Abs(y - x)
+	if conf.Percent > 0 {
+		if x == 0 {
+			return delta > 0
+		}
+		return delta > math.Abs(x)*conf.Percent/100
+	}
+	return delta > conf.Absolute
+}
+
+// deadbandNumber gets a reading value as a number, if it is numeric. Strings are
+// not considered numeric, even if they could be parsed as numbers.
+func deadbandNumber(value interface{}) (float64, bool) {
+	if _, ok := value.(string); ok {
+		return 0, false
+	}
+	n, err := utils.ConvertToFloat64(value)
+	return n, err == nil
+}
+
+// deliverReadings checks whether the device's latest readings, received at the
+// given time, should be delivered to read streams and the readings cache. If the
+// device has no deadband settings, all readings are delivered.
+func (device *Device) deliverReadings(readings []*output.Reading, now time.Time) bool {
+	if device == nil || device.Deadband == nil {
+		return true
+	}
+	return device.deadband.observe(readings, device.Deadband, now)
+}
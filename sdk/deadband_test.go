@@ -0,0 +1,169 @@
+// Synse SDK
+// Copyright (c) 2017-2020 Vapor IO
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package sdk
+
+import (
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/vapor-ware/synse-sdk/sdk/config"
+	"github.com/vapor-ware/synse-sdk/sdk/output"
+)
+
+// deadbandValues creates readings with the given values.
+func deadbandValues(values ...interface{}) []*output.Reading {
+	readings := make([]*output.Reading, len(values))
+	for i, v := range values {
+		readings[i] = &output.Reading{Type: "temperature", Value: v}
+	}
+	return readings
+}
+
+func TestDeadbandFilter_observe_changeOnly(t *testing.T) {
+	var filter deadbandFilter
+	conf := &config.DeadbandSettings{}
+	now := time.Now()
+
+	assert.True(t, filter.observe(deadbandValues(1), conf, now))
+	assert.False(t, filter.observe(deadbandValues(1), conf, now))
+	assert.True(t, filter.observe(deadbandValues(2), conf, now))
+	assert.True(t, filter.observe(deadbandValues("on"), conf, now))
+	assert.False(t, filter.observe(deadbandValues("on"), conf, now))
+}
+
+func TestDeadbandFilter_observe_absolute(t *testing.T) {
+	var filter deadbandFilter
+	conf := &config.DeadbandSettings{Absolute: 0.5}
+	now := time.Now()
+
+	assert.True(t, filter.observe(deadbandValues(20.0), conf, now))
+	assert.False(t, filter.observe(deadbandValues(20.3), conf, now))
+
+	// Changes are compared to the last delivered value, so slow drift is
+	// delivered once it exceeds the deadband.
+	assert.False(t, filter.observe(deadbandValues(20.5), conf, now))
+	assert.True(t, filter.observe(deadbandValues(20.6), conf, now))
+	assert.False(t, filter.observe(deadbandValues(20.2), conf, now))
+	assert.True(t, filter.observe(deadbandValues(int64(20)), conf, now))
+}
+
+func TestDeadbandFilter_observe_percent(t *testing.T) {
+	var filter deadbandFilter
+	conf := &config.DeadbandSettings{Percent: 10}
+	now := time.Now()
+
+	assert.True(t, filter.observe(deadbandValues(100), conf, now))
+	assert.False(t, filter.observe(deadbandValues(90), conf, now))
+	assert.True(t, filter.observe(deadbandValues(89), conf, now))
+
+	// Any change from zero exceeds a percentage deadband.
+	assert.True(t, filter.observe(deadbandValues(0), conf, now))
+	assert.True(t, filter.observe(deadbandValues(0.001), conf, now))
+}
+
+func TestDeadbandFilter_observe_notANumber(t *testing.T) {
+	var filter deadbandFilter
+	conf := &config.DeadbandSettings{Absolute: 1}
+	now := time.Now()
+
+	assert.True(t, filter.observe(deadbandValues(1.0), conf, now))
+	assert.True(t, filter.observe(deadbandValues(math.NaN()), conf, now))
+	assert.False(t, filter.observe(deadbandValues(math.NaN()), conf, now))
+	assert.True(t, filter.observe(deadbandValues(1.0), conf, now))
+}
+
+func TestDeadbandFilter_observe_readingsChanged(t *testing.T) {
+	var filter deadbandFilter
+	conf := &config.DeadbandSettings{Absolute: 10}
+	now := time.Now()
+
+	assert.True(t, filter.observe(deadbandValues(1), conf, now))
+	assert.True(t, filter.observe(deadbandValues(1, 2), conf, now))
+
+	readings := deadbandValues(1, 2)
+	readings[1].Unit = &output.Unit{Name: "celsius", Symbol: "C"}
+	assert.True(t, filter.observe(readings, conf, now))
+
+	readings = deadbandValues(1, 2)
+	readings[1].Unit = &output.Unit{Name: "celsius", Symbol: "C"}
+	readings[1].Context = map[string]string{"zone": "a"}
+	assert.True(t, filter.observe(readings, conf, now))
+}
+
+func TestDeadbandFilter_observe_maxSilence(t *testing.T) {
+	var filter deadbandFilter
+	conf := &config.DeadbandSettings{MaxSilence: time.Minute}
+	now := time.Now()
+
+	assert.True(t, filter.observe(deadbandValues(1), conf, now))
+	assert.False(t, filter.observe(deadbandValues(1), conf, now.Add(30*time.Second)))
+	assert.True(t, filter.observe(deadbandValues(1), conf, now.Add(time.Minute)))
+
+	// The max silence is measured from the last delivered readings.
+	assert.False(t, filter.observe(deadbandValues(1), conf, now.Add(90*time.Second)))
+	assert.True(t, filter.observe(deadbandValues(1), conf, now.Add(2*time.Minute)))
+}
+
+func TestDevice_deliverReadings(t *testing.T) {
+	var device *Device
+	assert.True(t, device.deliverReadings(deadbandValues(1), time.Now()))
+
+	device = &Device{}
+	assert.True(t, device.deliverReadings(deadbandValues(1), time.Now()))
+	assert.True(t, device.deliverReadings(deadbandValues(1), time.Now()))
+
+	device.Deadband = &config.DeadbandSettings{}
+	assert.True(t, device.deliverReadings(deadbandValues(1), time.Now()))
+	assert.False(t, device.deliverReadings(deadbandValues(1), time.Now()))
+}
+
+func TestStateManager_updateReadings_deadband(t *testing.T) {
+	device := &Device{id: "1", Deadband: &config.DeadbandSettings{Absolute: 1}}
+	sm := &stateManager{
+		config: &config.PluginSettings{
+			Cache: &config.CacheSettings{Enabled: true},
+		},
+		readChan:      make(chan *ReadContext),
+		readings:      map[string][]*output.Reading{},
+		readingsLock:  &sync.RWMutex{},
+		readingsCache: newReadingsCache(time.Minute, 10, 0),
+		streams:       map[uuid.UUID]*ReadStream{},
+		streamLock:    &sync.Mutex{},
+	}
+	stream := newReadStream(nil, 10, overflowDropOldest)
+	sm.addStream(stream)
+	go sm.updateReadings()
+
+	for _, v := range []float64{20, 20.5, 21.5, 21} {
+		sm.readChan <- &ReadContext{Device: device, Reading: deadbandValues(v)}
+	}
+
+	// The current readings are always the latest readings.
+	assert.Eventually(t, func() bool {
+		readings := sm.GetReadingsForDevice("1")
+		return len(readings) == 1 && readings[0].Value == 21.0
+	}, time.Second, 10*time.Millisecond)
+
+	// Only readings outside of the deadband are cached and streamed.
+	cached := sm.readingsCache.query(nil, time.Time{}, time.Time{}, time.Now())
+	assert.Equal(t, []interface{}{20.0, 21.5}, cachedValues(cached))
+	assert.Equal(t, []interface{}{20.0, 21.5}, streamValues(stream))
+}
@@ -18,8 +18,11 @@ package sdk
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
 	"fmt"
 	"os"
+	"sync/atomic"
 	"text/template"
 	"time"
 
@@ -27,9 +30,11 @@ import (
 	log "github.com/sirupsen/logrus"
 	"github.com/vapor-ware/synse-sdk/sdk/config"
 	"github.com/vapor-ware/synse-sdk/sdk/errors"
+	"github.com/vapor-ware/synse-sdk/sdk/funcs"
 	"github.com/vapor-ware/synse-sdk/sdk/output"
 	"github.com/vapor-ware/synse-sdk/sdk/utils"
 	synse "github.com/vapor-ware/synse-server-grpc/go"
+	"gopkg.in/yaml.v2"
 )
 
 const (
@@ -57,7 +62,8 @@ type Device struct {
 	Data map[string]interface{}
 
 	// Context contains any contextual information which should be associated
-	// with the device's reading(s).
+	// with the device's reading(s). Keys with the "synse." prefix are reserved
+	// for the metadata which the SDK adds for the device (see metadataPrefix).
 	Context map[string]string
 
 	// Handler is the name of the device's handler.
@@ -88,6 +94,50 @@ type Device struct {
 	// will remain valid for this device.
 	WriteTimeout time.Duration
 
+	// ReadInterval defines the time to wait between reads of this device. If
+	// unset, the device's handler read interval, or the global read interval
+	// if that is unset, is used. This does not apply to devices which are read
+	// in bulk, as they are read on their handler's read interval.
+	ReadInterval time.Duration
+
+	// ReadTimeout defines the time within which a read of this device must
+	// complete before it is abandoned. If unset, the device's handler read
+	// timeout, or the global read timeout if that is unset, is used. This does
+	// not apply to devices which are read in bulk.
+	ReadTimeout time.Duration
+
+	// WriteRetry defines the write retry policy for this device. Any fields
+	// which are unset fall back to the write retry settings from the plugin
+	// config. If nil, the plugin's write retry settings are used as-is.
+	WriteRetry *config.DeviceRetrySettings
+
+	// LockGroup is the name of the lock group for this device. Reads and writes
+	// of devices in the same lock group are serialized, while different lock
+	// groups are accessed concurrently. If unset, the device's handler lock group,
+	// or the lock group named by the device's data (see the plugin's lock group
+	// settings), is used.
+	LockGroup string
+
+	// Limiter defines a rate limiter for reads and writes of this device, within
+	// the bounds of the plugin's global rate limiter. Since devices which are
+	// bulk read are read via their handler, this only applies to writes for them.
+	Limiter *config.LimiterSettings
+
+	// AdaptivePolling defines the adaptive polling settings for this device. If
+	// set, the interval between reads of the device grows while its readings are
+	// unchanged. This does not apply to devices which are read in bulk.
+	AdaptivePolling *config.AdaptivePollingSettings
+
+	// Staleness defines when the readings of this device are considered stale,
+	// and how stale readings are handled. If nil, the device's readings are
+	// never considered stale.
+	Staleness *config.StalenessSettings
+
+	// Deadband defines the deadband settings for this device. If set, its readings
+	// are only sent to read streams and the readings cache when they change by more
+	// than the deadband, or after a max silence has passed.
+	Deadband *config.DeadbandSettings
+
 	// Output is the name of the Output that this device instance will use. This
 	// is not needed for all devices/plugins, as many DeviceHandlers will already
 	// know which output to use. This field is used in cases of generalized plugins,
@@ -106,6 +156,33 @@ type Device struct {
 	// populated via the SDK on device loading and parsing and uses the Handler
 	// field to match the name of the handler to the actual instance.
 	handler *DeviceHandler
+
+	// configDigest is a digest of the configuration which the device was created
+	// from. It is used to detect changes to the device's configuration when device
+	// configuration is reloaded. Devices not created from config have no digest.
+	configDigest string
+
+	// removed is set (atomically) once the device has been removed from the
+	// plugin. Reads and writes which were already in flight for the device
+	// when it was removed check this so their results are discarded.
+	removed uint32
+
+	// breaker holds the device's *circuitBreaker, if circuit breakers are
+	// enabled and the device has been read or written.
+	breaker atomic.Value
+
+	// readStats and writeStats track the statistics for the device's reads
+	// and writes.
+	readStats  statsTracker
+	writeStats statsTracker
+
+	// poller tracks the device's effective read interval, which may vary if
+	// adaptive polling is enabled for the device.
+	poller adaptivePoller
+
+	// deadband tracks the device's last delivered readings, which new readings
+	// are compared to if the device has deadband settings.
+	deadband deadbandFilter
 }
 
 // NewDeviceFromConfig creates a new instance of a Device from its device prototype
@@ -121,11 +198,50 @@ type Device struct {
 // looking up the appropriate handler from the map using the `Handler` name.
 //
 // If no handler is found in the map for the device, an error is returned.
+//
+// Outputs and transform functions referenced by the configuration are resolved
+// from the package-level registries. To build a device using a plugin's own
+// registries, use Plugin.NewDevice.
 func NewDeviceFromConfig(
 	proto *config.DeviceProto,
 	instance *config.DeviceInstance,
 	handlers map[string]*DeviceHandler,
 ) (*Device, error) {
+	return newDeviceFromConfig(proto, instance, handlers, defaultDeviceResources())
+}
+
+// deviceResources holds the plugin-scoped resources which are used when building
+// a Device from its configuration.
+type deviceResources struct {
+	// meta is the metadata for the plugin, used when rendering alias templates.
+	meta *PluginMetadata
+
+	// outputs is the registry which output references are resolved against.
+	outputs *output.Registry
+
+	// funcs is the registry which transform functions are resolved against.
+	funcs *funcs.Registry
+}
+
+// defaultDeviceResources gets the deviceResources backed by the package-level
+// plugin metadata and output/func registries.
+func defaultDeviceResources() *deviceResources {
+	return &deviceResources{
+		meta:    &metadata,
+		outputs: output.DefaultRegistry(),
+		funcs:   funcs.DefaultRegistry(),
+	}
+}
+
+// newDeviceFromConfig creates a new instance of a Device from its device prototype
+// and device instance configuration, using the provided resources to resolve any
+// references in the configuration.
+func newDeviceFromConfig(
+	proto *config.DeviceProto,
+	instance *config.DeviceInstance,
+	handlers map[string]*DeviceHandler,
+	resources *deviceResources,
+) (*Device, error) {
 
 	if proto == nil || instance == nil {
 		return nil, fmt.Errorf("cannot create new device from nil config")
@@ -141,6 +257,15 @@ func NewDeviceFromConfig(
 		handler      string
 		deviceType   string
 		writeTimeout time.Duration
+		readInterval time.Duration
+		readTimeout  time.Duration
+		writeRetry   *config.DeviceRetrySettings
+		lockGroup    string
+		limiter      *config.LimiterSettings
+
+		adaptivePolling *config.AdaptivePollingSettings
+		staleness       *config.StalenessSettings
+		deadband        *config.DeadbandSettings
 	)
 
 	// If inheritance is enabled, use the prototype defined value as the base. For
@@ -157,9 +282,17 @@ func NewDeviceFromConfig(
 		handler = proto.Handler
 		deviceType = proto.Type
 		writeTimeout = proto.WriteTimeout
+		readInterval = proto.ReadInterval
+		readTimeout = proto.ReadTimeout
+		writeRetry = proto.WriteRetry
+		lockGroup = proto.LockGroup
+		limiter = proto.Limiter
+		adaptivePolling = proto.AdaptivePolling
+		staleness = proto.Staleness
+		deadband = proto.Deadband
 
 		for _, v := range proto.Transforms {
-			t, err := NewTransformer(v)
+			t, err := newTransformer(v, resources.funcs)
 			if err != nil {
 				log.WithFields(log.Fields{
 					"error":  err,
@@ -235,7 +368,7 @@ func NewDeviceFromConfig(
 	// If an output is specified for the device, make sure that an output
 	// with that name exists. If not, the device config is incorrect.
 	if instance.Output != "" {
-		if output.Get(instance.Output) == nil {
+		if resources.outputs.Get(instance.Output) == nil {
 			log.WithFields(log.Fields{
 				"prototype": proto,
 				"instance":  instance,
@@ -247,7 +380,7 @@ func NewDeviceFromConfig(
 	// Collect the instance transforms, then parse the transform configs
 	// to validate they are correct.
 	for _, v := range instance.Transforms {
-		t, err := NewTransformer(v)
+		t, err := newTransformer(v, resources.funcs)
 		if err != nil {
 			log.WithFields(log.Fields{
 				"error":  err,
@@ -271,26 +404,76 @@ func NewDeviceFromConfig(
 		writeTimeout = defaultWriteTimeout
 	}
 
+	// Override read interval, if set.
+	if instance.ReadInterval != 0 {
+		readInterval = instance.ReadInterval
+	}
+
+	// Override read timeout, if set.
+	if instance.ReadTimeout != 0 {
+		readTimeout = instance.ReadTimeout
+	}
+
+	// Override lock group, if set.
+	if instance.LockGroup != "" {
+		lockGroup = instance.LockGroup
+	}
+
+	// Override limiter, if set.
+	if instance.Limiter != nil {
+		limiter = instance.Limiter
+	}
+
+	// Override staleness settings, if set.
+	if instance.Staleness != nil {
+		staleness = instance.Staleness
+	}
+	if staleness != nil {
+		switch staleness.Action {
+		case "", stalenessMark, stalenessDrop:
+		default:
+			return nil, fmt.Errorf("new device: unknown staleness action specified '%s'", staleness.Action)
+		}
+	}
+
+	if deadband != nil {
+		if deadband.Absolute < 0 || deadband.Percent < 0 {
+			return nil, fmt.Errorf("new device: deadband must not be negative")
+		}
+		if deadband.Absolute > 0 && deadband.Percent > 0 {
+			return nil, fmt.Errorf("new device: deadband may only specify one of absolute and percent")
+		}
+	}
+
 	// Render any templates which may exist in the context.
 	if err := parseContext(context); err != nil {
 		return nil, err
 	}
 
 	d := &Device{
-		Type:         deviceType,
-		Tags:         deviceTags,
-		Data:         data,
-		Context:      context,
-		Handler:      handler,
-		Info:         instance.Info,
-		SortIndex:    instance.SortIndex,
-		Transforms:   transforms,
-		WriteTimeout: writeTimeout,
-		Output:       instance.Output,
-		handler:      handlerFn,
-	}
-
-	if err := d.setAlias(instance.Alias); err != nil {
+		Type:            deviceType,
+		Tags:            deviceTags,
+		Data:            data,
+		Context:         context,
+		Handler:         handler,
+		Info:            instance.Info,
+		SortIndex:       instance.SortIndex,
+		Transforms:      transforms,
+		WriteTimeout:    writeTimeout,
+		ReadInterval:    readInterval,
+		ReadTimeout:     readTimeout,
+		WriteRetry:      writeRetry,
+		LockGroup:       lockGroup,
+		Limiter:         limiter,
+		Output:          instance.Output,
+		AdaptivePolling: adaptivePolling,
+		Staleness:       staleness,
+		Deadband:        deadband,
+		handler:         handlerFn,
+		configDigest:    newConfigDigest(proto, instance),
+	}
+
+	if err := d.setAlias(instance.Alias, resources.meta); err != nil {
 		log.WithFields(log.Fields{
 			"error": err,
 			"alias": instance.Alias,
@@ -338,14 +521,94 @@ func parseContext(ctx map[string]string) error {
 	return nil
 }
 
+// newConfigDigest creates a digest of the prototype and instance configuration
+// which a device is created from. If the configuration can not be digested, an
+// empty string is returned.
+func newConfigDigest(proto *config.DeviceProto, instance *config.DeviceInstance) string {
+	// Only the prototype's own fields factor into the device config, not those of
+	// its other instances.
+	p := *proto
+	p.Instances = nil
+
+	data, err := yaml.Marshal(struct {
+		Proto    config.DeviceProto
+		Instance config.DeviceInstance
+	}{
+		Proto:    p,
+		Instance: *instance,
+	})
+	if err != nil {
+		log.WithField("error", err).Debug("[device] unable to create device config digest")
+		return ""
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(data))
+}
+
+// newDeviceDigest creates a digest of a Device which was not created from config
+// (e.g. one created by a DynamicDeviceRegistrar), so that changes to the device can
+// be detected when it is registered again. Transforms are not included, as they
+// can not be serialized.
+func newDeviceDigest(device *Device) string {
+	tags := make([]string, 0, len(device.Tags))
+	for _, t := range device.Tags {
+		tags = append(tags, t.String())
+	}
+
+	data, err := yaml.Marshal(struct {
+		Type            string
+		Info            string
+		Tags            []string
+		Data            map[string]interface{}
+		Context         map[string]string
+		Handler         string
+		SortIndex       int32
+		Alias           string
+		WriteTimeout    time.Duration
+		ReadInterval    time.Duration
+		ReadTimeout     time.Duration
+		WriteRetry      *config.DeviceRetrySettings
+		LockGroup       string
+		Limiter         *config.LimiterSettings
+		Output          string
+		AdaptivePolling *config.AdaptivePollingSettings
+		Staleness       *config.StalenessSettings
+		Deadband        *config.DeadbandSettings
+	}{
+		Type:            device.Type,
+		Info:            device.Info,
+		Tags:            tags,
+		Data:            device.Data,
+		Context:         device.Context,
+		Handler:         device.Handler,
+		SortIndex:       device.SortIndex,
+		Alias:           device.Alias,
+		WriteTimeout:    device.WriteTimeout,
+		ReadInterval:    device.ReadInterval,
+		ReadTimeout:     device.ReadTimeout,
+		WriteRetry:      device.WriteRetry,
+		LockGroup:       device.LockGroup,
+		Limiter:         device.Limiter,
+		Output:          device.Output,
+		AdaptivePolling: device.AdaptivePolling,
+		Staleness:       device.Staleness,
+		Deadband:        device.Deadband,
+	})
+	if err != nil {
+		log.WithField("error", err).Debug("[device] unable to create device digest")
+		return ""
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(data))
+}
+
 // AliasContext is the context that is used to render alias templates.
 type AliasContext struct {
 	Meta   *PluginMetadata
 	Device *Device
 }
 
-// setAlias sets the device alias for a given device.
-func (device *Device) setAlias(conf *config.DeviceAlias) error {
+// setAlias sets the device alias for a given device. The plugin metadata is made
+// available to alias templates.
+func (device *Device) setAlias(conf *config.DeviceAlias, meta *PluginMetadata) error {
 	// If there is no DeviceAlias config, there is no alias set for the device.
 	if conf == nil {
 		return nil
@@ -361,7 +624,7 @@ func (device *Device) setAlias(conf *config.DeviceAlias) error {
 	// template.
 	if conf.Template != "" {
 		ctx := &AliasContext{
-			Meta:   &metadata,
+			Meta:   meta,
 			Device: device,
 		}
 
@@ -399,6 +662,31 @@ func (device *Device) GetID() string {
 	return device.id
 }
 
+// markRemoved marks the device as having been removed from the plugin.
+func (device *Device) markRemoved() {
+	atomic.StoreUint32(&device.removed, 1)
+}
+
+// isRemoved checks whether the device has been removed from the plugin.
+func (device *Device) isRemoved() bool {
+	return atomic.LoadUint32(&device.removed) == 1
+}
+
+// circuitBreaker gets the device's circuit breaker, or nil if it does not have one.
+func (device *Device) circuitBreaker() *circuitBreaker {
+	breaker, _ := device.breaker.Load().(*circuitBreaker)
+	return breaker
+}
+
+// Stats gets a snapshot of the read and write statistics for the device.
+func (device *Device) Stats() *DeviceStats {
+	return &DeviceStats{
+		Read:         device.readStats.snapshot(),
+		Write:        device.writeStats.snapshot(),
+		ReadInterval: device.poller.getCurrent(),
+	}
+}
+
 // Read performs the read action for the device, as set by its DeviceHandler.
 //
 // If reading is not supported on the device, an UnsupportedCommandError is
@@ -425,6 +713,17 @@ func (device *Device) Read() (*ReadContext, error) {
 // If writing is not supported on the device, an UnsupportedCommandError is
 // returned.
 func (device *Device) Write(data *WriteData) error {
+	return device.WriteContext(context.Background(), data)
+}
+
+// WriteContext performs the write action for the device, as set by its DeviceHandler,
+// with the given context. If the handler defines a WriteContext function, the context
+// is passed to it so the write can be cancelled; otherwise, the handler's Write
+// function is used and the context is ignored.
+//
+// If writing is not supported on the device, an UnsupportedCommandError is
+// returned.
+func (device *Device) WriteContext(ctx context.Context, data *WriteData) error {
 	if !device.IsWritable() {
 		log.WithField("id", device.id).Debug("[device] device is not writable")
 		return &errors.UnsupportedCommandError{}
@@ -444,7 +743,12 @@ func (device *Device) Write(data *WriteData) error {
 		}
 	}
 
-	err := device.handler.Write(device, data)
+	var err error
+	if device.handler.WriteContext != nil {
+		err = device.handler.WriteContext(ctx, device, data)
+	} else {
+		err = device.handler.Write(device, data)
+	}
 	if err != nil {
 		log.WithFields(log.Fields{
 			"error": err,
@@ -465,7 +769,7 @@ func (device *Device) IsReadable() bool {
 }
 
 // IsWritable checks if the Device is writable based on the presence/absence
-// of a Write action defined in its DeviceHandler.
+// of a Write or WriteContext action defined in its DeviceHandler.
 func (device *Device) IsWritable() bool {
 	if device == nil {
 		return false
@@ -473,6 +777,49 @@ func (device *Device) IsWritable() bool {
 	return device.handler.CanWrite()
 }
 
+// metadataPrefix is the prefix of the device metadata keys which the SDK adds to
+// the device context, e.g. for the device's read and write statistics, so they
+// can be told apart from the keys of the device context.
+const metadataPrefix = "synse."
+
+// metadata gets the metadata for the encoded device. This is the device context,
+// along with the state of its circuit breaker, its read and write statistics,
+// and, if it is polled adaptively, its effective read interval, if it has any.
+// The SDK's metadata keys are namespaced by metadataPrefix, and never overwrite
+// keys of the device context.
+func (device *Device) metadata() map[string]string {
+	var extra []map[string]string
+	if breaker := device.circuitBreaker(); breaker != nil {
+		extra = append(extra, map[string]string{metadataCircuitState: breaker.getState()})
+	}
+	stats := device.Stats()
+	if m := stats.Read.metadata(metadataPrefix + "read"); m != nil {
+		extra = append(extra, m)
+	}
+	if m := stats.Write.metadata(metadataPrefix + "write"); m != nil {
+		extra = append(extra, m)
+	}
+	if device.AdaptivePolling != nil && stats.ReadInterval > 0 {
+		extra = append(extra, map[string]string{metadataReadInterval: stats.ReadInterval.String()})
+	}
+	if len(extra) == 0 {
+		return device.Context
+	}
+
+	metadata := make(map[string]string, len(device.Context))
+	for k, v := range device.Context {
+		metadata[k] = v
+	}
+	for _, m := range extra {
+		for k, v := range m {
+			if _, exists := metadata[k]; !exists {
+				metadata[k] = v
+			}
+		}
+	}
+	return metadata
+}
+
 // encode translates the Device to the corresponding gRPC Device message.
 func (device *Device) encode() *synse.V3Device {
 	var tags = make([]*synse.V3Tag, len(device.Tags))
@@ -494,7 +841,7 @@ func (device *Device) encode() *synse.V3Device {
 		Type:      device.Type,
 		Info:      device.Info,
 		Alias:     device.Alias,
-		Metadata:  device.Context,
+		Metadata:  device.metadata(),
 		SortIndex: device.SortIndex,
 		Tags:      tags,
 		Capabilities: &synse.V3DeviceCapability{
@@ -16,7 +16,13 @@
 
 package sdk
 
-import "github.com/vapor-ware/synse-sdk/sdk/output"
+import (
+	"context"
+	"time"
+
+	"github.com/vapor-ware/synse-sdk/sdk/config"
+	"github.com/vapor-ware/synse-sdk/sdk/output"
+)
 
 // DeviceHandler specifies the read and write handlers for a Device
 // based on its type and model.
@@ -31,6 +37,15 @@ type DeviceHandler struct {
 	// the devices do not support writing, this can be left unspecified.
 	Write func(*Device, *WriteData) error
 
+	// WriteContext is a context-aware variant of Write. The context is cancelled
+	// once the device's WriteTimeout elapses or the plugin is shutting down; the
+	// handler should stop actuating the device and return the context's error
+	// (e.g. ctx.Err()) when that happens. The write fails once its timeout elapses,
+	// but the device's next write, and the writes of any devices in its lock groups,
+	// do not start until the handler returns. If both Write and WriteContext are
+	// specified, WriteContext is used.
+	WriteContext func(context.Context, *Device, *WriteData) error
+
 	// Read is a function that handles Read requests for the handler's devices. If the
 	// devices do not support reading, this can be left unspecified.
 	Read func(*Device) ([]*output.Reading, error)
@@ -48,9 +63,49 @@ type DeviceHandler struct {
 	// before the read/write loops.
 	//
 	// NOTE: The Listen function is deprecated and will be removed in a future version
-	// of the SDK.
+	// of the SDK. Use Subscribe instead.
 	Listen func(*Device, chan *ReadContext) error
 
+	// Subscribe is a function that receives push-based data from the device. It is
+	// called once per device using the handler, in a separate goroutine, and should
+	// pass readings to the Emitter as they arrive until the context is cancelled.
+	// The context is cancelled when the device is removed or the plugin shuts down.
+	//
+	// If Subscribe returns an error, it is restarted with backoff, as configured
+	// by the plugin's listen settings. If it returns nil, it is not restarted.
+	Subscribe func(context.Context, *Device, Emitter) error
+
+	// ReadInterval is the time to wait between reads of the handler's devices. For
+	// handlers which read devices individually, this applies to each device which
+	// does not configure its own read interval. For handlers which bulk read, this
+	// is the interval between bulk reads. If left unspecified, the global read
+	// interval from the plugin config is used.
+	ReadInterval time.Duration
+
+	// ReadTimeout is the time within which a read (or bulk read) of the handler's
+	// devices must complete before it is abandoned. Devices may configure their
+	// own read timeout, which takes precedence. If left unspecified, the global
+	// read timeout from the plugin config is used.
+	ReadTimeout time.Duration
+
+	// MaxConcurrency is the maximum number of reads of the handler's devices which
+	// may run at once. This only applies when reads are run by a bounded worker
+	// pool (see the plugin's read settings). If left unspecified, the handler's
+	// reads are only bounded by the size of the pool.
+	MaxConcurrency int
+
+	// LockGroup is the name of the lock group for the handler's devices. Reads
+	// and writes of devices in the same lock group are serialized, while different
+	// lock groups are accessed concurrently. A device may configure its own lock
+	// group, which takes precedence over the handler's.
+	LockGroup string
+
+	// Limiter defines a rate limiter for reads and writes of the handler's devices,
+	// within the bounds of the plugin's global rate limiter. This allows a handler
+	// to be given its own budget, e.g. for an API-rate-limited backend, so it does
+	// not compete with other handlers.
+	Limiter *config.LimiterSettings
+
 	// Actions specifies a list of the supported write actions for the handler.
 	// This is optional and is just used as metadata surfaced by the SDK to the
 	// client via the gRPC API.
@@ -75,22 +130,33 @@ func (handler *DeviceHandler) CanBulkRead() bool {
 	return handler.Read == nil && handler.BulkRead != nil
 }
 
-// CanWrite returns true if the handler has a write function defined; false otherwise.
+// CanWrite returns true if the handler has a write function (Write or WriteContext)
+// defined; false otherwise.
 func (handler *DeviceHandler) CanWrite() bool {
 	if handler == nil {
 		return false
 	}
-	return handler.Write != nil
+	return handler.Write != nil || handler.WriteContext != nil
 }
 
-// CanListen returns true if the handler has a listen function defined; false otherwise.
+// CanListen returns true if the handler has a listen function (Listen or Subscribe)
+// defined; false otherwise.
 func (handler *DeviceHandler) CanListen() bool {
 	if handler == nil {
 		return false
 	}
-	return handler.Listen != nil
+	return handler.Listen != nil || handler.Subscribe != nil
 }
 
+// Emitter is passed to a device handler's Subscribe function to emit the readings
+// pushed by the device. The readings are transformed and have the device context
+// applied, as they would for a device read.
+//
+// Emit blocks until the readings are accepted by the plugin. If the subscription's
+// context is cancelled first, the readings are discarded and the context error
+// is returned.
+type Emitter func(readings ...*output.Reading) error
+
 // GetCapabilitiesMode gets the capabilities mode string representation for a device
 // based on its device handler. This will be one of: "r" (read-only), "w" (write-only),
 // or "rw" (read-write).
@@ -17,6 +17,7 @@
 package sdk
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -56,6 +57,15 @@ func TestDeviceHandler_CanWrite_true(t *testing.T) {
 	assert.True(t, handler.CanWrite())
 }
 
+func TestDeviceHandler_CanWrite_trueWriteContext(t *testing.T) {
+	handler := DeviceHandler{
+		WriteContext: func(ctx context.Context, device *Device, data *WriteData) error {
+			return nil
+		},
+	}
+	assert.True(t, handler.CanWrite())
+}
+
 func TestDeviceHandler_CanWrite_false(t *testing.T) {
 	handler := DeviceHandler{}
 	assert.False(t, handler.CanWrite())
@@ -75,6 +85,15 @@ func TestDeviceHandler_CanListen_true(t *testing.T) {
 	assert.True(t, handler.CanListen())
 }
 
+func TestDeviceHandler_CanListen_trueSubscribe(t *testing.T) {
+	handler := DeviceHandler{
+		Subscribe: func(ctx context.Context, device *Device, emit Emitter) error {
+			return nil
+		},
+	}
+	assert.True(t, handler.CanListen())
+}
+
 func TestDeviceHandler_CanListen_false(t *testing.T) {
 	handler := DeviceHandler{}
 	assert.False(t, handler.CanListen())
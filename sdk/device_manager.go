@@ -19,6 +19,9 @@ package sdk
 import (
 	"errors"
 	"fmt"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/gobwas/glob"
 
@@ -44,10 +47,42 @@ var (
 // Device manager error definitions.
 var (
 	ErrDeviceIDExists = errors.New("conflict: device id already exists")
+	ErrDeviceNotFound = sdkError.NotFoundErr("device not found")
 )
 
+// deviceSource identifies where a device managed by the deviceManager came from.
+type deviceSource string
+
+// Device sources. Devices which are reconciled against a source (e.g. on reload
+// of device configuration) are only compared with other devices from that source.
+const (
+	// sourceConfig designates devices which were created from device
+	// configuration files.
+	sourceConfig deviceSource = "config"
+
+	// sourceDynamicConfig designates devices which were created from device
+	// configuration generated by the dynamic device config registrar.
+	sourceDynamicConfig deviceSource = "dynamic-config"
+
+	// sourceDynamic designates devices which were created by the dynamic
+	// device registrar.
+	sourceDynamic deviceSource = "dynamic"
+)
+
+// registrarSource gets the source of the devices which a dynamic registrar produced
+// from the dynamic registration config at the given index. Each config has its own
+// source, so the devices from one config can be reconciled without affecting the
+// devices from the others, e.g. when another config's registration fails.
+func registrarSource(source deviceSource, index int) deviceSource {
+	return deviceSource(fmt.Sprintf("%s/%d", source, index))
+}
+
 // DeviceAction defines an action that can be run before the main Plugin run
 // logic. This is generally used for doing device-specific setup actions.
+//
+// A DeviceAction may also be run periodically while the plugin is running, e.g.
+// for device maintenance such as re-arming a watchdog. A periodic action must
+// specify either an Interval or a Schedule.
 type DeviceAction struct {
 	// Name is the name of the action. This is used to identify the action.
 	Name string
@@ -65,20 +100,40 @@ type DeviceAction struct {
 
 	// The action to execute for the device.
 	Action func(p *Plugin, d *Device) error
+
+	// Interval is the time to wait between runs of a periodic action. It is
+	// measured from the end of a run, so runs never overlap. This is only
+	// used for periodic actions.
+	Interval time.Duration
+
+	// Schedule is a cron spec for when a periodic action is run, e.g.
+	// "*/15 * * * *" to run every 15 minutes, or a macro such as "@daily".
+	// Times are in the plugin's local time. This is only used for periodic
+	// actions.
+	Schedule string
 }
 
 // deviceManager loads and manages a Plugin's devices.
 type deviceManager struct {
-	config         *config.Devices
-	id             *pluginID
-	pluginHandlers *PluginHandlers
-	policies       *policy.Policies
-	dynamicConfig  *config.DynamicRegistrationSettings
-	tagCache       *TagCache
-	aliasCache     *AliasCache
-	setupActions   []*DeviceAction
-	devices        map[string]*Device
-	handlers       map[string]*DeviceHandler
+	config          *config.Devices
+	id              *pluginID
+	pluginHandlers  *PluginHandlers
+	policies        *policy.Policies
+	dynamicConfig   *config.DynamicRegistrationSettings
+	tagCache        *TagCache
+	aliasCache      *AliasCache
+	setupActions    []*DeviceAction
+	periodicActions []*DeviceAction
+	devices         map[string]*Device
+	handlers        map[string]*DeviceHandler
+
+	// sources tracks the source of each device which was not registered
+	// directly with the manager, keyed by device ID.
+	sources map[string]deviceSource
+
+	// lock guards the devices and sources maps, as devices may be added and
+	// removed while the plugin is running.
+	lock sync.RWMutex
 
 	plugin *Plugin
 }
@@ -114,13 +169,13 @@ func (manager *deviceManager) init() error {
 		return err
 	}
 
-	// Load device configs dynamically.
-	if err := manager.loadDynamicConfig(); err != nil {
+	// Create devices from config.
+	if err := manager.createDevices(); err != nil {
 		return err
 	}
 
-	// Create devices from config.
-	if err := manager.createDevices(); err != nil {
+	// Load device configs dynamically and create devices from them.
+	if err := manager.createDynamicConfigDevices(); err != nil {
 		return err
 	}
 
@@ -132,61 +187,122 @@ func (manager *deviceManager) init() error {
 	return nil
 }
 
-// loadDynamicConfig loads device configurations using the dynamic device config
-// registrar plugin handler.
-func (manager *deviceManager) loadDynamicConfig() error {
+// dynamicRegistrationError applies the DynamicDeviceConfig policy to an error
+// from dynamic device registration. If the policy is optional, the error is
+// logged and nil is returned so that registration can continue; otherwise, the
+// error is returned.
+func (manager *deviceManager) dynamicRegistrationError(err error, action string) error {
+	switch manager.policies.DynamicDeviceConfig {
+	case policy.Optional:
+		log.WithError(err).Infof("[device manager] failed %s; skipping since its optional", action)
+		return nil
+	case policy.Required:
+		log.WithError(err).Errorf("[device manager] failed %s; erroring since its required", action)
+		return err
+	default:
+		log.WithFields(log.Fields{
+			"policy": manager.policies.DynamicDeviceConfig,
+		}).Errorf("[device manager] invalid policy when %s", action)
+		return err
+	}
+}
+
+// registrarSources gets the sources of the devices produced by a dynamic registrar
+// for each of the dynamic registration configs, in order (see registrarSource).
+func (manager *deviceManager) registrarSources(source deviceSource) []deviceSource {
+	if manager.dynamicConfig == nil {
+		return nil
+	}
+	sources := make([]deviceSource, len(manager.dynamicConfig.Config))
+	for i := range manager.dynamicConfig.Config {
+		sources[i] = registrarSource(source, i)
+	}
+	return sources
+}
+
+// readDynamicConfig reads device configurations using the dynamic device config
+// registrar plugin handler. The configs are keyed by the source of the dynamic
+// registration config they were read from. The number of registrar configs which
+// failed, but were skipped per the DynamicDeviceConfig policy, is also returned;
+// skipped configs have no entry.
+func (manager *deviceManager) readDynamicConfig() (map[deviceSource]*config.Devices, int, error) {
+	var skipped int
+	configs := make(map[deviceSource]*config.Devices)
 	if manager.dynamicConfig != nil {
 		log.Debug("[device manager] loading dynamic config...")
-		for _, cfg := range manager.dynamicConfig.Config {
+		for i, cfg := range manager.dynamicConfig.Config {
 			devices, err := manager.pluginHandlers.DynamicConfigRegistrar(cfg)
 			if err != nil {
-				switch manager.policies.DynamicDeviceConfig {
-				case policy.Optional:
-					log.WithError(err).Info("[device manager] failed loading dynamic device config; skipping since its optional")
-					continue
-				case policy.Required:
-					log.WithError(err).Error("[device manager] failed loading dynamic device config; erroring since its required")
-					return err
-				default:
-					log.WithFields(log.Fields{
-						"policy": manager.policies.DynamicDeviceConfig,
-					}).Error("[device manager] invalid policy when loading dynamic device config")
-					return err
+				if err := manager.dynamicRegistrationError(err, "loading dynamic device config"); err != nil {
+					return nil, skipped, err
 				}
+				skipped++
+				continue
 			}
-			manager.config.Devices = append(manager.config.Devices, devices...)
+			configs[registrarSource(sourceDynamicConfig, i)] = &config.Devices{Devices: devices}
 		}
 	}
-	return nil
+	return configs, skipped, nil
 }
 
-// createDynamicDevices creates devices using the dynamic device registrar plugin handler.
-func (manager *deviceManager) createDynamicDevices() error {
+// runDynamicRegistrar creates devices using the dynamic device registrar plugin
+// handler. The devices are keyed by the source of the dynamic registration config
+// they were created from. The number of registrar configs which failed, but were
+// skipped per the DynamicDeviceConfig policy, is also returned; skipped configs
+// have no entry.
+func (manager *deviceManager) runDynamicRegistrar() (map[deviceSource][]*Device, int, error) {
+	var skipped int
+	devices := make(map[deviceSource][]*Device)
 	if manager.dynamicConfig != nil {
 		log.Debug("[device manager] creating dynamic devices...")
-		for _, cfg := range manager.dynamicConfig.Config {
-			devices, err := manager.pluginHandlers.DynamicRegistrar(cfg)
+		for i, cfg := range manager.dynamicConfig.Config {
+			d, err := manager.pluginHandlers.DynamicRegistrar(cfg)
 			if err != nil {
-				switch manager.policies.DynamicDeviceConfig {
-				case policy.Optional:
-					log.WithError(err).Info("[device manager] failed creating dynamic devices; skipping since its optional")
-					continue
-				case policy.Required:
-					log.WithError(err).Error("[device manager] failed creating dynamic devices; erroring since its required")
-					return err
-				default:
-					log.WithFields(log.Fields{
-						"policy": manager.policies.DynamicDeviceConfig,
-					}).Error("[device manager] invalid policy when loading dynamic devices")
-					return err
+				if err := manager.dynamicRegistrationError(err, "creating dynamic devices"); err != nil {
+					return nil, skipped, err
 				}
+				skipped++
+				continue
 			}
+			devices[registrarSource(sourceDynamic, i)] = d
+		}
+	}
+	return devices, skipped, nil
+}
 
-			for _, device := range devices {
-				if err := manager.AddDevice(device); err != nil {
-					log.WithError(err).Error("[device manager] failed to add device to manager")
-					return err
-				}
+// createDynamicConfigDevices loads device configurations using the dynamic device
+// config registrar plugin handler and creates devices from them. The loaded configs
+// are added to the manager's device config.
+func (manager *deviceManager) createDynamicConfigDevices() error {
+	configs, _, err := manager.readDynamicConfig()
+	if err != nil {
+		return err
+	}
+	for _, source := range manager.registrarSources(sourceDynamicConfig) {
+		cfg, ok := configs[source]
+		if !ok {
+			continue
+		}
+		if err := manager.createDevicesFrom(cfg, source); err != nil {
+			return err
+		}
+		manager.config.Devices = append(manager.config.Devices, cfg.Devices...)
+	}
+	return nil
+}
+
+// createDynamicDevices creates devices using the dynamic device registrar plugin handler.
+func (manager *deviceManager) createDynamicDevices() error {
+	devices, _, err := manager.runDynamicRegistrar()
+	if err != nil {
+		return err
+	}
+
+	for _, source := range manager.registrarSources(sourceDynamic) {
+		for _, device := range devices[source] {
+			if err := manager.addDeviceFromSource(device, source); err != nil {
+				log.WithError(err).Error("[device manager] failed to add device to manager")
+				return err
 			}
 		}
 	}
@@ -206,7 +322,10 @@ func (manager *deviceManager) Start(plugin *Plugin) error {
 // GetDevice gets a device from the manager by ID. If the device does not
 // exists, nil is returned.
 func (manager *deviceManager) GetDevice(id string) *Device {
+	manager.lock.RLock()
 	device, exists := manager.devices[id]
+	manager.lock.RUnlock()
+
 	if !exists {
 		log.WithFields(log.Fields{
 			"id": id,
@@ -272,6 +391,9 @@ func (manager *deviceManager) GetDevicesByTagNamespace(namespace ...string) []*D
 
 // GetAllDevices gets all devices that are registered with the deviceManager.
 func (manager *deviceManager) GetAllDevices() []*Device {
+	manager.lock.RLock()
+	defer manager.lock.RUnlock()
+
 	devices := make([]*Device, 0, len(manager.devices))
 	for _, device := range manager.devices {
 		devices = append(devices, device)
@@ -332,6 +454,19 @@ func (manager *deviceManager) HasListenerHandlers() bool {
 // If the Device specifies a handler that does not exist, this will
 // result in an error.
 func (manager *deviceManager) AddDevice(device *Device) error {
+	if err := manager.prepareDevice(device); err != nil {
+		return err
+	}
+
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+
+	return manager.addDevice(device)
+}
+
+// prepareDevice validates a device and resolves its handler and ID so that it
+// is ready to be added to the deviceManager.
+func (manager *deviceManager) prepareDevice(device *Device) error {
 	if device == nil {
 		return fmt.Errorf("can not add nil device to device manager")
 	}
@@ -361,7 +496,12 @@ func (manager *deviceManager) AddDevice(device *Device) error {
 	if device.id == "" {
 		manager.plugin.GenerateDeviceID(device)
 	}
+	return nil
+}
 
+// addDevice adds a prepared device to the deviceManager. The caller must hold
+// the manager's lock.
+func (manager *deviceManager) addDevice(device *Device) error {
 	// Check if the Device ID collides with an existing device.
 	if _, exists := manager.devices[device.id]; exists {
 		// Log at least device.id and device.info here so we can see the duplicate.
@@ -400,6 +540,239 @@ func (manager *deviceManager) AddDevice(device *Device) error {
 	return nil
 }
 
+// addDeviceFromSource adds a device to the deviceManager, recording the source
+// which the device came from.
+func (manager *deviceManager) addDeviceFromSource(device *Device, source deviceSource) error {
+	// Devices not created from config have no config digest, so digest the
+	// device itself so changes to it can be detected on reconciliation.
+	if device != nil && device.configDigest == "" {
+		device.configDigest = newDeviceDigest(device)
+	}
+	if err := manager.AddDevice(device); err != nil {
+		return err
+	}
+
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+
+	if manager.sources == nil {
+		manager.sources = make(map[string]deviceSource)
+	}
+	manager.sources[device.id] = source
+	return nil
+}
+
+// removeDevice removes the device with the given ID from the deviceManager,
+// including its entries in the tag cache and alias cache. The removed device
+// is returned. If no device with the given ID exists, nil is returned.
+func (manager *deviceManager) removeDevice(id string) *Device {
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+
+	return manager.removeDeviceLocked(id)
+}
+
+// removeDeviceLocked removes the device with the given ID from the deviceManager.
+// The caller must hold the manager's lock.
+func (manager *deviceManager) removeDeviceLocked(id string) *Device {
+	device, exists := manager.devices[id]
+	if !exists {
+		return nil
+	}
+
+	delete(manager.devices, id)
+	delete(manager.sources, id)
+
+	if device.Alias != "" {
+		manager.aliasCache.Remove(device.Alias, device)
+	}
+	for _, t := range device.Tags {
+		manager.tagCache.Remove(t, device)
+	}
+	device.markRemoved()
+
+	log.WithFields(log.Fields{
+		"id":   device.id,
+		"type": device.Type,
+		"info": device.Info,
+	}).Info("[device manager] removed device")
+
+	return device
+}
+
+// replaceDevice replaces the device with the given ID with a new device. The
+// replacement is atomic with respect to other device lookups: the new device is
+// validated and checked for conflicts before the old device is removed, so if
+// the replacement fails, the old device remains in place. The replaced device
+// is returned.
+func (manager *deviceManager) replaceDevice(id string, device *Device) (*Device, error) {
+	if err := manager.prepareDevice(device); err != nil {
+		return nil, err
+	}
+
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+
+	old, exists := manager.devices[id]
+	if !exists {
+		return nil, ErrDeviceNotFound
+	}
+	if device.id != id {
+		if _, exists := manager.devices[device.id]; exists {
+			return nil, ErrDeviceIDExists
+		}
+	}
+	if device.Alias != "" {
+		if d := manager.aliasCache.Get(device.Alias); d != nil && d != old {
+			return nil, fmt.Errorf("duplicate device alias detected")
+		}
+	}
+
+	// The new device takes over the old device's source, so it is still
+	// reconciled against that source.
+	source, sourced := manager.sources[id]
+
+	manager.removeDeviceLocked(id)
+	if err := manager.addDevice(device); err != nil {
+		return nil, err
+	}
+	if sourced {
+		manager.sources[device.id] = source
+	}
+	return old, nil
+}
+
+// getDevicesFromSource gets all devices managed by the deviceManager which came
+// from the given source, keyed by device ID.
+func (manager *deviceManager) getDevicesFromSource(source deviceSource) map[string]*Device {
+	manager.lock.RLock()
+	defer manager.lock.RUnlock()
+
+	devices := make(map[string]*Device)
+	for id, s := range manager.sources {
+		if s == source {
+			if device, exists := manager.devices[id]; exists {
+				devices[id] = device
+			}
+		}
+	}
+	return devices
+}
+
+// reconcile updates the set of devices which came from the given source to match
+// the provided devices. Devices are matched by ID:
+//   - devices which do not yet exist are added
+//   - devices which exist and whose configuration has changed are replaced
+//   - devices from the source which are not in the provided set are removed
+//
+// Changed devices are replaced atomically (see replaceDevice), so they are never
+// missing from device lookups, and a device whose new configuration fails to be
+// added keeps its current configuration.
+//
+// Reconciliation continues past devices which fail to be added or replaced, so a
+// single bad device does not prevent others from being reconciled. Any such failures
+// are collected and returned as an error alongside the changes which were made.
+func (manager *deviceManager) reconcile(source deviceSource, devices []*Device) (*deviceChanges, error) {
+	var multiErr = sdkError.NewMultiError("device reconciliation")
+	changes := &deviceChanges{}
+
+	current := manager.getDevicesFromSource(source)
+	desired := make(map[string]*Device, len(devices))
+	for _, device := range devices {
+		if device.id == "" {
+			manager.plugin.GenerateDeviceID(device)
+		}
+		if device.configDigest == "" {
+			device.configDigest = newDeviceDigest(device)
+		}
+		if _, exists := desired[device.id]; exists {
+			log.WithFields(log.Fields{
+				"id":   device.id,
+				"type": device.Type,
+				"info": device.Info,
+			}).Error("[device manager] duplicate device id in reconciled devices")
+			multiErr.Add(ErrDeviceIDExists)
+			continue
+		}
+		desired[device.id] = device
+	}
+
+	// Remove devices which no longer exist first, so any aliases they held are
+	// freed up for the devices which are updated or added.
+	for id := range current {
+		if _, exists := desired[id]; !exists {
+			if removed := manager.removeDevice(id); removed != nil {
+				changes.removed = append(changes.removed, removed)
+			}
+		}
+	}
+
+	var toUpdate, toAdd []*Device
+	for id, device := range desired {
+		existing, exists := current[id]
+		if !exists {
+			toAdd = append(toAdd, device)
+			continue
+		}
+		if existing.configDigest != "" && existing.configDigest == device.configDigest {
+			changes.unchanged++
+			continue
+		}
+		toUpdate = append(toUpdate, device)
+	}
+
+	// Replace updated devices, and then add new devices, in a deterministic order.
+	sort.Slice(toUpdate, func(i, j int) bool { return toUpdate[i].id < toUpdate[j].id })
+	for _, device := range toUpdate {
+		replaced, err := manager.replaceDevice(device.id, device)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"id":    device.id,
+				"error": err,
+			}).Error("[device manager] failed to update device on reconciliation, keeping current device")
+			multiErr.Add(err)
+			continue
+		}
+		changes.removed = append(changes.removed, replaced)
+		changes.added = append(changes.added, device)
+	}
+
+	sort.Slice(toAdd, func(i, j int) bool { return toAdd[i].id < toAdd[j].id })
+	for _, device := range toAdd {
+		if err := manager.addDeviceFromSource(device, source); err != nil {
+			log.WithFields(log.Fields{
+				"id":    device.id,
+				"error": err,
+			}).Error("[device manager] failed to add device on reconciliation")
+			multiErr.Add(err)
+			continue
+		}
+		changes.added = append(changes.added, device)
+	}
+
+	return changes, multiErr.Err()
+}
+
+// deviceChanges describes the changes made to the devices managed by the
+// deviceManager on reconciliation. A device which was updated is included
+// both in the removed devices (as its old instance) and added devices (as
+// its new instance).
+type deviceChanges struct {
+	added     []*Device
+	removed   []*Device
+	unchanged int
+}
+
+// merge adds the given changes to the deviceChanges.
+func (changes *deviceChanges) merge(other *deviceChanges) {
+	if other == nil {
+		return
+	}
+	changes.added = append(changes.added, other.added...)
+	changes.removed = append(changes.removed, other.removed...)
+	changes.unchanged += other.unchanged
+}
+
 // AddHandlers adds DeviceHandlers to the DeviceManager.
 func (manager *deviceManager) AddHandlers(handlers ...*DeviceHandler) error {
 	for _, handler := range handlers {
@@ -417,6 +790,9 @@ func (manager *deviceManager) AddHandlers(handlers ...*DeviceHandler) error {
 // GetDevicesForHandler gets all of the Devices which are configured to use the
 // DeviceHandler with the given name.
 func (manager *deviceManager) GetDevicesForHandler(handler string) []*Device {
+	manager.lock.RLock()
+	defer manager.lock.RUnlock()
+
 	var devices []*Device
 	for _, device := range manager.devices {
 		if device.Handler == handler {
@@ -456,6 +832,39 @@ func (manager *deviceManager) AddDeviceSetupActions(actions ...*DeviceAction) er
 	return nil
 }
 
+// AddDevicePeriodicActions registers actions with the device manager which will
+// be executed periodically while the plugin is running. These actions are used
+// for recurring device-specific maintenance.
+//
+// As with device setup actions, a DeviceAction must specify a filter. It must
+// also specify either an Interval or a Schedule at which it is run.
+func (manager *deviceManager) AddDevicePeriodicActions(actions ...*DeviceAction) error {
+	for _, action := range actions {
+		alog := log.WithField("action", action.Name)
+
+		if len(action.Filter) == 0 {
+			alog.Error("[device manager] no filter set for device periodic action")
+			return fmt.Errorf("no filter set for device periodic action")
+		}
+		if _, err := filterDevices(nil, action.Filter); err != nil {
+			alog.WithField("error", err).Error("[device manager] invalid filter for device periodic action")
+			return err
+		}
+		if (action.Interval > 0) == (action.Schedule != "") {
+			alog.Error("[device manager] device periodic action must set one of interval or schedule")
+			return fmt.Errorf("device periodic action must set one of interval or schedule")
+		}
+		if action.Schedule != "" {
+			if _, err := parseCron(action.Schedule); err != nil {
+				alog.WithField("error", err).Error("[device manager] invalid schedule for device periodic action")
+				return err
+			}
+		}
+		manager.periodicActions = append(manager.periodicActions, action)
+	}
+	return nil
+}
+
 // FilterDevices applies a filter to the compete set of registered devices and returns
 // the set of devices which match the filter.
 //
@@ -463,6 +872,12 @@ func (manager *deviceManager) AddDeviceSetupActions(actions ...*DeviceAction) er
 // value are the allowable values for that field. This filtering is additive, e.g.
 // type=temperature and type=led will return all temperature and led devices.
 func (manager *deviceManager) FilterDevices(filter map[string][]string) ([]*Device, error) {
+	return filterDevices(manager.GetAllDevices(), filter)
+}
+
+// filterDevices applies a filter to the given set of devices and returns the set of
+// devices which match the filter.
+func filterDevices(devices []*Device, filter map[string][]string) ([]*Device, error) {
 	var filteredSet []*Device
 	var checks []func(d *Device) bool
 
@@ -492,7 +907,7 @@ func (manager *deviceManager) FilterDevices(filter map[string][]string) ([]*Devi
 		checks = append(checks, check)
 	}
 
-	for _, device := range manager.devices {
+	for _, device := range devices {
 		for _, check := range checks {
 			if check(device) {
 				filteredSet = append(filteredSet, device)
@@ -502,27 +917,43 @@ func (manager *deviceManager) FilterDevices(filter map[string][]string) ([]*Devi
 	return filteredSet, nil
 }
 
+// deviceResources gets the resources used for building the manager's devices. These
+// come from the plugin, falling back to the package-level resources if the manager
+// has no plugin.
+func (manager *deviceManager) deviceResources() *deviceResources {
+	if manager.plugin == nil {
+		return defaultDeviceResources()
+	}
+	return manager.plugin.deviceResources()
+}
+
 // createDevices takes the manager configuration and generates all corresponding
 // Device instances from it.
 func (manager *deviceManager) createDevices() error {
-	if manager.config == nil {
+	return manager.createDevicesFrom(manager.config, sourceConfig)
+}
+
+// createDevicesFrom creates devices from the given device configuration and adds
+// them to the manager, recording the given source for each device.
+func (manager *deviceManager) createDevicesFrom(cfg *config.Devices, source deviceSource) error {
+	if cfg == nil {
 		return errors.New("unable to create devices: config is nil")
 	}
 
 	var failedLoad bool
 
-	for _, proto := range manager.config.Devices {
+	for _, proto := range cfg.Devices {
 		for _, instance := range proto.Instances {
 
 			// Create the device.
-			device, err := NewDeviceFromConfig(proto, instance, manager.handlers)
+			device, err := newDeviceFromConfig(proto, instance, manager.handlers, manager.deviceResources())
 			if err != nil {
 				log.WithField("error", err).Error("[device manager] failed to create device from config")
 				failedLoad = true
 				continue
 			}
 			// Add it to the manager.
-			if err := manager.AddDevice(device); err != nil {
+			if err := manager.addDeviceFromSource(device, source); err != nil {
 				log.WithField("error", err).Error("[device manager] failed to add device to manager")
 				failedLoad = true
 			}
@@ -538,9 +969,53 @@ func (manager *deviceManager) createDevices() error {
 	return nil
 }
 
+// loadConfigDevices loads the device configuration from file and creates the
+// devices defined by it.
+//
+// Unlike the initial device creation, this fails if any device can not be created
+// so that a bad configuration is not partially applied. On success, the loaded
+// configuration replaces the manager's current device configuration.
+func (manager *deviceManager) loadConfigDevices() ([]*Device, error) {
+	cfg := new(config.Devices)
+	if err := manager.readConfig(cfg); err != nil {
+		return nil, err
+	}
+
+	devices, err := manager.newDevicesFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	manager.config = cfg
+	return devices, nil
+}
+
+// newDevicesFromConfig creates the devices defined by the given device configuration,
+// without adding them to the manager. If any device can not be created, an error is
+// returned.
+func (manager *deviceManager) newDevicesFromConfig(cfg *config.Devices) ([]*Device, error) {
+	var devices []*Device
+	for _, proto := range cfg.Devices {
+		for _, instance := range proto.Instances {
+			device, err := newDeviceFromConfig(proto, instance, manager.handlers, manager.deviceResources())
+			if err != nil {
+				log.WithField("error", err).Error("[device manager] failed to create device from config")
+				return nil, err
+			}
+			devices = append(devices, device)
+		}
+	}
+	return devices, nil
+}
+
 // loadConfig is a helper function used to load device configurations into the
 // deviceManager.
 func (manager *deviceManager) loadConfig() error {
+	return manager.readConfig(manager.config)
+}
+
+// readConfig reads device configurations from file into the given config.
+func (manager *deviceManager) readConfig(cfg *config.Devices) error {
 	// Setup the config loader for the device manager.
 	loader := config.NewYamlLoader("device")
 	loader.EnvOverride = DeviceEnvOverride
@@ -554,13 +1029,20 @@ func (manager *deviceManager) loadConfig() error {
 		return err
 	}
 
-	return loader.Scan(manager.config)
+	return loader.Scan(cfg)
 }
 
 // execDeviceStartupActions runs all the device startup actions registered with
 // the manager. This should be done before any reads/write occur (e.g. before
 // the scheduler is started).
 func (manager *deviceManager) execDeviceSetupActions(plugin *Plugin) error {
+	return manager.execDeviceSetupActionsFor(plugin, manager.GetAllDevices())
+}
+
+// execDeviceSetupActionsFor runs the device setup actions registered with the
+// manager for the given devices. This is used to set up devices which are added
+// after the plugin has started.
+func (manager *deviceManager) execDeviceSetupActionsFor(plugin *Plugin, devices []*Device) error {
 	if len(manager.setupActions) == 0 {
 		return nil
 	}
@@ -572,7 +1054,7 @@ func (manager *deviceManager) execDeviceSetupActions(plugin *Plugin) error {
 	}).Info("[device manager] executing device setup actions")
 
 	for _, action := range manager.setupActions {
-		devices, err := manager.FilterDevices(action.Filter)
+		matches, err := filterDevices(devices, action.Filter)
 		if err != nil {
 			log.WithField("filter", action.Filter).Error(
 				"[device manager] failed to filter device for setup actions",
@@ -583,11 +1065,11 @@ func (manager *deviceManager) execDeviceSetupActions(plugin *Plugin) error {
 
 		log.WithFields(log.Fields{
 			"action":  action.Name,
-			"matches": len(devices),
+			"matches": len(matches),
 			"filter":  action.Filter,
 		}).Debug("[device manager] applied filter to devices")
 
-		for _, device := range devices {
+		for _, device := range matches {
 			if err := action.Action(plugin, device); err != nil {
 				log.WithFields(log.Fields{
 					"action": action.Name,
@@ -20,6 +20,7 @@ import (
 	"errors"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
@@ -52,18 +53,18 @@ func TestDeviceManager_Start(t *testing.T) {
 	assert.NoError(t, err)
 }
 
-func TestDeviceManager_loadDynamicConfig_noConfig(t *testing.T) {
+func TestDeviceManager_readDynamicConfig_noConfig(t *testing.T) {
 	m := deviceManager{
 		config:        &config.Devices{},
 		dynamicConfig: &config.DynamicRegistrationSettings{},
 	}
 
-	err := m.loadDynamicConfig()
+	configs, _, err := m.readDynamicConfig()
 	assert.NoError(t, err)
-	assert.Empty(t, m.config.Devices)
+	assert.Empty(t, configs)
 }
 
-func TestDeviceManager_loadDynamicConfig_ok(t *testing.T) {
+func TestDeviceManager_readDynamicConfig_ok(t *testing.T) {
 	m := deviceManager{
 		config: &config.Devices{},
 		dynamicConfig: &config.DynamicRegistrationSettings{
@@ -79,12 +80,14 @@ func TestDeviceManager_loadDynamicConfig_ok(t *testing.T) {
 		},
 	}
 
-	err := m.loadDynamicConfig()
+	configs, skipped, err := m.readDynamicConfig()
 	assert.NoError(t, err)
-	assert.Len(t, m.config.Devices, 2)
+	assert.Equal(t, 0, skipped)
+	assert.Len(t, configs, 1)
+	assert.Len(t, configs[registrarSource(sourceDynamicConfig, 0)].Devices, 2)
 }
 
-func TestDeviceManager_loadDynamicConfig_errUnknownPolicy(t *testing.T) {
+func TestDeviceManager_readDynamicConfig_errUnknownPolicy(t *testing.T) {
 	m := deviceManager{
 		config: &config.Devices{},
 		dynamicConfig: &config.DynamicRegistrationSettings{
@@ -100,12 +103,12 @@ func TestDeviceManager_loadDynamicConfig_errUnknownPolicy(t *testing.T) {
 		},
 	}
 
-	err := m.loadDynamicConfig()
+	configs, _, err := m.readDynamicConfig()
 	assert.Error(t, err)
-	assert.Empty(t, m.config.Devices)
+	assert.Empty(t, configs)
 }
 
-func TestDeviceManager_loadDynamicConfig_errOptionalPolicy(t *testing.T) {
+func TestDeviceManager_readDynamicConfig_errOptionalPolicy(t *testing.T) {
 	m := deviceManager{
 		config: &config.Devices{},
 		dynamicConfig: &config.DynamicRegistrationSettings{
@@ -121,12 +124,13 @@ func TestDeviceManager_loadDynamicConfig_errOptionalPolicy(t *testing.T) {
 		},
 	}
 
-	err := m.loadDynamicConfig()
+	configs, skipped, err := m.readDynamicConfig()
 	assert.NoError(t, err)
-	assert.Empty(t, m.config.Devices)
+	assert.Equal(t, 1, skipped)
+	assert.Empty(t, configs)
 }
 
-func TestDeviceManager_loadDynamicConfig_errRequiredPolicy(t *testing.T) {
+func TestDeviceManager_readDynamicConfig_errRequiredPolicy(t *testing.T) {
 	m := deviceManager{
 		config: &config.Devices{},
 		dynamicConfig: &config.DynamicRegistrationSettings{
@@ -142,9 +146,9 @@ func TestDeviceManager_loadDynamicConfig_errRequiredPolicy(t *testing.T) {
 		},
 	}
 
-	err := m.loadDynamicConfig()
+	configs, _, err := m.readDynamicConfig()
 	assert.Error(t, err)
-	assert.Empty(t, m.config.Devices)
+	assert.Empty(t, configs)
 }
 
 func TestDeviceManager_createDynamicDevices_noConfig(t *testing.T) {
@@ -186,6 +190,8 @@ func TestDeviceManager_createDynamicDevices_ok(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Len(t, m.devices, 1)
 	assert.Contains(t, m.devices, "12345")
+	assert.Equal(t, registrarSource(sourceDynamic, 0), m.sources["12345"])
+	assert.NotEmpty(t, m.devices["12345"].configDigest)
 }
 
 func TestDeviceManager_createDynamicDevices_errUnknownPolicy(t *testing.T) {
@@ -809,6 +815,313 @@ func TestDeviceManager_AddDevice_aliasExists(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestDeviceManager_removeDevice(t *testing.T) {
+	pluginid := &pluginID{uuid: uuid.NewSHA1(uuid.NameSpaceDNS, []byte("test"))}
+	m := deviceManager{
+		aliasCache:     NewAliasCache(),
+		tagCache:       NewTagCache(),
+		id:             pluginid,
+		pluginHandlers: NewDefaultPluginHandlers(),
+		handlers: map[string]*DeviceHandler{
+			"foo": {Name: "foo"},
+		},
+		devices: map[string]*Device{},
+		plugin: &Plugin{
+			id:             pluginid,
+			pluginHandlers: NewDefaultPluginHandlers(),
+		},
+	}
+	device := &Device{
+		Type:    "testtype",
+		Handler: "foo",
+		Tags: []*Tag{
+			{Namespace: "default", Label: "foo"},
+		},
+		Alias: "example-alias-1",
+	}
+	err := m.addDeviceFromSource(device, sourceConfig)
+	assert.NoError(t, err)
+	assert.Len(t, m.devices, 1)
+	assert.Len(t, m.sources, 1)
+
+	removed := m.removeDevice(device.id)
+	assert.Equal(t, device, removed)
+	assert.Empty(t, m.devices)
+	assert.Empty(t, m.sources)
+	assert.Empty(t, m.tagCache.cache)
+	assert.Nil(t, m.aliasCache.Get("example-alias-1"))
+	assert.True(t, removed.isRemoved())
+
+	// Removing a device which does not exist returns nil.
+	assert.Nil(t, m.removeDevice(device.id))
+}
+
+func TestDeviceManager_replaceDevice(t *testing.T) {
+	pluginid := &pluginID{uuid: uuid.NewSHA1(uuid.NameSpaceDNS, []byte("test"))}
+	m := deviceManager{
+		aliasCache:     NewAliasCache(),
+		tagCache:       NewTagCache(),
+		id:             pluginid,
+		pluginHandlers: NewDefaultPluginHandlers(),
+		handlers: map[string]*DeviceHandler{
+			"foo": {Name: "foo"},
+		},
+		devices: map[string]*Device{},
+		plugin: &Plugin{
+			id:             pluginid,
+			pluginHandlers: NewDefaultPluginHandlers(),
+		},
+	}
+	old := &Device{
+		Type:    "testtype",
+		Handler: "foo",
+		Data:    map[string]interface{}{"id": 1},
+		Alias:   "example-alias-1",
+	}
+	err := m.AddDevice(old)
+	assert.NoError(t, err)
+
+	// The new device may re-use the alias of the device it replaces.
+	device := &Device{
+		Type:    "testtype",
+		Handler: "foo",
+		Data:    map[string]interface{}{"id": 2},
+		Alias:   "example-alias-1",
+	}
+	replaced, err := m.replaceDevice(old.id, device)
+	assert.NoError(t, err)
+	assert.Equal(t, old, replaced)
+	assert.True(t, old.isRemoved())
+	assert.False(t, device.isRemoved())
+
+	assert.Len(t, m.devices, 1)
+	assert.Equal(t, device, m.GetDevice(device.id))
+	assert.Nil(t, m.GetDevice(old.id))
+	assert.Equal(t, device, m.aliasCache.Get("example-alias-1"))
+	assert.Equal(t, []*Device{device}, m.tagCache.GetDevicesFromNamespace("system"))
+}
+
+func TestDeviceManager_replaceDevice_keepsSource(t *testing.T) {
+	pluginid := &pluginID{uuid: uuid.NewSHA1(uuid.NameSpaceDNS, []byte("test"))}
+	m := deviceManager{
+		aliasCache:     NewAliasCache(),
+		tagCache:       NewTagCache(),
+		id:             pluginid,
+		pluginHandlers: NewDefaultPluginHandlers(),
+		handlers: map[string]*DeviceHandler{
+			"foo": {Name: "foo"},
+		},
+		devices: map[string]*Device{},
+		plugin: &Plugin{
+			id:             pluginid,
+			pluginHandlers: NewDefaultPluginHandlers(),
+		},
+	}
+	old := &Device{Type: "testtype", Handler: "foo", Data: map[string]interface{}{"id": 1}}
+	assert.NoError(t, m.addDeviceFromSource(old, sourceDynamic))
+
+	device := &Device{Type: "testtype", Handler: "foo", Data: map[string]interface{}{"id": 2}}
+	_, err := m.replaceDevice(old.id, device)
+	assert.NoError(t, err)
+
+	// The new device is reconciled against the old device's source, so it is
+	// retired once the source no longer has it.
+	assert.Equal(t, map[string]*Device{device.id: device}, m.getDevicesFromSource(sourceDynamic))
+
+	changes, err := m.reconcile(sourceDynamic, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []*Device{device}, changes.removed)
+	assert.Empty(t, m.devices)
+}
+
+func TestDeviceManager_replaceDevice_notFound(t *testing.T) {
+	pluginid := &pluginID{uuid: uuid.NewSHA1(uuid.NameSpaceDNS, []byte("test"))}
+	m := deviceManager{
+		aliasCache:     NewAliasCache(),
+		tagCache:       NewTagCache(),
+		id:             pluginid,
+		pluginHandlers: NewDefaultPluginHandlers(),
+		handlers: map[string]*DeviceHandler{
+			"foo": {Name: "foo"},
+		},
+		devices: map[string]*Device{},
+		plugin: &Plugin{
+			id:             pluginid,
+			pluginHandlers: NewDefaultPluginHandlers(),
+		},
+	}
+
+	replaced, err := m.replaceDevice("123", &Device{Type: "testtype", Handler: "foo"})
+	assert.Equal(t, ErrDeviceNotFound, err)
+	assert.Nil(t, replaced)
+	assert.Empty(t, m.devices)
+}
+
+func TestDeviceManager_replaceDevice_conflict(t *testing.T) {
+	pluginid := &pluginID{uuid: uuid.NewSHA1(uuid.NameSpaceDNS, []byte("test"))}
+	m := deviceManager{
+		aliasCache:     NewAliasCache(),
+		tagCache:       NewTagCache(),
+		id:             pluginid,
+		pluginHandlers: NewDefaultPluginHandlers(),
+		handlers: map[string]*DeviceHandler{
+			"foo": {Name: "foo"},
+		},
+		devices: map[string]*Device{},
+		plugin: &Plugin{
+			id:             pluginid,
+			pluginHandlers: NewDefaultPluginHandlers(),
+		},
+	}
+	old := &Device{Type: "testtype", Handler: "foo", Data: map[string]interface{}{"id": 1}}
+	other := &Device{Type: "testtype", Handler: "foo", Data: map[string]interface{}{"id": 2}, Alias: "other"}
+	assert.NoError(t, m.AddDevice(old))
+	assert.NoError(t, m.AddDevice(other))
+
+	// Replacement conflicts with the ID of another device.
+	replaced, err := m.replaceDevice(old.id, &Device{Type: "testtype", Handler: "foo", Data: map[string]interface{}{"id": 2}})
+	assert.Equal(t, ErrDeviceIDExists, err)
+	assert.Nil(t, replaced)
+
+	// Replacement conflicts with the alias of another device.
+	replaced, err = m.replaceDevice(old.id, &Device{Type: "testtype", Handler: "foo", Data: map[string]interface{}{"id": 3}, Alias: "other"})
+	assert.Error(t, err)
+	assert.Nil(t, replaced)
+
+	// The old device remains in place.
+	assert.Len(t, m.devices, 2)
+	assert.Equal(t, old, m.GetDevice(old.id))
+	assert.False(t, old.isRemoved())
+}
+
+func TestDeviceManager_reconcile(t *testing.T) {
+	pluginid := &pluginID{uuid: uuid.NewSHA1(uuid.NameSpaceDNS, []byte("test"))}
+	m := deviceManager{
+		aliasCache:     NewAliasCache(),
+		tagCache:       NewTagCache(),
+		id:             pluginid,
+		pluginHandlers: NewDefaultPluginHandlers(),
+		handlers: map[string]*DeviceHandler{
+			"foo": {Name: "foo"},
+		},
+		devices: map[string]*Device{},
+		plugin: &Plugin{
+			id:             pluginid,
+			pluginHandlers: NewDefaultPluginHandlers(),
+		},
+	}
+	newDevice := func(id int, digest string) *Device {
+		return &Device{
+			Type:         "foo",
+			Handler:      "foo",
+			Data:         map[string]interface{}{"id": id},
+			configDigest: digest,
+		}
+	}
+
+	// A device from another source should not be affected.
+	other := newDevice(0, "")
+	assert.NoError(t, m.AddDevice(other))
+
+	changes, err := m.reconcile(sourceConfig, []*Device{newDevice(1, "a"), newDevice(2, "b")})
+	assert.NoError(t, err)
+	assert.Len(t, changes.added, 2)
+	assert.Empty(t, changes.removed)
+	assert.Len(t, m.devices, 3)
+
+	changes, err = m.reconcile(sourceConfig, []*Device{newDevice(2, "b-updated"), newDevice(3, "c")})
+	assert.NoError(t, err)
+	assert.Len(t, changes.added, 2)
+	assert.Len(t, changes.removed, 2)
+	assert.Equal(t, 0, changes.unchanged)
+	assert.Len(t, m.devices, 3)
+	assert.Contains(t, m.devices, other.id)
+
+	changes, err = m.reconcile(sourceConfig, []*Device{newDevice(2, "b-updated"), newDevice(3, "c")})
+	assert.NoError(t, err)
+	assert.Empty(t, changes.added)
+	assert.Empty(t, changes.removed)
+	assert.Equal(t, 2, changes.unchanged)
+}
+
+func TestDeviceManager_reconcile_updateFails(t *testing.T) {
+	pluginid := &pluginID{uuid: uuid.NewSHA1(uuid.NameSpaceDNS, []byte("test"))}
+	m := deviceManager{
+		aliasCache:     NewAliasCache(),
+		tagCache:       NewTagCache(),
+		id:             pluginid,
+		pluginHandlers: NewDefaultPluginHandlers(),
+		handlers: map[string]*DeviceHandler{
+			"foo": {Name: "foo"},
+		},
+		devices: map[string]*Device{},
+		plugin: &Plugin{
+			id:             pluginid,
+			pluginHandlers: NewDefaultPluginHandlers(),
+		},
+	}
+	newDevice := func(id int, digest, alias string) *Device {
+		return &Device{
+			Type:         "foo",
+			Handler:      "foo",
+			Alias:        alias,
+			Data:         map[string]interface{}{"id": id},
+			configDigest: digest,
+		}
+	}
+
+	other := newDevice(0, "", "taken")
+	assert.NoError(t, m.AddDevice(other))
+
+	device := newDevice(1, "a", "")
+	changes, err := m.reconcile(sourceConfig, []*Device{device})
+	assert.NoError(t, err)
+	assert.Len(t, changes.added, 1)
+
+	// The update clashes with the other device's alias, so the current device
+	// is kept and no change is recorded for it.
+	changes, err = m.reconcile(sourceConfig, []*Device{newDevice(1, "a-updated", "taken")})
+	assert.Error(t, err)
+	assert.Empty(t, changes.added)
+	assert.Empty(t, changes.removed)
+	assert.Len(t, m.devices, 2)
+	assert.Equal(t, device, m.devices[device.id])
+	assert.False(t, device.isRemoved())
+	assert.Equal(t, other, m.aliasCache.Get("taken"))
+
+	// The device is still reconciled against its source.
+	changes, err = m.reconcile(sourceConfig, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []*Device{device}, changes.removed)
+}
+
+func TestDeviceManager_reconcile_duplicateID(t *testing.T) {
+	pluginid := &pluginID{uuid: uuid.NewSHA1(uuid.NameSpaceDNS, []byte("test"))}
+	m := deviceManager{
+		aliasCache:     NewAliasCache(),
+		tagCache:       NewTagCache(),
+		id:             pluginid,
+		pluginHandlers: NewDefaultPluginHandlers(),
+		handlers: map[string]*DeviceHandler{
+			"foo": {Name: "foo"},
+		},
+		devices: map[string]*Device{},
+		plugin: &Plugin{
+			id:             pluginid,
+			pluginHandlers: NewDefaultPluginHandlers(),
+		},
+	}
+	devices := []*Device{
+		{Type: "foo", Handler: "foo", Data: map[string]interface{}{"id": 1}},
+		{Type: "foo", Handler: "foo", Data: map[string]interface{}{"id": 1}},
+	}
+
+	changes, err := m.reconcile(sourceConfig, devices)
+	assert.Error(t, err)
+	assert.Len(t, changes.added, 1)
+	assert.Len(t, m.devices, 1)
+}
+
 func TestDeviceManager_AddDevice(t *testing.T) {
 	handler := DeviceHandler{Name: "foo"}
 	pluginid := &pluginID{uuid: uuid.NewSHA1(uuid.NameSpaceDNS, []byte("test"))}
@@ -994,6 +1307,69 @@ func TestDeviceManager_AddDeviceSetupActions_error(t *testing.T) {
 	assert.Empty(t, m.setupActions)
 }
 
+func TestDeviceManager_AddDevicePeriodicActions_ok(t *testing.T) {
+	m := deviceManager{}
+	assert.Empty(t, m.periodicActions)
+
+	err := m.AddDevicePeriodicActions(
+		&DeviceAction{
+			Name:     "foo",
+			Filter:   map[string][]string{"type": {"foo"}},
+			Interval: time.Minute,
+			Action: func(p *Plugin, d *Device) error {
+				return nil
+			},
+		},
+		&DeviceAction{
+			Name:     "bar",
+			Filter:   map[string][]string{"type": {"bar"}},
+			Schedule: "@hourly",
+			Action: func(p *Plugin, d *Device) error {
+				return nil
+			},
+		},
+	)
+
+	assert.NoError(t, err)
+	assert.Len(t, m.periodicActions, 2)
+	assert.Empty(t, m.setupActions)
+}
+
+func TestDeviceManager_AddDevicePeriodicActions_error(t *testing.T) {
+	cases := []struct {
+		name   string
+		action *DeviceAction
+	}{
+		{
+			name:   "no filter",
+			action: &DeviceAction{Name: "foo", Interval: time.Minute},
+		},
+		{
+			name:   "unsupported filter",
+			action: &DeviceAction{Name: "foo", Filter: map[string][]string{"bus": {"1"}}, Interval: time.Minute},
+		},
+		{
+			name:   "no interval or schedule",
+			action: &DeviceAction{Name: "foo", Filter: map[string][]string{"type": {"foo"}}},
+		},
+		{
+			name:   "interval and schedule",
+			action: &DeviceAction{Name: "foo", Filter: map[string][]string{"type": {"foo"}}, Interval: time.Minute, Schedule: "@hourly"},
+		},
+		{
+			name:   "invalid schedule",
+			action: &DeviceAction{Name: "foo", Filter: map[string][]string{"type": {"foo"}}, Schedule: "every minute"},
+		},
+	}
+
+	for _, c := range cases {
+		m := deviceManager{}
+		err := m.AddDevicePeriodicActions(c.action)
+		assert.Error(t, err, c.name)
+		assert.Empty(t, m.periodicActions, c.name)
+	}
+}
+
 func TestDeviceManager_FilterDevices_ok(t *testing.T) {
 	m := deviceManager{
 		devices: map[string]*Device{
@@ -1163,6 +1539,50 @@ func TestDeviceManager_createDevices_ok(t *testing.T) {
 	assert.Len(t, m.devices, 1)
 }
 
+func TestDeviceManager_createDynamicConfigDevices(t *testing.T) {
+	pluginid := &pluginID{uuid: uuid.NewSHA1(uuid.NameSpaceDNS, []byte("test"))}
+	m := deviceManager{
+		config: &config.Devices{
+			Devices: []*config.DeviceProto{{Type: "bar"}},
+		},
+		dynamicConfig: &config.DynamicRegistrationSettings{
+			Config: []map[string]interface{}{{}},
+		},
+		tagCache:       NewTagCache(),
+		aliasCache:     NewAliasCache(),
+		id:             pluginid,
+		pluginHandlers: NewDefaultPluginHandlers(),
+		handlers: map[string]*DeviceHandler{
+			"foo": {Name: "foo"},
+		},
+		devices: map[string]*Device{},
+		plugin: &Plugin{
+			id:             pluginid,
+			pluginHandlers: NewDefaultPluginHandlers(),
+		},
+	}
+	m.pluginHandlers.DynamicConfigRegistrar = func(i map[string]interface{}) ([]*config.DeviceProto, error) {
+		return []*config.DeviceProto{
+			{
+				Type:    "foo",
+				Handler: "foo",
+				Instances: []*config.DeviceInstance{
+					{Data: map[string]interface{}{"id": 1}},
+				},
+			},
+		}, nil
+	}
+
+	err := m.createDynamicConfigDevices()
+	assert.NoError(t, err)
+	assert.Len(t, m.devices, 1)
+	assert.Len(t, m.getDevicesFromSource(registrarSource(sourceDynamicConfig, 0)), 1)
+	assert.Empty(t, m.getDevicesFromSource(sourceConfig))
+
+	// The dynamic config is added to the manager's config.
+	assert.Len(t, m.config.Devices, 2)
+}
+
 func TestDeviceManager_loadConfig_noCfgOptional(t *testing.T) {
 	origLocal := localDeviceConfig
 	origDefault := defaultDeviceConfig
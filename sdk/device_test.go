@@ -17,6 +17,7 @@
 package sdk
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"testing"
@@ -57,6 +58,7 @@ func TestNewDeviceFromConfig_nil3(t *testing.T) {
 func TestNewDeviceFromConfig(t *testing.T) {
 	// Tests creating a device where inheritance is enabled, but the
 	// instance defines all inheritable things.
+	attempts := 3
 	proto := &config.DeviceProto{
 		Type: "type1",
 		Data: map[string]interface{}{
@@ -65,9 +67,15 @@ func TestNewDeviceFromConfig(t *testing.T) {
 		Context: map[string]string{
 			"foo": "bar",
 		},
-		Tags:         []string{"default/foo"},
-		Handler:      "testhandler",
-		WriteTimeout: 3 * time.Second,
+		Tags:            []string{"default/foo"},
+		Handler:         "testhandler",
+		WriteTimeout:    3 * time.Second,
+		ReadInterval:    10 * time.Second,
+		WriteRetry:      &config.DeviceRetrySettings{MaxAttempts: &attempts},
+		LockGroup:       "bus1",
+		Limiter:         &config.LimiterSettings{Rate: 5},
+		AdaptivePolling: &config.AdaptivePollingSettings{MaxInterval: time.Minute},
+		ReadTimeout:     2 * time.Second,
 	}
 	instance := &config.DeviceInstance{
 		Type: "type2",
@@ -90,11 +98,14 @@ func TestNewDeviceFromConfig(t *testing.T) {
 			{Apply: "FtoC"},
 		},
 		WriteTimeout:       5 * time.Second,
+		ReadInterval:       20 * time.Second,
+		LockGroup:          "bus2",
 		DisableInheritance: false,
 	}
 
 	device, err := NewDeviceFromConfig(proto, instance, testHandlers)
 	assert.NoError(t, err)
+	assert.Equal(t, 20*time.Second, device.ReadInterval)
 	assert.Equal(t, "type2", device.Type)
 	assert.Equal(t, "testdata", device.Info)
 	assert.Equal(t, 2, len(device.Tags))
@@ -107,6 +118,11 @@ func TestNewDeviceFromConfig(t *testing.T) {
 	assert.Equal(t, "scale [2]", device.Transforms[0].Name())
 	assert.Equal(t, "apply [FtoC]", device.Transforms[1].Name())
 	assert.Equal(t, 5*time.Second, device.WriteTimeout)
+	assert.Equal(t, &config.DeviceRetrySettings{MaxAttempts: &attempts}, device.WriteRetry)
+	assert.Equal(t, "bus2", device.LockGroup)
+	assert.Equal(t, &config.LimiterSettings{Rate: 5}, device.Limiter)
+	assert.Equal(t, &config.AdaptivePollingSettings{MaxInterval: time.Minute}, device.AdaptivePolling)
+	assert.Equal(t, 2*time.Second, device.ReadTimeout)
 	assert.Equal(t, "temperature", device.Output)
 }
 
@@ -124,6 +140,7 @@ func TestNewDeviceFromConfig2(t *testing.T) {
 		Tags:         []string{"default/foo"},
 		Handler:      "testhandler",
 		WriteTimeout: 3 * time.Second,
+		ReadInterval: 10 * time.Second,
 		Transforms: []*config.TransformConfig{
 			{Scale: "2"},
 			{Apply: "FtoC"},
@@ -154,6 +171,7 @@ func TestNewDeviceFromConfig2(t *testing.T) {
 	assert.Equal(t, int32(1), device.SortIndex)
 	assert.Equal(t, "foo", device.Alias)
 	assert.Equal(t, 3*time.Second, device.WriteTimeout)
+	assert.Equal(t, 10*time.Second, device.ReadInterval)
 	assert.Equal(t, "temperature", device.Output)
 	assert.Equal(t, 2, len(device.Transforms))
 	assert.Equal(t, "scale [2]", device.Transforms[0].Name())
@@ -240,6 +258,7 @@ func TestNewDeviceFromConfig5a(t *testing.T) {
 		Tags:         []string{"default/foo"},
 		Handler:      "testhandler",
 		WriteTimeout: 3 * time.Second,
+		ReadInterval: 10 * time.Second,
 		Transforms: []*config.TransformConfig{
 			{Scale: "2"},
 			{Apply: "FtoC"},
@@ -272,7 +291,8 @@ func TestNewDeviceFromConfig5a(t *testing.T) {
 	assert.Equal(t, "type2", device.Handler) // inheritance disabled, does not get proto handler
 	assert.Equal(t, int32(1), device.SortIndex)
 	assert.Equal(t, "foo", device.Alias)
-	assert.Equal(t, 30*time.Second, device.WriteTimeout) // takes the default value
+	assert.Equal(t, 30*time.Second, device.WriteTimeout)   // takes the default value
+	assert.Equal(t, time.Duration(0), device.ReadInterval) // inheritance disabled, uses the handler/global interval
 	assert.Equal(t, "", device.Output)
 	assert.Equal(t, 0, len(device.Transforms))
 }
@@ -756,6 +776,79 @@ func TestNewDeviceFromConfig14(t *testing.T) {
 	assert.Contains(t, err.Error(), "unknown handler specified")
 }
 
+func TestNewDeviceFromConfig_staleness(t *testing.T) {
+	proto := &config.DeviceProto{
+		Type:      "type1",
+		Handler:   "testhandler",
+		Staleness: &config.StalenessSettings{Multiple: 5},
+	}
+
+	// The instance inherits the prototype's staleness settings.
+	device, err := NewDeviceFromConfig(proto, &config.DeviceInstance{Info: "one"}, testHandlers)
+	assert.NoError(t, err)
+	assert.Equal(t, &config.StalenessSettings{Multiple: 5}, device.Staleness)
+
+	// The instance's staleness settings override the prototype's.
+	device, err = NewDeviceFromConfig(proto, &config.DeviceInstance{
+		Info:      "two",
+		Staleness: &config.StalenessSettings{Action: "drop"},
+	}, testHandlers)
+	assert.NoError(t, err)
+	assert.Equal(t, &config.StalenessSettings{Action: "drop"}, device.Staleness)
+}
+
+func TestNewDeviceFromConfig_stalenessInvalidAction(t *testing.T) {
+	proto := &config.DeviceProto{
+		Type:    "type1",
+		Handler: "testhandler",
+	}
+	instance := &config.DeviceInstance{
+		Info:      "testdata",
+		Staleness: &config.StalenessSettings{Action: "ignore"},
+	}
+
+	device, err := NewDeviceFromConfig(proto, instance, testHandlers)
+	assert.Nil(t, device)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown staleness action specified")
+}
+
+func TestNewDeviceFromConfig_deadband(t *testing.T) {
+	proto := &config.DeviceProto{
+		Type:     "type1",
+		Handler:  "testhandler",
+		Deadband: &config.DeadbandSettings{Percent: 5, MaxSilence: time.Minute},
+	}
+
+	device, err := NewDeviceFromConfig(proto, &config.DeviceInstance{Info: "one"}, testHandlers)
+	assert.NoError(t, err)
+	assert.Equal(t, &config.DeadbandSettings{Percent: 5, MaxSilence: time.Minute}, device.Deadband)
+
+	// Instances which disable inheritance have no deadband.
+	device, err = NewDeviceFromConfig(proto, &config.DeviceInstance{Info: "two", DisableInheritance: true, Type: "type1", Handler: "testhandler"}, testHandlers)
+	assert.NoError(t, err)
+	assert.Nil(t, device.Deadband)
+}
+
+func TestNewDeviceFromConfig_deadbandInvalid(t *testing.T) {
+	for _, deadband := range []*config.DeadbandSettings{
+		{Absolute: -1},
+		{Percent: -1},
+		{Absolute: 1, Percent: 1},
+	} {
+		proto := &config.DeviceProto{
+			Type:     "type1",
+			Handler:  "testhandler",
+			Deadband: deadband,
+		}
+
+		device, err := NewDeviceFromConfig(proto, &config.DeviceInstance{Info: "testdata"}, testHandlers)
+		assert.Nil(t, device)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "deadband")
+	}
+}
+
 func TestNewDeviceFromConfig15(t *testing.T) {
 	// Tests creating a device with tags and context including templates
 	proto := &config.DeviceProto{
@@ -829,7 +922,7 @@ func TestNewDeviceFromConfig15(t *testing.T) {
 func TestDevice_setAlias_noConf(t *testing.T) {
 	device := Device{}
 
-	err := device.setAlias(nil)
+	err := device.setAlias(nil, &metadata)
 	assert.NoError(t, err)
 	assert.Equal(t, "", device.Alias)
 }
@@ -837,7 +930,7 @@ func TestDevice_setAlias_noConf(t *testing.T) {
 func TestDevice_setAlias_emptyConf(t *testing.T) {
 	device := Device{}
 
-	err := device.setAlias(&config.DeviceAlias{})
+	err := device.setAlias(&config.DeviceAlias{}, &metadata)
 	assert.NoError(t, err)
 	assert.Equal(t, "", device.Alias)
 }
@@ -847,7 +940,7 @@ func TestDevice_setAlias_hasName(t *testing.T) {
 
 	err := device.setAlias(&config.DeviceAlias{
 		Name: "foo",
-	})
+	}, &metadata)
 	assert.NoError(t, err)
 	assert.Equal(t, "foo", device.Alias)
 }
@@ -857,7 +950,7 @@ func TestDevice_setAlias_hasBadTemplate(t *testing.T) {
 
 	err := device.setAlias(&config.DeviceAlias{
 		Template: "{{{{",
-	})
+	}, &metadata)
 	assert.Error(t, err)
 	assert.Equal(t, "", device.Alias)
 }
@@ -867,7 +960,7 @@ func TestDevice_setAlias_templateExecuteError(t *testing.T) {
 
 	err := device.setAlias(&config.DeviceAlias{
 		Template: "{{.NotAField}}",
-	})
+	}, &metadata)
 	assert.Error(t, err)
 	assert.Equal(t, "", device.Alias)
 }
@@ -879,11 +972,21 @@ func TestDevice_setAlias_templateOk(t *testing.T) {
 
 	err := device.setAlias(&config.DeviceAlias{
 		Template: "{{.Device.Type}}",
-	})
+	}, &metadata)
 	assert.NoError(t, err)
 	assert.Equal(t, "testtype", device.Alias)
 }
 
+func TestDevice_setAlias_templateMeta(t *testing.T) {
+	device := Device{}
+
+	err := device.setAlias(&config.DeviceAlias{
+		Template: "{{.Meta.Name}}-alias",
+	}, &PluginMetadata{Name: "embedded"})
+	assert.NoError(t, err)
+	assert.Equal(t, "embedded-alias", device.Alias)
+}
+
 func TestDevice_GetContext(t *testing.T) {
 	device := Device{
 		Context: map[string]string{
@@ -897,6 +1000,26 @@ func TestDevice_GetContext(t *testing.T) {
 	assert.Equal(t, "xyz", device.GetContext("abc"))
 }
 
+func TestNewDeviceDigest(t *testing.T) {
+	device := func() *Device {
+		return &Device{
+			Type:    "foo",
+			Handler: "foo",
+			Info:    "info",
+			Data:    map[string]interface{}{"id": 1},
+			Tags:    []*Tag{{Namespace: "default", Label: "foo"}},
+		}
+	}
+
+	digest := newDeviceDigest(device())
+	assert.NotEmpty(t, digest)
+	assert.Equal(t, digest, newDeviceDigest(device()))
+
+	changed := device()
+	changed.Data["id"] = 2
+	assert.NotEqual(t, digest, newDeviceDigest(changed))
+}
+
 func TestDevice_GetHandler(t *testing.T) {
 	device := Device{}
 	assert.Nil(t, device.GetHandler())
@@ -1039,6 +1162,40 @@ func TestDevice_Write_err(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestDevice_WriteContext_ok(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	device := Device{
+		handler: &DeviceHandler{
+			WriteContext: func(c context.Context, device *Device, data *WriteData) error {
+				assert.Equal(t, ctx, c)
+				return nil
+			},
+			// WriteContext takes precedence over Write.
+			Write: func(device *Device, data *WriteData) error {
+				return fmt.Errorf("test error")
+			},
+		},
+	}
+
+	err := device.WriteContext(ctx, &WriteData{})
+	assert.NoError(t, err)
+}
+
+func TestDevice_WriteContext_err(t *testing.T) {
+	device := Device{
+		handler: &DeviceHandler{
+			WriteContext: func(ctx context.Context, device *Device, data *WriteData) error {
+				return fmt.Errorf("test error")
+			},
+		},
+	}
+
+	err := device.Write(&WriteData{})
+	assert.Error(t, err)
+}
+
 func TestDevice_IsReadable_trueReadHandler(t *testing.T) {
 	device := Device{
 		handler: &DeviceHandler{
@@ -1296,3 +1453,76 @@ func TestDevice_parseContextError(t *testing.T) {
 	err := parseContext(ctx)
 	assert.Error(t, err)
 }
+
+func TestDevice_encode_circuitBreaker(t *testing.T) {
+	device := Device{
+		Type:    "foo",
+		Context: map[string]string{"abc": "123"},
+		id:      "1234",
+		handler: &DeviceHandler{Name: "vapor"},
+	}
+	device.breaker.Store(newCircuitBreaker("1234", "vapor", config.CircuitBreakerSettings{Threshold: 1}, nil))
+
+	encoded := device.encode()
+	assert.Equal(t, map[string]string{"abc": "123", "synse.circuit_breaker": "closed"}, encoded.Metadata)
+
+	// The device context is not modified.
+	assert.Equal(t, map[string]string{"abc": "123"}, device.Context)
+}
+
+func TestDevice_encode_stats(t *testing.T) {
+	device := Device{
+		Type:    "foo",
+		Context: map[string]string{"abc": "123"},
+		id:      "1234",
+		handler: &DeviceHandler{Name: "vapor"},
+	}
+	device.readStats.record(time.Now(), fmt.Errorf("test error"))
+
+	encoded := device.encode()
+	assert.Equal(t, "123", encoded.Metadata["abc"])
+	assert.Equal(t, "test error", encoded.Metadata["synse.read_last_error"])
+	assert.Equal(t, "1", encoded.Metadata["synse.read_consecutive_failures"])
+	assert.NotContains(t, encoded.Metadata, "synse.read_last_success")
+	assert.NotContains(t, encoded.Metadata, "synse.write_attempts")
+}
+
+func TestDevice_encode_contextNotOverwritten(t *testing.T) {
+	device := Device{
+		Type: "foo",
+		Context: map[string]string{
+			"read_attempts":         "context",
+			"synse.read_last_error": "context",
+			"synse.circuit_breaker": "context",
+		},
+		id:      "1234",
+		handler: &DeviceHandler{Name: "vapor"},
+	}
+	device.breaker.Store(newCircuitBreaker("1234", "vapor", config.CircuitBreakerSettings{Threshold: 1}, nil))
+	device.readStats.record(time.Now(), fmt.Errorf("test error"))
+
+	// The device context is kept as-is, even where its keys collide with the
+	// SDK's metadata keys.
+	encoded := device.encode()
+	assert.Equal(t, "context", encoded.Metadata["read_attempts"])
+	assert.Equal(t, "context", encoded.Metadata["synse.read_last_error"])
+	assert.Equal(t, "context", encoded.Metadata["synse.circuit_breaker"])
+	assert.Equal(t, "1", encoded.Metadata["synse.read_attempts"])
+}
+
+func TestDevice_encode_readInterval(t *testing.T) {
+	device := Device{
+		Type:    "foo",
+		id:      "1234",
+		handler: &DeviceHandler{Name: "vapor"},
+	}
+	device.poller.start(5 * time.Second)
+
+	// The read interval is only included for devices which are polled adaptively.
+	encoded := device.encode()
+	assert.Nil(t, encoded.Metadata)
+
+	device.AdaptivePolling = &config.AdaptivePollingSettings{MaxInterval: time.Minute}
+	encoded = device.encode()
+	assert.Equal(t, map[string]string{"synse.read_interval": "5s"}, encoded.Metadata)
+}
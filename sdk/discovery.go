@@ -0,0 +1,239 @@
+// Synse SDK
+// Copyright (c) 2017-2020 Vapor IO
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package sdk
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/vapor-ware/synse-sdk/sdk/config"
+	sdkError "github.com/vapor-ware/synse-sdk/sdk/errors"
+	"github.com/vapor-ware/synse-sdk/sdk/health"
+)
+
+// deviceDiscoverer is the plugin component which periodically re-runs dynamic
+// device registration while the plugin is running, so that devices which appear
+// after startup are registered and devices which disappear are retired.
+//
+// Both the DynamicDeviceConfigRegistrar and the DynamicDeviceRegistrar are re-run,
+// and the devices they produce are reconciled against the devices they previously
+// produced by deterministic device ID.
+type deviceDiscoverer struct {
+	plugin *Plugin
+	config *config.DynamicRegistrationSettings
+
+	// check is the health check which reports the result of the most
+	// recent discovery.
+	check *health.ReportedHealthCheck
+
+	// stop is a channel used to signal that the discoverer should stop.
+	stop     chan struct{}
+	stopOnce sync.Once
+
+	// lock ensures that only one discovery happens at a time.
+	lock sync.Mutex
+}
+
+// newDeviceDiscoverer creates a new instance of the plugin's device discoverer.
+func newDeviceDiscoverer(plugin *Plugin) *deviceDiscoverer {
+	conf := plugin.config.DynamicRegistration
+	if conf == nil {
+		conf = &config.DynamicRegistrationSettings{}
+	}
+
+	return &deviceDiscoverer{
+		plugin: plugin,
+		config: conf,
+		check:  health.NewReportedHealthCheck("dynamic device registration"),
+		stop:   make(chan struct{}),
+	}
+}
+
+// enabled checks whether periodic dynamic registration is enabled.
+func (discoverer *deviceDiscoverer) enabled() bool {
+	return discoverer.config.Interval > 0 && len(discoverer.config.Config) > 0
+}
+
+// registerActions registers pre-run (setup) and post-run (teardown) actions
+// for the device discoverer.
+func (discoverer *deviceDiscoverer) registerActions(plugin *Plugin) {
+	// Register pre-run actions.
+	plugin.RegisterPreRunActions(
+		&PluginAction{
+			Name: "Register default device discoverer health checks",
+			Action: func(p *Plugin) error {
+				if discoverer.enabled() {
+					p.health.RegisterDefault(discoverer.check)
+				}
+				return nil
+			},
+		},
+	)
+
+	// Register post-run actions.
+	plugin.RegisterPostRunActions(
+		&PluginAction{
+			Name:   "Stop device discoverer",
+			Action: func(p *Plugin) error { discoverer.Stop(); return nil },
+		},
+	)
+}
+
+// Start starts the device discoverer. If periodic dynamic registration is not
+// enabled, this does nothing.
+func (discoverer *deviceDiscoverer) Start() {
+	if !discoverer.enabled() {
+		log.Debug("[discovery] periodic dynamic registration is not enabled")
+		return
+	}
+
+	log.WithField("interval", discoverer.config.Interval).Info("[discovery] starting")
+	go discoverer.run()
+}
+
+// Stop stops the device discoverer. It is safe to call Stop more than once.
+func (discoverer *deviceDiscoverer) Stop() {
+	discoverer.stopOnce.Do(func() {
+		log.Info("[discovery] stopping")
+		close(discoverer.stop)
+	})
+}
+
+// run re-runs dynamic registration at the configured interval until the
+// discoverer is stopped.
+func (discoverer *deviceDiscoverer) run() {
+	ticker := time.NewTicker(discoverer.config.Interval)
+	defer ticker.Stop()
+
+	// Discovery errors are logged and reported via the health check, so they
+	// do not need to be handled here.
+	for {
+		select {
+		case <-discoverer.stop:
+			log.Info("[discovery] stop channel closed, terminating discoverer")
+			return
+
+		case <-ticker.C:
+			_, _ = discoverer.discover()
+		}
+	}
+}
+
+// discover re-runs dynamic device registration and reconciles the plugin's
+// dynamically registered devices against the results.
+//
+// The devices produced for each dynamic registration config are reconciled
+// separately. Registrar failures are governed by the DynamicDeviceConfig policy.
+// If a registrar fails and the policy is required, discovery fails. If the policy
+// is optional, the failure is skipped, but since the devices that registrar would
+// have produced for the failed config are unknown, the devices from that config
+// are left unchanged (rather than retired) until registration next succeeds. The
+// devices from the other configs are reconciled as normal. The result of discovery
+// is logged and reported via the discoverer's health check.
+func (discoverer *deviceDiscoverer) discover() (*DeviceReloadResult, error) {
+	discoverer.lock.Lock()
+	defer discoverer.lock.Unlock()
+
+	log.Debug("[discovery] re-running dynamic device registration")
+
+	manager := discoverer.plugin.device
+	multiErr := sdkError.NewMultiError("dynamic device registration")
+	changes := &deviceChanges{}
+
+	var skipped int
+
+	// Devices created from dynamically registered device config. Configs which
+	// failed to register have no entry, so their devices are left unchanged.
+	configs, n, err := manager.readDynamicConfig()
+	skipped += n
+	if err != nil {
+		multiErr.Add(err)
+	} else {
+		for _, source := range manager.registrarSources(sourceDynamicConfig) {
+			cfg, ok := configs[source]
+			if !ok {
+				continue
+			}
+			devices, err := manager.newDevicesFromConfig(cfg)
+			if err != nil {
+				multiErr.Add(err)
+				continue
+			}
+			c, err := manager.reconcile(source, devices)
+			changes.merge(c)
+			if err != nil {
+				multiErr.Add(err)
+			}
+		}
+	}
+
+	// Devices created by the dynamic registrar.
+	registered, n, err := manager.runDynamicRegistrar()
+	skipped += n
+	if err != nil {
+		multiErr.Add(err)
+	} else {
+		for _, source := range manager.registrarSources(sourceDynamic) {
+			devices, ok := registered[source]
+			if !ok {
+				continue
+			}
+			c, err := manager.reconcile(source, devices)
+			changes.merge(c)
+			if err != nil {
+				multiErr.Add(err)
+			}
+		}
+	}
+
+	discoverer.plugin.detachDevices(changes.removed...)
+	discoverer.plugin.attachDevices(changes.added...)
+
+	// Run device setup actions for any new devices.
+	if err := manager.execDeviceSetupActionsFor(discoverer.plugin, changes.added); err != nil {
+		log.WithField("error", err).Error("[discovery] failed to run setup actions for discovered devices")
+		multiErr.Add(err)
+	}
+
+	result := newDeviceReloadResult(changes)
+	dlog := log.WithFields(log.Fields{
+		"added":     result.Added,
+		"updated":   result.Updated,
+		"removed":   result.Removed,
+		"unchanged": result.Unchanged,
+		"skipped":   skipped,
+	})
+	if err := multiErr.Err(); err != nil {
+		dlog.WithField("error", err).Error("[discovery] dynamic device registration completed with errors")
+		discoverer.check.Report("", fmt.Errorf("dynamic device registration completed with errors (%s): %v", result, err))
+		return result, err
+	}
+
+	msg := fmt.Sprintf("dynamic device registration completed (%s)", result)
+	if skipped > 0 {
+		msg = fmt.Sprintf("%s; %d optional registration(s) failed, kept existing devices", msg, skipped)
+	}
+	if len(result.Added) > 0 || len(result.Updated) > 0 || len(result.Removed) > 0 {
+		dlog.Info("[discovery] dynamic device registration completed")
+	} else {
+		dlog.Debug("[discovery] dynamic device registration completed")
+	}
+	discoverer.check.Report(msg, nil)
+	return result, nil
+}
@@ -0,0 +1,301 @@
+// Synse SDK
+// Copyright (c) 2017-2020 Vapor IO
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package sdk
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/vapor-ware/synse-sdk/sdk/config"
+	"github.com/vapor-ware/synse-sdk/sdk/output"
+	"github.com/vapor-ware/synse-sdk/sdk/policy"
+)
+
+// newDiscoveryTestPlugin creates a plugin with periodic dynamic registration
+// configured, using the given plugin handlers and dynamic device config policy.
+func newDiscoveryTestPlugin(handlers *PluginHandlers, p policy.Policy) *Plugin {
+	pluginid := &pluginID{uuid: uuid.NewSHA1(uuid.NameSpaceDNS, []byte("test"))}
+	dynamicConfig := &config.DynamicRegistrationSettings{
+		Config:   []map[string]interface{}{{"address": "localhost"}},
+		Interval: 1 * time.Minute,
+	}
+
+	plugin := &Plugin{
+		id:             pluginid,
+		info:           &PluginMetadata{Name: "test"},
+		pluginHandlers: handlers,
+		policies: &policy.Policies{
+			DynamicDeviceConfig: p,
+		},
+		config: &config.Plugin{
+			DynamicRegistration: dynamicConfig,
+		},
+	}
+	plugin.device = &deviceManager{
+		config:         new(config.Devices),
+		id:             pluginid,
+		pluginHandlers: handlers,
+		policies:       plugin.policies,
+		dynamicConfig:  dynamicConfig,
+		tagCache:       NewTagCache(),
+		aliasCache:     NewAliasCache(),
+		devices:        map[string]*Device{},
+		handlers: map[string]*DeviceHandler{
+			"foo": {Name: "foo"},
+		},
+		plugin: plugin,
+	}
+	plugin.state = &stateManager{
+		readings:     map[string][]*output.Reading{},
+		readingsLock: &sync.RWMutex{},
+	}
+	plugin.discoverer = newDeviceDiscoverer(plugin)
+	return plugin
+}
+
+// registrarDevices creates devices for the "foo" handler with the given data IDs.
+func registrarDevices(ids ...int) []*Device {
+	var devices []*Device
+	for _, id := range ids {
+		devices = append(devices, &Device{
+			Type:    "foo",
+			Handler: "foo",
+			Data:    map[string]interface{}{"id": id},
+		})
+	}
+	return devices
+}
+
+func TestDeviceDiscoverer_enabled(t *testing.T) {
+	cases := []struct {
+		conf     *config.DynamicRegistrationSettings
+		expected bool
+	}{
+		{conf: &config.DynamicRegistrationSettings{}, expected: false},
+		{conf: &config.DynamicRegistrationSettings{Interval: time.Second}, expected: false},
+		{conf: &config.DynamicRegistrationSettings{Config: []map[string]interface{}{{}}}, expected: false},
+		{conf: &config.DynamicRegistrationSettings{Config: []map[string]interface{}{{}}, Interval: time.Second}, expected: true},
+	}
+
+	for _, c := range cases {
+		d := deviceDiscoverer{config: c.conf}
+		assert.Equal(t, c.expected, d.enabled())
+	}
+}
+
+func TestDeviceDiscoverer_discover(t *testing.T) {
+	var ids []int
+	handlers := NewDefaultPluginHandlers()
+	handlers.DynamicRegistrar = func(map[string]interface{}) ([]*Device, error) {
+		return registrarDevices(ids...), nil
+	}
+	p := newDiscoveryTestPlugin(handlers, policy.Optional)
+
+	// A device which was not dynamically registered should not be affected.
+	other := &Device{Type: "foo", Handler: "foo", Data: map[string]interface{}{"id": 100}}
+	assert.NoError(t, p.AddDevice(other))
+
+	// Initial registration.
+	ids = []int{1, 2}
+	result, err := p.discoverer.discover()
+	assert.NoError(t, err)
+	assert.Len(t, result.Added, 2)
+	assert.Empty(t, result.Removed)
+	assert.Len(t, p.device.devices, 3)
+
+	status := p.discoverer.check.Status()
+	assert.True(t, status.Ok)
+	assert.Contains(t, status.Message, "added: 2")
+
+	// Re-registration with the same devices changes nothing.
+	result, err = p.discoverer.discover()
+	assert.NoError(t, err)
+	assert.Empty(t, result.Added)
+	assert.Empty(t, result.Removed)
+	assert.Equal(t, 2, result.Unchanged)
+
+	// A device appears and a device vanishes.
+	removed := p.device.getDevicesFromSource(registrarSource(sourceDynamic, 0))
+	ids = []int{2, 3}
+	result, err = p.discoverer.discover()
+	assert.NoError(t, err)
+	assert.Len(t, result.Added, 1)
+	assert.Len(t, result.Removed, 1)
+	assert.Equal(t, 1, result.Unchanged)
+	assert.Len(t, p.device.devices, 3)
+	assert.Contains(t, p.device.devices, other.id)
+
+	for _, d := range removed {
+		if _, exists := p.device.devices[d.id]; !exists {
+			assert.True(t, d.isRemoved())
+		}
+	}
+}
+
+func TestDeviceDiscoverer_discover_dynamicConfig(t *testing.T) {
+	var ids []int
+	handlers := NewDefaultPluginHandlers()
+	handlers.DynamicConfigRegistrar = func(map[string]interface{}) ([]*config.DeviceProto, error) {
+		proto := &config.DeviceProto{Type: "foo", Handler: "foo"}
+		for _, id := range ids {
+			proto.Instances = append(proto.Instances, &config.DeviceInstance{
+				Data: map[string]interface{}{"id": id},
+			})
+		}
+		return []*config.DeviceProto{proto}, nil
+	}
+	p := newDiscoveryTestPlugin(handlers, policy.Optional)
+
+	ids = []int{1, 2}
+	result, err := p.discoverer.discover()
+	assert.NoError(t, err)
+	assert.Len(t, result.Added, 2)
+	assert.Len(t, p.device.getDevicesFromSource(registrarSource(sourceDynamicConfig, 0)), 2)
+
+	ids = []int{1}
+	result, err = p.discoverer.discover()
+	assert.NoError(t, err)
+	assert.Empty(t, result.Added)
+	assert.Len(t, result.Removed, 1)
+	assert.Equal(t, 1, result.Unchanged)
+	assert.Len(t, p.device.devices, 1)
+}
+
+func TestDeviceDiscoverer_discover_optionalFailure(t *testing.T) {
+	var fail bool
+	handlers := NewDefaultPluginHandlers()
+	handlers.DynamicRegistrar = func(map[string]interface{}) ([]*Device, error) {
+		if fail {
+			return nil, errors.New("test error")
+		}
+		return registrarDevices(1, 2), nil
+	}
+	p := newDiscoveryTestPlugin(handlers, policy.Optional)
+
+	_, err := p.discoverer.discover()
+	assert.NoError(t, err)
+	assert.Len(t, p.device.devices, 2)
+
+	// The registrar failing does not retire its devices.
+	fail = true
+	result, err := p.discoverer.discover()
+	assert.NoError(t, err)
+	assert.Empty(t, result.Removed)
+	assert.Len(t, p.device.devices, 2)
+
+	status := p.discoverer.check.Status()
+	assert.True(t, status.Ok)
+	assert.Contains(t, status.Message, "1 optional registration(s) failed")
+}
+
+func TestDeviceDiscoverer_discover_optionalFailurePartial(t *testing.T) {
+	var fail bool
+	ids := []int{2, 3}
+	handlers := NewDefaultPluginHandlers()
+	handlers.DynamicRegistrar = func(cfg map[string]interface{}) ([]*Device, error) {
+		if cfg["address"] == "localhost" {
+			if fail {
+				return nil, errors.New("test error")
+			}
+			return registrarDevices(1), nil
+		}
+		return registrarDevices(ids...), nil
+	}
+	p := newDiscoveryTestPlugin(handlers, policy.Optional)
+	p.device.dynamicConfig.Config = append(p.device.dynamicConfig.Config, map[string]interface{}{"address": "remote"})
+
+	_, err := p.discoverer.discover()
+	assert.NoError(t, err)
+	assert.Len(t, p.device.devices, 3)
+	assert.Len(t, p.device.getDevicesFromSource(registrarSource(sourceDynamic, 0)), 1)
+	assert.Len(t, p.device.getDevicesFromSource(registrarSource(sourceDynamic, 1)), 2)
+
+	// The failing registrar config's devices are kept, while the devices from
+	// the other config are still reconciled.
+	fail = true
+	ids = []int{3, 4}
+	result, err := p.discoverer.discover()
+	assert.NoError(t, err)
+	assert.Len(t, result.Added, 1)
+	assert.Len(t, result.Removed, 1)
+	assert.Equal(t, 1, result.Unchanged)
+	assert.Len(t, p.device.devices, 3)
+	assert.Len(t, p.device.getDevicesFromSource(registrarSource(sourceDynamic, 0)), 1)
+
+	status := p.discoverer.check.Status()
+	assert.True(t, status.Ok)
+	assert.Contains(t, status.Message, "1 optional registration(s) failed")
+}
+
+func TestDeviceDiscoverer_discover_requiredFailure(t *testing.T) {
+	var fail bool
+	handlers := NewDefaultPluginHandlers()
+	handlers.DynamicRegistrar = func(map[string]interface{}) ([]*Device, error) {
+		if fail {
+			return nil, errors.New("test error")
+		}
+		return registrarDevices(1, 2), nil
+	}
+	p := newDiscoveryTestPlugin(handlers, policy.Required)
+
+	_, err := p.discoverer.discover()
+	assert.NoError(t, err)
+	assert.Len(t, p.device.devices, 2)
+
+	fail = true
+	result, err := p.discoverer.discover()
+	assert.Error(t, err)
+	assert.Empty(t, result.Removed)
+	assert.Len(t, p.device.devices, 2)
+
+	status := p.discoverer.check.Status()
+	assert.False(t, status.Ok)
+	assert.Contains(t, status.Message, "test error")
+}
+
+func TestDeviceDiscoverer_discover_updated(t *testing.T) {
+	info := "first"
+	handlers := NewDefaultPluginHandlers()
+	handlers.DynamicRegistrar = func(map[string]interface{}) ([]*Device, error) {
+		devices := registrarDevices(1)
+		devices[0].Info = info
+		return devices, nil
+	}
+	p := newDiscoveryTestPlugin(handlers, policy.Optional)
+
+	_, err := p.discoverer.discover()
+	assert.NoError(t, err)
+
+	info = "second"
+	result, err := p.discoverer.discover()
+	assert.NoError(t, err)
+	assert.Len(t, result.Updated, 1)
+	assert.Equal(t, "second", p.device.GetDevice(result.Updated[0]).Info)
+}
+
+func TestDeviceDiscoverer_Stop_twice(t *testing.T) {
+	p := newDiscoveryTestPlugin(NewDefaultPluginHandlers(), policy.Optional)
+
+	assert.NotPanics(t, func() {
+		p.discoverer.Stop()
+		p.discoverer.Stop()
+	})
+}
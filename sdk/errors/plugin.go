@@ -17,6 +17,8 @@
 package errors
 
 import (
+	"errors"
+
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -40,3 +42,66 @@ func InvalidArgumentErr(format string, a ...interface{}) error {
 func NotFoundErr(format string, a ...interface{}) error {
 	return status.Errorf(codes.NotFound, format, a...)
 }
+
+// ResourceExhaustedErr creates a gRPC ResourceExhausted error with the given description.
+func ResourceExhaustedErr(format string, a ...interface{}) error {
+	return status.Errorf(codes.ResourceExhausted, format, a...)
+}
+
+// RetryableError marks an error returned by a device write handler as transient,
+// so the write is retried according to the plugin's write retry policy.
+type RetryableError struct {
+	Err error
+}
+
+func (e *RetryableError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *RetryableError) Unwrap() error {
+	return e.Err
+}
+
+// FatalError marks an error returned by a device write handler as permanent,
+// so the write is not retried, regardless of the plugin's write retry policy.
+type FatalError struct {
+	Err error
+}
+
+func (e *FatalError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *FatalError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable marks the given error as retryable. If the error is nil, nil is returned.
+func Retryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &RetryableError{Err: err}
+}
+
+// Fatal marks the given error as fatal. If the error is nil, nil is returned.
+func Fatal(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &FatalError{Err: err}
+}
+
+// IsRetryable checks whether the error, or any error it wraps, was marked as retryable.
+func IsRetryable(err error) bool {
+	var e *RetryableError
+	return errors.As(err, &e)
+}
+
+// IsFatal checks whether the error, or any error it wraps, was marked as fatal.
+func IsFatal(err error) bool {
+	var e *FatalError
+	return errors.As(err, &e)
+}
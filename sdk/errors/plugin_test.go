@@ -17,6 +17,7 @@
 package errors
 
 import (
+	"fmt"
 	"strings"
 	"testing"
 
@@ -41,6 +42,15 @@ func TestNotFoundErr(t *testing.T) {
 	assert.True(t, strings.Contains(err.Error(), errString))
 }
 
+// TestResourceExhaustedErr tests constructing a new ResourceExhausted error.
+func TestResourceExhaustedErr(t *testing.T) {
+	errString := "test error"
+	err := ResourceExhaustedErr(errString)
+
+	assert.True(t, strings.Contains(err.Error(), "ResourceExhausted"))
+	assert.True(t, strings.Contains(err.Error(), errString))
+}
+
 // TestUnsupportedCommandErrorErr tests constructing and stringify-ing
 // an UnsupportedCommandError error.
 func TestUnsupportedCommandErrorErr(t *testing.T) {
@@ -53,3 +63,28 @@ func TestUnsupportedCommandErrorErr(t *testing.T) {
 		err.Error(),
 	)
 }
+
+func TestRetryable(t *testing.T) {
+	err := Retryable(fmt.Errorf("test error"))
+	assert.Equal(t, "test error", err.Error())
+	assert.True(t, IsRetryable(err))
+	assert.False(t, IsFatal(err))
+
+	// Marked errors can be wrapped further.
+	assert.True(t, IsRetryable(fmt.Errorf("wrapped: %w", err)))
+}
+
+func TestRetryable_nil(t *testing.T) {
+	assert.NoError(t, Retryable(nil))
+}
+
+func TestFatal(t *testing.T) {
+	err := Fatal(fmt.Errorf("test error"))
+	assert.Equal(t, "test error", err.Error())
+	assert.True(t, IsFatal(err))
+	assert.False(t, IsRetryable(err))
+}
+
+func TestFatal_nil(t *testing.T) {
+	assert.NoError(t, Fatal(nil))
+}
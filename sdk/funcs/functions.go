@@ -22,6 +22,9 @@ import (
 	"github.com/vapor-ware/synse-sdk/sdk/errors"
 )
 
+// registeredFuncs holds the funcs registered with the package-level Get and
+// Register functions. It is shared by all plugins which do not provide their
+// own Registry.
 var registeredFuncs map[string]*Func
 
 func init() {
@@ -31,22 +34,61 @@ func init() {
 	}
 }
 
-// Get gets a Func by its name. If a func with the specified name
-// is not found, nil is returned.
+// Get gets a Func by its name from the default registry. If a func
+// with the specified name is not found, nil is returned.
 func Get(name string) *Func {
-	return registeredFuncs[name]
+	return DefaultRegistry().Get(name)
 }
 
-// Register registers new funcs to the tracked funcs.
+// Register registers new funcs to the default registry.
 func Register(funcs ...*Func) error {
+	return DefaultRegistry().Register(funcs...)
+}
+
+// Registry is a collection of funcs, referenced by name.
+//
+// A plugin uses the default registry unless it is given its own, which allows
+// multiple plugins to run in the same process with their own set of funcs.
+type Registry struct {
+	funcs map[string]*Func
+}
+
+// NewRegistry creates a new Func Registry. The registry is initialized with the
+// built-in funcs.
+func NewRegistry() *Registry {
+	registry := &Registry{
+		funcs: make(map[string]*Func),
+	}
+	for _, f := range GetBuiltins() {
+		registry.funcs[f.Name] = f
+	}
+	return registry
+}
+
+// DefaultRegistry gets the package-level registry, which is used by the Get
+// and Register functions.
+func DefaultRegistry() *Registry {
+	return &Registry{
+		funcs: registeredFuncs,
+	}
+}
+
+// Get gets a Func from the registry by name. If a func with
+// the specified name is not found, nil is returned.
+func (registry *Registry) Get(name string) *Func {
+	return registry.funcs[name]
+}
+
+// Register registers new funcs with the registry.
+func (registry *Registry) Register(funcs ...*Func) error {
 	multiErr := errors.NewMultiError("func registration")
 
 	for _, f := range funcs {
-		if _, exists := registeredFuncs[f.Name]; exists {
+		if _, exists := registry.funcs[f.Name]; exists {
 			multiErr.Add(fmt.Errorf("conflict: Func with name '%s' already exists", f.Name))
 			continue
 		}
-		registeredFuncs[f.Name] = f
+		registry.funcs[f.Name] = f
 	}
 	return multiErr.Err()
 }
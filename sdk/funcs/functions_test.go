@@ -118,3 +118,35 @@ func TestFunc_Call_err(t *testing.T) {
 	assert.Error(t, err)
 	assert.Nil(t, val)
 }
+
+func TestNewRegistry(t *testing.T) {
+	registry := NewRegistry()
+	assert.Len(t, registry.funcs, len(GetBuiltins()))
+	assert.NotNil(t, registry.Get("FtoC"))
+}
+
+func TestRegistry_Register_isolated(t *testing.T) {
+	registry := NewRegistry()
+	initLen := len(registeredFuncs)
+
+	err := registry.Register(&Func{
+		Name: "test-func-1",
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, registry.Get("test-func-1"))
+
+	// Registering with a non-default registry should not affect the default registry.
+	assert.Nil(t, Get("test-func-1"))
+	assert.Len(t, registeredFuncs, initLen)
+}
+
+func TestRegistry_Register_conflict(t *testing.T) {
+	registry := NewRegistry()
+	initLen := len(registry.funcs)
+
+	err := registry.Register(&Func{
+		Name: "FtoC", // same name as a built-in, should conflict
+	})
+	assert.Error(t, err)
+	assert.Len(t, registry.funcs, initLen)
+}
@@ -21,6 +21,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -34,6 +35,10 @@ type Manager struct {
 	config   *config.HealthSettings
 	checks   map[string]Check
 	defaults []Check
+
+	// lock guards the custom checks, which may be registered and unregistered
+	// while the plugin is running.
+	lock sync.RWMutex
 }
 
 // NewManager creates a new instance of the health Manager component.
@@ -52,12 +57,22 @@ func NewManager(conf *config.HealthSettings, defaults ...Check) *Manager {
 // Count returns the total number of checks configured with the manager.
 // This is the sum of both the custom and default checks.
 func (manager *Manager) Count() int {
+	manager.lock.RLock()
+	defer manager.lock.RUnlock()
+
 	return len(manager.checks) + len(manager.defaults)
 }
 
 // Register registers a health check with the manager. If the name of the Check
 // being registered conflicts with an existing Check's name, an error is returned.
+//
+// Checks may be registered while the plugin is running. Checks registered after
+// the manager has started are not run by the manager, so this should only be done
+// for checks which do not need to be run, e.g. reported checks.
 func (manager *Manager) Register(check Check) error {
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+
 	if check.GetName() == "" {
 		return fmt.Errorf("health manager: registered check must have name")
 	}
@@ -73,6 +88,21 @@ func (manager *Manager) Register(check Check) error {
 	return nil
 }
 
+// Unregister removes the health check with the given name from the manager, e.g.
+// when the component it checks is removed. Only custom checks (registered via
+// Register) can be unregistered. It returns whether a check was removed.
+func (manager *Manager) Unregister(name string) bool {
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+
+	if _, exists := manager.checks[name]; !exists {
+		return false
+	}
+	delete(manager.checks, name)
+	log.WithField("name", name).Debug("[health] unregistered health check")
+	return true
+}
+
 // RegisterDefault registers default health checks with the health manager.
 func (manager *Manager) RegisterDefault(check Check) {
 	manager.defaults = append(manager.defaults, check)
@@ -108,9 +138,11 @@ func (manager *Manager) Start() {
 	}
 
 	// Run any custom health checks.
+	manager.lock.RLock()
 	for _, check := range manager.checks {
 		go check.Run()
 	}
+	manager.lock.RUnlock()
 
 	// Update the health file, if configured.
 	if manager.config.HealthFile != "" {
@@ -150,6 +182,7 @@ func (manager *Manager) Status() *Summary {
 	}
 
 	// Get the status of any custom checks.
+	manager.lock.RLock()
 	for _, check := range manager.checks {
 		s := check.Status()
 		if !s.Ok {
@@ -157,6 +190,7 @@ func (manager *Manager) Status() *Summary {
 		}
 		checks = append(checks, s)
 	}
+	manager.lock.RUnlock()
 
 	return &Summary{
 		Timestamp: utils.GetCurrentTime(),
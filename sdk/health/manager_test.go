@@ -166,6 +166,24 @@ func TestManager_Register_alreadyExists(t *testing.T) {
 	assert.Len(t, m.checks, 1)
 }
 
+func TestManager_Unregister(t *testing.T) {
+	m := Manager{
+		checks: make(map[string]Check),
+	}
+	m.checks["foo"] = &testCheck{name: "foo"}
+
+	assert.True(t, m.Unregister("foo"))
+	assert.Empty(t, m.checks)
+}
+
+func TestManager_Unregister_notExists(t *testing.T) {
+	m := Manager{
+		checks: make(map[string]Check),
+	}
+
+	assert.False(t, m.Unregister("foo"))
+}
+
 func TestManager_RegisterDefault(t *testing.T) {
 	check := testCheck{}
 	m := Manager{}
@@ -0,0 +1,104 @@
+// Synse SDK
+// Copyright (c) 2017-2020 Vapor IO
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package health
+
+import (
+	"sync"
+
+	"github.com/vapor-ware/synse-sdk/sdk/utils"
+)
+
+const (
+	// ReportedCheck is the type for Checks whose status is reported by the
+	// component they check, rather than being polled.
+	ReportedCheck CheckType = "reported"
+)
+
+// ReportedHealthCheck defines a point of health whose status is updated when the
+// checked component reports it. This is useful for events which happen at irregular
+// times, e.g. reloading configuration, where the result of the most recent event
+// should be surfaced.
+type ReportedHealthCheck struct {
+	Name string
+	Type CheckType
+
+	lock       sync.RWMutex
+	lastUpdate string
+	message    string
+	err        error
+}
+
+// NewReportedHealthCheck creates a new health Check of the "reported" type. Until
+// a status is reported, the check is considered ok.
+func NewReportedHealthCheck(name string) *ReportedHealthCheck {
+	return &ReportedHealthCheck{
+		Name: name,
+		Type: ReportedCheck,
+	}
+}
+
+// GetName gets the name of the reported health check.
+func (check *ReportedHealthCheck) GetName() string {
+	return check.Name
+}
+
+// GetType gets the type of the reported health check.
+func (check *ReportedHealthCheck) GetType() CheckType {
+	return check.Type
+}
+
+// Status gets the status of the health Check in an asynchronous-safe manner.
+//
+// If the last report was an error, the error is used as the status message.
+// Otherwise, the message of the last report is used.
+func (check *ReportedHealthCheck) Status() *Status {
+	check.lock.RLock()
+	defer check.lock.RUnlock()
+
+	message := check.message
+	if check.err != nil {
+		message = check.err.Error()
+	}
+
+	return &Status{
+		Name:      check.Name,
+		Ok:        check.err == nil,
+		Message:   message,
+		Timestamp: check.lastUpdate,
+		Type:      check.Type,
+	}
+}
+
+// Report updates the state of the health Check in an asynchronous-safe manner. A
+// nil error signifies that the checked component is healthy; the message can be
+// used to describe its state.
+func (check *ReportedHealthCheck) Report(message string, err error) {
+	check.lock.Lock()
+	defer check.lock.Unlock()
+
+	check.lastUpdate = utils.GetCurrentTime()
+	check.message = message
+	check.err = err
+}
+
+// Update does nothing for a reported health check, as its state is only updated
+// when reported via Report.
+func (check *ReportedHealthCheck) Update() {}
+
+// Run does nothing for a reported health check, as its state is only updated
+// when reported via Report.
+func (check *ReportedHealthCheck) Run() {}
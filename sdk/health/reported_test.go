@@ -0,0 +1,73 @@
+// Synse SDK
+// Copyright (c) 2017-2020 Vapor IO
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package health
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewReportedHealthCheck(t *testing.T) {
+	hc := NewReportedHealthCheck("foo")
+
+	assert.Equal(t, "foo", hc.GetName())
+	assert.Equal(t, ReportedCheck, hc.GetType())
+}
+
+func TestReportedHealthCheck_Status_notReported(t *testing.T) {
+	hc := NewReportedHealthCheck("test")
+
+	status := hc.Status()
+	assert.Equal(t, "test", status.Name)
+	assert.Equal(t, true, status.Ok)
+	assert.Equal(t, "", status.Message)
+	assert.Equal(t, "", status.Timestamp)
+	assert.Equal(t, ReportedCheck, status.Type)
+}
+
+func TestReportedHealthCheck_Report_ok(t *testing.T) {
+	hc := NewReportedHealthCheck("test")
+	hc.Report("all good", nil)
+
+	status := hc.Status()
+	assert.Equal(t, true, status.Ok)
+	assert.Equal(t, "all good", status.Message)
+	assert.NotEqual(t, "", status.Timestamp)
+}
+
+func TestReportedHealthCheck_Report_error(t *testing.T) {
+	hc := NewReportedHealthCheck("test")
+	hc.Report("all good", nil)
+	hc.Report("ignored", fmt.Errorf("test error"))
+
+	status := hc.Status()
+	assert.Equal(t, false, status.Ok)
+	assert.Equal(t, "test error", status.Message)
+	assert.NotEqual(t, "", status.Timestamp)
+}
+
+func TestReportedHealthCheck_Report_recovered(t *testing.T) {
+	hc := NewReportedHealthCheck("test")
+	hc.Report("", fmt.Errorf("test error"))
+	hc.Report("recovered", nil)
+
+	status := hc.Status()
+	assert.Equal(t, true, status.Ok)
+	assert.Equal(t, "recovered", status.Message)
+}
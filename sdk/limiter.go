@@ -0,0 +1,158 @@
+// Synse SDK
+// Copyright (c) 2017-2020 Vapor IO
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package sdk
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/vapor-ware/synse-sdk/sdk/config"
+	"golang.org/x/time/rate"
+)
+
+// Rate limiter scopes, used to identify limiters in logs and metrics.
+const (
+	limiterGlobal  = "global"
+	limiterGroup   = "group"
+	limiterHandler = "handler"
+	limiterDevice  = "device"
+)
+
+// newRateLimiter creates a new rate limiter from the given settings. If the
+// settings are nil or do not specify a rate or burst, nil is returned, as
+// the limiter is unlimited. If no burst is specified, it takes the value of
+// the rate.
+func newRateLimiter(conf *config.LimiterSettings) *rate.Limiter {
+	if conf == nil || (conf.Rate == 0 && conf.Burst == 0) {
+		return nil
+	}
+
+	burst := conf.Burst
+	if burst == 0 {
+		burst = conf.Rate
+	}
+	return rate.NewLimiter(rate.Limit(conf.Rate), burst)
+}
+
+// scopedLimiter is a rate limiter created from settings for a specific scope
+// (lock group, handler, or device). The settings it was created from are kept
+// so the limiter can be re-created if they change, e.g. on device reload.
+type scopedLimiter struct {
+	settings config.LimiterSettings
+	limiter  *rate.Limiter
+}
+
+// scopedLimiter gets the rate limiter for the given scope and name, creating it
+// from the given settings if it does not exist or if its settings have changed.
+// If the settings do not specify a limit, nil is returned.
+func (scheduler *scheduler) scopedLimiter(scope, name string, conf *config.LimiterSettings) *rate.Limiter {
+	key := scope + "/" + name
+
+	scheduler.limitersLock.Lock()
+	defer scheduler.limitersLock.Unlock()
+
+	if conf == nil || (conf.Rate == 0 && conf.Burst == 0) {
+		delete(scheduler.limiters, key)
+		return nil
+	}
+
+	if scheduler.limiters == nil {
+		scheduler.limiters = map[string]*scopedLimiter{}
+	}
+	l, exists := scheduler.limiters[key]
+	if !exists || l.settings != *conf {
+		log.WithFields(log.Fields{
+			"scope": scope,
+			"name":  name,
+			"rate":  conf.Rate,
+			"burst": conf.Burst,
+		}).Info("[scheduler] configuring rate limiter")
+		l = &scopedLimiter{
+			settings: *conf,
+			limiter:  newRateLimiter(conf),
+		}
+		scheduler.limiters[key] = l
+	}
+	return l.limiter
+}
+
+// waitLimiters waits on each of the rate limiters which apply to a read or write.
+//
+// The limiters for the given lock groups, the handler, and the devices are waited
+// on first, so that each can enforce its own budget. The global limiter, which
+// bounds all reads and writes, is waited on last, so a read or write which is held
+// back by its own limiters does not take up any of the global budget while others
+// could use it. The time spent waiting on each limiter is reported in the plugin's
+// metrics, by limiter scope and handler.
+func (scheduler *scheduler) waitLimiters(groups []string, handler *DeviceHandler, devices ...*Device) {
+	var handlerName string
+	if handler != nil {
+		handlerName = handler.Name
+	}
+
+	if conf := scheduler.config.LockGroups; conf != nil {
+		for _, group := range groups {
+			if group == "" {
+				continue
+			}
+			scheduler.waitLimiter(limiterGroup, group, handlerName, scheduler.scopedLimiter(limiterGroup, group, conf.Limiters[group]))
+		}
+	}
+
+	if handler != nil {
+		scheduler.waitLimiter(limiterHandler, handler.Name, handlerName, scheduler.scopedLimiter(limiterHandler, handler.Name, handler.Limiter))
+	}
+
+	for _, device := range devices {
+		// A removed device's limiter has been released (see removeLimiter), so it
+		// is not re-created for a read or write which was already in progress.
+		if device.isRemoved() {
+			continue
+		}
+		scheduler.waitLimiter(limiterDevice, device.id, handlerName, scheduler.scopedLimiter(limiterDevice, device.id, device.Limiter))
+	}
+
+	scheduler.waitLimiter(limiterGlobal, "", handlerName, scheduler.limiter)
+}
+
+// waitLimiter waits on the given rate limiter, if it is not nil, and records
+// the time spent waiting for the given handler. The metric is not labelled by
+// the limiter's name, as there may be a limiter for every device.
+func (scheduler *scheduler) waitLimiter(scope, name, handler string, limiter *rate.Limiter) {
+	if limiter == nil {
+		return
+	}
+
+	start := time.Now()
+	if err := limiter.Wait(context.Background()); err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"scope": scope,
+			"name":  name,
+		}).Error("[scheduler] error with rate limiter")
+	}
+	metricLimiterWait.WithLabelValues(scope, handler).Observe(time.Since(start).Seconds())
+}
+
+// removeLimiter releases the device's rate limiter, if it has one, e.g. when
+// the device is removed from the plugin.
+func (scheduler *scheduler) removeLimiter(device *Device) {
+	scheduler.limitersLock.Lock()
+	defer scheduler.limitersLock.Unlock()
+	delete(scheduler.limiters, limiterDevice+"/"+device.id)
+}
@@ -0,0 +1,181 @@
+// Synse SDK
+// Copyright (c) 2017-2020 Vapor IO
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package sdk
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/vapor-ware/synse-sdk/sdk/config"
+	"golang.org/x/time/rate"
+)
+
+func TestNewRateLimiter(t *testing.T) {
+	cases := []struct {
+		conf  *config.LimiterSettings
+		limit rate.Limit
+		burst int
+	}{
+		{conf: &config.LimiterSettings{Rate: 10}, limit: 10, burst: 10},
+		{conf: &config.LimiterSettings{Rate: 10, Burst: 2}, limit: 10, burst: 2},
+	}
+
+	for i, c := range cases {
+		limiter := newRateLimiter(c.conf)
+		assert.Equal(t, c.limit, limiter.Limit(), i)
+		assert.Equal(t, c.burst, limiter.Burst(), i)
+	}
+}
+
+func TestNewRateLimiter_unlimited(t *testing.T) {
+	assert.Nil(t, newRateLimiter(nil))
+	assert.Nil(t, newRateLimiter(&config.LimiterSettings{}))
+}
+
+func TestScheduler_scopedLimiter(t *testing.T) {
+	s := scheduler{}
+
+	// Created from settings.
+	l1 := s.scopedLimiter(limiterHandler, "foo", &config.LimiterSettings{Rate: 10})
+	assert.NotNil(t, l1)
+	assert.Len(t, s.limiters, 1)
+
+	// Reused if the settings are the same.
+	l2 := s.scopedLimiter(limiterHandler, "foo", &config.LimiterSettings{Rate: 10})
+	assert.Same(t, l1, l2)
+
+	// Scoped by name.
+	l3 := s.scopedLimiter(limiterDevice, "foo", &config.LimiterSettings{Rate: 10})
+	assert.NotSame(t, l1, l3)
+	assert.Len(t, s.limiters, 2)
+
+	// Re-created if the settings change.
+	l4 := s.scopedLimiter(limiterHandler, "foo", &config.LimiterSettings{Rate: 5})
+	assert.NotSame(t, l1, l4)
+	assert.Equal(t, rate.Limit(5), l4.Limit())
+
+	// Removed if the settings no longer specify a limit.
+	assert.Nil(t, s.scopedLimiter(limiterHandler, "foo", nil))
+	assert.Len(t, s.limiters, 1)
+}
+
+func TestScheduler_waitLimiters(t *testing.T) {
+	s := scheduler{
+		config: &config.PluginSettings{
+			LockGroups: &config.LockGroupSettings{
+				Limiters: map[string]*config.LimiterSettings{
+					"bus1": {Rate: 20, Burst: 1},
+				},
+			},
+		},
+	}
+	handler := &DeviceHandler{
+		Name:    "limited",
+		Limiter: &config.LimiterSettings{Rate: 20, Burst: 1},
+	}
+	device := &Device{
+		id:      "123",
+		handler: handler,
+		Limiter: &config.LimiterSettings{Rate: 20, Burst: 1},
+	}
+
+	// Each limiter allows one event every 50ms, with a burst of 1, so the
+	// first wait is immediate and the following waits are throttled.
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		s.waitLimiters([]string{"", "bus1"}, handler, device)
+	}
+	assert.GreaterOrEqual(t, int64(time.Since(start)), int64(90*time.Millisecond))
+
+	// A wait time was recorded for each of the scoped limiters.
+	assert.GreaterOrEqual(t, testutil.CollectAndCount(metricLimiterWait), 3)
+}
+
+func TestScheduler_waitLimiters_globalLast(t *testing.T) {
+	global := rate.NewLimiter(1, 1)
+	s := scheduler{
+		config:  &config.PluginSettings{},
+		limiter: global,
+	}
+	handler := &DeviceHandler{
+		Name:    "limited",
+		Limiter: &config.LimiterSettings{Rate: 10, Burst: 1},
+	}
+
+	// Use up the handler's budget, then wait on the limiters again, which
+	// waits on the handler limiter for ~100ms.
+	s.scopedLimiter(limiterHandler, handler.Name, handler.Limiter).Allow()
+	done := make(chan struct{})
+	go func() {
+		s.waitLimiters(nil, handler)
+		close(done)
+	}()
+
+	// The global budget is not taken while waiting on the handler limiter.
+	time.Sleep(20 * time.Millisecond)
+	assert.True(t, global.Allow())
+	<-done
+}
+
+func TestScheduler_removeLimiter(t *testing.T) {
+	s := scheduler{
+		config: &config.PluginSettings{},
+	}
+	handler := &DeviceHandler{
+		Name:    "test",
+		Limiter: &config.LimiterSettings{Rate: 100},
+	}
+	device := &Device{
+		id:      "123",
+		handler: handler,
+		Limiter: &config.LimiterSettings{Rate: 100},
+	}
+
+	s.waitLimiters(nil, handler, device)
+	assert.Len(t, s.limiters, 2)
+
+	s.removeLimiter(device)
+	assert.Len(t, s.limiters, 1)
+
+	// The limiter is not re-created for a removed device.
+	device.markRemoved()
+	s.waitLimiters(nil, handler, device)
+	assert.Len(t, s.limiters, 1)
+}
+
+func TestScheduler_waitLimiters_independentHandlers(t *testing.T) {
+	s := scheduler{
+		config: &config.PluginSettings{},
+	}
+	limited := &DeviceHandler{
+		Name:    "limited",
+		Limiter: &config.LimiterSettings{Rate: 1, Burst: 1},
+	}
+	unlimited := &DeviceHandler{Name: "unlimited"}
+
+	// Use up the limited handler's budget.
+	s.waitLimiters(nil, limited)
+
+	// The unlimited handler is not affected by the limited handler.
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		s.waitLimiters(nil, unlimited)
+	}
+	assert.Less(t, int64(time.Since(start)), int64(100*time.Millisecond))
+}
@@ -0,0 +1,156 @@
+// Synse SDK
+// Copyright (c) 2017-2020 Vapor IO
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package sdk
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/vapor-ware/synse-sdk/sdk/config"
+)
+
+// lockGroup gets the name of the lock group for the device. The device's own
+// lock group takes precedence, followed by the lock group of its handler, and
+// then by the value of the device Data field named by the plugin's lock group
+// data key. An empty string is returned if the device is not in a lock group.
+func (scheduler *scheduler) lockGroup(device *Device) string {
+	if device.LockGroup != "" {
+		return device.LockGroup
+	}
+	if device.handler != nil && device.handler.LockGroup != "" {
+		return device.handler.LockGroup
+	}
+	if conf := scheduler.config.LockGroups; conf != nil && conf.DataKey != "" {
+		if value, exists := device.Data[conf.DataKey]; exists && value != nil {
+			return fmt.Sprint(value)
+		}
+	}
+	return ""
+}
+
+// lockGroupsFor gets the sorted, de-duplicated names of the lock groups for
+// the given devices.
+func (scheduler *scheduler) lockGroupsFor(devices ...*Device) []string {
+	seen := map[string]bool{}
+	var groups []string
+	for _, device := range devices {
+		group := scheduler.lockGroup(device)
+		if !seen[group] {
+			seen[group] = true
+			groups = append(groups, group)
+		}
+	}
+	sort.Strings(groups)
+	return groups
+}
+
+// lockGroups acquires the locks for the given lock groups, which must be sorted
+// and de-duplicated (see lockGroupsFor), and returns a function which releases
+// them. Locks are always acquired in sorted order so that callers which need
+// multiple groups (e.g. a bulk read) can not deadlock with each other.
+//
+// Devices which are not in a lock group (the "" group) are only serialized when
+// the scheduler runs in serial mode, in which case the serial lock is used.
+func (scheduler *scheduler) lockGroups(groups []string) func() {
+	var locks []*sync.Mutex
+	for _, group := range groups {
+		if group == "" {
+			if scheduler.config.Mode == modeSerial && scheduler.serialLock != nil {
+				locks = append(locks, scheduler.serialLock)
+			}
+			continue
+		}
+		locks = append(locks, scheduler.groupLock(group))
+	}
+
+	for _, lock := range locks {
+		lock.Lock()
+	}
+	return func() {
+		for i := len(locks) - 1; i >= 0; i-- {
+			locks[i].Unlock()
+		}
+	}
+}
+
+// lockGroupKeys gets the keys by which the locks which lockGroups acquires for
+// the given lock groups are tracked while held by an abandoned read (see runRead).
+func (scheduler *scheduler) lockGroupKeys(groups []string) []string {
+	var keys []string
+	for _, group := range groups {
+		if group == "" {
+			if scheduler.config.Mode == modeSerial && scheduler.serialLock != nil {
+				keys = append(keys, "serial")
+			}
+			continue
+		}
+		keys = append(keys, "group/"+group)
+	}
+	return keys
+}
+
+// groupLock gets the lock for the named lock group, creating it if it does
+// not yet exist.
+func (scheduler *scheduler) groupLock(group string) *sync.Mutex {
+	scheduler.groupLocksLock.Lock()
+	defer scheduler.groupLocksLock.Unlock()
+
+	if scheduler.groupLocks == nil {
+		scheduler.groupLocks = map[string]*sync.Mutex{}
+	}
+	lock, exists := scheduler.groupLocks[group]
+	if !exists {
+		lock = &sync.Mutex{}
+		scheduler.groupLocks[group] = lock
+	}
+	return lock
+}
+
+// lockGroupDelay gets the delay to wait after a read or write of devices in the
+// given lock groups, before releasing the group locks. A group's configured delay
+// replaces the global read or write delay. If there are multiple groups, the
+// longest delay is used.
+func (scheduler *scheduler) lockGroupDelay(groups []string, write bool) time.Duration {
+	var global time.Duration
+	if write {
+		global = scheduler.config.Write.Delay
+	} else {
+		global = scheduler.config.Read.Delay
+	}
+
+	var delays map[string]*config.LockGroupDelays
+	if scheduler.config.LockGroups != nil {
+		delays = scheduler.config.LockGroups.Delays
+	}
+
+	var delay time.Duration
+	for _, group := range groups {
+		d := global
+		if conf := delays[group]; group != "" && conf != nil {
+			d = conf.Read
+			if write {
+				d = conf.Write
+			}
+		}
+		if d > delay {
+			delay = d
+		}
+	}
+	return delay
+}
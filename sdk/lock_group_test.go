@@ -0,0 +1,263 @@
+// Synse SDK
+// Copyright (c) 2017-2020 Vapor IO
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package sdk
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vapor-ware/synse-sdk/sdk/config"
+	"github.com/vapor-ware/synse-sdk/sdk/output"
+)
+
+func TestScheduler_lockGroup(t *testing.T) {
+	s := scheduler{
+		config: &config.PluginSettings{
+			LockGroups: &config.LockGroupSettings{DataKey: "bus"},
+		},
+	}
+
+	cases := []struct {
+		device   *Device
+		expected string
+	}{
+		{
+			// not in a group
+			device:   &Device{handler: &DeviceHandler{}},
+			expected: "",
+		},
+		{
+			// group from data key
+			device:   &Device{handler: &DeviceHandler{}, Data: map[string]interface{}{"bus": 1}},
+			expected: "1",
+		},
+		{
+			// handler group takes precedence over data key
+			device:   &Device{handler: &DeviceHandler{LockGroup: "h"}, Data: map[string]interface{}{"bus": 1}},
+			expected: "h",
+		},
+		{
+			// device group takes precedence over all
+			device:   &Device{LockGroup: "d", handler: &DeviceHandler{LockGroup: "h"}, Data: map[string]interface{}{"bus": 1}},
+			expected: "d",
+		},
+	}
+
+	for i, c := range cases {
+		assert.Equal(t, c.expected, s.lockGroup(c.device), i)
+	}
+}
+
+func TestScheduler_lockGroup_noSettings(t *testing.T) {
+	s := scheduler{
+		config: &config.PluginSettings{},
+	}
+
+	device := &Device{handler: &DeviceHandler{}, Data: map[string]interface{}{"bus": 1}}
+	assert.Equal(t, "", s.lockGroup(device))
+}
+
+func TestScheduler_lockGroupsFor(t *testing.T) {
+	s := scheduler{
+		config: &config.PluginSettings{},
+	}
+
+	groups := s.lockGroupsFor(
+		&Device{LockGroup: "b"},
+		&Device{LockGroup: "a"},
+		&Device{},
+		&Device{LockGroup: "b"},
+	)
+	assert.Equal(t, []string{"", "a", "b"}, groups)
+}
+
+func TestScheduler_lockGroupDelay(t *testing.T) {
+	s := scheduler{
+		config: &config.PluginSettings{
+			Read:  &config.ReadSettings{Delay: 10 * time.Millisecond},
+			Write: &config.WriteSettings{Delay: 20 * time.Millisecond},
+			LockGroups: &config.LockGroupSettings{
+				Delays: map[string]*config.LockGroupDelays{
+					"a": {Read: 50 * time.Millisecond, Write: 0},
+					"b": {Read: 5 * time.Millisecond, Write: 30 * time.Millisecond},
+				},
+			},
+		},
+	}
+
+	// Groups without configured delays use the global delays.
+	assert.Equal(t, 10*time.Millisecond, s.lockGroupDelay([]string{""}, false))
+	assert.Equal(t, 20*time.Millisecond, s.lockGroupDelay([]string{"c"}, true))
+
+	// Group delays replace the global delays.
+	assert.Equal(t, 50*time.Millisecond, s.lockGroupDelay([]string{"a"}, false))
+	assert.Equal(t, time.Duration(0), s.lockGroupDelay([]string{"a"}, true))
+	assert.Equal(t, 5*time.Millisecond, s.lockGroupDelay([]string{"b"}, false))
+
+	// The longest delay of multiple groups is used.
+	assert.Equal(t, 50*time.Millisecond, s.lockGroupDelay([]string{"a", "b"}, false))
+	assert.Equal(t, 30*time.Millisecond, s.lockGroupDelay([]string{"a", "b"}, true))
+}
+
+// concurrencyTracker tracks the maximum number of concurrent calls, either to
+// run or between enter and the function it returns.
+type concurrencyTracker struct {
+	current int32
+	max     int32
+}
+
+// run records a call which takes the given duration.
+func (tracker *concurrencyTracker) run(d time.Duration) {
+	defer tracker.enter()()
+	time.Sleep(d)
+}
+
+// enter records the start of a call, returning a function which records its end.
+func (tracker *concurrencyTracker) enter() func() {
+	n := atomic.AddInt32(&tracker.current, 1)
+	for {
+		max := atomic.LoadInt32(&tracker.max)
+		if n <= max || atomic.CompareAndSwapInt32(&tracker.max, max, n) {
+			break
+		}
+	}
+	return func() { atomic.AddInt32(&tracker.current, -1) }
+}
+
+// readConcurrently reads the given devices concurrently, returning once all
+// of the reads complete.
+func readConcurrently(s *scheduler, devices ...*Device) {
+	var wg sync.WaitGroup
+	for _, device := range devices {
+		wg.Add(1)
+		go func(d *Device) {
+			defer wg.Done()
+			s.read(d)
+		}(device)
+	}
+	wg.Wait()
+}
+
+func TestScheduler_read_lockGroups(t *testing.T) {
+	s := newTestScheduler()
+	s.config.LockGroups = &config.LockGroupSettings{DataKey: "bus"}
+
+	bus1 := &concurrencyTracker{}
+	bus2 := &concurrencyTracker{}
+	all := &concurrencyTracker{}
+
+	device := func(bus int, tracker *concurrencyTracker) *Device {
+		return &Device{
+			Data: map[string]interface{}{"bus": bus},
+			handler: &DeviceHandler{
+				Read: func(device *Device) ([]*output.Reading, error) {
+					defer all.enter()()
+					tracker.run(50 * time.Millisecond)
+					return nil, nil
+				},
+			},
+		}
+	}
+
+	readConcurrently(s,
+		device(1, bus1), device(1, bus1), device(1, bus1),
+		device(2, bus2), device(2, bus2), device(2, bus2),
+	)
+
+	// Reads within a group are serialized, but groups run concurrently.
+	assert.Equal(t, int32(1), atomic.LoadInt32(&bus1.max))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&bus2.max))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&all.max))
+}
+
+func TestScheduler_read_ungroupedParallel(t *testing.T) {
+	s := newTestScheduler()
+	s.config.LockGroups = &config.LockGroupSettings{DataKey: "bus"}
+
+	tracker := &concurrencyTracker{}
+	handler := &DeviceHandler{
+		Read: func(device *Device) ([]*output.Reading, error) {
+			tracker.run(50 * time.Millisecond)
+			return nil, nil
+		},
+	}
+
+	readConcurrently(s, &Device{handler: handler}, &Device{handler: handler}, &Device{handler: handler})
+	assert.Equal(t, int32(3), atomic.LoadInt32(&tracker.max))
+}
+
+func TestScheduler_read_ungroupedSerial(t *testing.T) {
+	s := newTestScheduler()
+	s.config.Mode = modeSerial
+	s.config.LockGroups = &config.LockGroupSettings{DataKey: "bus"}
+
+	ungrouped := &concurrencyTracker{}
+	all := &concurrencyTracker{}
+	handler := &DeviceHandler{
+		Read: func(device *Device) ([]*output.Reading, error) {
+			defer all.enter()()
+			if device.Data == nil {
+				ungrouped.run(50 * time.Millisecond)
+			} else {
+				time.Sleep(50 * time.Millisecond)
+			}
+			return nil, nil
+		},
+	}
+
+	readConcurrently(s,
+		&Device{handler: handler}, &Device{handler: handler},
+		&Device{handler: handler, Data: map[string]interface{}{"bus": 1}},
+	)
+
+	// Ungrouped devices are serialized with each other in serial mode, but
+	// not with devices in a lock group.
+	assert.Equal(t, int32(1), atomic.LoadInt32(&ungrouped.max))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&all.max))
+}
+
+func TestScheduler_lockGroups_multiple(t *testing.T) {
+	s := newTestScheduler()
+	s.config.Mode = modeSerial
+	s.config.LockGroups = &config.LockGroupSettings{DataKey: "bus"}
+	locks := []*sync.Mutex{s.serialLock, s.groupLock("a"), s.groupLock("b")}
+
+	unlock := s.lockGroups([]string{"", "a", "b"})
+
+	// Each of the locks should be held until released.
+	var acquired sync.WaitGroup
+	var count int32
+	for _, lock := range locks {
+		acquired.Add(1)
+		go func(l *sync.Mutex) {
+			defer acquired.Done()
+			l.Lock()
+			atomic.AddInt32(&count, 1)
+			l.Unlock()
+		}(lock)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&count))
+
+	unlock()
+	acquired.Wait()
+	assert.Equal(t, int32(3), atomic.LoadInt32(&count))
+}
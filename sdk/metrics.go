@@ -19,10 +19,147 @@ package sdk
 import (
 	"net/http"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	log "github.com/sirupsen/logrus"
 )
 
+// Plugin metrics. These are registered with the default Prometheus registry
+// and are exposed when the plugin has metrics enabled.
+var (
+	// metricLimiterWait records the time spent waiting on rate limiters before
+	// reading from or writing to devices, by limiter scope and device handler.
+	metricLimiterWait = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "synse",
+			Subsystem: "plugin",
+			Name:      "limiter_wait_seconds",
+			Help:      "Time spent waiting on rate limiters before device reads and writes.",
+			Buckets:   []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10},
+		},
+		[]string{"scope", "handler"},
+	)
+
+	// metricReadTimeouts counts the device reads (and bulk reads) which timed
+	// out and were abandoned, by device handler.
+	metricReadTimeouts = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "synse",
+			Subsystem: "plugin",
+			Name:      "read_timeouts_total",
+			Help:      "Total number of device reads which timed out and were abandoned.",
+		},
+		[]string{"handler"},
+	)
+
+	// metricAbandonedReads tracks the number of abandoned reads which have not
+	// yet returned. Each is a goroutine which is still running a device read.
+	metricAbandonedReads = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "synse",
+			Subsystem: "plugin",
+			Name:      "abandoned_reads",
+			Help:      "Number of timed out device reads which have not yet returned.",
+		},
+	)
+
+	// metricReadQueueDepth tracks the number of reads waiting for a worker
+	// in the read pool.
+	metricReadQueueDepth = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "synse",
+			Subsystem: "plugin",
+			Name:      "read_queue_depth",
+			Help:      "Number of device reads waiting for a read worker.",
+		},
+	)
+
+	// metricReadWorkersBusy tracks the number of read pool workers which
+	// are running a read.
+	metricReadWorkersBusy = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "synse",
+			Subsystem: "plugin",
+			Name:      "read_workers_busy",
+			Help:      "Number of read workers which are running a device read.",
+		},
+	)
+
+	// metricReadWorkerUtilization tracks the fraction of read pool workers
+	// which are running a read.
+	metricReadWorkerUtilization = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "synse",
+			Subsystem: "plugin",
+			Name:      "read_worker_utilization",
+			Help:      "Fraction (0 to 1) of read workers which are running a device read.",
+		},
+	)
+
+	// metricCircuitState tracks the number of devices whose circuit breakers are
+	// open or half-open, by device handler and circuit state. A handler's bulk
+	// read circuit breaker is counted as one.
+	metricCircuitState = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "synse",
+			Subsystem: "plugin",
+			Name:      "circuit_breaker_devices",
+			Help:      "Number of device (and bulk read) circuit breakers which are open or half-open.",
+		},
+		[]string{"handler", "state"},
+	)
+
+	// metricCircuitTrips counts the number of times device (and bulk read)
+	// circuit breakers have opened, by device handler.
+	metricCircuitTrips = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "synse",
+			Subsystem: "plugin",
+			Name:      "circuit_breaker_trips_total",
+			Help:      "Total number of times a device or bulk read circuit breaker has opened.",
+		},
+		[]string{"handler"},
+	)
+
+	// metricStreamDropped counts the readings dropped by read streams because
+	// their buffer was full, by the streams' overflow policy.
+	metricStreamDropped = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "synse",
+			Subsystem: "plugin",
+			Name:      "stream_dropped_readings_total",
+			Help:      "Total number of readings dropped by read streams because their buffer was full.",
+		},
+		[]string{"overflow"},
+	)
+
+	// metricStreamDisconnects counts the read streams which were disconnected
+	// because their buffer was full.
+	metricStreamDisconnects = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "synse",
+			Subsystem: "plugin",
+			Name:      "stream_disconnects_total",
+			Help:      "Total number of read streams disconnected because their buffer was full.",
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(
+		metricLimiterWait,
+		metricReadTimeouts,
+		metricAbandonedReads,
+		metricCircuitState,
+		metricCircuitTrips,
+		metricReadQueueDepth,
+		metricReadWorkersBusy,
+		metricReadWorkerUtilization,
+		metricStreamDropped,
+		metricStreamDisconnects,
+	)
+}
+
 // exposeMetrics exposes Prometheus application metrics via HTTP. It starts
 // an HTTP server on the default metrics port (2112) and exposes the /metrics
 // endpoint.
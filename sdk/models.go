@@ -17,6 +17,8 @@
 package sdk
 
 import (
+	"time"
+
 	"github.com/vapor-ware/synse-sdk/sdk/output"
 	synse "github.com/vapor-ware/synse-server-grpc/go"
 )
@@ -33,6 +35,9 @@ import (
 type ReadContext struct {
 	Device  *Device
 	Reading []*output.Reading
+
+	// received is the time at which the state manager received the readings.
+	received time.Time
 }
 
 // NewReadContext creates a new instance of a ReadContext from the given
@@ -17,7 +17,12 @@
 package sdk
 
 import (
+	"flag"
+
 	log "github.com/sirupsen/logrus"
+	"github.com/vapor-ware/synse-sdk/sdk/config"
+	"github.com/vapor-ware/synse-sdk/sdk/funcs"
+	"github.com/vapor-ware/synse-sdk/sdk/output"
 	"github.com/vapor-ware/synse-sdk/sdk/policy"
 )
 
@@ -92,3 +97,63 @@ func DynamicConfigRequired() PluginOption {
 		plugin.policies.DynamicDeviceConfig = policy.Required
 	}
 }
+
+// CustomPluginMetadata sets the metadata for the plugin. This is required when
+// creating a plugin with New. When using NewPlugin, the metadata set via SetPluginInfo
+// is used unless overridden by this option.
+func CustomPluginMetadata(meta PluginMetadata) PluginOption {
+	return func(plugin *Plugin) {
+		plugin.info = &meta
+	}
+}
+
+// CustomPluginVersion sets the version information for the plugin. When using
+// New without this option, only the SDK version is known; when using NewPlugin,
+// the version set via the build-time package variables is used unless overridden
+// by this option.
+func CustomPluginVersion(info VersionInfo) PluginOption {
+	return func(plugin *Plugin) {
+		plugin.version = newPluginVersion(info)
+	}
+}
+
+// CustomPluginConfig sets the configuration for the plugin. When set, the plugin
+// does not search for or load its configuration from file or environment. Defaults
+// are applied to any fields which are not set in the provided config.
+func CustomPluginConfig(cfg *config.Plugin) PluginOption {
+	log.Debug("[options] using custom plugin config")
+	return func(plugin *Plugin) {
+		plugin.config = cfg
+		plugin.configProvided = cfg != nil
+	}
+}
+
+// CustomFlagSet sets the flag set which the plugin's command line flags (e.g.
+// --debug, --dry-run) are defined on. The flag set is parsed with the given args
+// when the plugin is created, so it should not have been parsed already.
+//
+// This allows an application which embeds a plugin to own its command line
+// interface. If no flag set is given to New, no command line flags are parsed.
+func CustomFlagSet(flags *flag.FlagSet, args []string) PluginOption {
+	log.Debug("[options] using custom flag set")
+	return func(plugin *Plugin) {
+		plugin.flags = flags
+		plugin.args = args
+	}
+}
+
+// CustomOutputRegistry sets the registry which the plugin registers its outputs
+// with and resolves device config output references against.
+func CustomOutputRegistry(registry *output.Registry) PluginOption {
+	return func(plugin *Plugin) {
+		plugin.outputs = registry
+	}
+}
+
+// CustomFuncRegistry sets the registry which the plugin registers its transform
+// funcs with and resolves device config "apply" transforms against.
+func CustomFuncRegistry(registry *funcs.Registry) PluginOption {
+	return func(plugin *Plugin) {
+		plugin.funcs = registry
+	}
+}
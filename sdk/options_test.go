@@ -17,10 +17,13 @@
 package sdk
 
 import (
+	"flag"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/vapor-ware/synse-sdk/sdk/config"
+	"github.com/vapor-ware/synse-sdk/sdk/funcs"
+	"github.com/vapor-ware/synse-sdk/sdk/output"
 	"github.com/vapor-ware/synse-sdk/sdk/policy"
 )
 
@@ -124,3 +127,76 @@ func TestDynamicConfigRequired(t *testing.T) {
 	opt(&plugin)
 	assert.Equal(t, policy.Required, plugin.policies.DynamicDeviceConfig)
 }
+
+func TestCustomPluginMetadata(t *testing.T) {
+	opt := CustomPluginMetadata(PluginMetadata{Name: "test"})
+	plugin := Plugin{}
+	assert.Nil(t, plugin.info)
+
+	opt(&plugin)
+	assert.Equal(t, "test", plugin.info.Name)
+}
+
+func TestCustomPluginVersion(t *testing.T) {
+	opt := CustomPluginVersion(VersionInfo{PluginVersion: "1.2.3", GitTag: "v1.2.3"})
+	plugin := Plugin{}
+	assert.Nil(t, plugin.version)
+
+	opt(&plugin)
+	assert.Equal(t, "1.2.3", plugin.version.PluginVersion)
+	assert.Equal(t, "v1.2.3", plugin.version.GitTag)
+	assert.Equal(t, "-", plugin.version.GitCommit)
+	assert.Equal(t, Version, plugin.version.SDKVersion)
+}
+
+func TestCustomPluginConfig(t *testing.T) {
+	cfg := &config.Plugin{Debug: true}
+	opt := CustomPluginConfig(cfg)
+	plugin := Plugin{}
+	assert.Nil(t, plugin.config)
+	assert.False(t, plugin.configProvided)
+
+	opt(&plugin)
+	assert.Equal(t, cfg, plugin.config)
+	assert.True(t, plugin.configProvided)
+}
+
+func TestCustomPluginConfig_nil(t *testing.T) {
+	opt := CustomPluginConfig(nil)
+	plugin := Plugin{}
+
+	opt(&plugin)
+	assert.Nil(t, plugin.config)
+	assert.False(t, plugin.configProvided)
+}
+
+func TestCustomFlagSet(t *testing.T) {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	opt := CustomFlagSet(flags, []string{"--debug"})
+	plugin := Plugin{}
+	assert.Nil(t, plugin.flags)
+
+	opt(&plugin)
+	assert.Equal(t, flags, plugin.flags)
+	assert.Equal(t, []string{"--debug"}, plugin.args)
+}
+
+func TestCustomOutputRegistry(t *testing.T) {
+	registry := output.NewRegistry()
+	opt := CustomOutputRegistry(registry)
+	plugin := Plugin{}
+	assert.Nil(t, plugin.outputs)
+
+	opt(&plugin)
+	assert.Equal(t, registry, plugin.outputs)
+}
+
+func TestCustomFuncRegistry(t *testing.T) {
+	registry := funcs.NewRegistry()
+	opt := CustomFuncRegistry(registry)
+	plugin := Plugin{}
+	assert.Nil(t, plugin.funcs)
+
+	opt(&plugin)
+	assert.Equal(t, registry, plugin.funcs)
+}
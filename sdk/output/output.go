@@ -24,6 +24,9 @@ import (
 	synse "github.com/vapor-ware/synse-server-grpc/go"
 )
 
+// registeredOutputs holds the outputs registered with the package-level Get and
+// Register functions. It is shared by all plugins which do not provide their
+// own Registry.
 var registeredOutputs map[string]*Output
 
 func init() {
@@ -33,22 +36,61 @@ func init() {
 	}
 }
 
-// Get gets an Output by name. If an output with the specified name
-// is not found, nil is returned.
+// Get gets an Output by name from the default registry. If an output
+// with the specified name is not found, nil is returned.
 func Get(name string) *Output {
-	return registeredOutputs[name]
+	return DefaultRegistry().Get(name)
 }
 
-// Register registers new outputs to the tracked outputs.
+// Register registers new outputs to the default registry.
 func Register(output ...*Output) error {
+	return DefaultRegistry().Register(output...)
+}
+
+// Registry is a collection of outputs, referenced by name.
+//
+// A plugin uses the default registry unless it is given its own, which allows
+// multiple plugins to run in the same process with their own set of outputs.
+type Registry struct {
+	outputs map[string]*Output
+}
+
+// NewRegistry creates a new Output Registry. The registry is initialized with the
+// built-in outputs.
+func NewRegistry() *Registry {
+	registry := &Registry{
+		outputs: make(map[string]*Output),
+	}
+	for _, o := range GetBuiltins() {
+		registry.outputs[o.Name] = o
+	}
+	return registry
+}
+
+// DefaultRegistry gets the package-level registry, which is used by the Get
+// and Register functions.
+func DefaultRegistry() *Registry {
+	return &Registry{
+		outputs: registeredOutputs,
+	}
+}
+
+// Get gets an Output from the registry by name. If an output with
+// the specified name is not found, nil is returned.
+func (registry *Registry) Get(name string) *Output {
+	return registry.outputs[name]
+}
+
+// Register registers new outputs with the registry.
+func (registry *Registry) Register(output ...*Output) error {
 	multiErr := errors.NewMultiError("output registration")
 
 	for _, o := range output {
-		if _, exists := registeredOutputs[o.Name]; exists {
+		if _, exists := registry.outputs[o.Name]; exists {
 			multiErr.Add(fmt.Errorf("conflict: output with name '%s' already exists", o.Name))
 			continue
 		}
-		registeredOutputs[o.Name] = o
+		registry.outputs[o.Name] = o
 	}
 	return multiErr.Err()
 }
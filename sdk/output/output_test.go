@@ -92,6 +92,38 @@ func TestRegister_conflict(t *testing.T) {
 	assert.Len(t, registeredOutputs, initLen)
 }
 
+func TestNewRegistry(t *testing.T) {
+	registry := NewRegistry()
+	assert.Len(t, registry.outputs, len(GetBuiltins()))
+	assert.NotNil(t, registry.Get("temperature"))
+}
+
+func TestRegistry_Register_isolated(t *testing.T) {
+	registry := NewRegistry()
+	initLen := len(registeredOutputs)
+
+	err := registry.Register(&Output{
+		Name: "test-output-1",
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, registry.Get("test-output-1"))
+
+	// Registering with a non-default registry should not affect the default registry.
+	assert.Nil(t, Get("test-output-1"))
+	assert.Len(t, registeredOutputs, initLen)
+}
+
+func TestRegistry_Register_conflict(t *testing.T) {
+	registry := NewRegistry()
+	initLen := len(registry.outputs)
+
+	err := registry.Register(&Output{
+		Name: "temperature", // same name as a built-in, should conflict
+	})
+	assert.Error(t, err)
+	assert.Len(t, registry.outputs, initLen)
+}
+
 func TestOutput_MakeReading(t *testing.T) {
 	o := Output{
 		Name:      "test-output",
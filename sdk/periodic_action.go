@@ -0,0 +1,188 @@
+// Synse SDK
+// Copyright (c) 2017-2020 Vapor IO
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package sdk
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	sdkError "github.com/vapor-ware/synse-sdk/sdk/errors"
+	"github.com/vapor-ware/synse-sdk/sdk/health"
+)
+
+// periodicAction holds the run state of a device periodic action.
+type periodicAction struct {
+	action *DeviceAction
+	cron   *cronSchedule
+
+	// check is the health check which reports the result of the most recent
+	// run of the action.
+	check *health.ReportedHealthCheck
+}
+
+// newPeriodicAction creates the run state for a device periodic action. The
+// action's schedule should already have been validated when it was registered.
+func newPeriodicAction(action *DeviceAction) (*periodicAction, error) {
+	var cron *cronSchedule
+	if action.Schedule != "" {
+		var err error
+		if cron, err = parseCron(action.Schedule); err != nil {
+			return nil, err
+		}
+	}
+	return &periodicAction{
+		action: action,
+		cron:   cron,
+		check:  health.NewReportedHealthCheck("device periodic action: " + action.Name),
+	}, nil
+}
+
+// next gets the time the action should next be run. If the action's schedule
+// never matches, the zero time is returned.
+func (pa *periodicAction) next(now time.Time) time.Time {
+	if pa.cron != nil {
+		return pa.cron.next(now)
+	}
+	return now.Add(pa.action.Interval)
+}
+
+// schedulePeriodicActions runs the device periodic actions registered with the
+// device manager, each at its own interval or schedule. This blocks until the
+// scheduler is stopped and any in-progress actions complete.
+func (scheduler *scheduler) schedulePeriodicActions() {
+	if scheduler.deviceManager == nil || len(scheduler.deviceManager.periodicActions) == 0 {
+		log.Debug("[scheduler] no device periodic actions registered")
+		return
+	}
+
+	actions := scheduler.deviceManager.periodicActions
+	log.WithField("actions", len(actions)).Info("[scheduler] starting device periodic actions")
+
+	var wg sync.WaitGroup
+	for _, action := range actions {
+		pa, err := newPeriodicAction(action)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"action": action.Name,
+				"error":  err,
+			}).Error("[scheduler] unable to schedule device periodic action")
+			continue
+		}
+		if scheduler.health != nil {
+			if err := scheduler.health.Register(pa.check); err != nil {
+				log.WithField("error", err).Error("[scheduler] failed to register device periodic action health check")
+			}
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			scheduler.runPeriodicAction(pa)
+		}()
+	}
+	wg.Wait()
+}
+
+// runPeriodicAction runs a device periodic action at its interval or schedule
+// until the scheduler is stopped.
+func (scheduler *scheduler) runPeriodicAction(pa *periodicAction) {
+	alog := log.WithField("action", pa.action.Name)
+
+	for {
+		next := pa.next(time.Now())
+		if next.IsZero() {
+			alog.WithField("schedule", pa.action.Schedule).Error("[scheduler] device periodic action schedule never matches")
+			pa.check.Report("", fmt.Errorf("schedule %q never matches", pa.action.Schedule))
+			return
+		}
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-scheduler.stop:
+			timer.Stop()
+			alog.Debug("[scheduler] stop channel closed, terminating device periodic action")
+			return
+		case <-timer.C:
+		}
+
+		// An action's failures are logged and reported via its health check,
+		// so they do not need to be handled here.
+		_ = scheduler.execPeriodicAction(pa)
+	}
+}
+
+// execPeriodicAction runs a device periodic action once for each of the devices
+// which match its filter. Like reads and writes, the action for a device waits
+// on the device's rate limiters and holds its lock group (or the serial lock)
+// while it runs. The actions for different devices run in parallel.
+//
+// The result of the run is reported via the action's health check.
+func (scheduler *scheduler) execPeriodicAction(pa *periodicAction) error {
+	alog := log.WithField("action", pa.action.Name)
+
+	devices, err := scheduler.deviceManager.FilterDevices(pa.action.Filter)
+	if err != nil {
+		alog.WithField("error", err).Error("[scheduler] failed to filter devices for device periodic action")
+		pa.check.Report("", err)
+		return err
+	}
+
+	plugin := scheduler.deviceManager.plugin
+	var (
+		wg       sync.WaitGroup
+		lock     sync.Mutex
+		multiErr = sdkError.NewMultiError("device periodic action: " + pa.action.Name)
+	)
+	for _, device := range devices {
+		wg.Add(1)
+		go func(device *Device) {
+			defer wg.Done()
+
+			groups := scheduler.lockGroupsFor(device)
+			scheduler.waitLimiters(groups, device.handler, device)
+			unlock := scheduler.lockGroups(groups)
+			defer unlock()
+
+			// The device may have been removed while waiting.
+			if device.isRemoved() {
+				return
+			}
+			if err := pa.action.Action(plugin, device); err != nil {
+				alog.WithFields(log.Fields{
+					"device": device.id,
+					"error":  err,
+				}).Error("[scheduler] device periodic action failed")
+
+				lock.Lock()
+				multiErr.Add(fmt.Errorf("device %s: %w", device.id, err))
+				lock.Unlock()
+			}
+		}(device)
+	}
+	wg.Wait()
+
+	if err := multiErr.Err(); err != nil {
+		pa.check.Report("", fmt.Errorf("failed for %d of %d device(s): %v", len(multiErr.Errors), len(devices), err))
+		return err
+	}
+
+	alog.WithField("devices", len(devices)).Debug("[scheduler] device periodic action completed")
+	pa.check.Report(fmt.Sprintf("completed for %d device(s)", len(devices)), nil)
+	return nil
+}
@@ -0,0 +1,214 @@
+// Synse SDK
+// Copyright (c) 2017-2020 Vapor IO
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package sdk
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vapor-ware/synse-sdk/sdk/config"
+	"github.com/vapor-ware/synse-sdk/sdk/health"
+)
+
+func newPeriodicActionTestDevice(id, kind string, bus int) *Device {
+	return &Device{
+		id:      id,
+		Type:    kind,
+		Data:    map[string]interface{}{"bus": bus},
+		handler: &DeviceHandler{},
+	}
+}
+
+func TestScheduler_execPeriodicAction(t *testing.T) {
+	s := newTestScheduler(
+		newPeriodicActionTestDevice("1", "fan", 1),
+		newPeriodicActionTestDevice("2", "fan", 2),
+		newPeriodicActionTestDevice("3", "led", 1),
+	)
+
+	var lock sync.Mutex
+	var ran []string
+	pa, err := newPeriodicAction(&DeviceAction{
+		Name:     "test",
+		Filter:   map[string][]string{"type": {"fan"}},
+		Interval: time.Minute,
+		Action: func(p *Plugin, d *Device) error {
+			lock.Lock()
+			defer lock.Unlock()
+			ran = append(ran, d.id)
+			return nil
+		},
+	})
+	assert.NoError(t, err)
+
+	err = s.execPeriodicAction(pa)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"1", "2"}, ran)
+
+	status := pa.check.Status()
+	assert.True(t, status.Ok)
+	assert.Equal(t, "completed for 2 device(s)", status.Message)
+}
+
+func TestScheduler_execPeriodicAction_failure(t *testing.T) {
+	s := newTestScheduler(
+		newPeriodicActionTestDevice("1", "fan", 1),
+		newPeriodicActionTestDevice("2", "fan", 2),
+	)
+
+	pa, err := newPeriodicAction(&DeviceAction{
+		Name:     "test",
+		Filter:   map[string][]string{"type": {"fan"}},
+		Interval: time.Minute,
+		Action: func(p *Plugin, d *Device) error {
+			if d.id == "2" {
+				return fmt.Errorf("watchdog not armed")
+			}
+			return nil
+		},
+	})
+	assert.NoError(t, err)
+
+	err = s.execPeriodicAction(pa)
+	assert.Error(t, err)
+
+	status := pa.check.Status()
+	assert.False(t, status.Ok)
+	assert.Contains(t, status.Message, "failed for 1 of 2 device(s)")
+	assert.Contains(t, status.Message, "watchdog not armed")
+}
+
+func TestScheduler_execPeriodicAction_lockGroups(t *testing.T) {
+	s := newTestScheduler(
+		newPeriodicActionTestDevice("1", "fan", 1),
+		newPeriodicActionTestDevice("2", "fan", 1),
+		newPeriodicActionTestDevice("3", "fan", 1),
+		newPeriodicActionTestDevice("4", "fan", 2),
+		newPeriodicActionTestDevice("5", "fan", 2),
+		newPeriodicActionTestDevice("6", "fan", 2),
+	)
+	s.config.LockGroups = &config.LockGroupSettings{DataKey: "bus"}
+
+	bus1 := &concurrencyTracker{}
+	bus2 := &concurrencyTracker{}
+	all := &concurrencyTracker{}
+	pa, err := newPeriodicAction(&DeviceAction{
+		Name:     "test",
+		Filter:   map[string][]string{"type": {"fan"}},
+		Interval: time.Minute,
+		Action: func(p *Plugin, d *Device) error {
+			defer all.enter()()
+			if d.Data["bus"] == 1 {
+				bus1.run(50 * time.Millisecond)
+			} else {
+				bus2.run(50 * time.Millisecond)
+			}
+			return nil
+		},
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, s.execPeriodicAction(pa))
+
+	// Actions within a group are serialized, but groups run concurrently.
+	assert.Equal(t, int32(1), atomic.LoadInt32(&bus1.max))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&bus2.max))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&all.max))
+}
+
+func TestScheduler_execPeriodicAction_removedDevice(t *testing.T) {
+	device := newPeriodicActionTestDevice("1", "fan", 1)
+	device.markRemoved()
+	s := newTestScheduler(device)
+
+	var runs int32
+	pa, err := newPeriodicAction(&DeviceAction{
+		Name:     "test",
+		Filter:   map[string][]string{"type": {"fan"}},
+		Interval: time.Minute,
+		Action: func(p *Plugin, d *Device) error {
+			atomic.AddInt32(&runs, 1)
+			return nil
+		},
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, s.execPeriodicAction(pa))
+	assert.Equal(t, int32(0), runs)
+}
+
+func TestScheduler_schedulePeriodicActions(t *testing.T) {
+	s := newTestScheduler(newPeriodicActionTestDevice("1", "fan", 1))
+	s.health = health.NewManager(&config.HealthSettings{Checks: &config.HealthCheckSettings{}})
+
+	var runs int32
+	assert.NoError(t, s.deviceManager.AddDevicePeriodicActions(&DeviceAction{
+		Name:     "test",
+		Filter:   map[string][]string{"type": {"fan"}},
+		Interval: 10 * time.Millisecond,
+		Action: func(p *Plugin, d *Device) error {
+			atomic.AddInt32(&runs, 1)
+			return nil
+		},
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		s.schedulePeriodicActions()
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&runs) >= 3
+	}, time.Second, 5*time.Millisecond)
+
+	close(s.stop)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for periodic actions to stop")
+	}
+
+	assert.Equal(t, 1, s.health.Count())
+	status := s.health.Status()
+	assert.Len(t, status.Checks, 1)
+	assert.Equal(t, "device periodic action: test", status.Checks[0].Name)
+	assert.True(t, status.Checks[0].Ok)
+}
+
+func TestScheduler_schedulePeriodicActions_none(t *testing.T) {
+	s := newTestScheduler()
+
+	// With no periodic actions registered, this returns right away.
+	s.schedulePeriodicActions()
+}
+
+func TestPeriodicAction_next(t *testing.T) {
+	now := time.Date(2020, 1, 1, 10, 30, 15, 0, time.UTC)
+
+	pa, err := newPeriodicAction(&DeviceAction{Interval: 5 * time.Minute})
+	assert.NoError(t, err)
+	assert.Equal(t, now.Add(5*time.Minute), pa.next(now))
+
+	pa, err = newPeriodicAction(&DeviceAction{Schedule: "@hourly"})
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2020, 1, 1, 11, 0, 0, 0, time.UTC), pa.next(now))
+}
@@ -17,6 +17,8 @@
 package sdk
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"net/http"
@@ -24,11 +26,15 @@ import (
 	"os"
 	"os/signal"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
 
+	"github.com/creasty/defaults"
 	log "github.com/sirupsen/logrus"
 	"github.com/vapor-ware/synse-sdk/sdk/config"
-	"github.com/vapor-ware/synse-sdk/sdk/errors"
+	sdkError "github.com/vapor-ware/synse-sdk/sdk/errors"
+	"github.com/vapor-ware/synse-sdk/sdk/funcs"
 	"github.com/vapor-ware/synse-sdk/sdk/health"
 	"github.com/vapor-ware/synse-sdk/sdk/output"
 	"github.com/vapor-ware/synse-sdk/sdk/policy"
@@ -47,17 +53,56 @@ var (
 	flagDryRun  bool
 	flagPprof   bool
 
+	flagPprofAddr string
+
 	// Config file locations
 	currentDirConfig    = "."
 	localPluginConfig   = "./config"
 	defaultPluginConfig = "/etc/synse/plugin/config"
+
+	// defaultStopTimeout is the time a plugin is given to shut down gracefully
+	// when it is terminated via signal or context cancellation. Once elapsed,
+	// any remaining work is abandoned and the gRPC server is stopped forcefully.
+	defaultStopTimeout = 30 * time.Second
+
+	// defaultPprofAddr is the address which profiling data is served on when
+	// the plugin is run with profiling enabled.
+	defaultPprofAddr = "0.0.0.0:6060"
+)
+
+// Errors relating to Plugin construction.
+var (
+	// ErrVersionRequested is returned by New when the plugin's flag set was
+	// parsed with the '--version' flag. The version information is printed
+	// prior to returning, so the caller should typically just exit.
+	ErrVersionRequested = errors.New("plugin version requested: not creating plugin")
 )
 
 func init() {
 	flag.BoolVar(&flagDebug, "debug", false, "enable debug logging")
 	flag.BoolVar(&flagVersion, "version", false, "print the plugin version information")
 	flag.BoolVar(&flagDryRun, "dry-run", false, "run only the setup actions to verify functionality and configuration")
-	flag.BoolVar(&flagPprof, "pprof", false, "run the plugin with profiling enabled (port 6060)")
+	flag.BoolVar(&flagPprof, "pprof", false, "run the plugin with profiling enabled")
+	flag.StringVar(&flagPprofAddr, "pprof-addr", defaultPprofAddr, "the address to serve profiling data on")
+}
+
+// runOptions are the command line options which modify a plugin run.
+type runOptions struct {
+	debug   bool
+	version bool
+	dryRun  bool
+	pprof   bool
+
+	pprofAddr string
+}
+
+// addFlags defines the command line flags for the run options on the given flag set.
+func (opts *runOptions) addFlags(flags *flag.FlagSet) {
+	flags.BoolVar(&opts.debug, "debug", false, "enable debug logging")
+	flags.BoolVar(&opts.version, "version", false, "print the plugin version information")
+	flags.BoolVar(&opts.dryRun, "dry-run", false, "run only the setup actions to verify functionality and configuration")
+	flags.BoolVar(&opts.pprof, "pprof", false, "run the plugin with profiling enabled")
+	flags.StringVar(&opts.pprofAddr, "pprof-addr", defaultPprofAddr, "the address to serve profiling data on")
 }
 
 // PluginAction defines an action that can be run before or after the main
@@ -82,17 +127,41 @@ type Plugin struct {
 
 	// Options and handlers
 	pluginHandlers *PluginHandlers
+	runOptions     runOptions
+	flags          *flag.FlagSet
+	args           []string
+	configProvided bool
+
+	// Registries for the outputs and transform functions which device
+	// configurations reference by name.
+	outputs *output.Registry
+	funcs   *funcs.Registry
 
 	// Plugin components
-	scheduler *scheduler
-	state     *stateManager
-	device    *deviceManager
-	server    *server
-	health    *health.Manager
+	scheduler  *scheduler
+	state      *stateManager
+	device     *deviceManager
+	server     *server
+	health     *health.Manager
+	reloader   *deviceReloader
+	discoverer *deviceDiscoverer
+
+	// Shutdown state. The stopping channel is closed once a shutdown has been
+	// requested, and the stopped channel is closed once it has completed.
+	stopOnce sync.Once
+	stopping chan struct{}
+	stopped  chan struct{}
+	stopErr  error
+	stopCtx  context.Context
 }
 
-// NewPlugin creates a new instance of a Plugin. This should be the only
-// way that a Plugin is initialized.
+// NewPlugin creates a new instance of a Plugin. This is the constructor for
+// standalone plugins, where the plugin owns the process.
+//
+// It parses the command line flags, requires the plugin metadata to have been
+// set via SetPluginInfo, and uses the package-level output and func registries.
+// Beyond that, it behaves the same as New; the provided options are applied on
+// top of the global state, so they take precedence.
 //
 // This constructor will load the plugin configuration; if it is not present
 // or invalid, this will fail. All other Plugin component initialization
@@ -104,13 +173,6 @@ func NewPlugin(options ...PluginOption) (*Plugin, error) {
 	flag.Parse()
 	handleRunOptions()
 
-	// Since this is essentially the entry point for the plugin and setup actions
-	// occur as part of plugin construction, we want to set the log level as early
-	// as possible. If the debug flag is set, set the level to debug.
-	if flagDebug {
-		log.SetLevel(log.DebugLevel)
-	}
-
 	// Various things use the plugin metadata on setup, so we need to make sure
 	// it is set prior to initializing the plugin.
 	if metadata.Name == "" {
@@ -120,15 +182,49 @@ func NewPlugin(options ...PluginOption) (*Plugin, error) {
 		)
 	}
 
+	globals := []PluginOption{
+		CustomPluginMetadata(metadata),
+		func(plugin *Plugin) {
+			plugin.version = version
+		},
+		CustomOutputRegistry(output.DefaultRegistry()),
+		CustomFuncRegistry(funcs.DefaultRegistry()),
+		func(plugin *Plugin) {
+			plugin.runOptions = runOptions{
+				debug:  flagDebug,
+				dryRun: flagDryRun,
+			}
+		},
+	}
+	return New(append(globals, options...)...)
+}
+
+// New creates a new instance of a Plugin which is configured entirely through
+// the provided options. Unlike NewPlugin, it does not depend on any package-level
+// state, so it can be used to embed a plugin in a larger application or to run
+// multiple plugins in the same process.
+//
+// The plugin metadata must be provided via the CustomPluginMetadata option. All
+// other options are optional:
+//   - CustomPluginVersion provides the plugin version information, otherwise only
+//     the SDK version is known.
+//   - CustomPluginConfig provides the plugin config, otherwise it is loaded from file.
+//   - CustomFlagSet defines and parses the plugin command line flags, otherwise
+//     no flags are parsed.
+//   - CustomOutputRegistry and CustomFuncRegistry provide the registries which
+//     device configs are resolved against, otherwise new registries containing only
+//     the SDK built-ins are used.
+//
+// All other Plugin component initialization is deferred until Run is called.
+func New(options ...PluginOption) (*Plugin, error) {
 	log.Debug("[plugin] creating new plugin")
 
 	// Create the plugin. We create the instance first so a reference to it
 	// is available for subsequent setup actions.
 	p := Plugin{
-		version:        version,
-		info:           &metadata,
-		config:         new(config.Plugin),
-		quit:           make(chan os.Signal),
+		quit:           make(chan os.Signal, 1),
+		stopping:       make(chan struct{}),
+		stopped:        make(chan struct{}),
 		policies:       policy.NewDefaultPolicies(),
 		pluginHandlers: NewDefaultPluginHandlers(),
 	}
@@ -139,7 +235,49 @@ func NewPlugin(options ...PluginOption) (*Plugin, error) {
 		option(&p)
 	}
 
+	if p.version == nil {
+		p.version = newPluginVersion(VersionInfo{})
+	}
+
+	// Parse the plugin command line flags, if a flag set was provided.
+	if p.flags != nil {
+		p.runOptions.addFlags(p.flags)
+		if err := p.flags.Parse(p.args); err != nil {
+			log.WithField("error", err).Error("[plugin] failed to parse command line flags")
+			return nil, err
+		}
+		if err := p.handleRunOptions(); err != nil {
+			return nil, err
+		}
+	}
+
+	// Since this is essentially the entry point for the plugin and setup actions
+	// occur as part of plugin construction, we want to set the log level as early
+	// as possible. If the debug flag is set, set the level to debug.
+	if p.runOptions.debug {
+		log.SetLevel(log.DebugLevel)
+	}
+
+	// Various things use the plugin metadata on setup, so we need to make sure
+	// it is set prior to initializing the plugin.
+	if p.info == nil || p.info.Name == "" {
+		return nil, fmt.Errorf(
+			"plugin metadata must be set when creating a plugin; " +
+				"this can be done via the 'CustomPluginMetadata' option",
+		)
+	}
+
+	if p.outputs == nil {
+		p.outputs = output.NewRegistry()
+	}
+	if p.funcs == nil {
+		p.funcs = funcs.NewRegistry()
+	}
+
 	// Load the plugin configuration.
+	if p.config == nil {
+		p.config = new(config.Plugin)
+	}
 	if err := p.loadConfig(); err != nil {
 		log.Errorf("[plugin] failed to load plugin config")
 		return nil, err
@@ -152,12 +290,12 @@ func NewPlugin(options ...PluginOption) (*Plugin, error) {
 	}
 
 	// Log the plugin metadata, version info, and config.
-	metadata.log()
-	version.Log()
+	p.info.log()
+	p.version.Log()
 	p.config.Log()
 
 	// Initialize the plugin ID namespace.
-	id, err := newPluginID(p.config.ID, &metadata)
+	id, err := newPluginID(p.config.ID, p.info)
 	if err != nil {
 		log.Error("[plugin] failed to initialize plugin ID namespace")
 		return nil, err
@@ -174,6 +312,8 @@ func NewPlugin(options ...PluginOption) (*Plugin, error) {
 	p.state = newStateManager(p.config.Settings, p.device)
 	p.scheduler = newScheduler(&p)
 	p.server = newServer(&p)
+	p.reloader = newDeviceReloader(&p)
+	p.discoverer = newDeviceDiscoverer(&p)
 
 	return &p, nil
 }
@@ -182,9 +322,21 @@ func NewPlugin(options ...PluginOption) (*Plugin, error) {
 //
 // This is the functional starting point for all plugins. Once this is called,
 // the plugin will initialize all of its components and validate its state. Once
-// everything is ready, it will run each of its components. The gRPC server is
-// run in the foreground; all other components are run as goroutines.
+// everything is ready, it will run each of its components. Run blocks until the
+// plugin is terminated, either via signal (SIGTERM, SIGINT) or a call to Stop.
 func (plugin *Plugin) Run() error {
+	return plugin.RunContext(context.Background())
+}
+
+// RunContext starts the plugin and runs it until the provided context is
+// cancelled, a termination signal (SIGTERM, SIGINT) is received, or Stop is
+// called.
+//
+// In any of those cases, the plugin is shut down gracefully (see Stop) and
+// RunContext returns once shutdown has completed, rather than exiting the
+// process. This allows a plugin to be embedded in a larger application which
+// manages its own lifecycle.
+func (plugin *Plugin) RunContext(ctx context.Context) error {
 	// Initialize the plugin and its components.
 	if err := plugin.initialize(); err != nil {
 		log.Error("[plugin] failed to initialize plugin")
@@ -196,6 +348,8 @@ func (plugin *Plugin) Run() error {
 	plugin.state.registerActions(plugin)
 	plugin.scheduler.registerActions(plugin)
 	plugin.server.registerActions(plugin)
+	plugin.reloader.registerActions(plugin)
+	plugin.discoverer.registerActions(plugin)
 
 	// Run pre-run actions, if any exist.
 	if err := plugin.execPreRun(); err != nil {
@@ -203,18 +357,88 @@ func (plugin *Plugin) Run() error {
 		return err
 	}
 
-	// Listen for plugin quit.
-	go plugin.onQuitSignal()
-
 	// If the plugin was run with the '--dry-run' flag, end the run here
 	// before we actually start any of the plugin components.
-	if flagDryRun {
+	if plugin.runOptions.dryRun {
 		log.Info("[plugin] dry-run successful")
-		os.Exit(0)
+		return nil
+	}
+
+	// Register system calls for graceful stopping.
+	signal.Notify(plugin.quit, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(plugin.quit)
+	log.Info("[plugin] will terminate on: [SIGTERM, SIGINT]")
+
+	// Run the plugin. The gRPC server blocks while it is serving, so the
+	// plugin is run in a goroutine and its result collected on termination.
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- plugin.run()
+	}()
+
+	select {
+	case sig := <-plugin.quit:
+		log.WithField("signal", sig.String()).Info("[plugin] terminating plugin")
+	case <-ctx.Done():
+		log.WithField("reason", ctx.Err()).Info("[plugin] context done, terminating plugin")
+	case <-plugin.stopping:
+		log.Info("[plugin] stop requested, terminating plugin")
+	case err := <-serveErr:
+		// The plugin stopped running without a shutdown having been requested,
+		// e.g. a component failed to start. Clean up what is running and return
+		// the error which caused the plugin to terminate.
+		log.WithField("error", err).Error("[plugin] plugin terminated unexpectedly")
+		stopCtx, cancel := context.WithTimeout(context.Background(), defaultStopTimeout)
+		defer cancel()
+		if stopErr := plugin.Stop(stopCtx); stopErr != nil {
+			log.WithField("error", stopErr).Error("[plugin] failed to stop plugin")
+		}
+		return err
+	}
+
+	stopCtx, cancel := context.WithTimeout(context.Background(), defaultStopTimeout)
+	defer cancel()
+	if err := plugin.Stop(stopCtx); err != nil {
+		log.WithField("error", err).Error("[plugin] failed to stop plugin gracefully")
+		return err
 	}
 
-	// Run the plugin.
-	return plugin.run()
+	// Once the server has been stopped, the run goroutine will return.
+	if err := <-serveErr; err != nil {
+		return err
+	}
+	log.Info("[done]")
+	return nil
+}
+
+// Stop gracefully shuts down a running plugin.
+//
+// On shutdown, the plugin stops accepting new writes, allows in-progress reads
+// and writes to complete, fails any writes which are still queued, and gracefully
+// stops the gRPC server. Post-run actions are executed as part of shutdown.
+//
+// The provided context bounds the shutdown. If it is done before shutdown completes,
+// any remaining work is abandoned and its error is returned. Stop may be called more
+// than once; only the first call initiates the shutdown, subsequent calls wait for
+// it to complete.
+func (plugin *Plugin) Stop(ctx context.Context) error {
+	plugin.stopOnce.Do(func() {
+		// The stop context is set before shutdown starts, so the post-run actions
+		// which read it do not race with it being set.
+		plugin.stopCtx = ctx
+		close(plugin.stopping)
+		go func() {
+			plugin.stopErr = plugin.shutdown()
+			close(plugin.stopped)
+		}()
+	})
+
+	select {
+	case <-plugin.stopped:
+		return plugin.stopErr
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 // RegisterHealthChecks registers custom health checks with the plugin.
@@ -234,7 +458,18 @@ func (plugin *Plugin) RegisterHealthChecks(checks ...health.Check) error {
 // If any registered output names conflict with those of built-in or other custom
 // outputs, an error is returned.
 func (plugin *Plugin) RegisterOutputs(outputs ...*output.Output) error {
-	return output.Register(outputs...)
+	return plugin.outputRegistry().Register(outputs...)
+}
+
+// RegisterFuncs registers new transform Funcs with the plugin. A plugin will
+// automatically register the built-in SDK funcs. This function allows a plugin to
+// augment that set of funcs with its own custom funcs, which device configs may
+// then reference in their "apply" transforms.
+//
+// If any registered func names conflict with those of built-in or other custom
+// funcs, an error is returned.
+func (plugin *Plugin) RegisterFuncs(fns ...*funcs.Func) error {
+	return plugin.funcRegistry().Register(fns...)
 }
 
 // RegisterPreRunActions registers actions with the Plugin which will be called prior
@@ -269,16 +504,108 @@ func (plugin *Plugin) RegisterDeviceSetupActions(actions ...*DeviceAction) error
 	return plugin.device.AddDeviceSetupActions(actions...)
 }
 
+// RegisterDevicePeriodicActions registers actions with the device manager which
+// will be executed periodically while the plugin is running, at each action's
+// interval or schedule. These actions are used for recurring device-specific
+// maintenance, such as re-arming a watchdog or refreshing a session token.
+func (plugin *Plugin) RegisterDevicePeriodicActions(actions ...*DeviceAction) error {
+	return plugin.device.AddDevicePeriodicActions(actions...)
+}
+
 // NewDevice creates a new device, using the Device handlers registered with the plugin.
 //
 // Note that this does not add the new device to the plugin.
 func (plugin *Plugin) NewDevice(proto *config.DeviceProto, instance *config.DeviceInstance) (*Device, error) {
-	return NewDeviceFromConfig(proto, instance, plugin.device.handlers)
+	return newDeviceFromConfig(proto, instance, plugin.device.handlers, plugin.deviceResources())
+}
+
+// ReloadDevices reloads the plugin's device configuration and reconciles the
+// plugin's devices against it. Devices are matched by ID: new devices are added,
+// devices whose configuration changed are replaced, and devices which are no longer
+// configured are removed. Devices which were not created from device config files
+// (e.g. those registered directly or via dynamic registration) are not affected.
+//
+// A reload also happens automatically when the plugin receives SIGHUP, or when the
+// device config files change if watching is enabled in the plugin config.
+func (plugin *Plugin) ReloadDevices() (*DeviceReloadResult, error) {
+	return plugin.reloader.reload()
 }
 
-// AddDevice adds a new device to the plugin's device manager.
+// AddDevice adds a new device to the plugin's device manager. If the plugin is
+// already running, reading from the device is started immediately.
 func (plugin *Plugin) AddDevice(device *Device) error {
-	return plugin.device.AddDevice(device)
+	if err := plugin.device.AddDevice(device); err != nil {
+		return err
+	}
+	plugin.attachDevices(device)
+	return nil
+}
+
+// RemoveDevice removes a device from the plugin. The device is no longer read
+// from or written to, its listener (if any) is stopped, and its readings and
+// cached tag and alias lookups are purged. Reads and writes which are in progress
+// for the device when it is removed are allowed to finish, but their results are
+// discarded.
+//
+// If no device exists with the given ID, ErrDeviceNotFound is returned.
+func (plugin *Plugin) RemoveDevice(id string) error {
+	device := plugin.device.removeDevice(id)
+	if device == nil {
+		return ErrDeviceNotFound
+	}
+	plugin.detachDevices(device)
+	return nil
+}
+
+// ReplaceDevice replaces the device with the given ID with a new device. The old
+// device is removed as it would be with RemoveDevice, and the new device is added
+// as it would be with AddDevice. The new device may have the same ID as the one
+// it replaces.
+//
+// If the new device can not be added (e.g. it conflicts with another device),
+// an error is returned and the old device is left in place.
+func (plugin *Plugin) ReplaceDevice(old string, device *Device) error {
+	replaced, err := plugin.device.replaceDevice(old, device)
+	if err != nil {
+		return err
+	}
+	plugin.detachDevices(replaced)
+	plugin.attachDevices(device)
+	return nil
+}
+
+// attachDevices starts the per-device jobs (reads and listeners) for devices
+// which were added while the plugin is running. For devices which are bulk read,
+// their handler's bulk read loop is started if it is not already running. Devices
+// which were added before the plugin started are attached when the scheduler starts.
+func (plugin *Plugin) attachDevices(devices ...*Device) {
+	if plugin.scheduler == nil {
+		return
+	}
+	for _, device := range devices {
+		plugin.scheduler.startReader(device)
+		plugin.scheduler.startListener(device)
+	}
+}
+
+// detachDevices stops any per-device jobs for devices which were removed from
+// the plugin, releases their circuit breakers and rate limiters, and purges
+// their readings. A bulk read loop is stopped once its handler has no devices
+// left.
+func (plugin *Plugin) detachDevices(devices ...*Device) {
+	ids := make([]string, 0, len(devices))
+	for _, device := range devices {
+		if plugin.scheduler != nil {
+			plugin.scheduler.stopReader(device)
+			plugin.scheduler.stopListener(device)
+			plugin.scheduler.removeCircuitBreaker(device)
+			plugin.scheduler.removeLimiter(device)
+		}
+		ids = append(ids, device.id)
+	}
+	if plugin.state != nil {
+		plugin.state.removeReadings(ids...)
+	}
 }
 
 // GetDevice gets a device from the plugin's device manager.
@@ -286,6 +613,18 @@ func (plugin *Plugin) GetDevice(id string) *Device {
 	return plugin.device.GetDevice(id)
 }
 
+// Stats gets a snapshot of the read and write statistics which the plugin has
+// collected for its devices, and the bulk read statistics for its device handlers.
+func (plugin *Plugin) Stats() *SchedulerStats {
+	if plugin.scheduler == nil {
+		return &SchedulerStats{
+			Devices:  map[string]*DeviceStats{},
+			Handlers: map[string]*OperationStats{},
+		}
+	}
+	return plugin.scheduler.stats()
+}
+
 // GenerateDeviceID generates the deterministic ID for a device using the data contained
 // within a Device definition as well as the DeviceIdentifier function, whether custom or
 // default.
@@ -339,42 +678,36 @@ func (plugin *Plugin) run() error {
 	plugin.health.Start()
 	plugin.state.Start()
 	plugin.scheduler.Start()
+	plugin.reloader.Start()
+	plugin.discoverer.Start()
 
 	// Run the gRPC server. This will block while running until the
 	// plugin is terminated.
 	return plugin.server.start()
 }
 
-// onQuitSignal is a function that runs as a goroutine during plugin Run. It
-// listens for a quit signal and will terminate the plugin when such a signal
-// is received.
-//
-// Post-run actions are executed here as part of plugin termination.
-func (plugin *Plugin) onQuitSignal() {
-	// Register system calls for graceful stopping.
-	signal.Notify(plugin.quit, syscall.SIGTERM)
-	signal.Notify(plugin.quit, syscall.SIGINT)
-
-	log.Info("[plugin] will terminate on: [SIGTERM, SIGINT]")
-
-	// Listen for the quit signal(s). This will block until a signal
-	// is received.
-	sig := <-plugin.quit
-
-	// If we get here, a signal was received, so we can run termination actions.
-	log.WithFields(log.Fields{
-		"signal": sig.String(),
-	}).Info("[plugin] terminating plugin")
+// shutdown terminates the plugin by running its post-run actions, which include
+// the teardown actions for plugin components.
+func (plugin *Plugin) shutdown() error {
+	log.Info("[plugin] shutting down")
 
 	if err := plugin.execPostRun(); err != nil {
 		log.WithFields(log.Fields{
 			"error": err,
 		}).Error("[plugin] failed post-run action execution")
-		os.Exit(1)
+		return err
 	}
+	return nil
+}
 
-	log.Info("[done]")
-	os.Exit(0)
+// stopContext gets the context which bounds the plugin shutdown. Post-run actions
+// which may block should use this context. If the plugin is not shutting down, a
+// background context is returned.
+func (plugin *Plugin) stopContext() context.Context {
+	if plugin.stopCtx == nil {
+		return context.Background()
+	}
+	return plugin.stopCtx
 }
 
 // execPreRun executes the pre-run actions for the plugin.
@@ -383,7 +716,7 @@ func (plugin *Plugin) execPreRun() error {
 		return nil
 	}
 
-	var multiErr = errors.NewMultiError("Pre-Run Actions")
+	var multiErr = sdkError.NewMultiError("Pre-Run Actions")
 
 	log.WithFields(log.Fields{
 		"actions": len(plugin.preRun),
@@ -406,7 +739,7 @@ func (plugin *Plugin) execPostRun() error {
 		return nil
 	}
 
-	var multiErr = errors.NewMultiError("Post-Run Actions")
+	var multiErr = sdkError.NewMultiError("Post-Run Actions")
 
 	log.WithFields(log.Fields{
 		"actions": len(plugin.postRun),
@@ -423,9 +756,52 @@ func (plugin *Plugin) execPostRun() error {
 	return multiErr.Err()
 }
 
+// outputRegistry gets the output registry for the plugin. If the plugin does not
+// have its own registry, the package-level registry is used.
+func (plugin *Plugin) outputRegistry() *output.Registry {
+	if plugin.outputs == nil {
+		return output.DefaultRegistry()
+	}
+	return plugin.outputs
+}
+
+// funcRegistry gets the func registry for the plugin. If the plugin does not
+// have its own registry, the package-level registry is used.
+func (plugin *Plugin) funcRegistry() *funcs.Registry {
+	if plugin.funcs == nil {
+		return funcs.DefaultRegistry()
+	}
+	return plugin.funcs
+}
+
+// deviceResources gets the plugin-scoped resources used for building devices.
+func (plugin *Plugin) deviceResources() *deviceResources {
+	meta := plugin.info
+	if meta == nil {
+		meta = &PluginMetadata{}
+	}
+	return &deviceResources{
+		meta:    meta,
+		outputs: plugin.outputRegistry(),
+		funcs:   plugin.funcRegistry(),
+	}
+}
+
 // loadConfig loads plugin configurations from file and environment
 // and marshals that data into the Plugin's config struct.
+//
+// If the plugin was provided a config via the CustomPluginConfig option,
+// that config is used instead, with defaults applied for any unset fields.
 func (plugin *Plugin) loadConfig() error {
+	if plugin.configProvided {
+		log.Debug("[plugin] using provided plugin configuration")
+		if err := defaults.Set(plugin.config); err != nil {
+			log.WithField("error", err).Error("[plugin] failed to set plugin config defaults")
+			return err
+		}
+		return nil
+	}
+
 	// Setup the config loader for the plugin.
 	loader := config.NewYamlLoader("plugin")
 	loader.EnvPrefix = "PLUGIN"
@@ -447,6 +823,21 @@ func (plugin *Plugin) loadConfig() error {
 	return loader.Scan(plugin.config)
 }
 
+// handleRunOptions checks whether any run options were specified via the plugin's
+// flag set and handles them appropriately. If the version was requested, it is
+// printed and ErrVersionRequested is returned.
+func (plugin *Plugin) handleRunOptions() error {
+	if plugin.runOptions.pprof {
+		servePprof(plugin.runOptions.pprofAddr)
+	}
+
+	if plugin.runOptions.version {
+		fmt.Println(plugin.version.format())
+		return ErrVersionRequested
+	}
+	return nil
+}
+
 // handleRunOptions checks whether any command line options were specified for
 // the plugin run. If any are set, it handles them appropriately.
 func handleRunOptions() {
@@ -463,12 +854,7 @@ func handleRunOptions() {
 	}
 
 	if flagPprof {
-		log.Info("[plugin] running plugin with profiling enabled (0.0.0.0:6060)")
-		go func() {
-			if err := http.ListenAndServe("0.0.0.0:6060", nil); err != nil {
-				log.WithError(err).Error("[plugin] error serving pprof data on 0.0.0.0:6060")
-			}
-		}()
+		servePprof(flagPprofAddr)
 	}
 
 	if terminate {
@@ -476,3 +862,17 @@ func handleRunOptions() {
 		os.Exit(0)
 	}
 }
+
+// servePprof serves profiling data on the given address in the background. If no
+// address is given, the default address is used.
+func servePprof(addr string) {
+	if addr == "" {
+		addr = defaultPprofAddr
+	}
+	log.WithField("addr", addr).Info("[plugin] running plugin with profiling enabled")
+	go func() {
+		if err := http.ListenAndServe(addr, nil); err != nil {
+			log.WithError(err).WithField("addr", addr).Error("[plugin] error serving pprof data")
+		}
+	}()
+}
@@ -17,7 +17,11 @@
 package sdk
 
 import (
+	"context"
+	"flag"
 	"fmt"
+	"io/ioutil"
+	"sync"
 	"testing"
 	"time"
 
@@ -27,7 +31,9 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/vapor-ware/synse-sdk/internal/test"
 	"github.com/vapor-ware/synse-sdk/sdk/config"
+	"github.com/vapor-ware/synse-sdk/sdk/funcs"
 	"github.com/vapor-ware/synse-sdk/sdk/health"
+	"github.com/vapor-ware/synse-sdk/sdk/output"
 	"github.com/vapor-ware/synse-sdk/sdk/policy"
 )
 
@@ -116,6 +122,208 @@ func TestNewPlugin_noConfig(t *testing.T) {
 	assert.Nil(t, p)
 }
 
+func TestNew(t *testing.T) {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	outputs := output.NewRegistry()
+	fns := funcs.NewRegistry()
+
+	p, err := New(
+		CustomPluginMetadata(PluginMetadata{Name: "embedded"}),
+		CustomPluginConfig(&config.Plugin{Version: 3}),
+		CustomPluginVersion(VersionInfo{PluginVersion: "1.0.0"}),
+		CustomFlagSet(flags, []string{"--dry-run", "--pprof-addr", "localhost:6161"}),
+		CustomOutputRegistry(outputs),
+		CustomFuncRegistry(fns),
+		DeviceConfigOptional(),
+	)
+	assert.NoError(t, err)
+	assert.NotNil(t, p)
+
+	assert.Equal(t, "embedded", p.info.Name)
+	assert.Equal(t, 3, p.config.Version)
+	assert.NotNil(t, p.config.Settings) // defaults applied
+	assert.NotNil(t, p.config.Network)
+	assert.Equal(t, "1.0.0", p.version.PluginVersion)
+	assert.True(t, p.runOptions.dryRun)
+	assert.False(t, p.runOptions.pprof)
+	assert.Equal(t, "localhost:6161", p.runOptions.pprofAddr)
+	assert.True(t, flags.Parsed())
+	assert.Equal(t, outputs, p.outputs)
+	assert.Equal(t, fns, p.funcs)
+	assert.NotNil(t, p.id)
+	assert.NotNil(t, p.health)
+	assert.NotNil(t, p.state)
+	assert.NotNil(t, p.device)
+	assert.NotNil(t, p.scheduler)
+	assert.NotNil(t, p.server)
+}
+
+func TestNew_isolatedRegistries(t *testing.T) {
+	p, err := New(
+		CustomPluginMetadata(PluginMetadata{Name: "embedded"}),
+		CustomPluginConfig(&config.Plugin{}),
+	)
+	assert.NoError(t, err)
+	assert.NotNil(t, p)
+
+	// The plugin does not use the version set via the package variables.
+	assert.NotSame(t, version, p.version)
+	assert.Equal(t, "-", p.version.PluginVersion)
+
+	err = p.RegisterOutputs(&output.Output{Name: "test-embedded-output"})
+	assert.NoError(t, err)
+	assert.NotNil(t, p.outputs.Get("test-embedded-output"))
+	assert.Nil(t, output.Get("test-embedded-output"))
+
+	err = p.RegisterFuncs(&funcs.Func{Name: "test-embedded-func"})
+	assert.NoError(t, err)
+	assert.NotNil(t, p.funcs.Get("test-embedded-func"))
+	assert.Nil(t, funcs.Get("test-embedded-func"))
+}
+
+func TestNew_noMetadata(t *testing.T) {
+	p, err := New(
+		CustomPluginConfig(&config.Plugin{}),
+	)
+	assert.Error(t, err)
+	assert.Nil(t, p)
+}
+
+func TestNew_badFlags(t *testing.T) {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+
+	p, err := New(
+		CustomPluginMetadata(PluginMetadata{Name: "embedded"}),
+		CustomFlagSet(flags, []string{"--not-a-flag"}),
+	)
+	assert.Error(t, err)
+	assert.Nil(t, p)
+}
+
+func TestNew_versionRequested(t *testing.T) {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+
+	p, err := New(
+		CustomPluginMetadata(PluginMetadata{Name: "embedded"}),
+		CustomFlagSet(flags, []string{"--version"}),
+	)
+	assert.Equal(t, ErrVersionRequested, err)
+	assert.Nil(t, p)
+}
+
+func TestPlugin_NewDevice_pluginRegistries(t *testing.T) {
+	outputs := output.NewRegistry()
+	err := outputs.Register(&output.Output{Name: "test-plugin-output"})
+	assert.NoError(t, err)
+
+	p := Plugin{
+		info:    &PluginMetadata{Name: "embedded"},
+		outputs: outputs,
+		funcs:   funcs.NewRegistry(),
+		device: &deviceManager{
+			handlers: map[string]*DeviceHandler{
+				"foo": {Name: "foo"},
+			},
+		},
+	}
+
+	device, err := p.NewDevice(
+		&config.DeviceProto{Type: "foo"},
+		&config.DeviceInstance{
+			Output: "test-plugin-output",
+			Alias:  &config.DeviceAlias{Template: "{{.Meta.Name}}"},
+		},
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, "test-plugin-output", device.Output)
+	assert.Equal(t, "embedded", device.Alias)
+
+	// The output is not registered globally, so creating the device without
+	// the plugin's registry should fail.
+	_, err = NewDeviceFromConfig(
+		&config.DeviceProto{Type: "foo"},
+		&config.DeviceInstance{Output: "test-plugin-output"},
+		p.device.handlers,
+	)
+	assert.Error(t, err)
+}
+
+// newRunnablePlugin creates a plugin from test configuration which can be run
+// in tests: it has no device config requirement and writes no health file.
+func newRunnablePlugin(t *testing.T) *Plugin {
+	origPath := currentDirConfig
+	metadata = PluginMetadata{Name: "test"}
+	defer func() {
+		currentDirConfig = origPath
+		metadata = PluginMetadata{}
+	}()
+	currentDirConfig = "./testdata/plugin"
+
+	p, err := NewPlugin(DeviceConfigOptional())
+	assert.NoError(t, err)
+	p.config.Health.HealthFile = ""
+	return p
+}
+
+func TestPlugin_RunContext_contextCancelled(t *testing.T) {
+	p := newRunnablePlugin(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() {
+		errs <- p.RunContext(ctx)
+	}()
+
+	// Give the plugin a moment to start up before cancelling.
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-errs:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("plugin did not return from RunContext after context cancelled")
+	}
+	assert.True(t, p.scheduler.isStopped())
+}
+
+func TestPlugin_Stop(t *testing.T) {
+	p := newRunnablePlugin(t)
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- p.Run()
+	}()
+
+	// Give the plugin a moment to start up before stopping.
+	time.Sleep(100 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, p.Stop(ctx))
+
+	// Stopping again should wait on the same shutdown and not error.
+	assert.NoError(t, p.Stop(ctx))
+
+	select {
+	case err := <-errs:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("plugin did not return from Run after Stop")
+	}
+}
+
+func TestPlugin_stopContext(t *testing.T) {
+	p := Plugin{}
+	assert.Equal(t, context.Background(), p.stopContext())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p.stopCtx = ctx
+	assert.Equal(t, ctx, p.stopContext())
+}
+
 func TestPlugin_RegisterHealthChecks_noneRegistered(t *testing.T) {
 	p := Plugin{
 		health: health.NewManager(&config.HealthSettings{}),
@@ -773,6 +981,144 @@ func TestPlugin_AddDevice(t *testing.T) {
 	assert.Len(t, device.Tags, 3) // two additional system-generated tags added
 }
 
+func TestPlugin_RemoveDevice(t *testing.T) {
+	handler := DeviceHandler{Name: "foo"}
+	pluginid := &pluginID{uuid: uuid.NewSHA1(uuid.NameSpaceDNS, []byte("test"))}
+	p := Plugin{
+		pluginHandlers: NewDefaultPluginHandlers(),
+		id:             pluginid,
+		device: &deviceManager{
+			aliasCache:     NewAliasCache(),
+			tagCache:       NewTagCache(),
+			id:             pluginid,
+			pluginHandlers: NewDefaultPluginHandlers(),
+			handlers: map[string]*DeviceHandler{
+				"foo": &handler,
+			},
+			devices: map[string]*Device{},
+		},
+		state: &stateManager{
+			readings:     map[string][]*output.Reading{},
+			readingsLock: &sync.RWMutex{},
+		},
+		scheduler: &scheduler{},
+	}
+	p.device.plugin = &p
+	device := Device{
+		Type:    "testtype",
+		Handler: "foo",
+		Data: map[string]interface{}{
+			"id":  1,
+			"foo": "bar",
+		},
+		Tags: []*Tag{
+			{Namespace: "default", Label: "foo"},
+		},
+		Alias: "example-alias-1",
+	}
+
+	err := p.AddDevice(&device)
+	assert.NoError(t, err)
+	p.state.readings[device.id] = []*output.Reading{{Value: 1}}
+
+	err = p.RemoveDevice(device.id)
+	assert.NoError(t, err)
+
+	assert.Empty(t, p.device.devices)
+	assert.Empty(t, p.device.tagCache.cache)
+	assert.Empty(t, p.device.aliasCache.cache)
+	assert.Empty(t, p.state.readings)
+	assert.True(t, device.isRemoved())
+	assert.Nil(t, p.GetDevice(device.id))
+}
+
+func TestPlugin_RemoveDevice_notFound(t *testing.T) {
+	p := Plugin{
+		device: &deviceManager{
+			devices: map[string]*Device{},
+		},
+	}
+
+	err := p.RemoveDevice("123")
+	assert.Equal(t, ErrDeviceNotFound, err)
+}
+
+func TestPlugin_ReplaceDevice(t *testing.T) {
+	handler := DeviceHandler{Name: "foo"}
+	pluginid := &pluginID{uuid: uuid.NewSHA1(uuid.NameSpaceDNS, []byte("test"))}
+	p := Plugin{
+		pluginHandlers: NewDefaultPluginHandlers(),
+		id:             pluginid,
+		device: &deviceManager{
+			aliasCache:     NewAliasCache(),
+			tagCache:       NewTagCache(),
+			id:             pluginid,
+			pluginHandlers: NewDefaultPluginHandlers(),
+			handlers: map[string]*DeviceHandler{
+				"foo": &handler,
+			},
+			devices: map[string]*Device{},
+		},
+		state: &stateManager{
+			readings:     map[string][]*output.Reading{},
+			readingsLock: &sync.RWMutex{},
+		},
+		scheduler: &scheduler{},
+	}
+	p.device.plugin = &p
+	old := Device{
+		Type:    "testtype",
+		Handler: "foo",
+		Data:    map[string]interface{}{"id": 1},
+		Alias:   "example-alias-1",
+	}
+	err := p.AddDevice(&old)
+	assert.NoError(t, err)
+	p.state.readings[old.id] = []*output.Reading{{Value: 1}}
+
+	// Replace the device with a new instance which has the same ID.
+	device := Device{
+		Type:    "testtype",
+		Handler: "foo",
+		Data:    map[string]interface{}{"id": 1},
+		Alias:   "example-alias-1",
+		Info:    "replaced",
+	}
+	err = p.ReplaceDevice(old.id, &device)
+	assert.NoError(t, err)
+
+	assert.Len(t, p.device.devices, 1)
+	assert.Equal(t, &device, p.GetDevice(old.id))
+	assert.Equal(t, &device, p.device.aliasCache.Get("example-alias-1"))
+	assert.Empty(t, p.state.readings)
+	assert.True(t, old.isRemoved())
+	assert.False(t, device.isRemoved())
+}
+
+func TestPlugin_ReplaceDevice_notFound(t *testing.T) {
+	handler := DeviceHandler{Name: "foo"}
+	pluginid := &pluginID{uuid: uuid.NewSHA1(uuid.NameSpaceDNS, []byte("test"))}
+	p := Plugin{
+		pluginHandlers: NewDefaultPluginHandlers(),
+		id:             pluginid,
+		device: &deviceManager{
+			aliasCache:     NewAliasCache(),
+			tagCache:       NewTagCache(),
+			id:             pluginid,
+			pluginHandlers: NewDefaultPluginHandlers(),
+			handlers: map[string]*DeviceHandler{
+				"foo": &handler,
+			},
+			devices: map[string]*Device{},
+		},
+	}
+	p.device.plugin = &p
+
+	err := p.ReplaceDevice("123", &Device{Type: "testtype", Handler: "foo"})
+	assert.Equal(t, ErrDeviceNotFound, err)
+	assert.Empty(t, p.device.devices)
+}
+
 func TestPlugin_GetDevice(t *testing.T) {
 	p := Plugin{
 		device: &deviceManager{
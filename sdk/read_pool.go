@@ -0,0 +1,224 @@
+// Synse SDK
+// Copyright (c) 2017-2020 Vapor IO
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package sdk
+
+import (
+	"sync"
+)
+
+// readPool is a bounded pool of workers which run device reads and bulk reads.
+//
+// Each device (or bulk-read handler) has its own read schedule, which queues a
+// read in the pool when the read is due, and only schedules its next read once
+// the queued read completes (see readTimers). Since a schedule has at most one
+// read queued at a time, no device can crowd out the others.
+//
+// Queued reads are held in a queue per handler, and are run in the order in which
+// they were queued for each handler. Workers take reads from the handlers which
+// have queued reads in turn, skipping over handlers which are already running
+// their maximum number of concurrent reads, so taking the next read is O(1).
+type readPool struct {
+	size int
+
+	lock     sync.Mutex
+	cond     *sync.Cond
+	handlers map[string]*handlerQueue
+	ready    []*handlerQueue
+	queued   int
+	busy     int
+	closed   bool
+
+	workers sync.WaitGroup
+}
+
+// handlerQueue holds the reads queued in the read pool for a single handler.
+type handlerQueue struct {
+	handler *DeviceHandler
+	jobs    []*readJob
+
+	// active is the number of the handler's reads which are running, and ready
+	// is set while the handler is in the pool's ready list.
+	active int
+	ready  bool
+}
+
+// runnable checks whether the handler has a queued read which may run without
+// exceeding the handler's maximum number of concurrent reads.
+func (queue *handlerQueue) runnable() bool {
+	limit := queue.handler.MaxConcurrency
+	return len(queue.jobs) > 0 && (limit <= 0 || queue.active < limit)
+}
+
+// readJob is a read which was queued in the read pool.
+type readJob struct {
+	queue *handlerQueue
+	read  func()
+
+	// finish is called once the read has run, or with false if it was dropped
+	// because the pool closed.
+	finish func(ran bool)
+}
+
+// newReadPool creates a new read pool with the given number of workers.
+func newReadPool(size int) *readPool {
+	pool := &readPool{
+		size:     size,
+		handlers: make(map[string]*handlerQueue),
+	}
+	pool.cond = sync.NewCond(&pool.lock)
+	return pool
+}
+
+// start starts the pool's workers.
+func (pool *readPool) start() {
+	pool.lock.Lock()
+	pool.updateMetrics()
+	pool.lock.Unlock()
+
+	for i := 0; i < pool.size; i++ {
+		pool.workers.Add(1)
+		go pool.work()
+	}
+}
+
+// enqueue queues a read for the given handler's device(s) without waiting for it
+// to run. The finish function is called once the read has run, or with false if
+// it was not run because the pool closed. It returns false if the pool is closed,
+// in which case finish is not called.
+func (pool *readPool) enqueue(handler *DeviceHandler, read func(), finish func(ran bool)) bool {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	if pool.closed {
+		return false
+	}
+	queue, exists := pool.handlers[handler.Name]
+	if !exists {
+		queue = &handlerQueue{handler: handler}
+		pool.handlers[handler.Name] = queue
+	}
+	queue.jobs = append(queue.jobs, &readJob{queue: queue, read: read, finish: finish})
+	pool.queued++
+	pool.markReady(queue)
+	pool.updateMetrics()
+	return true
+}
+
+// markReady adds the handler's queue to the ready list if it has a read which
+// may run and it is not already in the list. This should be called with the
+// lock held.
+func (pool *readPool) markReady(queue *handlerQueue) {
+	if queue.ready || !queue.runnable() {
+		return
+	}
+	queue.ready = true
+	pool.ready = append(pool.ready, queue)
+	pool.cond.Signal()
+}
+
+// work runs queued reads until the pool closes.
+func (pool *readPool) work() {
+	defer pool.workers.Done()
+
+	for {
+		job := pool.next()
+		if job == nil {
+			return
+		}
+
+		job.read()
+
+		pool.lock.Lock()
+		pool.busy--
+		job.queue.active--
+		// A read of this handler finished, so a read which was held back by the
+		// handler's concurrency limit may now be able to run.
+		pool.markReady(job.queue)
+		pool.updateMetrics()
+		pool.lock.Unlock()
+
+		job.finish(true)
+	}
+}
+
+// next takes the next runnable read from the queues, waiting until there is one.
+// The handler it was taken from goes to the back of the ready list, so handlers
+// take turns. It returns nil once the pool is closed.
+func (pool *readPool) next() *readJob {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	for len(pool.ready) == 0 && !pool.closed {
+		pool.cond.Wait()
+	}
+	if pool.closed {
+		return nil
+	}
+
+	queue := pool.ready[0]
+	pool.ready[0] = nil
+	pool.ready = pool.ready[1:]
+	queue.ready = false
+
+	job := queue.jobs[0]
+	queue.jobs[0] = nil
+	queue.jobs = queue.jobs[1:]
+	queue.active++
+	pool.queued--
+	pool.busy++
+
+	pool.markReady(queue)
+	pool.updateMetrics()
+	return job
+}
+
+// close stops the pool. Reads which are running are allowed to complete, but
+// queued reads are dropped.
+func (pool *readPool) close() {
+	pool.lock.Lock()
+	pool.closed = true
+	var dropped []*readJob
+	for _, queue := range pool.handlers {
+		dropped = append(dropped, queue.jobs...)
+		queue.jobs = nil
+		queue.ready = false
+	}
+	pool.ready = nil
+	pool.queued = 0
+	pool.updateMetrics()
+	pool.lock.Unlock()
+
+	pool.cond.Broadcast()
+	for _, job := range dropped {
+		job.finish(false)
+	}
+}
+
+// wait waits for the pool's workers to finish after the pool is closed.
+func (pool *readPool) wait() {
+	pool.workers.Wait()
+}
+
+// updateMetrics updates the read pool metrics. This should be called with the
+// lock held.
+func (pool *readPool) updateMetrics() {
+	metricReadQueueDepth.Set(float64(pool.queued))
+	metricReadWorkersBusy.Set(float64(pool.busy))
+	if pool.size > 0 {
+		metricReadWorkerUtilization.Set(float64(pool.busy) / float64(pool.size))
+	}
+}
@@ -0,0 +1,284 @@
+// Synse SDK
+// Copyright (c) 2017-2020 Vapor IO
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package sdk
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/vapor-ware/synse-sdk/sdk/config"
+	"github.com/vapor-ware/synse-sdk/sdk/output"
+)
+
+// enqueueRead queues a read in the pool, returning a channel which receives
+// whether the read ran once it is finished.
+func enqueueRead(pool *readPool, handler *DeviceHandler, read func()) <-chan bool {
+	done := make(chan bool, 1)
+	if !pool.enqueue(handler, read, func(ran bool) { done <- ran }) {
+		done <- false
+	}
+	return done
+}
+
+// enqueueReads queues the given number of reads in the pool at once, returning
+// once all of them have run.
+func enqueueReads(pool *readPool, handler *DeviceHandler, n int, read func()) {
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		pool.enqueue(handler, read, func(bool) { wg.Done() })
+	}
+	wg.Wait()
+}
+
+// waitForPool waits until the pool has the given number of queued and
+// running reads.
+func waitForPool(t *testing.T, pool *readPool, queued, busy int) {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		pool.lock.Lock()
+		q, b := pool.queued, pool.busy
+		pool.lock.Unlock()
+		if q == queued && b == busy {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d queued and %d running reads", queued, busy)
+}
+
+func TestReadPool_bounded(t *testing.T) {
+	pool := newReadPool(2)
+	pool.start()
+	defer pool.close()
+
+	tracker := &concurrencyTracker{}
+	enqueueReads(pool, &DeviceHandler{Name: "test"}, 10, func() {
+		tracker.run(10 * time.Millisecond)
+	})
+	assert.Equal(t, int32(2), atomic.LoadInt32(&tracker.max))
+}
+
+func TestReadPool_handlerLimit(t *testing.T) {
+	pool := newReadPool(4)
+	pool.start()
+	defer pool.close()
+
+	limited := &concurrencyTracker{}
+	all := &concurrencyTracker{}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		enqueueReads(pool, &DeviceHandler{Name: "limited", MaxConcurrency: 1}, 4, func() {
+			defer all.enter()()
+			limited.run(10 * time.Millisecond)
+		})
+	}()
+	go func() {
+		defer wg.Done()
+		enqueueReads(pool, &DeviceHandler{Name: "other"}, 4, func() {
+			all.run(10 * time.Millisecond)
+		})
+	}()
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&limited.max))
+	assert.Greater(t, atomic.LoadInt32(&all.max), int32(1))
+}
+
+func TestReadPool_fifo(t *testing.T) {
+	pool := newReadPool(1)
+	pool.start()
+	defer pool.close()
+
+	handler := &DeviceHandler{Name: "test"}
+	release := make(chan struct{})
+	enqueueRead(pool, handler, func() { <-release })
+	waitForPool(t, pool, 0, 1)
+
+	var (
+		order []string
+		lock  sync.Mutex
+		done  []<-chan bool
+	)
+	for _, name := range []string{"a", "b", "c"} {
+		name := name
+		done = append(done, enqueueRead(pool, handler, func() {
+			lock.Lock()
+			order = append(order, name)
+			lock.Unlock()
+		}))
+	}
+	waitForPool(t, pool, 3, 1)
+
+	close(release)
+	for _, ran := range done {
+		assert.True(t, <-ran)
+	}
+	assert.Equal(t, []string{"a", "b", "c"}, order)
+}
+
+func TestReadPool_skipsLimitedHandler(t *testing.T) {
+	pool := newReadPool(2)
+	pool.start()
+	defer pool.close()
+
+	limited := &DeviceHandler{Name: "limited", MaxConcurrency: 1}
+	release := make(chan struct{})
+	enqueueRead(pool, limited, func() { <-release })
+	waitForPool(t, pool, 0, 1)
+
+	// The limited handler's next read is queued first, but the other handler's
+	// read is not held up behind it.
+	ran := make(chan string, 2)
+	enqueueRead(pool, limited, func() { ran <- "limited" })
+	waitForPool(t, pool, 1, 1)
+	enqueueRead(pool, &DeviceHandler{Name: "other"}, func() { ran <- "other" })
+	assert.Equal(t, "other", <-ran)
+
+	close(release)
+	assert.Equal(t, "limited", <-ran)
+}
+
+func TestReadPool_close(t *testing.T) {
+	pool := newReadPool(1)
+	pool.start()
+
+	handler := &DeviceHandler{Name: "test"}
+	release := make(chan struct{})
+	running := enqueueRead(pool, handler, func() { <-release })
+	waitForPool(t, pool, 0, 1)
+
+	dropped := enqueueRead(pool, handler, func() {})
+	waitForPool(t, pool, 1, 1)
+	assert.Equal(t, float64(1), testutil.ToFloat64(metricReadQueueDepth))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metricReadWorkerUtilization))
+
+	// Queued reads are dropped, and the running read finishes.
+	pool.close()
+	assert.False(t, <-dropped)
+	close(release)
+	assert.True(t, <-running)
+	pool.wait()
+
+	// Reads are not queued once the pool is closed.
+	assert.False(t, pool.enqueue(handler, func() {}, func(bool) {
+		t.Error("finish called for a read which was not queued")
+	}))
+	assert.Equal(t, float64(0), testutil.ToFloat64(metricReadQueueDepth))
+	assert.Equal(t, float64(0), testutil.ToFloat64(metricReadWorkersBusy))
+}
+
+func TestScheduler_scheduleReads_pool(t *testing.T) {
+	tracker := &concurrencyTracker{}
+	var reads int32
+	handler := &DeviceHandler{
+		Name: "test",
+		Read: func(device *Device) ([]*output.Reading, error) {
+			atomic.AddInt32(&reads, 1)
+			tracker.run(5 * time.Millisecond)
+			return nil, nil
+		},
+	}
+
+	devices := map[string]*Device{}
+	for i := 0; i < 10; i++ {
+		id := fmt.Sprint(i)
+		devices[id] = &Device{id: id, Handler: "test", handler: handler}
+	}
+
+	s := scheduler{
+		config: &config.PluginSettings{
+			Mode: modeParallel,
+			Read: &config.ReadSettings{
+				Interval:       10 * time.Millisecond,
+				MaxConcurrency: 3,
+			},
+		},
+		deviceManager: &deviceManager{
+			handlers: map[string]*DeviceHandler{"test": handler},
+			devices:  devices,
+		},
+		stateManager: &stateManager{
+			readChan: make(chan *ReadContext, 1000),
+		},
+		stop: make(chan struct{}),
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.scheduleReads()
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	close(s.stop)
+	<-done
+
+	assert.Greater(t, atomic.LoadInt32(&reads), int32(10))
+	assert.LessOrEqual(t, atomic.LoadInt32(&tracker.max), int32(3))
+}
+
+// BenchmarkReadTimers_run measures the throughput of pooled reads as the scheduler
+// runs them: each device's read schedule queues its read in the pool when it is
+// due, and schedules its next read once the read completes.
+func BenchmarkReadTimers_run(b *testing.B) {
+	for _, workers := range []int{1, 8, 64} {
+		for _, devices := range []int{1, 100, 1000} {
+			b.Run(fmt.Sprintf("workers=%d/devices=%d", workers, devices), func(b *testing.B) {
+				pool := newReadPool(workers)
+				pool.start()
+				defer pool.close()
+
+				timers := newReadTimers(pool)
+				stop := make(chan struct{})
+				defer close(stop)
+
+				var reads int64
+				done := make(chan struct{})
+				read := func() {
+					if atomic.AddInt64(&reads, 1) == int64(b.N) {
+						close(done)
+					}
+				}
+
+				handler := &DeviceHandler{Name: "bench"}
+				for i := 0; i < devices; i++ {
+					timers.add(&readSchedule{
+						key:     fmt.Sprintf("device/%d", i),
+						handler: handler,
+						jitter:  &readJitter{},
+						read:    read,
+						index:   -1,
+					}, 0)
+				}
+
+				b.ReportAllocs()
+				b.ResetTimer()
+				go timers.run(stop)
+				<-done
+			})
+		}
+	}
+}
@@ -0,0 +1,227 @@
+// Synse SDK
+// Copyright (c) 2017-2020 Vapor IO
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package sdk
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// readSchedule is the read schedule of a device (or bulk-read handler) whose
+// reads are run by the read pool.
+type readSchedule struct {
+	key      string
+	handler  *DeviceHandler
+	interval time.Duration
+	poller   *adaptivePoller
+	jitter   *readJitter
+	read     func()
+
+	// next is the time at which the next read is due, and waiting is the time
+	// at which the schedule started waiting for it. index is the schedule's
+	// index in the timer heap, or -1 while its read is queued or running.
+	next    time.Time
+	waiting time.Time
+	index   int
+
+	// stopped is set once the schedule is removed, e.g. because its device
+	// was removed, after which it is not rescheduled.
+	stopped bool
+}
+
+// readHeap is a min-heap of read schedules, ordered by the time at which their
+// next read is due. It implements heap.Interface.
+type readHeap []*readSchedule
+
+func (h readHeap) Len() int           { return len(h) }
+func (h readHeap) Less(i, j int) bool { return h[i].next.Before(h[j].next) }
+
+func (h readHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *readHeap) Push(x interface{}) {
+	s := x.(*readSchedule)
+	s.index = len(*h)
+	*h = append(*h, s)
+}
+
+func (h *readHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	s := old[n-1]
+	old[n-1] = nil
+	s.index = -1
+	*h = old[:n-1]
+	return s
+}
+
+// readTimers drives the read schedules of all devices (and bulk-read handlers)
+// from a single timer, when reads are run by the read pool. Each read is queued
+// in the pool when it is due, and the schedule's next read is only scheduled
+// once that read completes, so a schedule has at most one read queued at a time.
+type readTimers struct {
+	pool *readPool
+
+	lock      sync.Mutex
+	schedules readHeap
+
+	// wake is signalled when the earliest due read may have changed.
+	wake chan struct{}
+}
+
+// newReadTimers creates the read timers which feed reads into the given pool.
+func newReadTimers(pool *readPool) *readTimers {
+	return &readTimers{
+		pool: pool,
+		wake: make(chan struct{}, 1),
+	}
+}
+
+// add adds a read schedule, whose first read is due after the given delay.
+func (timers *readTimers) add(schedule *readSchedule, delay time.Duration) {
+	if schedule.poller != nil {
+		schedule.poller.onReset(func() { timers.snapBack(schedule) })
+	}
+
+	timers.lock.Lock()
+	now := time.Now()
+	schedule.waiting = now
+	schedule.next = now.Add(delay)
+	heap.Push(&timers.schedules, schedule)
+	timers.lock.Unlock()
+	timers.signal()
+}
+
+// remove removes a read schedule. A read which is queued or in progress for
+// the schedule is allowed to complete, but no further reads are scheduled.
+func (timers *readTimers) remove(schedule *readSchedule) {
+	if schedule.poller != nil {
+		schedule.poller.onReset(nil)
+	}
+
+	timers.lock.Lock()
+	defer timers.lock.Unlock()
+
+	schedule.stopped = true
+	if schedule.index >= 0 {
+		heap.Remove(&timers.schedules, schedule.index)
+	}
+}
+
+// reschedule schedules the next read of a schedule, once its previous read
+// completed (or was dropped).
+func (timers *readTimers) reschedule(schedule *readSchedule) {
+	timers.lock.Lock()
+	if schedule.stopped {
+		timers.lock.Unlock()
+		return
+	}
+	now := time.Now()
+	schedule.waiting = now
+	if schedule.interval > 0 {
+		schedule.next = now.Add(schedule.jitter.apply(schedule.poller.interval(schedule.interval)))
+	} else {
+		schedule.next = now
+	}
+	heap.Push(&timers.schedules, schedule)
+	timers.lock.Unlock()
+	timers.signal()
+}
+
+// snapBack brings a schedule's next read forward when its effective read interval
+// snaps back to the base interval, so it waits no longer than the base interval
+// since it started waiting.
+func (timers *readTimers) snapBack(schedule *readSchedule) {
+	timers.lock.Lock()
+	if schedule.index < 0 {
+		timers.lock.Unlock()
+		return
+	}
+	next := schedule.waiting.Add(schedule.poller.interval(schedule.interval))
+	if !next.Before(schedule.next) {
+		timers.lock.Unlock()
+		return
+	}
+	schedule.next = next
+	heap.Fix(&timers.schedules, schedule.index)
+	timers.lock.Unlock()
+	timers.signal()
+}
+
+// signal wakes the run loop to re-check the earliest due read.
+func (timers *readTimers) signal() {
+	select {
+	case timers.wake <- struct{}{}:
+	default:
+	}
+}
+
+// due takes the schedules whose reads are due, and gets the time until the next
+// read is due after them. If there are no schedules, the time is negative.
+func (timers *readTimers) due(now time.Time) ([]*readSchedule, time.Duration) {
+	timers.lock.Lock()
+	defer timers.lock.Unlock()
+
+	var due []*readSchedule
+	for len(timers.schedules) > 0 && !timers.schedules[0].next.After(now) {
+		due = append(due, heap.Pop(&timers.schedules).(*readSchedule))
+	}
+	if len(timers.schedules) == 0 {
+		return due, -1
+	}
+	return due, timers.schedules[0].next.Sub(now)
+}
+
+// run queues reads in the pool as they come due, until the given stop channel
+// is closed.
+func (timers *readTimers) run(stop <-chan struct{}) {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		due, wait := timers.due(time.Now())
+		for _, schedule := range due {
+			schedule := schedule
+			timers.pool.enqueue(schedule.handler, schedule.read, func(bool) {
+				timers.reschedule(schedule)
+			})
+		}
+
+		// Wait for the next read to be due, or for the schedules to change.
+		var expired <-chan time.Time
+		if wait >= 0 {
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(wait)
+			expired = timer.C
+		}
+		select {
+		case <-stop:
+			return
+		case <-timers.wake:
+		case <-expired:
+		}
+	}
+}
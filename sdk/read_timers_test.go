@@ -0,0 +1,136 @@
+// Synse SDK
+// Copyright (c) 2017-2020 Vapor IO
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package sdk
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadTimers_run(t *testing.T) {
+	pool := newReadPool(2)
+	pool.start()
+	defer pool.close()
+
+	timers := newReadTimers(pool)
+	stop := make(chan struct{})
+	defer close(stop)
+	go timers.run(stop)
+
+	handler := &DeviceHandler{Name: "test"}
+	var fast, slow int32
+	timers.add(&readSchedule{
+		key:      "device/fast",
+		handler:  handler,
+		interval: 5 * time.Millisecond,
+		jitter:   &readJitter{},
+		read:     func() { atomic.AddInt32(&fast, 1) },
+		index:    -1,
+	}, 0)
+	timers.add(&readSchedule{
+		key:      "device/slow",
+		handler:  handler,
+		interval: time.Hour,
+		jitter:   &readJitter{},
+		read:     func() { atomic.AddInt32(&slow, 1) },
+		index:    -1,
+	}, 0)
+
+	time.Sleep(60 * time.Millisecond)
+
+	// The fast schedule is read repeatedly, and the slow schedule is read once,
+	// then waits for its interval.
+	assert.Greater(t, atomic.LoadInt32(&fast), int32(3))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&slow))
+}
+
+func TestReadTimers_remove(t *testing.T) {
+	pool := newReadPool(1)
+	pool.start()
+	defer pool.close()
+
+	timers := newReadTimers(pool)
+	stop := make(chan struct{})
+	defer close(stop)
+	go timers.run(stop)
+
+	var reads int32
+	schedule := &readSchedule{
+		key:      "device/123",
+		handler:  &DeviceHandler{Name: "test"},
+		interval: 2 * time.Millisecond,
+		jitter:   &readJitter{},
+		read:     func() { atomic.AddInt32(&reads, 1) },
+		index:    -1,
+	}
+	timers.add(schedule, 0)
+	time.Sleep(20 * time.Millisecond)
+	timers.remove(schedule)
+
+	// Allow a read which was already queued to complete.
+	time.Sleep(10 * time.Millisecond)
+	removed := atomic.LoadInt32(&reads)
+	assert.Greater(t, removed, int32(0))
+
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, removed, atomic.LoadInt32(&reads))
+
+	timers.lock.Lock()
+	defer timers.lock.Unlock()
+	assert.Empty(t, timers.schedules)
+}
+
+func TestReadTimers_snapBack(t *testing.T) {
+	pool := newReadPool(1)
+	pool.start()
+	defer pool.close()
+
+	timers := newReadTimers(pool)
+	stop := make(chan struct{})
+	defer close(stop)
+	go timers.run(stop)
+
+	poller := &adaptivePoller{}
+	poller.start(10 * time.Millisecond)
+	poller.lock.Lock()
+	poller.current = time.Hour
+	poller.lock.Unlock()
+
+	reads := make(chan struct{}, 10)
+	schedule := &readSchedule{
+		key:      "device/123",
+		handler:  &DeviceHandler{Name: "test"},
+		interval: 10 * time.Millisecond,
+		poller:   poller,
+		jitter:   &readJitter{},
+		read:     func() { reads <- struct{}{} },
+		index:    -1,
+	}
+	timers.add(schedule, time.Hour)
+	defer timers.remove(schedule)
+
+	// Snapping back to the base interval brings the next read forward.
+	poller.reset()
+	select {
+	case <-reads:
+	case <-time.After(time.Second):
+		t.Fatal("read was not brought forward when the interval snapped back")
+	}
+}
@@ -0,0 +1,383 @@
+// Synse SDK
+// Copyright (c) 2017-2020 Vapor IO
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package sdk
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Approximate sizes, in bytes, used to estimate the memory held by the readings
+// cache. These cover the fixed size of the structures; the variable size of
+// strings and byte values is added to them.
+const (
+	cachedContextSize = 96
+	cachedReadingSize = 160
+
+	// cachedEntrySize is the size of a slot in a device's ring buffer, which is
+	// held whether or not the slot is in use.
+	cachedEntrySize = 48
+)
+
+// cachedReading is a reading context held in the readings cache.
+type cachedReading struct {
+	ctx *ReadContext
+
+	// at is the time the reading was added to the cache.
+	at time.Time
+
+	// seq is the order in which the reading was added to the cache, across
+	// all devices.
+	seq uint64
+
+	// size is the estimated memory held by the reading, in bytes.
+	size int
+}
+
+// readingsRing is a ring buffer of the cached readings for a single device, from
+// oldest to newest. The buffer grows as readings are added, up to the cache depth,
+// and shrinks as they are removed, so devices which have few readings in the cache
+// do not hold a full-depth buffer.
+type readingsRing struct {
+	entries []cachedReading
+	head    int
+	count   int
+}
+
+// size gets the memory held by the ring's buffer, in bytes. This excludes the
+// memory held by the readings themselves.
+func (ring *readingsRing) size() int {
+	return len(ring.entries) * cachedEntrySize
+}
+
+// resize moves the ring's readings into a new buffer with the given capacity,
+// which must be at least the number of readings in the ring.
+func (ring *readingsRing) resize(capacity int) {
+	entries := make([]cachedReading, capacity)
+	for i := 0; i < ring.count; i++ {
+		entries[i] = *ring.get(i)
+	}
+	ring.entries = entries
+	ring.head = 0
+}
+
+// get gets the i'th oldest reading in the ring.
+func (ring *readingsRing) get(i int) *cachedReading {
+	return &ring.entries[(ring.head+i)%len(ring.entries)]
+}
+
+// push adds a reading to the ring, growing the ring's buffer if it is full and
+// holds fewer than depth readings. If the ring holds depth readings, its oldest
+// reading is overwritten and returned.
+func (ring *readingsRing) push(entry cachedReading, depth int) (cachedReading, bool) {
+	if ring.count == len(ring.entries) && len(ring.entries) < depth {
+		capacity := 2 * len(ring.entries)
+		if capacity == 0 {
+			capacity = 1
+		}
+		if capacity > depth {
+			capacity = depth
+		}
+		ring.resize(capacity)
+	}
+	if ring.count < len(ring.entries) {
+		*ring.get(ring.count) = entry
+		ring.count++
+		return cachedReading{}, false
+	}
+	oldest := *ring.get(0)
+	ring.entries[ring.head] = entry
+	ring.head = (ring.head + 1) % len(ring.entries)
+	return oldest, true
+}
+
+// pop removes and returns the oldest reading in the ring. The ring's buffer is
+// shrunk once it is no more than a quarter full, and released once it is empty.
+func (ring *readingsRing) pop() cachedReading {
+	oldest := *ring.get(0)
+	*ring.get(0) = cachedReading{}
+	ring.head = (ring.head + 1) % len(ring.entries)
+	ring.count--
+
+	switch {
+	case ring.count == 0:
+		ring.entries = nil
+		ring.head = 0
+	case ring.count <= len(ring.entries)/4:
+		ring.resize(len(ring.entries) / 2)
+	}
+	return oldest
+}
+
+// search gets the index of the oldest reading in the ring which was cached at
+// or after the given time.
+func (ring *readingsRing) search(t time.Time) int {
+	return sort.Search(ring.count, func(i int) bool {
+		return !ring.get(i).at.Before(t)
+	})
+}
+
+// readingsCache holds the recent readings for each device in a ring buffer of a
+// fixed depth, so the readings for a device are kept in the order they were read
+// and can be looked up without going through the readings for other devices.
+//
+// Readings are removed from the cache once they exceed the TTL, once a newer
+// reading for their device pushes them out of its ring, or, if the cache has
+// a memory cap, once the cache exceeds the cap and they are the oldest readings
+// in the cache. The memory held by the device ring buffers is counted against
+// the cap along with the readings. Readings which exceed the TTL are removed
+// when a new reading is added for their device, and by a periodic sweep (see
+// sweep), so devices which are no longer read do not hold expired readings.
+type readingsCache struct {
+	ttl      time.Duration
+	depth    int
+	maxBytes int
+
+	lock    sync.RWMutex
+	devices map[string]*readingsRing
+	seq     uint64
+	size    int
+}
+
+// newReadingsCache creates a new readings cache. A depth less than 1 keeps a
+// single reading per device, and a maxBytes of 0 does not cap the cache's memory.
+func newReadingsCache(ttl time.Duration, depth, maxBytes int) *readingsCache {
+	if depth < 1 {
+		depth = 1
+	}
+	return &readingsCache{
+		ttl:      ttl,
+		depth:    depth,
+		maxBytes: maxBytes,
+		devices:  make(map[string]*readingsRing),
+	}
+}
+
+// add adds a reading context to the cache, as read at the given time.
+func (c *readingsCache) add(ctx *ReadContext, now time.Time) {
+	id := ctx.Device.GetID()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	ring, ok := c.devices[id]
+	if !ok {
+		ring = &readingsRing{}
+		c.devices[id] = ring
+	}
+	c.expire(ring, now)
+
+	c.seq++
+	entry := cachedReading{
+		ctx:  ctx,
+		at:   now,
+		seq:  c.seq,
+		size: readContextSize(ctx),
+	}
+	c.size += entry.size - ring.size()
+	evicted, ok := ring.push(entry, c.depth)
+	if ok {
+		c.size -= evicted.size
+	}
+	c.size += ring.size()
+
+	// Evict the oldest readings across all devices until the cache is back
+	// under its memory cap. The reading which was just added is always kept.
+	for c.maxBytes > 0 && c.size > c.maxBytes {
+		if !c.evictOldest(entry.seq) {
+			break
+		}
+	}
+}
+
+// expire removes the readings from a device's ring which have exceeded the TTL.
+// The cache lock should be held when this is called.
+func (c *readingsCache) expire(ring *readingsRing, now time.Time) {
+	if c.ttl <= 0 {
+		return
+	}
+	cutoff := now.Add(-c.ttl)
+	for ring.count > 0 && ring.get(0).at.Before(cutoff) {
+		c.pop(ring)
+	}
+}
+
+// pop removes the oldest reading from a device's ring, updating the size of the
+// cache. The cache lock should be held when this is called.
+func (c *readingsCache) pop(ring *readingsRing) {
+	c.size -= ring.size()
+	c.size -= ring.pop().size
+	c.size += ring.size()
+}
+
+// sweep removes the readings which have exceeded the TTL from all devices' rings,
+// along with the rings which are left empty. It returns the number of readings
+// which were removed.
+func (c *readingsCache) sweep(now time.Time) int {
+	if c.ttl <= 0 {
+		return 0
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	var removed int
+	for id, ring := range c.devices {
+		count := ring.count
+		c.expire(ring, now)
+		removed += count - ring.count
+		if ring.count == 0 {
+			delete(c.devices, id)
+		}
+	}
+	return removed
+}
+
+// evictOldest removes the oldest reading in the cache, unless it is the reading
+// with the given sequence number. It returns false if nothing was removed. The
+// cache lock should be held when this is called.
+func (c *readingsCache) evictOldest(keep uint64) bool {
+	var (
+		oldest *readingsRing
+		id     string
+	)
+	for device, ring := range c.devices {
+		if ring.count == 0 {
+			continue
+		}
+		if oldest == nil || ring.get(0).seq < oldest.get(0).seq {
+			oldest, id = ring, device
+		}
+	}
+	if oldest == nil || oldest.get(0).seq == keep {
+		return false
+	}
+
+	c.pop(oldest)
+	if oldest.count == 0 {
+		delete(c.devices, id)
+	}
+	return true
+}
+
+// remove removes all cached readings for the given devices.
+func (c *readingsCache) remove(devices ...string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for _, id := range devices {
+		ring, ok := c.devices[id]
+		if !ok {
+			continue
+		}
+		for ring.count > 0 {
+			c.pop(ring)
+		}
+		delete(c.devices, id)
+	}
+}
+
+// query gets the cached readings which were read within the given bounds, in the
+// order in which they were read. A zero start or end leaves that side of the range
+// unbounded. If any devices are given, only the readings for those devices are
+// returned; otherwise, the readings for all devices are returned.
+func (c *readingsCache) query(devices []string, start, end, now time.Time) []*ReadContext {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	var rings []*readingsRing
+	if len(devices) == 0 {
+		for _, ring := range c.devices {
+			rings = append(rings, ring)
+		}
+	} else {
+		for _, id := range devices {
+			if ring, ok := c.devices[id]; ok {
+				rings = append(rings, ring)
+			}
+		}
+	}
+
+	// Readings which have exceeded the TTL, but have not yet been removed,
+	// are not returned.
+	if c.ttl > 0 {
+		if cutoff := now.Add(-c.ttl); start.IsZero() || start.Before(cutoff) {
+			start = cutoff
+		}
+	}
+
+	var entries []*cachedReading
+	for _, ring := range rings {
+		first := 0
+		if !start.IsZero() {
+			first = ring.search(start)
+		}
+		for i := first; i < ring.count; i++ {
+			entry := ring.get(i)
+			if !end.IsZero() && entry.at.After(end) {
+				break
+			}
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].seq < entries[j].seq
+	})
+
+	ctxs := make([]*ReadContext, len(entries))
+	for i, entry := range entries {
+		ctxs[i] = entry.ctx
+	}
+	return ctxs
+}
+
+// len gets the number of readings in the cache.
+func (c *readingsCache) len() int {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	var n int
+	for _, ring := range c.devices {
+		n += ring.count
+	}
+	return n
+}
+
+// readContextSize estimates the memory, in bytes, held by a reading context.
+func readContextSize(ctx *ReadContext) int {
+	size := cachedContextSize
+	for _, r := range ctx.Reading {
+		if r == nil {
+			continue
+		}
+		size += cachedReadingSize + len(r.Timestamp) + len(r.Type)
+		if r.Unit != nil {
+			size += len(r.Unit.Name) + len(r.Unit.Symbol)
+		}
+		for k, v := range r.Context {
+			size += len(k) + len(v)
+		}
+		switch v := r.Value.(type) {
+		case string:
+			size += len(v)
+		case []byte:
+			size += len(v)
+		}
+	}
+	return size
+}
@@ -0,0 +1,209 @@
+// Synse SDK
+// Copyright (c) 2017-2020 Vapor IO
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package sdk
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vapor-ware/synse-sdk/sdk/output"
+)
+
+// cachedValue creates a read context for a device with a single reading of the
+// given value.
+func cachedValue(device string, value interface{}) *ReadContext {
+	return &ReadContext{
+		Device:  &Device{id: device},
+		Reading: []*output.Reading{{Value: value}},
+	}
+}
+
+// cachedValues gets the reading values of the given read contexts, in order.
+func cachedValues(ctxs []*ReadContext) []interface{} {
+	var values []interface{}
+	for _, ctx := range ctxs {
+		values = append(values, ctx.Reading[0].Value)
+	}
+	return values
+}
+
+func TestNewReadingsCache(t *testing.T) {
+	c := newReadingsCache(time.Minute, 0, 0)
+	assert.Equal(t, 1, c.depth)
+	assert.Equal(t, 0, c.len())
+}
+
+func TestReadingsCache_add_depth(t *testing.T) {
+	c := newReadingsCache(time.Minute, 3, 0)
+	now := time.Now()
+
+	for i := 0; i < 5; i++ {
+		c.add(cachedValue("1", i), now)
+	}
+	c.add(cachedValue("2", 10), now)
+
+	// Only the newest readings for the device are kept, without affecting
+	// the readings for other devices.
+	assert.Equal(t, 4, c.len())
+	assert.Equal(t, []interface{}{2, 3, 4}, cachedValues(c.query([]string{"1"}, time.Time{}, time.Time{}, now)))
+	assert.Equal(t, []interface{}{10}, cachedValues(c.query([]string{"2"}, time.Time{}, time.Time{}, now)))
+}
+
+func TestReadingsCache_add_maxBytes(t *testing.T) {
+	// Each device's ring holds two readings, so the rings hold four slots.
+	size := readContextSize(cachedValue("1", 0))
+	c := newReadingsCache(time.Minute, 10, 3*size+4*cachedEntrySize)
+	now := time.Now()
+
+	c.add(cachedValue("1", 1), now)
+	c.add(cachedValue("2", 2), now)
+	c.add(cachedValue("1", 3), now)
+	c.add(cachedValue("2", 4), now)
+
+	// The oldest reading in the cache is evicted, regardless of its device.
+	assert.Equal(t, 3*size+4*cachedEntrySize, c.size)
+	assert.Equal(t, []interface{}{2, 3, 4}, cachedValues(c.query(nil, time.Time{}, time.Time{}, now)))
+}
+
+func TestReadingsCache_add_maxBytesKeepsNewest(t *testing.T) {
+	c := newReadingsCache(time.Minute, 10, 1)
+	now := time.Now()
+
+	c.add(cachedValue("1", 1), now)
+	c.add(cachedValue("2", 2), now)
+
+	// The newest reading is kept even if it alone exceeds the cap.
+	assert.Equal(t, []interface{}{2}, cachedValues(c.query(nil, time.Time{}, time.Time{}, now)))
+	assert.NotContains(t, c.devices, "1")
+}
+
+func TestReadingsCache_add_expired(t *testing.T) {
+	c := newReadingsCache(time.Minute, 10, 0)
+	now := time.Now()
+
+	c.add(cachedValue("1", 1), now.Add(-2*time.Minute))
+	c.add(cachedValue("2", 2), now.Add(-30*time.Second))
+	assert.Equal(t, 2, c.len())
+
+	// Expired readings are not returned, and are removed when a new reading
+	// is added for the device.
+	assert.Equal(t, []interface{}{2}, cachedValues(c.query(nil, time.Time{}, time.Time{}, now)))
+
+	c.add(cachedValue("1", 3), now)
+	assert.Equal(t, 2, c.len())
+	assert.Equal(t, []interface{}{2, 3}, cachedValues(c.query(nil, time.Time{}, time.Time{}, now)))
+}
+
+func TestReadingsCache_add_growsRing(t *testing.T) {
+	c := newReadingsCache(time.Minute, 5, 0)
+	now := time.Now()
+
+	// A device's ring grows as readings are added, up to the cache depth, and
+	// the ring's slots are counted in the size of the cache.
+	c.add(cachedValue("1", 1), now)
+	assert.Len(t, c.devices["1"].entries, 1)
+	for i := 2; i <= 3; i++ {
+		c.add(cachedValue("1", i), now)
+	}
+	assert.Len(t, c.devices["1"].entries, 4)
+	for i := 4; i <= 7; i++ {
+		c.add(cachedValue("1", i), now)
+	}
+	assert.Len(t, c.devices["1"].entries, 5)
+	assert.Equal(t, 5*readContextSize(cachedValue("1", 0))+5*cachedEntrySize, c.size)
+	assert.Equal(t, []interface{}{3, 4, 5, 6, 7}, cachedValues(c.query(nil, time.Time{}, time.Time{}, now)))
+}
+
+func TestReadingsCache_sweep(t *testing.T) {
+	c := newReadingsCache(time.Minute, 10, 0)
+	now := time.Now()
+
+	for i := 0; i < 7; i++ {
+		c.add(cachedValue("1", i), now.Add(-90*time.Second))
+	}
+	c.add(cachedValue("1", 8), now.Add(-30*time.Second))
+	c.add(cachedValue("2", 9), now.Add(-90*time.Second))
+
+	// Expired readings are removed without new readings being added, the ring
+	// of the device which still has a reading shrinks, and the ring of the device
+	// which has none is removed.
+	assert.Equal(t, 8, c.sweep(now))
+	assert.Equal(t, []interface{}{8}, cachedValues(c.query(nil, time.Time{}, time.Time{}, now)))
+	assert.NotContains(t, c.devices, "2")
+	assert.Len(t, c.devices["1"].entries, 2)
+	assert.Equal(t, readContextSize(cachedValue("1", 0))+2*cachedEntrySize, c.size)
+}
+
+func TestReadingsCache_query_ordered(t *testing.T) {
+	c := newReadingsCache(0, 10, 0)
+	now := time.Now()
+
+	for i, id := range []string{"1", "2", "3", "2", "1", "3"} {
+		c.add(cachedValue(id, i), now)
+	}
+
+	assert.Equal(t, []interface{}{0, 1, 2, 3, 4, 5}, cachedValues(c.query(nil, time.Time{}, time.Time{}, now)))
+	assert.Equal(t, []interface{}{0, 2, 4, 5}, cachedValues(c.query([]string{"3", "1"}, time.Time{}, time.Time{}, now)))
+	assert.Empty(t, c.query([]string{"unknown"}, time.Time{}, time.Time{}, now))
+}
+
+func TestReadingsCache_query_bounds(t *testing.T) {
+	c := newReadingsCache(0, 10, 0)
+	base := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 6; i++ {
+		c.add(cachedValue("1", i), base.Add(time.Duration(i)*time.Minute))
+	}
+
+	start := base.Add(2 * time.Minute)
+	end := base.Add(4 * time.Minute)
+	assert.Equal(t, []interface{}{2, 3, 4}, cachedValues(c.query(nil, start, end, base)))
+	assert.Equal(t, []interface{}{2, 3, 4, 5}, cachedValues(c.query(nil, start, time.Time{}, base)))
+	assert.Equal(t, []interface{}{0, 1, 2, 3, 4}, cachedValues(c.query(nil, time.Time{}, end, base)))
+}
+
+func TestReadingsCache_remove(t *testing.T) {
+	c := newReadingsCache(time.Minute, 10, 0)
+	now := time.Now()
+
+	c.add(cachedValue("1", 1), now)
+	c.add(cachedValue("2", 2), now)
+	c.add(cachedValue("1", 3), now)
+
+	c.remove("1", "unknown")
+	assert.Equal(t, 1, c.len())
+	assert.Equal(t, readContextSize(cachedValue("2", 2))+cachedEntrySize, c.size)
+	assert.Equal(t, []interface{}{2}, cachedValues(c.query(nil, time.Time{}, time.Time{}, now)))
+}
+
+func TestReadContextSize(t *testing.T) {
+	empty := readContextSize(&ReadContext{})
+	assert.Equal(t, cachedContextSize, empty)
+
+	size := readContextSize(&ReadContext{
+		Reading: []*output.Reading{
+			{
+				Type:    "temperature",
+				Unit:    &output.Unit{Name: "celsius", Symbol: "C"},
+				Value:   "hot",
+				Context: map[string]string{"zone": "a"},
+			},
+		},
+	})
+	assert.Equal(t, cachedContextSize+cachedReadingSize+len("temperature")+len("celsius")+len("C")+len("hot")+len("zone")+len("a"), size)
+}
@@ -0,0 +1,699 @@
+// Synse SDK
+// Copyright (c) 2017-2020 Vapor IO
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package sdk
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/vapor-ware/synse-sdk/sdk/config"
+	"github.com/vapor-ware/synse-sdk/sdk/output"
+)
+
+// historySegmentExt is the file extension of readings history segments.
+const historySegmentExt = ".log"
+
+// historyIndexFile is the name of the file in the history directory which holds
+// the index of the latest record for each device (see historyIndex).
+const historyIndexFile = "latest.json"
+
+// historyRecord is the record of a device's readings in the readings history.
+// Each record is written to a segment as a line of JSON.
+type historyRecord struct {
+	Time     time.Time        `json:"time"`
+	Device   string           `json:"device"`
+	Readings []historyReading `json:"readings"`
+}
+
+// historyReading is a reading in a history record. Since JSON does not keep the
+// type of a reading's value, its kind is recorded alongside it so the value can
+// be decoded back to the same type.
+type historyReading struct {
+	Timestamp string            `json:"timestamp"`
+	Type      string            `json:"type"`
+	Unit      *output.Unit      `json:"unit,omitempty"`
+	Kind      string            `json:"kind"`
+	Value     json.RawMessage   `json:"value,omitempty"`
+	Context   map[string]string `json:"context,omitempty"`
+	Output    string            `json:"output,omitempty"`
+}
+
+// newHistoryRecord creates the history record for a reading context, read at the
+// given time.
+func newHistoryRecord(ctx *ReadContext, at time.Time) (*historyRecord, error) {
+	record := &historyRecord{
+		Time:   at,
+		Device: ctx.Device.GetID(),
+	}
+	for _, r := range ctx.Reading {
+		if r == nil {
+			continue
+		}
+		kind, err := historyValueKind(r.Value)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(r.Value)
+		if err != nil {
+			return nil, err
+		}
+		hr := historyReading{
+			Timestamp: r.Timestamp,
+			Type:      r.Type,
+			Unit:      r.Unit,
+			Kind:      kind,
+			Value:     value,
+			Context:   r.Context,
+		}
+		if o := r.GetOutput(); o != nil {
+			hr.Output = o.Name
+		}
+		record.Readings = append(record.Readings, hr)
+	}
+	return record, nil
+}
+
+// readContext creates the reading context for a history record. The outputs of
+// its readings are looked up in the given registry, if any. Since a record may be
+// for a device which no longer exists, the context's device only has its ID set.
+func (record *historyRecord) readContext(registry *output.Registry) (*ReadContext, error) {
+	ctx := &ReadContext{
+		Device: &Device{id: record.Device},
+	}
+	for _, hr := range record.Readings {
+		value, err := historyValue(hr.Kind, hr.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		// Where possible, the reading is made from its output so it is
+		// associated with the output once again.
+		var reading *output.Reading
+		if registry != nil && hr.Output != "" {
+			if o := registry.Get(hr.Output); o != nil {
+				reading, _ = o.MakeReading(value)
+			}
+		}
+		if reading == nil {
+			reading = &output.Reading{Value: value}
+		}
+		reading.Timestamp = hr.Timestamp
+		reading.Type = hr.Type
+		reading.Unit = hr.Unit
+		reading.Context = hr.Context
+		ctx.Reading = append(ctx.Reading, reading)
+	}
+	return ctx, nil
+}
+
+// historyValueKind gets the kind of a reading value, as recorded in the history.
+// The kinds are the value types which a reading may be encoded with.
+func historyValueKind(value interface{}) (string, error) {
+	switch value.(type) {
+	case nil:
+		return "nil", nil
+	case []byte:
+		return "bytes", nil
+	case string, bool, float64, float32, int64, int32, int16, int8, int,
+		uint64, uint32, uint16, uint8, uint:
+		return fmt.Sprintf("%T", value), nil
+	default:
+		return "", fmt.Errorf("unsupported reading value type: %T", value)
+	}
+}
+
+// historyValue decodes a reading value of the given kind from the history.
+func historyValue(kind string, data json.RawMessage) (interface{}, error) {
+	var err error
+	switch kind {
+	case "nil":
+		return nil, nil
+	case "bytes":
+		var v []byte
+		err = json.Unmarshal(data, &v)
+		return v, err
+	case "string":
+		var v string
+		err = json.Unmarshal(data, &v)
+		return v, err
+	case "bool":
+		var v bool
+		err = json.Unmarshal(data, &v)
+		return v, err
+	case "float64", "float32":
+		var v float64
+		if err = json.Unmarshal(data, &v); kind == "float32" {
+			return float32(v), err
+		}
+		return v, err
+	case "int64", "int32", "int16", "int8", "int":
+		var v int64
+		err = json.Unmarshal(data, &v)
+		switch kind {
+		case "int32":
+			return int32(v), err
+		case "int16":
+			return int16(v), err
+		case "int8":
+			return int8(v), err
+		case "int":
+			return int(v), err
+		}
+		return v, err
+	case "uint64", "uint32", "uint16", "uint8", "uint":
+		var v uint64
+		err = json.Unmarshal(data, &v)
+		switch kind {
+		case "uint32":
+			return uint32(v), err
+		case "uint16":
+			return uint16(v), err
+		case "uint8":
+			return uint8(v), err
+		case "uint":
+			return uint(v), err
+		}
+		return v, err
+	default:
+		return nil, fmt.Errorf("unsupported reading value kind: %q", kind)
+	}
+}
+
+// historySegment is a segment file of the readings history.
+type historySegment struct {
+	path string
+
+	// first is the time of the first record in the segment, and last is
+	// the time of the last.
+	first time.Time
+	last  time.Time
+
+	size int64
+}
+
+// historyIndex is the index of the latest record for each device in the history,
+// as of the given offset in the given segment. It is saved when a new segment is
+// started and when the history is closed, so when the history is opened, only the
+// records written after it was saved need to be read to find the latest records.
+type historyIndex struct {
+	Segment string                    `json:"segment"`
+	Offset  int64                     `json:"offset"`
+	Latest  map[string]*historyRecord `json:"latest"`
+}
+
+// historyEntry is a reading context which is waiting to be written to the history.
+type historyEntry struct {
+	ctx *ReadContext
+	at  time.Time
+}
+
+// readingsHistory is an on-disk history of plugin readings. It is an append-only
+// log of history records, split into segment files in its directory. Segments are
+// named for the time of their first record, so they sort in the order in which
+// they were written.
+//
+// Once the oldest segment's records are all older than the maximum age, or the
+// history exceeds its maximum size, the segment is removed.
+//
+// Readings are queued (see enqueue) and written to the history in the background.
+// The history is read without holding its lock, from a snapshot of its segments,
+// so reading the history does not hold up writes to it.
+type readingsHistory struct {
+	dir         string
+	maxAge      time.Duration
+	maxSize     int64
+	segmentSize int64
+
+	lock     sync.Mutex
+	segments []*historySegment
+	active   *os.File
+	size     int64
+
+	// latest holds the latest record for each device in the history.
+	latest map[string]*historyRecord
+
+	// queue holds the readings waiting to be written to the history, and
+	// written is closed once the history's writer has written them all after
+	// the queue is closed. closed is set once the queue is closed, and is
+	// guarded by queueLock.
+	queue     chan historyEntry
+	queueLock sync.RWMutex
+	closed    bool
+	written   chan struct{}
+}
+
+// openReadingsHistory opens the readings history in the configured directory,
+// creating the directory if it does not exist, and starts writing queued readings
+// to it.
+func openReadingsHistory(conf *config.HistorySettings) (*readingsHistory, error) {
+	if err := os.MkdirAll(conf.Dir, 0700); err != nil {
+		return nil, err
+	}
+
+	queueSize := conf.QueueSize
+	if queueSize < 1 {
+		queueSize = 1
+	}
+	history := &readingsHistory{
+		dir:         conf.Dir,
+		maxAge:      conf.MaxAge,
+		maxSize:     conf.MaxSize,
+		segmentSize: conf.SegmentSize,
+		latest:      map[string]*historyRecord{},
+		queue:       make(chan historyEntry, queueSize),
+		written:     make(chan struct{}),
+	}
+
+	files, err := ioutil.ReadDir(conf.Dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != historySegmentExt {
+			continue
+		}
+		nanos, err := strconv.ParseInt(strings.TrimSuffix(f.Name(), historySegmentExt), 10, 64)
+		if err != nil {
+			log.WithField("file", f.Name()).Warn("[history] ignoring unknown file in history directory")
+			continue
+		}
+		history.segments = append(history.segments, &historySegment{
+			path:  filepath.Join(conf.Dir, f.Name()),
+			first: time.Unix(0, nanos),
+			last:  f.ModTime(),
+			size:  f.Size(),
+		})
+		history.size += f.Size()
+	}
+	sort.Slice(history.segments, func(i, j int) bool {
+		return history.segments[i].first.Before(history.segments[j].first)
+	})
+
+	history.lock.Lock()
+	history.retain(time.Now())
+	history.lock.Unlock()
+
+	if err := history.loadLatest(); err != nil {
+		return nil, err
+	}
+
+	go history.write()
+	return history, nil
+}
+
+// enqueue queues a reading context, read at the given time, to be written to the
+// history. This does not wait for the reading to be written. It returns false if
+// the reading was dropped because the queue is full or the history is closed.
+func (history *readingsHistory) enqueue(ctx *ReadContext, at time.Time) bool {
+	history.queueLock.RLock()
+	defer history.queueLock.RUnlock()
+
+	if history.closed {
+		return false
+	}
+	select {
+	case history.queue <- historyEntry{ctx: ctx, at: at}:
+		return true
+	default:
+		return false
+	}
+}
+
+// write writes the queued readings to the history until the queue is closed.
+func (history *readingsHistory) write() {
+	defer close(history.written)
+
+	for entry := range history.queue {
+		if err := history.add(entry.ctx, entry.at); err != nil {
+			log.WithFields(log.Fields{
+				"device": entry.ctx.Device.GetID(),
+				"error":  err,
+			}).Error("[history] failed to add reading to history")
+		}
+	}
+}
+
+// add appends the record for a reading context, read at the given time, to the
+// history. A new segment is started if the current one is full.
+func (history *readingsHistory) add(ctx *ReadContext, at time.Time) error {
+	record, err := newHistoryRecord(ctx, at)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	history.lock.Lock()
+	defer history.lock.Unlock()
+
+	// Records are only ever appended to a segment which was started while the
+	// history was open, so a segment left partially written by a crash is not
+	// appended to.
+	segment := history.current()
+	if history.active == nil || (history.segmentSize > 0 && segment.size > 0 && segment.size+int64(len(data)) > history.segmentSize) {
+		if err := history.roll(at); err != nil {
+			return err
+		}
+		segment = history.current()
+	}
+
+	n, err := history.active.Write(data)
+	segment.size += int64(n)
+	history.size += int64(n)
+	if err != nil {
+		return err
+	}
+	if at.After(segment.last) {
+		segment.last = at
+	}
+	history.latest[record.Device] = record
+
+	history.retain(at)
+	return nil
+}
+
+// current gets the newest segment of the history, or nil if it has none. The
+// history lock should be held when this is called.
+func (history *readingsHistory) current() *historySegment {
+	if len(history.segments) == 0 {
+		return nil
+	}
+	return history.segments[len(history.segments)-1]
+}
+
+// roll closes the active segment and starts a new one, whose first record is
+// at the given time. The latest record index is saved as of the start of the new
+// segment. The history lock should be held when this is called.
+func (history *readingsHistory) roll(at time.Time) error {
+	if history.active != nil {
+		if err := history.active.Close(); err != nil {
+			log.WithField("error", err).Warn("[history] failed to close history segment")
+		}
+		history.active = nil
+	}
+
+	// Segment names must be unique and sort in order, so the new segment's
+	// name is kept after that of the current segment.
+	first := at
+	if segment := history.current(); segment != nil && !first.After(segment.first) {
+		first = segment.first.Add(time.Nanosecond)
+	}
+	path := filepath.Join(history.dir, fmt.Sprintf("%020d%s", first.UnixNano(), historySegmentExt))
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	log.WithField("file", path).Debug("[history] started new history segment")
+
+	history.active = f
+	history.segments = append(history.segments, &historySegment{
+		path:  path,
+		first: first,
+		last:  at,
+	})
+	history.trySaveIndex()
+	return nil
+}
+
+// retain removes the oldest segments from the history while they are older than
+// the maximum age, or while the history is larger than its maximum size. The
+// active segment is never removed. The history lock should be held when this
+// is called.
+func (history *readingsHistory) retain(now time.Time) {
+	for len(history.segments) > 0 {
+		oldest := history.segments[0]
+		if history.active != nil && oldest == history.current() {
+			return
+		}
+
+		expired := history.maxAge > 0 && oldest.last.Before(now.Add(-history.maxAge))
+		oversize := history.maxSize > 0 && history.size > history.maxSize
+		if !expired && !oversize {
+			return
+		}
+
+		if err := os.Remove(oldest.path); err != nil && !os.IsNotExist(err) {
+			log.WithFields(log.Fields{
+				"file":  oldest.path,
+				"error": err,
+			}).Error("[history] failed to remove history segment")
+			return
+		}
+		log.WithField("file", oldest.path).Debug("[history] removed history segment")
+		history.size -= oldest.size
+		history.segments = history.segments[1:]
+	}
+}
+
+// loadLatest loads the latest record for each device in the history. These are
+// taken from the saved index, if there is one, updated with the records written
+// after the index was saved, so only those records need to be read. If there is
+// no index, or it can not be read, all records are read.
+func (history *readingsHistory) loadLatest() error {
+	var segment string
+	var offset int64
+
+	index, err := history.loadIndex()
+	if err != nil {
+		log.WithField("error", err).Warn("[history] failed to load history index, reading the full history")
+	} else if index != nil {
+		for id, record := range index.Latest {
+			history.latest[id] = record
+		}
+		segment, offset = index.Segment, index.Offset
+	}
+
+	// Segment names are fixed-width, so they sort in the order in which the
+	// segments were written.
+	for _, s := range history.segments {
+		name := filepath.Base(s.path)
+		if name < segment {
+			continue
+		}
+		var from int64
+		if name == segment {
+			from = offset
+		}
+		err := scanSegment(s.path, from, s.size, func(record *historyRecord) {
+			history.latest[record.Device] = record
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadIndex loads the latest record index from the history directory. If there
+// is no index, nil is returned.
+func (history *readingsHistory) loadIndex() (*historyIndex, error) {
+	data, err := ioutil.ReadFile(filepath.Join(history.dir, historyIndexFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var index historyIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("failed to parse history index: %w", err)
+	}
+	return &index, nil
+}
+
+// saveIndex saves the latest record index, as of the end of the current segment,
+// to the history directory. The file is replaced atomically so a failed save does
+// not lose the previous index. The history lock should be held when this is called.
+func (history *readingsHistory) saveIndex() error {
+	index := historyIndex{Latest: history.latest}
+	if segment := history.current(); segment != nil {
+		index.Segment = filepath.Base(segment.path)
+		index.Offset = segment.size
+	}
+	data, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(history.dir, historyIndexFile)
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// trySaveIndex saves the latest record index, logging any error. The index is
+// only used to speed up opening the history, so failing to save it is not fatal.
+// The history lock should be held when this is called.
+func (history *readingsHistory) trySaveIndex() {
+	if err := history.saveIndex(); err != nil {
+		log.WithField("error", err).Warn("[history] failed to save history index")
+	}
+}
+
+// query passes the readings in the history which were read within the given bounds
+// to fn, in the order in which they were read. A zero start or end leaves that side
+// of the range unbounded. If any devices are given, only the readings for those
+// devices are passed. Readings are read from disk as they are passed to fn, so they
+// are not all held in memory at once.
+func (history *readingsHistory) query(registry *output.Registry, devices []string, start, end time.Time, fn func(*ReadContext)) error {
+	include := make(map[string]bool, len(devices))
+	for _, id := range devices {
+		include[id] = true
+	}
+
+	return history.scan(start, end, func(record *historyRecord) {
+		if !start.IsZero() && record.Time.Before(start) {
+			return
+		}
+		if !end.IsZero() && record.Time.After(end) {
+			return
+		}
+		if len(include) > 0 && !include[record.Device] {
+			return
+		}
+		ctx, err := record.readContext(registry)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"device": record.Device,
+				"error":  err,
+			}).Warn("[history] skipping invalid history record")
+			return
+		}
+		fn(ctx)
+	})
+}
+
+// getLatest gets the latest record in the history for each device.
+func (history *readingsHistory) getLatest() map[string]*historyRecord {
+	history.lock.Lock()
+	defer history.lock.Unlock()
+
+	latest := make(map[string]*historyRecord, len(history.latest))
+	for id, record := range history.latest {
+		latest[id] = record
+	}
+	return latest
+}
+
+// scan reads the records of the segments which may hold records within the given
+// bounds, in the order in which they were written, passing each to fn. Records
+// which can not be parsed, such as one left partially written by a crash, are
+// skipped.
+//
+// The segments are read from a snapshot taken when the scan starts, without
+// holding the history lock, and only the records written before the snapshot
+// are read. A segment which is removed before it is read is skipped.
+func (history *readingsHistory) scan(start, end time.Time, fn func(*historyRecord)) error {
+	history.lock.Lock()
+	segments := make([]historySegment, len(history.segments))
+	for i, segment := range history.segments {
+		segments[i] = *segment
+	}
+	history.lock.Unlock()
+
+	for _, segment := range segments {
+		if !start.IsZero() && segment.last.Before(start) {
+			continue
+		}
+		if !end.IsZero() && segment.first.After(end) {
+			break
+		}
+		if err := scanSegment(segment.path, 0, segment.size, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanSegment reads the records of a segment file between the given offsets,
+// passing each to fn.
+func scanSegment(path string, from, to int64, fn func(*historyRecord)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(from, io.SeekStart); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(io.LimitReader(f, to-from))
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			var record historyRecord
+			if jsonErr := json.Unmarshal(line, &record); jsonErr != nil {
+				log.WithField("file", path).Warn("[history] skipping unreadable history record")
+			} else {
+				fn(&record)
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// close stops writing to the history once the queued readings are written, then
+// saves the latest record index and closes the history's active segment.
+func (history *readingsHistory) close() error {
+	history.queueLock.Lock()
+	if history.closed {
+		history.queueLock.Unlock()
+		return nil
+	}
+	history.closed = true
+	close(history.queue)
+	history.queueLock.Unlock()
+	<-history.written
+
+	history.lock.Lock()
+	defer history.lock.Unlock()
+
+	history.trySaveIndex()
+	if history.active == nil {
+		return nil
+	}
+	err := history.active.Close()
+	history.active = nil
+	return err
+}
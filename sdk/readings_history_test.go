@@ -0,0 +1,449 @@
+// Synse SDK
+// Copyright (c) 2017-2020 Vapor IO
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package sdk
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vapor-ware/synse-sdk/sdk/config"
+	"github.com/vapor-ware/synse-sdk/sdk/output"
+)
+
+func newTestHistorySettings(dir string) *config.HistorySettings {
+	return &config.HistorySettings{
+		Enabled:     true,
+		Dir:         dir,
+		MaxAge:      24 * time.Hour,
+		MaxSize:     1 << 20,
+		SegmentSize: 1 << 16,
+		QueueSize:   16,
+	}
+}
+
+// historySegments gets the names of the segment files in a history directory.
+func historySegments(t *testing.T, dir string) []string {
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+
+	var names []string
+	for _, f := range files {
+		if filepath.Ext(f.Name()) == historySegmentExt {
+			names = append(names, f.Name())
+		}
+	}
+	return names
+}
+
+// queryHistory gets the readings passed by a history query, in order.
+func queryHistory(history *readingsHistory, registry *output.Registry, devices []string, start, end time.Time) ([]*ReadContext, error) {
+	var ctxs []*ReadContext
+	err := history.query(registry, devices, start, end, func(ctx *ReadContext) {
+		ctxs = append(ctxs, ctx)
+	})
+	return ctxs, err
+}
+
+func TestReadingsHistory_addAndQuery(t *testing.T) {
+	history, err := openReadingsHistory(newTestHistorySettings(t.TempDir()))
+	assert.NoError(t, err)
+	defer history.close()
+
+	base := time.Now().Add(-time.Hour)
+	for i, id := range []string{"1", "2", "1", "3", "2"} {
+		assert.NoError(t, history.add(cachedValue(id, i), base.Add(time.Duration(i)*time.Minute)))
+	}
+
+	ctxs, err := queryHistory(history, nil, nil, time.Time{}, time.Time{})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{0, 1, 2, 3, 4}, cachedValues(ctxs))
+	assert.Equal(t, "2", ctxs[1].Device.id)
+
+	ctxs, err = queryHistory(history, nil, []string{"2", "3"}, time.Time{}, time.Time{})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{1, 3, 4}, cachedValues(ctxs))
+
+	ctxs, err = queryHistory(history, nil, nil, base.Add(time.Minute), base.Add(3*time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{1, 2, 3}, cachedValues(ctxs))
+}
+
+func TestReadingsHistory_values(t *testing.T) {
+	history, err := openReadingsHistory(newTestHistorySettings(t.TempDir()))
+	assert.NoError(t, err)
+	defer history.close()
+
+	values := []interface{}{
+		nil, "foo", true, 1.5, float32(2.5), int64(-3), int32(-4), int16(-5), int8(-6), 7,
+		uint64(8), uint32(9), uint16(10), uint8(11), uint(12), []byte("bar"),
+	}
+	ctx := &ReadContext{Device: &Device{id: "1"}}
+	for _, v := range values {
+		ctx.Reading = append(ctx.Reading, &output.Reading{Value: v})
+	}
+	assert.NoError(t, history.add(ctx, time.Now()))
+
+	ctxs, err := queryHistory(history, nil, nil, time.Time{}, time.Time{})
+	assert.NoError(t, err)
+	assert.Len(t, ctxs, 1)
+
+	var restored []interface{}
+	for _, r := range ctxs[0].Reading {
+		restored = append(restored, r.Value)
+	}
+	assert.Equal(t, values, restored)
+}
+
+func TestReadingsHistory_add_unsupportedValue(t *testing.T) {
+	history, err := openReadingsHistory(newTestHistorySettings(t.TempDir()))
+	assert.NoError(t, err)
+	defer history.close()
+
+	err = history.add(cachedValue("1", struct{}{}), time.Now())
+	assert.Error(t, err)
+}
+
+func TestReadingsHistory_output(t *testing.T) {
+	registry := output.NewRegistry()
+	temperature := registry.Get("temperature")
+	assert.NotNil(t, temperature)
+
+	history, err := openReadingsHistory(newTestHistorySettings(t.TempDir()))
+	assert.NoError(t, err)
+	defer history.close()
+
+	reading, err := temperature.MakeReading(21.5)
+	assert.NoError(t, err)
+	reading.Timestamp = "2020-01-01T00:00:00Z"
+	reading.WithContext(map[string]string{"zone": "a"})
+	assert.NoError(t, history.add(&ReadContext{Device: &Device{id: "1"}, Reading: []*output.Reading{reading}}, time.Now()))
+
+	ctxs, err := queryHistory(history, registry, nil, time.Time{}, time.Time{})
+	assert.NoError(t, err)
+	assert.Len(t, ctxs, 1)
+
+	restored := ctxs[0].Reading[0]
+	assert.Equal(t, temperature, restored.GetOutput())
+	assert.Equal(t, reading.Timestamp, restored.Timestamp)
+	assert.Equal(t, reading.Type, restored.Type)
+	assert.Equal(t, reading.Unit, restored.Unit)
+	assert.Equal(t, reading.Context, restored.Context)
+	assert.Equal(t, 21.5, restored.Value)
+}
+
+func TestReadingsHistory_segments(t *testing.T) {
+	dir := t.TempDir()
+	conf := newTestHistorySettings(dir)
+	conf.SegmentSize = 1
+	history, err := openReadingsHistory(conf)
+	assert.NoError(t, err)
+	defer history.close()
+
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, history.add(cachedValue("1", i), now))
+	}
+
+	// Each record starts a new segment, and segment names stay in order
+	// even when records are added at the same time.
+	segments := historySegments(t, dir)
+	assert.Len(t, segments, 3)
+
+	ctxs, err := queryHistory(history, nil, nil, time.Time{}, time.Time{})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{0, 1, 2}, cachedValues(ctxs))
+}
+
+func TestReadingsHistory_retain_maxSize(t *testing.T) {
+	dir := t.TempDir()
+	conf := newTestHistorySettings(dir)
+	conf.SegmentSize = 1
+	history, err := openReadingsHistory(conf)
+	assert.NoError(t, err)
+	defer history.close()
+
+	now := time.Now()
+	assert.NoError(t, history.add(cachedValue("1", 0), now))
+	history.maxSize = 2*history.size - 1
+
+	for i := 1; i < 4; i++ {
+		assert.NoError(t, history.add(cachedValue("1", i), now))
+	}
+
+	// The oldest segments are removed once the history exceeds its size.
+	assert.Len(t, historySegments(t, dir), 1)
+	ctxs, err := queryHistory(history, nil, nil, time.Time{}, time.Time{})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{3}, cachedValues(ctxs))
+}
+
+func TestReadingsHistory_retain_maxAge(t *testing.T) {
+	dir := t.TempDir()
+	conf := newTestHistorySettings(dir)
+	conf.SegmentSize = 1
+	conf.MaxAge = time.Hour
+	history, err := openReadingsHistory(conf)
+	assert.NoError(t, err)
+	defer history.close()
+
+	now := time.Now()
+	assert.NoError(t, history.add(cachedValue("1", 0), now.Add(-2*time.Hour)))
+	assert.NoError(t, history.add(cachedValue("1", 1), now.Add(-30*time.Minute)))
+	assert.NoError(t, history.add(cachedValue("1", 2), now))
+
+	ctxs, err := queryHistory(history, nil, nil, time.Time{}, time.Time{})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{1, 2}, cachedValues(ctxs))
+}
+
+func TestReadingsHistory_reopen(t *testing.T) {
+	dir := t.TempDir()
+	history, err := openReadingsHistory(newTestHistorySettings(dir))
+	assert.NoError(t, err)
+
+	now := time.Now()
+	assert.NoError(t, history.add(cachedValue("1", 0), now.Add(-2*time.Minute)))
+	assert.NoError(t, history.add(cachedValue("2", 1), now.Add(-time.Minute)))
+	assert.NoError(t, history.add(cachedValue("1", 2), now))
+	assert.NoError(t, history.close())
+
+	// A record left partially written (e.g. by a crash) is skipped.
+	segments := historySegments(t, dir)
+	assert.Len(t, segments, 1)
+	f, err := os.OpenFile(filepath.Join(dir, segments[0]), os.O_APPEND|os.O_WRONLY, 0600)
+	assert.NoError(t, err)
+	_, err = f.WriteString(`{"time":"2020-01-01T00:00:00Z","dev`)
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	history, err = openReadingsHistory(newTestHistorySettings(dir))
+	assert.NoError(t, err)
+	defer history.close()
+
+	latest := history.getLatest()
+	assert.Len(t, latest, 2)
+	assert.Equal(t, "2", string(latest["1"].Readings[0].Value))
+	assert.Equal(t, "1", string(latest["2"].Readings[0].Value))
+	assert.True(t, now.Equal(latest["1"].Time))
+
+	// New records go to a new segment, after the existing ones.
+	assert.NoError(t, history.add(cachedValue("2", 3), time.Now()))
+	assert.Len(t, historySegments(t, dir), 2)
+
+	ctxs, err := queryHistory(history, nil, nil, time.Time{}, time.Time{})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{0, 1, 2, 3}, cachedValues(ctxs))
+}
+
+func TestReadingsHistory_index(t *testing.T) {
+	dir := t.TempDir()
+	history, err := openReadingsHistory(newTestHistorySettings(dir))
+	assert.NoError(t, err)
+	assert.NoError(t, history.add(cachedValue("1", 1), time.Now()))
+	assert.NoError(t, history.add(cachedValue("2", 2), time.Now()))
+	assert.NoError(t, history.close())
+
+	// The latest records are taken from the index saved on close, rather than
+	// by reading the segments again.
+	segments := historySegments(t, dir)
+	assert.Len(t, segments, 1)
+	assert.NoError(t, os.Truncate(filepath.Join(dir, segments[0]), 0))
+
+	history, err = openReadingsHistory(newTestHistorySettings(dir))
+	assert.NoError(t, err)
+	defer history.close()
+
+	latest := history.getLatest()
+	assert.Len(t, latest, 2)
+	assert.Equal(t, "1", string(latest["1"].Readings[0].Value))
+	assert.Equal(t, "2", string(latest["2"].Readings[0].Value))
+}
+
+func TestReadingsHistory_index_notClosed(t *testing.T) {
+	dir := t.TempDir()
+	conf := newTestHistorySettings(dir)
+	conf.SegmentSize = 1
+	history, err := openReadingsHistory(conf)
+	assert.NoError(t, err)
+	defer history.close()
+
+	now := time.Now()
+	assert.NoError(t, history.add(cachedValue("1", 1), now))
+	assert.NoError(t, history.add(cachedValue("2", 2), now))
+	assert.NoError(t, history.add(cachedValue("1", 3), now))
+
+	// If the history was not closed (e.g. after a crash), the records written
+	// after the index was last saved are read.
+	reopened, err := openReadingsHistory(conf)
+	assert.NoError(t, err)
+	defer reopened.close()
+
+	latest := reopened.getLatest()
+	assert.Len(t, latest, 2)
+	assert.Equal(t, "3", string(latest["1"].Readings[0].Value))
+	assert.Equal(t, "2", string(latest["2"].Readings[0].Value))
+}
+
+func TestReadingsHistory_index_invalid(t *testing.T) {
+	dir := t.TempDir()
+	history, err := openReadingsHistory(newTestHistorySettings(dir))
+	assert.NoError(t, err)
+	assert.NoError(t, history.add(cachedValue("1", 1), time.Now()))
+	assert.NoError(t, history.close())
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, historyIndexFile), []byte("not json"), 0600))
+
+	// An unreadable index is ignored, and the full history is read instead.
+	history, err = openReadingsHistory(newTestHistorySettings(dir))
+	assert.NoError(t, err)
+	defer history.close()
+
+	latest := history.getLatest()
+	assert.Len(t, latest, 1)
+	assert.Equal(t, "1", string(latest["1"].Readings[0].Value))
+}
+
+func TestReadingsHistory_enqueue(t *testing.T) {
+	dir := t.TempDir()
+	history, err := openReadingsHistory(newTestHistorySettings(dir))
+	assert.NoError(t, err)
+
+	assert.True(t, history.enqueue(cachedValue("1", 1), time.Now()))
+	assert.True(t, history.enqueue(cachedValue("1", 2), time.Now()))
+
+	// Closing the history waits for the queued readings to be written.
+	assert.NoError(t, history.close())
+	assert.False(t, history.enqueue(cachedValue("1", 3), time.Now()))
+
+	history, err = openReadingsHistory(newTestHistorySettings(dir))
+	assert.NoError(t, err)
+	defer history.close()
+
+	ctxs, err := queryHistory(history, nil, nil, time.Time{}, time.Time{})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{1, 2}, cachedValues(ctxs))
+}
+
+func TestReadingsHistory_query_unlocked(t *testing.T) {
+	history, err := openReadingsHistory(newTestHistorySettings(t.TempDir()))
+	assert.NoError(t, err)
+	defer history.close()
+
+	assert.NoError(t, history.add(cachedValue("1", 1), time.Now()))
+	assert.NoError(t, history.add(cachedValue("1", 2), time.Now()))
+
+	// The history can be written to while it is being read. Records written
+	// after the query started are not returned by it.
+	var values []interface{}
+	err = history.query(nil, nil, time.Time{}, time.Time{}, func(ctx *ReadContext) {
+		values = append(values, ctx.Reading[0].Value)
+		assert.NoError(t, history.add(cachedValue("1", 3), time.Now()))
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{1, 2}, values)
+}
+
+func TestReadingsHistory_open_ignoresOtherFiles(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "notes.log"), []byte("foo"), 0600))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "other.txt"), []byte("foo"), 0600))
+
+	history, err := openReadingsHistory(newTestHistorySettings(dir))
+	assert.NoError(t, err)
+	defer history.close()
+
+	assert.Empty(t, history.segments)
+}
+
+func TestStateManager_openHistory(t *testing.T) {
+	dir := t.TempDir()
+	history, err := openReadingsHistory(newTestHistorySettings(dir))
+	assert.NoError(t, err)
+	assert.NoError(t, history.add(cachedValue("1", 1), time.Now()))
+	assert.NoError(t, history.add(cachedValue("2", 2), time.Now()))
+	assert.NoError(t, history.close())
+
+	sm := stateManager{
+		config: &config.PluginSettings{
+			Cache: &config.CacheSettings{
+				History: newTestHistorySettings(dir),
+			},
+		},
+		readings: map[string][]*output.Reading{
+			"2": {{Value: 3}},
+		},
+		readingsLock: &sync.RWMutex{},
+	}
+	assert.NoError(t, sm.openHistory(&Plugin{}))
+	defer sm.closeHistory()
+
+	// The latest readings are restored, without replacing current readings.
+	assert.NotNil(t, sm.history)
+	assert.Equal(t, 1, sm.GetReadingsForDevice("1")[0].Value)
+	assert.Equal(t, 3, sm.GetReadingsForDevice("2")[0].Value)
+}
+
+func TestStateManager_openHistory_disabled(t *testing.T) {
+	sm := stateManager{
+		config: &config.PluginSettings{
+			Cache: &config.CacheSettings{
+				History: &config.HistorySettings{Enabled: false},
+			},
+		},
+	}
+	assert.NoError(t, sm.openHistory(&Plugin{}))
+	assert.Nil(t, sm.history)
+	assert.NoError(t, sm.closeHistory())
+}
+
+func TestStateManager_GetCachedReadings_history(t *testing.T) {
+	history, err := openReadingsHistory(newTestHistorySettings(t.TempDir()))
+	assert.NoError(t, err)
+	defer history.close()
+
+	sm := stateManager{
+		config: &config.PluginSettings{
+			Cache: &config.CacheSettings{
+				Enabled: true,
+			},
+		},
+		readingsCache: newReadingsCache(time.Minute, 10, 0),
+		history:       history,
+	}
+
+	ts, err := time.Parse(time.RFC3339, "2019-03-22T09:48:00Z")
+	assert.NoError(t, err)
+	assert.NoError(t, history.add(cachedValue("2", 2), ts))
+	assert.NoError(t, history.add(cachedValue("1", 3), ts.Add(time.Minute)))
+	sm.addReadingToHistory(cachedValue("1", 1))
+
+	// Readings are served from the history rather than the cache.
+	sm.addReadingToCache(cachedValue("1", 4))
+
+	readings := make(chan *ReadContext, 5)
+	sm.GetCachedReadings("2019-03-22T09:45:00Z", "2019-03-22T09:50:00Z", readings, "1")
+
+	var values []interface{}
+	for rctx := range readings {
+		values = append(values, rctx.Reading[0].Value)
+	}
+	assert.Equal(t, []interface{}{3}, values)
+}
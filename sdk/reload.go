@@ -0,0 +1,318 @@
+// Synse SDK
+// Copyright (c) 2017-2020 Vapor IO
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package sdk
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/vapor-ware/synse-sdk/sdk/config"
+	"github.com/vapor-ware/synse-sdk/sdk/health"
+)
+
+const (
+	// defaultReloadInterval is the interval at which device config files are
+	// checked for changes if no interval is configured.
+	defaultReloadInterval = 5 * time.Second
+)
+
+// DeviceReloadResult describes the changes made to a plugin's devices when its
+// device configuration was reloaded. Devices are identified by their ID, and
+// each list of IDs is sorted.
+type DeviceReloadResult struct {
+	// Added contains the IDs of devices which were newly added.
+	Added []string
+
+	// Updated contains the IDs of devices whose configuration changed. These
+	// devices were replaced with a new instance built from the updated config.
+	Updated []string
+
+	// Removed contains the IDs of devices which no longer exist in the config.
+	Removed []string
+
+	// Unchanged is the number of devices whose configuration did not change.
+	Unchanged int
+}
+
+// newDeviceReloadResult creates a DeviceReloadResult from the changes made to the
+// devices on reconciliation.
+func newDeviceReloadResult(changes *deviceChanges) *DeviceReloadResult {
+	result := &DeviceReloadResult{
+		Unchanged: changes.unchanged,
+	}
+
+	removed := make(map[string]struct{}, len(changes.removed))
+	for _, d := range changes.removed {
+		removed[d.id] = struct{}{}
+	}
+
+	// A device which was both removed and added was updated.
+	for _, d := range changes.added {
+		if _, ok := removed[d.id]; ok {
+			result.Updated = append(result.Updated, d.id)
+			delete(removed, d.id)
+		} else {
+			result.Added = append(result.Added, d.id)
+		}
+	}
+	for id := range removed {
+		result.Removed = append(result.Removed, id)
+	}
+	sort.Strings(result.Added)
+	sort.Strings(result.Updated)
+	sort.Strings(result.Removed)
+	return result
+}
+
+// String returns a summary of the reload result.
+func (result *DeviceReloadResult) String() string {
+	return fmt.Sprintf(
+		"added: %d, updated: %d, removed: %d, unchanged: %d",
+		len(result.Added), len(result.Updated), len(result.Removed), result.Unchanged,
+	)
+}
+
+// deviceReloader is the plugin component which reloads device configuration while
+// the plugin is running. A reload is triggered on SIGHUP, or when a change to the
+// device config files is detected if watching is enabled.
+type deviceReloader struct {
+	plugin *Plugin
+	config *config.ReloadSettings
+
+	// check is the health check which reports the result of the most
+	// recent reload.
+	check *health.ReportedHealthCheck
+
+	// signals receives the signals which trigger a reload.
+	signals chan os.Signal
+
+	// stop is a channel used to signal that the reloader should stop.
+	stop     chan struct{}
+	stopOnce sync.Once
+
+	// lock ensures that only one reload happens at a time.
+	lock sync.Mutex
+}
+
+// newDeviceReloader creates a new instance of the plugin's device reloader.
+func newDeviceReloader(plugin *Plugin) *deviceReloader {
+	conf := plugin.config.Settings.Reload
+	if conf == nil {
+		conf = &config.ReloadSettings{
+			Interval: defaultReloadInterval,
+		}
+	}
+
+	return &deviceReloader{
+		plugin:  plugin,
+		config:  conf,
+		check:   health.NewReportedHealthCheck("device config reload"),
+		signals: make(chan os.Signal, 1),
+		stop:    make(chan struct{}),
+	}
+}
+
+// registerActions registers pre-run (setup) and post-run (teardown) actions
+// for the device reloader.
+func (reloader *deviceReloader) registerActions(plugin *Plugin) {
+	// Register pre-run actions.
+	plugin.RegisterPreRunActions(
+		&PluginAction{
+			Name: "Register default device reloader health checks",
+			Action: func(p *Plugin) error {
+				p.health.RegisterDefault(reloader.check)
+				return nil
+			},
+		},
+	)
+
+	// Register post-run actions.
+	plugin.RegisterPostRunActions(
+		&PluginAction{
+			Name:   "Stop device reloader",
+			Action: func(p *Plugin) error { reloader.Stop(); return nil },
+		},
+	)
+}
+
+// Start starts the device reloader. If reloading is disabled, this does nothing.
+func (reloader *deviceReloader) Start() {
+	if reloader.config.Disable {
+		log.Info("[reload] device config reloading is disabled")
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"watch":    reloader.config.Watch,
+		"interval": reloader.config.Interval,
+	}).Info("[reload] starting")
+
+	signal.Notify(reloader.signals, syscall.SIGHUP)
+	log.Info("[reload] will reload device config on: [SIGHUP]")
+
+	go reloader.run()
+}
+
+// Stop stops the device reloader. It is safe to call Stop more than once.
+func (reloader *deviceReloader) Stop() {
+	reloader.stopOnce.Do(func() {
+		log.Info("[reload] stopping")
+		signal.Stop(reloader.signals)
+		close(reloader.stop)
+	})
+}
+
+// run waits for reload triggers and reloads device config until the reloader
+// is stopped.
+func (reloader *deviceReloader) run() {
+	var changes <-chan time.Time
+	var fingerprint string
+
+	if reloader.config.Watch {
+		interval := reloader.config.Interval
+		if interval <= 0 {
+			interval = defaultReloadInterval
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		changes = ticker.C
+		fingerprint = deviceConfigFingerprint()
+	}
+
+	// Reload errors are logged and reported via the health check, so they
+	// do not need to be handled here.
+	for {
+		select {
+		case <-reloader.stop:
+			log.Info("[reload] stop channel closed, terminating reloader")
+			return
+
+		case sig := <-reloader.signals:
+			log.WithField("signal", sig.String()).Info("[reload] received reload signal")
+			_, _ = reloader.reload()
+
+		case <-changes:
+			current := deviceConfigFingerprint()
+			if current == fingerprint {
+				continue
+			}
+			fingerprint = current
+			log.Info("[reload] detected change to device config files")
+			_, _ = reloader.reload()
+		}
+	}
+}
+
+// reload reloads the plugin's device configuration and reconciles the plugin's
+// devices against it. Only devices created from device config files are affected.
+//
+// If the configuration can not be loaded or any device can not be created from
+// it, the current devices are left as they are. The result of the reload is
+// logged and reported via the reloader's health check.
+func (reloader *deviceReloader) reload() (*DeviceReloadResult, error) {
+	reloader.lock.Lock()
+	defer reloader.lock.Unlock()
+
+	log.Info("[reload] reloading device config")
+
+	devices, err := reloader.plugin.device.loadConfigDevices()
+	if err != nil {
+		log.WithField("error", err).Error("[reload] failed to load device config, keeping current devices")
+		reloader.check.Report("", fmt.Errorf("failed to load device config: %v", err))
+		return nil, err
+	}
+
+	changes, err := reloader.plugin.device.reconcile(sourceConfig, devices)
+	result := newDeviceReloadResult(changes)
+
+	// Detach removed devices, and the previous instance of updated devices, and
+	// attach their replacements.
+	reloader.plugin.detachDevices(changes.removed...)
+	reloader.plugin.attachDevices(changes.added...)
+
+	// Run device setup actions for any new devices.
+	if setupErr := reloader.plugin.device.execDeviceSetupActionsFor(reloader.plugin, changes.added); setupErr != nil {
+		log.WithField("error", setupErr).Error("[reload] failed to run setup actions for reloaded devices")
+		if err == nil {
+			err = setupErr
+		}
+	}
+
+	rlog := log.WithFields(log.Fields{
+		"added":     result.Added,
+		"updated":   result.Updated,
+		"removed":   result.Removed,
+		"unchanged": result.Unchanged,
+	})
+	if err != nil {
+		rlog.WithField("error", err).Error("[reload] device config reloaded with errors")
+		reloader.check.Report("", fmt.Errorf("device config reloaded with errors (%s): %v", result, err))
+		return result, err
+	}
+
+	rlog.Info("[reload] device config reloaded")
+	reloader.check.Report(fmt.Sprintf("device config reloaded (%s)", result), nil)
+	return result, nil
+}
+
+// deviceConfigFingerprint gets a fingerprint of the device config files which
+// would be loaded by the device manager. Changes to the fingerprint indicate
+// that the device config files have changed.
+func deviceConfigFingerprint() string {
+	paths := []string{localDeviceConfig, defaultDeviceConfig}
+	if override := os.Getenv(DeviceEnvOverride); override != "" {
+		paths = []string{override}
+	}
+
+	var parts []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+
+		files := []os.FileInfo{info}
+		if info.IsDir() {
+			files, err = ioutil.ReadDir(path)
+			if err != nil {
+				continue
+			}
+		} else {
+			path = filepath.Dir(path)
+		}
+
+		for _, f := range files {
+			if f.IsDir() {
+				continue
+			}
+			parts = append(parts, fmt.Sprintf(
+				"%s:%d:%d", filepath.Join(path, f.Name()), f.Size(), f.ModTime().UnixNano(),
+			))
+		}
+	}
+	return strings.Join(parts, ";")
+}
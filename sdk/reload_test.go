@@ -0,0 +1,311 @@
+// Synse SDK
+// Copyright (c) 2017-2020 Vapor IO
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package sdk
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/vapor-ware/synse-sdk/internal/test"
+	"github.com/vapor-ware/synse-sdk/sdk/config"
+	"github.com/vapor-ware/synse-sdk/sdk/health"
+	"github.com/vapor-ware/synse-sdk/sdk/output"
+	"github.com/vapor-ware/synse-sdk/sdk/policy"
+)
+
+// newReloadTestPlugin creates a plugin whose device config is loaded from a temporary
+// directory, which is returned along with a function to clean it up.
+func newReloadTestPlugin(t *testing.T) (*Plugin, string, func()) {
+	origLocal := localDeviceConfig
+	origDefault := defaultDeviceConfig
+	dir, closer := test.TempDir(t)
+
+	localDeviceConfig = dir
+	defaultDeviceConfig = dir
+
+	pluginid := &pluginID{uuid: uuid.NewSHA1(uuid.NameSpaceDNS, []byte("test"))}
+	p := &Plugin{
+		id:             pluginid,
+		info:           &PluginMetadata{Name: "test"},
+		pluginHandlers: NewDefaultPluginHandlers(),
+		policies: &policy.Policies{
+			DeviceConfig: policy.Optional,
+		},
+		config: &config.Plugin{
+			Settings: &config.PluginSettings{
+				Reload: &config.ReloadSettings{},
+			},
+		},
+	}
+	p.device = &deviceManager{
+		config:         new(config.Devices),
+		id:             pluginid,
+		pluginHandlers: p.pluginHandlers,
+		policies:       p.policies,
+		tagCache:       NewTagCache(),
+		aliasCache:     NewAliasCache(),
+		devices:        map[string]*Device{},
+		handlers: map[string]*DeviceHandler{
+			"foo": {Name: "foo"},
+		},
+		plugin: p,
+	}
+	p.state = &stateManager{
+		readings:     map[string][]*output.Reading{},
+		readingsLock: &sync.RWMutex{},
+	}
+	p.reloader = newDeviceReloader(p)
+
+	return p, dir, func() {
+		localDeviceConfig = origLocal
+		defaultDeviceConfig = origDefault
+		closer()
+	}
+}
+
+// writeDeviceConfig writes a device config file for the "foo" handler with the
+// given instances YAML.
+func writeDeviceConfig(t *testing.T, dir, instances string) {
+	data := "version: 3\ndevices:\n  - type: foo\n    handler: foo\n    instances:\n" + instances
+	err := ioutil.WriteFile(filepath.Join(dir, "config.yml"), []byte(data), 0644)
+	assert.NoError(t, err)
+}
+
+func TestNewDeviceReloadResult(t *testing.T) {
+	changes := &deviceChanges{
+		added: []*Device{
+			{id: "6"},
+			{id: "2"},
+			{id: "1"},
+			{id: "7"},
+			{id: "5"},
+		},
+		removed: []*Device{
+			{id: "4"},
+			{id: "7"},
+			{id: "2"},
+			{id: "3"},
+		},
+		unchanged: 5,
+	}
+
+	// The device IDs are sorted, regardless of the order of the changes.
+	result := newDeviceReloadResult(changes)
+	assert.Equal(t, []string{"1", "5", "6"}, result.Added)
+	assert.Equal(t, []string{"2", "7"}, result.Updated)
+	assert.Equal(t, []string{"3", "4"}, result.Removed)
+	assert.Equal(t, 5, result.Unchanged)
+	assert.Equal(t, "added: 3, updated: 2, removed: 2, unchanged: 5", result.String())
+}
+
+func TestDeviceReloader_reload(t *testing.T) {
+	p, dir, cleanup := newReloadTestPlugin(t)
+	defer cleanup()
+
+	// Initial load.
+	writeDeviceConfig(t, dir, `
+      - info: one
+        data: {id: 1}
+      - info: two
+        data: {id: 2}
+        alias: {name: two}
+`)
+	result, err := p.reloader.reload()
+	assert.NoError(t, err)
+	assert.Len(t, result.Added, 2)
+	assert.Empty(t, result.Updated)
+	assert.Empty(t, result.Removed)
+	assert.Len(t, p.device.devices, 2)
+	assert.NotNil(t, p.device.aliasCache.Get("two"))
+
+	status := p.reloader.check.Status()
+	assert.True(t, status.Ok)
+	assert.Equal(t, health.ReportedCheck, status.Type)
+	assert.Contains(t, status.Message, "added: 2")
+
+	// Set readings for all devices so we can check that they are cleaned up.
+	for id := range p.device.devices {
+		p.state.readings[id] = []*output.Reading{{Value: 1}}
+	}
+	var removedID, updatedID string
+	for id, d := range p.device.devices {
+		if d.Info == "one" {
+			removedID = id
+		} else {
+			updatedID = id
+		}
+	}
+
+	// Remove one device, update one device, and add a new device.
+	writeDeviceConfig(t, dir, `
+      - info: two (updated)
+        data: {id: 2}
+        alias: {name: two}
+      - info: three
+        data: {id: 3}
+`)
+	result, err = p.reloader.reload()
+	assert.NoError(t, err)
+	assert.Len(t, result.Added, 1)
+	assert.Equal(t, []string{updatedID}, result.Updated)
+	assert.Equal(t, []string{removedID}, result.Removed)
+	assert.Equal(t, 0, result.Unchanged)
+
+	assert.Len(t, p.device.devices, 2)
+	assert.NotContains(t, p.device.devices, removedID)
+	assert.Equal(t, "two (updated)", p.device.devices[updatedID].Info)
+	assert.Equal(t, p.device.devices[updatedID], p.device.aliasCache.Get("two"))
+	assert.Empty(t, p.device.tagCache.GetDevicesFromTags(newIDTag(removedID)))
+	assert.Empty(t, p.state.readings)
+
+	// Reloading again without changes should not change anything.
+	result, err = p.reloader.reload()
+	assert.NoError(t, err)
+	assert.Empty(t, result.Added)
+	assert.Empty(t, result.Updated)
+	assert.Empty(t, result.Removed)
+	assert.Equal(t, 2, result.Unchanged)
+}
+
+func TestDeviceReloader_reload_badConfig(t *testing.T) {
+	p, dir, cleanup := newReloadTestPlugin(t)
+	defer cleanup()
+
+	writeDeviceConfig(t, dir, `
+      - info: one
+        data: {id: 1}
+`)
+	_, err := p.reloader.reload()
+	assert.NoError(t, err)
+	assert.Len(t, p.device.devices, 1)
+
+	// A device with an unknown handler can not be created, so the reload
+	// should fail and leave the current devices in place.
+	writeDeviceConfig(t, dir, `
+      - info: one
+        handler: unknown
+        data: {id: 1}
+`)
+	result, err := p.reloader.reload()
+	assert.Error(t, err)
+	assert.Nil(t, result)
+	assert.Len(t, p.device.devices, 1)
+
+	status := p.reloader.check.Status()
+	assert.False(t, status.Ok)
+	assert.Contains(t, status.Message, "failed to load device config")
+}
+
+func TestDeviceReloader_reload_doesNotAffectOtherDevices(t *testing.T) {
+	p, dir, cleanup := newReloadTestPlugin(t)
+	defer cleanup()
+
+	// A device registered directly with the plugin is not from config.
+	direct := &Device{
+		Type:    "foo",
+		Handler: "foo",
+		Data:    map[string]interface{}{"id": "direct"},
+	}
+	assert.NoError(t, p.device.AddDevice(direct))
+
+	writeDeviceConfig(t, dir, `
+      - info: one
+        data: {id: 1}
+`)
+	result, err := p.reloader.reload()
+	assert.NoError(t, err)
+	assert.Len(t, result.Added, 1)
+	assert.Empty(t, result.Removed)
+	assert.Len(t, p.device.devices, 2)
+	assert.Contains(t, p.device.devices, direct.id)
+}
+
+func TestDeviceReloader_reload_setupActions(t *testing.T) {
+	p, dir, cleanup := newReloadTestPlugin(t)
+	defer cleanup()
+
+	var setup []string
+	err := p.device.AddDeviceSetupActions(&DeviceAction{
+		Name:   "test",
+		Filter: map[string][]string{"type": {"foo"}},
+		Action: func(_ *Plugin, d *Device) error {
+			setup = append(setup, d.Info)
+			if d.Info == "bad" {
+				return errors.New("setup failed")
+			}
+			return nil
+		},
+	})
+	assert.NoError(t, err)
+
+	writeDeviceConfig(t, dir, `
+      - info: bad
+        data: {id: 1}
+`)
+	_, err = p.reloader.reload()
+	assert.Error(t, err)
+	assert.Equal(t, []string{"bad"}, setup)
+	assert.False(t, p.reloader.check.Status().Ok)
+}
+
+func TestDeviceReloader_Stop_twice(t *testing.T) {
+	p, _, cleanup := newReloadTestPlugin(t)
+	defer cleanup()
+
+	p.reloader.Start()
+	p.reloader.Stop()
+	p.reloader.Stop()
+}
+
+func TestDeviceConfigFingerprint(t *testing.T) {
+	_, dir, cleanup := newReloadTestPlugin(t)
+	defer cleanup()
+
+	empty := deviceConfigFingerprint()
+	assert.Equal(t, "", empty)
+
+	writeDeviceConfig(t, dir, `
+      - info: one
+`)
+	first := deviceConfigFingerprint()
+	assert.NotEqual(t, empty, first)
+	assert.Equal(t, first, deviceConfigFingerprint())
+
+	writeDeviceConfig(t, dir, `
+      - info: one
+      - info: two
+`)
+	assert.NotEqual(t, first, deviceConfigFingerprint())
+}
+
+func TestDeviceConfigFingerprint_envOverride(t *testing.T) {
+	_, dir, cleanup := newReloadTestPlugin(t)
+	defer cleanup()
+
+	writeDeviceConfig(t, dir, `
+      - info: one
+`)
+	test.SetEnv(t, DeviceEnvOverride, filepath.Join(dir, "config.yml"))
+	defer test.RemoveEnv(t, DeviceEnvOverride)
+
+	assert.Contains(t, deviceConfigFingerprint(), filepath.Join(dir, "config.yml"))
+}
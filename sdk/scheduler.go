@@ -18,8 +18,12 @@ package sdk
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"math"
+	"math/rand"
 	"sync"
 	"time"
 
@@ -27,6 +31,7 @@ import (
 	"github.com/vapor-ware/synse-sdk/sdk/config"
 	sdkError "github.com/vapor-ware/synse-sdk/sdk/errors"
 	"github.com/vapor-ware/synse-sdk/sdk/health"
+	"github.com/vapor-ware/synse-sdk/sdk/output"
 	synse "github.com/vapor-ware/synse-server-grpc/go"
 	"golang.org/x/time/rate"
 )
@@ -36,14 +41,39 @@ const (
 	modeParallel = "parallel"
 )
 
+// Read schedules, which determine when each device is first read.
+const (
+	scheduleImmediate = "immediate"
+	scheduleStaggered = "staggered"
+)
+
 // Scheduler error definitions.
 var (
-	ErrDeviceNotWritable  = errors.New("writing is not enabled for the device")
-	ErrDeviceWriteTimeout = errors.New("device write timed out")
-	ErrNilDevice          = errors.New("cannot perform action on nil device")
-	ErrNilData            = errors.New("cannot write nil data to device")
+	ErrDeviceNotWritable    = errors.New("writing is not enabled for the device")
+	ErrDeviceReadTimeout    = errors.New("device read timed out")
+	ErrDeviceReadHung       = errors.New("device read skipped: a previous read of the device or its lock group timed out and has not returned")
+	ErrDeviceWriteTimeout   = errors.New("device write timed out")
+	ErrDeviceWriteCancelled = errors.New("device write cancelled: plugin shutting down")
+	ErrNilDevice            = errors.New("cannot perform action on nil device")
+	ErrNilData              = errors.New("cannot write nil data to device")
+	ErrSchedulerStopped     = errors.New("scheduler stopped: not accepting new writes")
+)
+
+// msgWriteCancelled is the transaction message set for writes which were still
+// queued when the scheduler was stopped.
+const msgWriteCancelled = "write cancelled: plugin shut down before the write was processed"
+
+// Transaction message suffixes which record how a device write handler responded
+// to its write being cancelled, either by timeout or by plugin shutdown.
+const (
+	msgWriteAcknowledged = "handler acknowledged cancellation"
+	msgWriteOverrun      = "handler overran deadline, write may still take effect"
 )
 
+// writeCancelGracePeriod is how long to wait for a WriteContext handler to return
+// after its context is cancelled before considering it to have overrun.
+var writeCancelGracePeriod = 1 * time.Second
+
 // ListenerCtx is the context needed for a listener function to be called
 // and retried at a later time if it errors out after the listener goroutine
 // is initially dispatched.
@@ -56,17 +86,40 @@ type ListenerCtx struct {
 
 	// restarts is the number of times the listener has been restarted.
 	restarts int
+
+	// stop is closed to signal that the listener should not be restarted,
+	// e.g. when its device is removed from the plugin.
+	stop chan struct{}
+
+	// ctx is the context passed to Subscribe handlers. It is cancelled along
+	// with stop being closed.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// check is the health check which reports the state of the listener.
+	check *health.ReportedHealthCheck
 }
 
 // NewListenerCtx creates a new ListenerCtx for the given handler and device.
 func NewListenerCtx(handler *DeviceHandler, device *Device) *ListenerCtx {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &ListenerCtx{
 		handler:  handler,
 		device:   device,
 		restarts: 0,
+		stop:     make(chan struct{}),
+		ctx:      ctx,
+		cancel:   cancel,
+		check:    health.NewReportedHealthCheck("device listener: " + device.id),
 	}
 }
 
+// close signals that the listener should stop.
+func (listenerCtx *ListenerCtx) close() {
+	close(listenerCtx.stop)
+	listenerCtx.cancel()
+}
+
 // scheduler is the plugin component which runs the read, write, and
 // listen jobs to get data from devices and write data to devices.
 type scheduler struct {
@@ -77,20 +130,98 @@ type scheduler struct {
 	// config is the configuration that is used by the scheduler.
 	config *config.PluginSettings
 
-	// serialLock is a lock that is used around reads/writes when
-	// the scheduler is run in serial mode.
+	// serialLock is a lock that is used around reads/writes of devices
+	// which are not in a lock group when the scheduler is run in serial mode.
 	serialLock *sync.Mutex
 
-	// limiter is a rate limiter for making requests.
+	// groupLocks holds the lock for each device lock group, keyed by group
+	// name. It is guarded by groupLocksLock.
+	groupLocks     map[string]*sync.Mutex
+	groupLocksLock sync.Mutex
+
+	// limiter is the global rate limiter for making requests.
 	limiter *rate.Limiter
 
+	// limiters holds the rate limiters for lock groups, handlers, and devices
+	// which configure their own, keyed by scope and name. It is guarded by
+	// limitersLock.
+	limiters     map[string]*scopedLimiter
+	limitersLock sync.Mutex
+
 	// writeChan is the channel that is used to queue write actions for
 	// devices.
 	writeChan chan *WriteContext
 
+	// writeQueues holds the writes waiting to be run for each device which
+	// has a write worker running, keyed by device ID. Each device's queue is
+	// bounded by the write queue size (see dispatchWrite). It is guarded by
+	// writeQueuesLock. The writeWorkers WaitGroup tracks the running workers.
+	writeQueues     map[string][]*WriteContext
+	writeQueuesLock sync.Mutex
+	writeWorkers    sync.WaitGroup
+
+	// schedule holds the scheduled writes which are not yet due. Writes are
+	// queued into the write queue as they come due (see runSchedule).
+	schedule *writeSchedule
+
 	// stop is a channel used to signal that the scheduler should stop.
-	// This is generally used for graceful shutdown.
-	stop chan struct{}
+	// This is generally used for graceful shutdown. It is closed once, via
+	// closeStop.
+	stop      chan struct{}
+	closeStop sync.Once
+
+	// stopped is set once the scheduler has been stopped, after which no
+	// new writes are accepted. It is guarded by stopLock, which is held for
+	// reading while writes are being queued.
+	stopped  bool
+	stopLock sync.RWMutex
+
+	// running tracks the scheduler's read and write loops so that a stop
+	// can wait for any in-progress reads and writes to complete.
+	running sync.WaitGroup
+
+	// readers holds the state of the read loop for each device which is
+	// read individually, keyed by device ID, so read loops can be stopped
+	// when their device is removed. It is guarded by readerLock, as is
+	// isReading. The readLoops WaitGroup tracks all running read loops.
+	readers    map[string]*reader
+	readerLock sync.Mutex
+	readLoops  sync.WaitGroup
+
+	// bulkReaders holds the state of the read loop for each handler which
+	// bulk reads its devices, keyed by handler name. A handler's bulk read
+	// loop runs while the handler has devices. It is guarded by readerLock.
+	bulkReaders map[string]*reader
+
+	// readPool runs reads when the number of concurrent reads is bounded, and
+	// readTimers schedules the reads which it runs, in place of the read loops.
+	// If reads are unbounded, both are nil and each device (or bulk-read handler)
+	// has a read loop which runs its own reads.
+	readPool   *readPool
+	readTimers *readTimers
+
+	// abandoned holds the keys of the reads which timed out and have not yet
+	// returned (see runRead). It is guarded by abandonedLock.
+	abandoned     map[string]bool
+	abandonedLock sync.Mutex
+
+	// listeners holds the context for each running device listener, keyed
+	// by device ID, so listeners can be stopped when their device is removed.
+	// It is guarded by listenerLock.
+	listeners    map[string]*ListenerCtx
+	listenerLock sync.Mutex
+
+	// bulkStats holds the bulk read statistics for each device handler, keyed
+	// by handler name. It is guarded by statsLock.
+	bulkStats map[string]*statsTracker
+	statsLock sync.Mutex
+
+	// breakerLock guards the creation of device circuit breakers, and the
+	// circuit breakers for the bulk reads of each device handler, keyed by
+	// handler name. Failing devices are reported to the health manager.
+	breakerLock  sync.Mutex
+	bulkBreakers map[string]*circuitBreaker
+	health       *health.Manager
 
 	// Flag to check what state the scheduler is in. This is generally
 	// used for debug/testing.
@@ -103,22 +234,14 @@ type scheduler struct {
 func newScheduler(plugin *Plugin) *scheduler {
 	conf := plugin.config.Settings
 
-	var limiter *rate.Limiter
-
 	// If the limiter is configured and non-0 values (which signify unlimited),
 	// set up the limiter.
-	if conf.Limiter != nil {
-		if conf.Limiter.Rate != 0 || conf.Limiter.Burst != 0 {
-			log.WithFields(log.Fields{
-				"rate":  conf.Limiter.Rate,
-				"burst": conf.Limiter.Burst,
-			}).Info("[scheduler] configuring rate limiter")
-
-			limiter = rate.NewLimiter(
-				rate.Limit(conf.Limiter.Rate),
-				conf.Limiter.Burst,
-			)
-		}
+	limiter := newRateLimiter(conf.Limiter)
+	if limiter != nil {
+		log.WithFields(log.Fields{
+			"rate":  conf.Limiter.Rate,
+			"burst": conf.Limiter.Burst,
+		}).Info("[scheduler] configuring rate limiter")
 	}
 
 	return &scheduler{
@@ -127,7 +250,9 @@ func newScheduler(plugin *Plugin) *scheduler {
 		config:        conf,
 		limiter:       limiter,
 		serialLock:    &sync.Mutex{},
+		health:        plugin.health,
 		writeChan:     make(chan *WriteContext, conf.Write.QueueSize),
+		schedule:      newWriteSchedule(conf.Write.ScheduleFile),
 		stop:          make(chan struct{}),
 	}
 }
@@ -147,7 +272,7 @@ func (scheduler *scheduler) registerActions(plugin *Plugin) {
 	plugin.RegisterPostRunActions(
 		&PluginAction{
 			Name:   "Stop scheduler",
-			Action: func(p *Plugin) error { return scheduler.Stop() },
+			Action: func(p *Plugin) error { return scheduler.Stop(p.stopContext()) },
 		},
 	)
 }
@@ -155,35 +280,147 @@ func (scheduler *scheduler) registerActions(plugin *Plugin) {
 // healthChecks defines and registers the scheduler's default health checks with
 // the plugin.
 func (scheduler *scheduler) healthChecks(plugin *Plugin) error {
-	wqh := health.NewPeriodicHealthCheck("write queue health", 30*time.Second, func() error {
-		// Determine the percent usage of the write queue.
-		pctUsage := (float64(len(scheduler.writeChan)) / float64(cap(scheduler.writeChan))) * 100
-
-		// If the write queue is at 95% usage, we consider it unhealthy; the write
-		// queue should be configured to be larger.
-		if pctUsage > 95 {
-			return fmt.Errorf("write queue usage >95%%, consider increasing size in configuration")
-		}
-		return nil
-	})
+	wqh := health.NewPeriodicHealthCheck("write queue health", 30*time.Second, scheduler.checkWriteQueues)
 	plugin.health.RegisterDefault(wqh)
 	return nil
 }
 
+// checkWriteQueues checks the usage of the write queue and of the device write
+// queues. If any of them is at 95% usage, it is considered unhealthy; the write
+// queue should be configured to be larger.
+func (scheduler *scheduler) checkWriteQueues() error {
+	pctUsage := (float64(len(scheduler.writeChan)) / float64(cap(scheduler.writeChan))) * 100
+	if pctUsage > 95 {
+		return fmt.Errorf("write queue usage >95%%, consider increasing size in configuration")
+	}
+
+	// A device whose write queue stays full may also be failing to complete
+	// its writes.
+	if device, usage := scheduler.writeQueueUsage(); usage*100 > 95 {
+		return fmt.Errorf("write queue usage for device %s >95%%, consider increasing size in configuration", device)
+	}
+	return nil
+}
+
 // Start starts the scheduler.
 func (scheduler *scheduler) Start() {
 	log.Info("[scheduler] starting")
 
-	go scheduler.scheduleReads()
-	go scheduler.scheduleWrites()
+	// Restore the saved write schedule before any writes can be scheduled, so
+	// that saving the schedule for a new write does not overwrite it.
+	if scheduler.schedule != nil && !scheduler.config.Write.Disable && scheduler.deviceManager.HasWriteHandlers() {
+		scheduler.restoreSchedule()
+	}
+
+	scheduler.running.Add(3)
+	go func() {
+		defer scheduler.running.Done()
+		scheduler.scheduleReads()
+	}()
+	go func() {
+		defer scheduler.running.Done()
+		scheduler.scheduleWrites()
+	}()
+	go func() {
+		defer scheduler.running.Done()
+		scheduler.schedulePeriodicActions()
+	}()
 	go scheduler.scheduleListen()
 }
 
 // Stop the scheduler.
-func (scheduler *scheduler) Stop() error {
+//
+// Once stopped, the scheduler no longer accepts new writes. Reads which are
+// already in progress are allowed to complete, the contexts of in-progress
+// writes are cancelled, and any writes which remain queued are failed. If the
+// context is done before in-progress work completes, the scheduler stops waiting
+// on it and the context error is returned.
+func (scheduler *scheduler) Stop(ctx context.Context) error {
 	log.Info("[scheduler] stopping")
 
-	close(scheduler.stop)
+	// Close the stop channel before taking the stop lock, which is held while
+	// writes are queued, so writes blocked on a full write queue give up.
+	scheduler.closeStop.Do(func() {
+		close(scheduler.stop)
+	})
+
+	scheduler.stopLock.Lock()
+	if scheduler.stopped {
+		scheduler.stopLock.Unlock()
+		return nil
+	}
+	scheduler.stopped = true
+	scheduler.stopLock.Unlock()
+
+	scheduler.stopListeners()
+
+	// Wait for the read and write loops, and any device periodic actions, to
+	// finish their current iteration.
+	done := make(chan struct{})
+	go func() {
+		scheduler.running.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+		log.Debug("[scheduler] in-progress reads and writes completed")
+	case <-ctx.Done():
+		log.WithField("error", ctx.Err()).Warn("[scheduler] stopped waiting for in-progress reads and writes")
+		err = ctx.Err()
+	}
+
+	scheduler.failQueuedWrites()
+	return err
+}
+
+// failQueuedWrites drains the write queue, failing the transactions for any
+// writes which were queued but not processed before the scheduler stopped.
+func (scheduler *scheduler) failQueuedWrites() {
+	var failed int
+	for {
+		select {
+		case w := <-scheduler.writeChan:
+			failWrites(w)
+			failed++
+		default:
+			if failed > 0 {
+				log.WithField("writes", failed).Warn("[scheduler] failed queued writes on stop")
+			}
+			return
+		}
+	}
+}
+
+// failWrites fails the transactions of writes which will not be run because
+// the scheduler stopped.
+func failWrites(writes ...*WriteContext) {
+	for _, w := range writes {
+		w.transaction.message = msgWriteCancelled
+		w.transaction.setStatusError()
+	}
+}
+
+// queueWrites adds writes to the scheduler's write queue. If the scheduler has
+// been stopped, or is stopped while waiting on a full write queue, the writes
+// which were not queued are failed and ErrSchedulerStopped is returned.
+func (scheduler *scheduler) queueWrites(writes ...*WriteContext) error {
+	scheduler.stopLock.RLock()
+	defer scheduler.stopLock.RUnlock()
+
+	if scheduler.stopped {
+		failWrites(writes...)
+		return ErrSchedulerStopped
+	}
+	for i, w := range writes {
+		select {
+		case scheduler.writeChan <- w:
+		case <-scheduler.stop:
+			failWrites(writes[i:]...)
+			return ErrSchedulerStopped
+		}
+	}
 	return nil
 }
 
@@ -199,7 +436,12 @@ func (scheduler *scheduler) Write(device *Device, data []*synse.V3WriteData) ([]
 		return nil, ErrDeviceNotWritable
 	}
 
+	if scheduler.isStopped() {
+		return nil, ErrSchedulerStopped
+	}
+
 	var response []*synse.V3WriteTransaction
+	var writes []*WriteContext
 	for _, writeData := range data {
 		t, err := scheduler.stateManager.newTransaction(device.WriteTimeout, writeData.Transaction)
 		if err != nil {
@@ -221,12 +463,16 @@ func (scheduler *scheduler) Write(device *Device, data []*synse.V3WriteData) ([]
 			Timeout: device.WriteTimeout.String(),
 		})
 
-		// Queue up the write.
-		scheduler.writeChan <- &WriteContext{
+		writes = append(writes, &WriteContext{
 			transaction: t,
 			device:      device,
 			data:        writeData,
-		}
+		})
+	}
+
+	// Queue up the writes.
+	if err := scheduler.queueWrites(writes...); err != nil {
+		return nil, err
 	}
 	return response, nil
 }
@@ -242,8 +488,13 @@ func (scheduler *scheduler) WriteAndWait(device *Device, data []*synse.V3WriteDa
 		return nil, ErrDeviceNotWritable
 	}
 
+	if scheduler.isStopped() {
+		return nil, ErrSchedulerStopped
+	}
+
 	var response []*synse.V3TransactionStatus
 	var txns []*transaction
+	var writes []*WriteContext
 	var waitGroup sync.WaitGroup
 
 	for _, writeData := range data {
@@ -260,14 +511,19 @@ func (scheduler *scheduler) WriteAndWait(device *Device, data []*synse.V3WriteDa
 		}).Debug("[scheduler] queuing device write")
 
 		txns = append(txns, t)
-
-		// Queue up the write.
-		scheduler.writeChan <- &WriteContext{
+		writes = append(writes, &WriteContext{
 			transaction: t,
 			device:      device,
 			data:        writeData,
-		}
+		})
+	}
 
+	// Queue up the writes.
+	if err := scheduler.queueWrites(writes...); err != nil {
+		return nil, err
+	}
+
+	for _, t := range txns {
 		waitGroup.Add(1)
 		go func(t *transaction, wg *sync.WaitGroup) {
 			t.wait()
@@ -283,8 +539,22 @@ func (scheduler *scheduler) WriteAndWait(device *Device, data []*synse.V3WriteDa
 	return response, nil
 }
 
+// isStopped checks whether the scheduler has been stopped.
+func (scheduler *scheduler) isStopped() bool {
+	scheduler.stopLock.RLock()
+	defer scheduler.stopLock.RUnlock()
+	return scheduler.stopped
+}
+
 // scheduleReads schedules device reads based on the plugin configuration.
 //
+// Each device which is read individually is read on its own schedule, as is each
+// handler which bulk reads its devices, so a slow read does not delay any others.
+// If reads are unbounded, each schedule is run by its own read loop; otherwise, all
+// schedules are driven by the read timers, which queue reads in the read pool as
+// they come due. This blocks until the scheduler is stopped and any in-progress
+// reads complete.
+//
 // This will do nothing if:
 // - Reading is globally disabled for the plugin.
 // - No registered device handlers implement a read function.
@@ -299,65 +569,486 @@ func (scheduler *scheduler) scheduleReads() {
 		return
 	}
 
-	interval := scheduler.config.Read.Interval
-	delay := scheduler.config.Read.Delay
-	mode := scheduler.config.Mode
-
 	log.WithFields(log.Fields{
-		"interval": interval,
-		"delay":    delay,
-		"mode":     mode,
+		"interval": scheduler.config.Read.Interval,
+		"delay":    scheduler.config.Read.Delay,
+		"mode":     scheduler.config.Mode,
+		"schedule": scheduler.config.Read.Schedule,
+		"jitter":   scheduler.config.Read.Jitter,
 	}).Info("[scheduler] starting read scheduling")
 
+	switch scheduler.config.Read.Schedule {
+	case "", scheduleImmediate, scheduleStaggered:
+	default:
+		log.WithField("schedule", scheduler.config.Read.Schedule).Warn("[scheduler] unknown read schedule, reads will be scheduled immediately")
+	}
+
+	// If reads are bounded, start the read pool, and the read timers which feed
+	// it. No read loops are run; the timers schedule all reads.
+	if n := scheduler.config.Read.MaxConcurrency; n > 0 {
+		log.WithField("workers", n).Info("[scheduler] starting read worker pool")
+		scheduler.readPool = newReadPool(n)
+		scheduler.readPool.start()
+		scheduler.readTimers = newReadTimers(scheduler.readPool)
+		scheduler.readLoops.Add(1)
+		go func() {
+			defer scheduler.readLoops.Done()
+			scheduler.readTimers.run(scheduler.stop)
+		}()
+	} else {
+		for _, handler := range scheduler.deviceManager.handlers {
+			if handler.MaxConcurrency > 0 {
+				log.WithField("handler", handler.Name).Warn("[scheduler] handler max concurrency has no effect unless read max concurrency is set")
+			}
+		}
+	}
+
+	scheduler.readerLock.Lock()
 	scheduler.isReading = true
+	scheduler.readerLock.Unlock()
+
+	// Start a read loop for each device which is read individually, and for
+	// each handler which bulk reads its devices.
+	for _, device := range scheduler.deviceManager.GetAllDevices() {
+		scheduler.startReader(device)
+	}
+
+	<-scheduler.stop
+	log.Info("[scheduler] stop channel closed, terminating scheduleReads")
+
+	// Prevent any new read loops from starting, then wait for the current read
+	// loops to finish any in-progress reads.
+	scheduler.readerLock.Lock()
+	scheduler.isReading = false
+	for id, r := range scheduler.readers {
+		scheduler.stopReadLoop(r)
+		delete(scheduler.readers, id)
+	}
+	for name, r := range scheduler.bulkReaders {
+		scheduler.stopReadLoop(r)
+		delete(scheduler.bulkReaders, name)
+	}
+	scheduler.readerLock.Unlock()
+
+	// Queued reads are dropped, but reads which are in progress are allowed
+	// to finish.
+	if scheduler.readPool != nil {
+		scheduler.readPool.close()
+	}
+	scheduler.readLoops.Wait()
+	if scheduler.readPool != nil {
+		scheduler.readPool.wait()
+	}
+}
+
+// reader holds the state of the read loop for a single device, or for a
+// handler which bulk reads its devices.
+type reader struct {
+	device *Device
+
+	// stop is closed to signal that the read loop should stop, e.g. when
+	// its device is removed from the plugin.
+	stop chan struct{}
+
+	// schedule is the reader's read schedule, if its reads are scheduled by
+	// the read timers rather than a read loop.
+	schedule *readSchedule
+}
+
+// startReadLoop starts reading for the given reader. If reads are bounded, its
+// read schedule is added to the read timers; otherwise, a read loop is started.
+// This should be called with the reader lock held.
+func (scheduler *scheduler) startReadLoop(r *reader, key string, handler *DeviceHandler, interval time.Duration, poller *adaptivePoller, read func()) {
+	if scheduler.readTimers != nil {
+		r.schedule = &readSchedule{
+			key:      key,
+			handler:  handler,
+			interval: interval,
+			poller:   poller,
+			jitter:   newReadJitter(key, scheduler.config.Read.Jitter),
+			read:     read,
+			index:    -1,
+		}
+		scheduler.readTimers.add(r.schedule, scheduler.readOffset(key, interval))
+		return
+	}
+
+	scheduler.readLoops.Add(1)
+	go func() {
+		defer scheduler.readLoops.Done()
+		scheduler.readLoop(key, interval, poller, r.stop, read)
+	}()
+}
+
+// stopReadLoop stops reading for the given reader. A read which is in progress
+// is allowed to complete. This should be called with the reader lock held.
+func (scheduler *scheduler) stopReadLoop(r *reader) {
+	close(r.stop)
+	if r.schedule != nil {
+		scheduler.readTimers.remove(r.schedule)
+	}
+}
+
+// startReader starts the read loop for a device, if the device is read
+// individually and the scheduler is running reads. This does nothing if a
+// read loop is already running for the device. If the device is bulk read,
+// the read loop for its handler is started instead (see startBulkReader).
+func (scheduler *scheduler) startReader(device *Device) {
+	if device == nil {
+		return
+	}
+	if device.handler.CanBulkRead() {
+		scheduler.startBulkReader(device.handler)
+		return
+	}
+	if !device.handler.CanRead() {
+		return
+	}
+
+	scheduler.readerLock.Lock()
+	defer scheduler.readerLock.Unlock()
+
+	if !scheduler.isReading {
+		return
+	}
+	if r, exists := scheduler.readers[device.id]; exists && r.device == device {
+		return
+	}
+	if scheduler.readers == nil {
+		scheduler.readers = make(map[string]*reader)
+	}
+
+	r := &reader{
+		device: device,
+		stop:   make(chan struct{}),
+	}
+	scheduler.readers[device.id] = r
+
+	interval := scheduler.readInterval(device)
+	log.WithFields(log.Fields{
+		"device":   device.id,
+		"interval": interval,
+		"adaptive": device.AdaptivePolling != nil,
+	}).Debug("[scheduler] starting device read loop")
+
+	device.poller.start(interval)
+	scheduler.startReadLoop(r, "device/"+device.id, device.handler, interval, &device.poller, func() {
+		scheduler.read(device)
+	})
+}
+
+// stopReader stops the read loop for a device, if one is running. A read which
+// is in progress is allowed to complete. If the device is bulk read, the read
+// loop for its handler is stopped if the handler has no devices left.
+func (scheduler *scheduler) stopReader(device *Device) {
+	if device == nil {
+		return
+	}
+	if device.handler.CanBulkRead() {
+		if scheduler.deviceManager == nil || len(scheduler.deviceManager.GetDevicesForHandler(device.handler.Name)) == 0 {
+			scheduler.stopBulkReader(device.handler)
+		}
+		return
+	}
+
+	scheduler.readerLock.Lock()
+	defer scheduler.readerLock.Unlock()
+
+	r, exists := scheduler.readers[device.id]
+	if !exists || r.device != device {
+		return
+	}
+	scheduler.stopReadLoop(r)
+	delete(scheduler.readers, device.id)
+}
+
+// startBulkReader starts the read loop for a handler which bulk reads its devices,
+// if the scheduler is running reads. This does nothing if a read loop is already
+// running for the handler.
+func (scheduler *scheduler) startBulkReader(handler *DeviceHandler) {
+	scheduler.readerLock.Lock()
+	defer scheduler.readerLock.Unlock()
+
+	if !scheduler.isReading {
+		return
+	}
+	if _, exists := scheduler.bulkReaders[handler.Name]; exists {
+		return
+	}
+	if scheduler.bulkReaders == nil {
+		scheduler.bulkReaders = make(map[string]*reader)
+	}
+
+	r := &reader{stop: make(chan struct{})}
+	scheduler.bulkReaders[handler.Name] = r
+
+	interval := scheduler.config.Read.Interval
+	if handler.ReadInterval > 0 {
+		interval = handler.ReadInterval
+	}
+	log.WithFields(log.Fields{
+		"handler":  handler.Name,
+		"interval": interval,
+	}).Debug("[scheduler] starting bulk read loop")
+
+	scheduler.startReadLoop(r, "handler/"+handler.Name, handler, interval, nil, func() {
+		scheduler.bulkRead(handler)
+	})
+}
+
+// stopBulkReader stops the read loop for a handler which bulk reads its devices,
+// if one is running. A read which is in progress is allowed to complete.
+func (scheduler *scheduler) stopBulkReader(handler *DeviceHandler) {
+	scheduler.readerLock.Lock()
+	defer scheduler.readerLock.Unlock()
+
+	r, exists := scheduler.bulkReaders[handler.Name]
+	if !exists {
+		return
+	}
+	log.WithField("handler", handler.Name).Debug("[scheduler] stopping bulk read loop")
+	scheduler.stopReadLoop(r)
+	delete(scheduler.bulkReaders, handler.Name)
+	scheduler.removeBulkReadCircuitBreaker(handler)
+}
+
+// readInterval gets the interval at which a device should be read. This is the
+// device's own read interval, if set, otherwise its handler's read interval, if
+// set, otherwise the global read interval.
+func (scheduler *scheduler) readInterval(device *Device) time.Duration {
+	return readIntervalFor(device, scheduler.config.Read.Interval)
+}
+
+// readTimeout gets the read timeout for a device or, if the device is nil, for
+// a bulk read of the handler's devices. The device's read timeout takes precedence,
+// followed by the handler's read timeout, and then the global read timeout. A timeout
+// of 0 means that reads do not time out.
+func (scheduler *scheduler) readTimeout(handler *DeviceHandler, device *Device) time.Duration {
+	if device != nil && device.ReadTimeout > 0 {
+		return device.ReadTimeout
+	}
+	if handler != nil && handler.ReadTimeout > 0 {
+		return handler.ReadTimeout
+	}
+	return scheduler.config.Read.Timeout
+}
+
+// runRead acquires the given lock groups (see lockGroups), then runs the given
+// read function, waiting at most the given timeout for it to complete. If the
+// timeout is 0, it waits for the read to complete. It returns a function which
+// releases the lock groups, which the caller must call once it is done with the
+// devices, e.g. after the lock group delay.
+//
+// A read which does not complete in time is abandoned: ErrDeviceReadTimeout is
+// returned and the read is left to finish in the background. Any result it
+// eventually produces is discarded, so the read function should only store its
+// result in variables which the caller only reads if runRead returns nil. As the
+// abandoned read may still be accessing the devices in its lock groups, e.g. on
+// a shared bus, the lock groups are held until it returns, and the returned
+// release function does nothing.
+//
+// Abandoned reads are tracked by key (the device or bulk-read handler being read)
+// and by the lock groups they hold until they return, and are reported in the
+// plugin's metrics. While a read for a key or lock group is abandoned, new reads
+// for that key or of devices in that lock group are not started and ErrDeviceReadHung
+// is returned, so a hung device does not leak a goroutine on every read, nor block
+// the reads of the other devices in its lock groups.
+func (scheduler *scheduler) runRead(key string, groups []string, timeout time.Duration, read func()) (func(), error) {
+	keys := append([]string{key}, scheduler.lockGroupKeys(groups)...)
+
+	scheduler.abandonedLock.Lock()
+	for _, k := range keys {
+		if scheduler.abandoned[k] {
+			scheduler.abandonedLock.Unlock()
+			return func() {}, ErrDeviceReadHung
+		}
+	}
+	scheduler.abandonedLock.Unlock()
+
+	unlock := scheduler.lockGroups(groups)
+	if timeout <= 0 {
+		read()
+		return unlock, nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		read()
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+		return unlock, nil
+	case <-timer.C:
+	}
+
+	scheduler.abandonedLock.Lock()
+	if scheduler.abandoned == nil {
+		scheduler.abandoned = map[string]bool{}
+	}
+	for _, k := range keys {
+		scheduler.abandoned[k] = true
+	}
+	scheduler.abandonedLock.Unlock()
+	metricAbandonedReads.Inc()
+
+	go func() {
+		<-done
+		log.WithField("read", key).Info("[scheduler] abandoned read returned, discarding its result")
+		unlock()
+		scheduler.abandonedLock.Lock()
+		for _, k := range keys {
+			delete(scheduler.abandoned, k)
+		}
+		scheduler.abandonedLock.Unlock()
+		metricAbandonedReads.Dec()
+	}()
+	return func() {}, ErrDeviceReadTimeout
+}
+
+// readLoop runs the given read function, waiting for the interval between each
+// run, until either the scheduler is stopped or the given stop channel is closed.
+// The key identifies the device (or bulk-read handler) being read; it determines
+// the offset of the first read when reads are staggered. If a poller is given,
+// it determines the effective interval between reads.
+func (scheduler *scheduler) readLoop(key string, interval time.Duration, poller *adaptivePoller, stop <-chan struct{}, read func()) {
+	var timer *time.Timer
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+
+	// The wait function waits for the given duration, returning false if the
+	// scheduler or the read loop was stopped while waiting. The timer is only
+	// reset once its previous expiry has been received (or drained), so it is
+	// safe to reset.
+	wake := poller.woken()
+	wait := func(d time.Duration) bool {
+		if timer == nil {
+			timer = time.NewTimer(d)
+		} else {
+			timer.Reset(d)
+		}
+		start := time.Now()
+		for {
+			select {
+			case <-scheduler.stop:
+				return false
+			case <-stop:
+				return false
+			case <-timer.C:
+				return true
+			case <-wake:
+				// The effective interval snapped back, so wait no longer than
+				// the new interval since the wait started.
+				if !timer.Stop() {
+					<-timer.C
+				}
+				remaining := poller.interval(interval) - time.Since(start)
+				if remaining <= 0 {
+					return true
+				}
+				timer.Reset(remaining)
+			}
+		}
+	}
+
+	if offset := scheduler.readOffset(key, interval); offset > 0 {
+		if !wait(offset) {
+			return
+		}
+	}
+
+	jitter := newReadJitter(key, scheduler.config.Read.Jitter)
 	for {
-		// If the stop channel is closed, stop the read loop.
+		// If the scheduler or the read loop was stopped, stop reading.
 		select {
 		case <-scheduler.stop:
-			scheduler.isReading = false
-			log.Info("[scheduler] stop channel closed, terminating scheduleReads")
+			return
+		case <-stop:
 			return
 		default:
-			// no stop signal
 		}
 
-		var waitGroup sync.WaitGroup
-
-		// Run all single device reads.
-		for _, device := range scheduler.deviceManager.devices {
-			// Increment the WaitGroup counter for each device.
-			waitGroup.Add(1)
+		read()
 
-			// Launch the device read.
-			go func(wg *sync.WaitGroup, device *Device) {
-				scheduler.read(device)
-				wg.Done()
-			}(&waitGroup, device)
+		if interval <= 0 {
+			continue
 		}
+		if !wait(jitter.apply(poller.interval(interval))) {
+			return
+		}
+	}
+}
 
-		// Run all batch device reads.
-		for _, handler := range scheduler.deviceManager.handlers {
-			// Increment the WaitGroup for each bulk read action.
-			waitGroup.Add(1)
+// readOffset gets the delay before the first read of the device (or bulk-read
+// handler) with the given key. Reads are only offset when they are staggered.
+//
+// The offset is a fraction of the read interval which is derived from a hash
+// of the key, so each device is consistently read at the same point within
+// the interval, and devices are spread evenly across the interval.
+func (scheduler *scheduler) readOffset(key string, interval time.Duration) time.Duration {
+	if scheduler.config.Read.Schedule != scheduleStaggered || interval <= 0 {
+		return 0
+	}
 
-			// Launch the bulk read.
-			go func(wg *sync.WaitGroup, handler *DeviceHandler) {
-				scheduler.bulkRead(handler)
-				wg.Done()
-			}(&waitGroup, handler)
-		}
+	fraction := float64(readKeyHash(key)) / float64(math.MaxUint64)
+	return time.Duration(fraction * float64(interval))
+}
 
-		// Wait for all device reads to complete.
-		waitGroup.Wait()
+// readKeyHash hashes the key of a device (or bulk-read handler). Device IDs
+// and handler names are often similar to one another, so a cryptographic hash
+// is used to get well-distributed values.
+func readKeyHash(key string) uint64 {
+	sum := sha256.Sum256([]byte(key))
+	return binary.BigEndian.Uint64(sum[:8])
+}
 
-		if interval != 0 {
-			time.Sleep(interval)
-		}
+// readJitter randomly varies the wait between reads of a device.
+type readJitter struct {
+	jitter float64
+	rand   *rand.Rand
+}
+
+// newReadJitter creates the read jitter for the device (or bulk-read handler)
+// with the given key. The jitter is clamped to be between 0 and 1.
+func newReadJitter(key string, jitter float64) *readJitter {
+	if jitter <= 0 {
+		return &readJitter{}
 	}
+	if jitter > 1 {
+		jitter = 1
+	}
+
+	// Each read loop gets its own random source, seeded so that devices (and
+	// plugins) which start at the same time do not get the same jitter.
+	seed := time.Now().UnixNano() ^ int64(readKeyHash(key))
+	return &readJitter{
+		jitter: jitter,
+		rand:   rand.New(rand.NewSource(seed)), // nolint: gosec
+	}
+}
+
+// apply gets the jittered wait for the given read interval.
+func (jitter *readJitter) apply(interval time.Duration) time.Duration {
+	if jitter.jitter == 0 {
+		return interval
+	}
+	delta := jitter.jitter * (2*jitter.rand.Float64() - 1)
+	return time.Duration(float64(interval) * (1 + delta))
 }
 
 // scheduleWrites schedules device writes based on the plugin configuration.
 //
+// Writes are taken from the write queue in batches and dispatched to a queue for
+// their device (see dispatchWrite), so that each device's writes are run in order
+// while the writes for different devices run in parallel.
+//
 // This will do nothing if:
 // - Writing is globally disabled for the plugin.
 // - No registered device handlers implement a write function.
@@ -384,35 +1075,37 @@ func (scheduler *scheduler) scheduleWrites() {
 
 	wlog.Info("[scheduler] starting write scheduling")
 	scheduler.isWriting = true
+
+	if scheduler.schedule != nil {
+		scheduler.writeWorkers.Add(1)
+		go func() {
+			defer scheduler.writeWorkers.Done()
+			scheduler.runSchedule()
+		}()
+	}
+
 	for {
-		// If the stop channel is closed, stop the write loop.
+		// If the stop channel is closed, stop the write loop once the
+		// device write workers and the write schedule have finished.
 		select {
 		case <-scheduler.stop:
 			scheduler.isWriting = false
 			log.Info("[scheduler] stop channel closed, terminating scheduleWrites")
+			scheduler.writeWorkers.Wait()
 			return
 		default:
 			// no stop signal
 		}
 
-		var waitGroup sync.WaitGroup
-
-		// Check for any pending writes. If any exist, attempt to fulfill
-		// the writes and update their transaction state accordingly.
+		// Check for any pending writes. If any exist, dispatch them to their
+		// device's write queue. Each device's writes are run in order, and the
+		// writes for different devices are run in parallel.
 		var totalWrites = 0
 		for i := 0; i < scheduler.config.Write.BatchSize; i++ {
 			select {
 			case w := <-scheduler.writeChan:
-				// Increment the WaitGroup counter for all writes being executed
-				// in this batch.
-				waitGroup.Add(1)
 				totalWrites++
-
-				// Launch the device write.
-				go func(wg *sync.WaitGroup, writeContext *WriteContext) {
-					scheduler.write(writeContext)
-					wg.Done()
-				}(&waitGroup, w)
+				scheduler.dispatchWrite(w)
 
 			default:
 				// If there is nothing to write, do nothing.
@@ -426,9 +1119,6 @@ func (scheduler *scheduler) scheduleWrites() {
 			}).Info("[scheduler] processed write requests")
 		}
 
-		// Wait for all device writes to complete.
-		waitGroup.Wait()
-
 		if interval != 0 {
 			time.Sleep(interval)
 		}
@@ -445,21 +1135,25 @@ func (scheduler *scheduler) scheduleListen() {
 		log.Info("[scheduler] listeners will not be scheduled (listening globally disabled)")
 		return
 	}
-	// DEPRECATE (etd)
-	log.Warning("[scheduler] Deprecation Warning: the SDK listener behavior for DeviceHandlers will be removed in a future release of the SDK")
-
 	if !scheduler.deviceManager.HasListenerHandlers() {
 		log.Info("[scheduler] listeners will not be scheduled (no listener handlers registered)")
 		return
 	}
 
+	scheduler.listenerLock.Lock()
 	scheduler.isListening = true
+	scheduler.listenerLock.Unlock()
+
 	// For each handler which has a listener function defined, get the devices for
 	// the handler and start the listener for those devices.
 	for _, handler := range scheduler.deviceManager.handlers {
 		hlog := log.WithField("handler", handler.Name)
 
-		if handler.Listen != nil {
+		if handler.CanListen() {
+			// DEPRECATE (etd)
+			if handler.Listen != nil && handler.Subscribe == nil {
+				hlog.Warning("[scheduler] Deprecation Warning: the SDK listener behavior for DeviceHandlers will be removed in a future release of the SDK; use Subscribe instead")
+			}
 			hlog.Info("[scheduler] starting listener")
 
 			// Get the devices for the handler.
@@ -471,13 +1165,84 @@ func (scheduler *scheduler) scheduleListen() {
 
 			// For each device, run the listener goroutine.
 			for _, device := range devices {
-				ctx := NewListenerCtx(handler, device)
-				go scheduler.listen(ctx)
+				scheduler.startListener(device)
 			}
 		}
 	}
 }
 
+// startListener starts the listener for a device, if its handler defines a
+// listener function and the scheduler is running listeners. This does nothing
+// if a listener is already running for the device.
+func (scheduler *scheduler) startListener(device *Device) {
+	if device == nil || !device.handler.CanListen() {
+		return
+	}
+
+	scheduler.listenerLock.Lock()
+	defer scheduler.listenerLock.Unlock()
+
+	if !scheduler.isListening || scheduler.isStopped() {
+		return
+	}
+	if ctx, exists := scheduler.listeners[device.id]; exists && ctx.device == device {
+		return
+	}
+	if scheduler.listeners == nil {
+		scheduler.listeners = make(map[string]*ListenerCtx)
+	}
+
+	ctx := NewListenerCtx(device.handler, device)
+	scheduler.listeners[device.id] = ctx
+	if scheduler.health != nil {
+		if err := scheduler.health.Register(ctx.check); err != nil {
+			log.WithField("error", err).Error("[scheduler] failed to register listener health check")
+		}
+	}
+	go scheduler.listen(ctx)
+}
+
+// stopListener stops the listener for a device, if one is running. The context
+// of a Subscribe handler is cancelled. A Listen function which is blocked is not
+// interrupted, but it will not be restarted and any readings it collects for the
+// removed device are discarded.
+func (scheduler *scheduler) stopListener(device *Device) {
+	if device == nil {
+		return
+	}
+
+	scheduler.listenerLock.Lock()
+	defer scheduler.listenerLock.Unlock()
+
+	ctx, exists := scheduler.listeners[device.id]
+	if !exists || ctx.device != device {
+		return
+	}
+	scheduler.closeListener(ctx)
+	delete(scheduler.listeners, device.id)
+}
+
+// stopListeners stops all running device listeners.
+func (scheduler *scheduler) stopListeners() {
+	scheduler.listenerLock.Lock()
+	defer scheduler.listenerLock.Unlock()
+
+	for id, ctx := range scheduler.listeners {
+		scheduler.closeListener(ctx)
+		delete(scheduler.listeners, id)
+	}
+	scheduler.isListening = false
+}
+
+// closeListener stops the listener and unregisters its health check. This should
+// be called with the listenerLock held.
+func (scheduler *scheduler) closeListener(ctx *ListenerCtx) {
+	ctx.close()
+	if scheduler.health != nil {
+		scheduler.health.Unregister(ctx.check.GetName())
+	}
+}
+
 // finalizeReadings is a helper function which takes a read context and
 // applies any transformations and augmentations which are defined by its
 // Device to produce the final reading result.
@@ -527,56 +1292,98 @@ func finalizeReadings(device *Device, rctx *ReadContext) error {
 
 // read reads from a single device using a handler's Read function.
 func (scheduler *scheduler) read(device *Device) {
-	delay := scheduler.config.Read.Delay
+	groups := scheduler.lockGroupsFor(device)
+	delay := scheduler.lockGroupDelay(groups, false)
 	mode := scheduler.config.Mode
 
 	rlog := log.WithFields(log.Fields{
 		"delay":  delay,
 		"mode":   mode,
+		"group":  groups[0],
 		"device": device.id,
 	})
 
+	// If the device's circuit is open, it is not read until its next probe is
+	// due. The reads of devices which are read in bulk are guarded by their
+	// handler's circuit breaker instead (see bulkRead).
+	var breaker *circuitBreaker
+	if !device.handler.CanBulkRead() {
+		breaker = scheduler.circuitBreaker(device)
+		if breaker != nil && !breaker.allow() {
+			rlog.Debug("[scheduler] device circuit open, skipping read")
+			return
+		}
+	}
+
 	// Rate limiting, if configured. We want to do this before potentially
 	// acquiring the serial lock so something isn't holding on to the lock
 	// and just waiting.
-	if scheduler.limiter != nil {
-		if err := scheduler.limiter.Wait(context.Background()); err != nil {
-			rlog.WithField("error", err).Error("[scheduler] error with rate limiter")
-		}
-	}
+	scheduler.waitLimiters(groups, device.handler, device)
 
 	// If the device does not get its readings from a bulk read operation, then
 	// it is read individually. If a device is read in bulk, it will not be read
 	// here; it will be read later via the bulkRead function.
 	if !device.handler.CanBulkRead() {
 
-		// If we are running in serial mode, acquire the serial lock.
-		if mode == modeSerial {
-			scheduler.serialLock.Lock()
-			defer scheduler.serialLock.Unlock()
+		// The device may have been removed while waiting on the rate limiter.
+		if device.isRemoved() {
+			rlog.Debug("[scheduler] device removed, skipping read")
+			return
 		}
 
-		// Read from the device.
-		response, err := device.Read()
+		// Read from the device, holding its lock group, or the serial lock if
+		// running in serial mode and the device is not in a lock group. If the
+		// read does not complete within the read timeout, it is abandoned.
+		var (
+			response, result *ReadContext
+			readErr          error
+		)
+		timeout := scheduler.readTimeout(device.handler, device)
+		start := time.Now()
+		unlock, err := scheduler.runRead("device/"+device.id, groups, timeout, func() {
+			result, readErr = device.Read()
+		})
+		defer unlock()
+		if err == ErrDeviceReadTimeout {
+			metricReadTimeouts.WithLabelValues(device.handler.Name).Inc()
+			rlog = rlog.WithField("timeout", timeout)
+		} else if err == nil {
+			response, err = result, readErr
+		}
+
+		// Reads which were skipped because the device is hung were not attempted.
+		if err != ErrDeviceReadHung {
+			device.readStats.record(start, err)
+		}
+		if breaker != nil {
+			if err == nil {
+				breaker.success()
+			} else if isDeviceFailure(err) {
+				breaker.failure(err)
+			}
+		}
 		if err != nil {
 			// Check to see if the error is that of unsupported error. If it is, we
 			// do not want to log out here (low-interval read polling would cause this
 			// to pollute the logs for something that we should already know).
 			_, unsupported := err.(*sdkError.UnsupportedCommandError)
 			if !unsupported {
-				rlog.Error("[scheduler] failed device read")
+				rlog.WithField("error", err).Error("[scheduler] failed device read")
 			}
 		} else {
 			err := finalizeReadings(device, response)
 			if err != nil {
 				rlog.Error("[scheduler] discarding readings")
 			} else {
+				if interval, changed := device.poller.observe(response.Reading, device.AdaptivePolling); changed {
+					rlog.WithField("interval", interval).Debug("[scheduler] adjusted adaptive read interval")
+				}
 				scheduler.stateManager.readChan <- response
 			}
 		}
 
 		// If a delay is configured, wait for the delay before continuing
-		// (and relinquishing the lock, if in serial mode).
+		// (and relinquishing the lock, if held).
 		if delay != 0 {
 			time.Sleep(delay)
 		}
@@ -586,24 +1393,13 @@ func (scheduler *scheduler) read(device *Device) {
 
 // bulkRead reads from multiple devices using a handler's BulkRead function.
 func (scheduler *scheduler) bulkRead(handler *DeviceHandler) {
-	delay := scheduler.config.Read.Delay
 	mode := scheduler.config.Mode
 
 	rlog := log.WithFields(log.Fields{
-		"delay":   delay,
 		"mode":    mode,
 		"handler": handler.Name,
 	})
 
-	// Rate limiting, if configured. We want to do this before potentially
-	// acquiring the serial lock so something isn't holding on to the lock
-	// and just waiting.
-	if scheduler.limiter != nil {
-		if err := scheduler.limiter.Wait(context.Background()); err != nil {
-			rlog.WithField("error", err).Error("[scheduler] error with rate limiter")
-		}
-	}
-
 	// If the handler supports bulk reading, execute bulk reads. Devices using the
 	// handler will not have been read individually yet.
 	if handler.CanBulkRead() {
@@ -613,13 +1409,61 @@ func (scheduler *scheduler) bulkRead(handler *DeviceHandler) {
 			return
 		}
 
-		// If we are running in serial mode, acquire the serial lock.
-		if mode == modeSerial {
-			scheduler.serialLock.Lock()
-			defer scheduler.serialLock.Unlock()
+		// If the handler's bulk read circuit is open, its devices are not read
+		// until its next probe is due.
+		breaker := scheduler.bulkReadCircuitBreaker(handler)
+		if breaker != nil && !breaker.allow() {
+			rlog.Debug("[scheduler] bulk read circuit open, skipping read")
+			return
+		}
+
+		groups := scheduler.lockGroupsFor(devices...)
+		delay := scheduler.lockGroupDelay(groups, false)
+		rlog = rlog.WithFields(log.Fields{
+			"delay":  delay,
+			"groups": groups,
+		})
+
+		// Rate limiting, if configured. We want to do this before potentially
+		// acquiring the serial lock so something isn't holding on to the lock
+		// and just waiting. Device limiters do not apply to bulk reads, since
+		// all of the devices are read at once.
+		scheduler.waitLimiters(groups, handler)
+
+		// Read from the devices, holding the lock groups for all of them. Devices
+		// which are not in a lock group use the serial lock in serial mode. If the
+		// bulk read does not complete within the read timeout, it is abandoned.
+		var (
+			response, result []*ReadContext
+			readErr          error
+		)
+		timeout := scheduler.readTimeout(handler, nil)
+		start := time.Now()
+		unlock, err := scheduler.runRead("handler/"+handler.Name, groups, timeout, func() {
+			result, readErr = handler.BulkRead(devices)
+		})
+		defer unlock()
+		if err == ErrDeviceReadTimeout {
+			metricReadTimeouts.WithLabelValues(handler.Name).Inc()
+			rlog = rlog.WithField("timeout", timeout)
+		} else if err == nil {
+			response, err = result, readErr
 		}
 
-		response, err := handler.BulkRead(devices)
+		// The outcome of the bulk read applies to each of the devices read.
+		if err != ErrDeviceReadHung {
+			scheduler.handlerStats(handler.Name).record(start, err)
+			for _, device := range devices {
+				device.readStats.record(start, err)
+			}
+		}
+		if breaker != nil {
+			if err == nil {
+				breaker.success()
+			} else if isDeviceFailure(err) {
+				breaker.failure(err)
+			}
+		}
 		if err != nil {
 			rlog.WithField("error", err).Error("[scheduler] handler failed bulk read")
 		} else {
@@ -635,7 +1479,7 @@ func (scheduler *scheduler) bulkRead(handler *DeviceHandler) {
 		}
 
 		// If a delay is configured, wait for the delay before continuing
-		// (and relinquishing the lock, if in serial mode).
+		// (and relinquishing the locks, if held).
 		if delay != 0 {
 			time.Sleep(delay)
 		}
@@ -644,38 +1488,58 @@ func (scheduler *scheduler) bulkRead(handler *DeviceHandler) {
 
 // write writes to devices using a handler's Write function.
 func (scheduler *scheduler) write(writeCtx *WriteContext) {
-	delay := scheduler.config.Write.Delay
 	mode := scheduler.config.Mode
 
 	wlog := log.WithFields(log.Fields{
-		"delay":       delay,
 		"mode":        mode,
 		"transaction": writeCtx.transaction.id,
 		"device":      writeCtx.device,
 	})
 
+	// Get the device.
+	device := writeCtx.device
+	if device == nil {
+		writeCtx.transaction.setStatusError()
+		writeCtx.transaction.message = "no device found with ID: " + writeCtx.device.id
+		wlog.Error("[scheduler] " + writeCtx.transaction.message)
+		return
+	}
+
+	// If the device's circuit is open, the write fails fast rather than waiting
+	// on a device which is known to be failing.
+	breaker := scheduler.circuitBreaker(device)
+	if breaker != nil && !breaker.allow() {
+		err := breaker.openError()
+		writeCtx.transaction.message = fmt.Sprintf("write rejected: %v", err)
+		writeCtx.transaction.setStatusError()
+		wlog.WithField("error", err).Error("[scheduler] device circuit open, rejecting write")
+		return
+	}
+
+	groups := scheduler.lockGroupsFor(device)
+	delay := scheduler.lockGroupDelay(groups, true)
+	wlog = wlog.WithFields(log.Fields{
+		"delay": delay,
+		"group": groups[0],
+	})
+
 	// Rate limiting, if configured. We want to do this before potentially
 	// acquiring the serial lock so something isn't holding on to the lock
 	// and just waiting.
-	if scheduler.limiter != nil {
-		if err := scheduler.limiter.Wait(context.Background()); err != nil {
-			wlog.WithField("error", err).Error("[scheduler] error with rate limiter")
-		}
-	}
+	scheduler.waitLimiters(groups, device.handler, device)
 
-	// If we are running in serial mode, acquire the serial lock.
-	if mode == modeSerial {
-		scheduler.serialLock.Lock()
-		defer scheduler.serialLock.Unlock()
-	}
+	// Acquire the device's lock group, or the serial lock if running in
+	// serial mode and the device is not in a lock group. If the write overruns
+	// its deadline, the lock groups are released once its handler returns
+	// (see awaitOverrunWrite) instead.
+	unlock := scheduler.lockGroups(groups)
+	defer func() { unlock() }()
 
 	wlog.Debug("[scheduler] starting device write")
 
-	// Get the device.
-	device := writeCtx.device
-	if device == nil {
+	if device.isRemoved() {
 		writeCtx.transaction.setStatusError()
-		writeCtx.transaction.message = "no device found with ID: " + writeCtx.device.id
+		writeCtx.transaction.message = "device was removed: " + writeCtx.device.id
 		wlog.Error("[scheduler] " + writeCtx.transaction.message)
 		return
 	}
@@ -689,43 +1553,10 @@ func (scheduler *scheduler) write(writeCtx *WriteContext) {
 
 	writeCtx.transaction.setStatusWriting()
 
-	// Write to the device. If the device write does not complete within
-	// the set time bounds, error out with timeout.
-	// See: https://gobyexample.com/timeouts
-	writer := make(chan error, 1)
-	go func() {
-		data := decodeWriteData(writeCtx.data)
-		writer <- device.Write(data)
-	}()
-
-	// Wait for the write to complete, or timeout.
-	// FIXME (etd): this does technically give us a timeout, where we will stop
-	//  waiting for the write after the given timeout and just mark the transaction
-	//  dead, but thats kinda all this does.
-	//
-	//  from an upstream perspective, this is fine.. we want to be able to say
-	//  "we expect this write to complete after N time, afterwards, timeout and consider
-	//  it failed".
-	//
-	//  from the backend, it does present this to the frontend consumer, but it doesn't
-	//  actually stop the write from happening, so while we have "timed out", the write
-	//  is still going on in the background and could eventually resolve, which is
-	//  not at all what we want to do.
-	//
-	//  this could be resolved by passing in a context and cancelling, but uhh.. its
-	//  complicated and the internet has many mixed feeling-ed blog posts about it.
-	//
-	//  this relates to #365. I'll need to spend more time thinking this through.
-	//  essentially the issue lies in the fact that context cancellation relies on the
-	//  fact that you can terminate the work at some point (e.g. if iterating in an
-	//  infinite loop.., emitting from a channel, ...), then you can wait on the context
-	//  done signal, wait for the fn to finish up, and then you're done. to me, it seems
-	//  like the write will need to be waited on either way, so i'm not sure there is
-	//  a benefit to using a cancellation context unless writing is handled in a different
-	//  manner..
-	//
-	//  it seems like having a cancelation context could be useful if there is some
-	//  retry logic on the write, but thats mostly it..
+	// The write context carries the device's write timeout and is cancelled if
+	// the scheduler is stopped while the write is in progress.
+	ctx, cancel := scheduler.writeContext(device.WriteTimeout)
+	defer cancel()
 
 	log.WithFields(log.Fields{
 		"device":  device.GetID(),
@@ -734,31 +1565,254 @@ func (scheduler *scheduler) write(writeCtx *WriteContext) {
 		"timeout": device.WriteTimeout,
 	}).Debug("[scheduler] writing")
 
-	var err error
+	start := time.Now()
+	writer := make(chan writeResult, 1)
+	go func() {
+		data := decodeWriteData(writeCtx.data)
+		writer <- scheduler.writeWithRetry(ctx, device, data, wlog)
+	}()
+
+	var (
+		result  writeResult
+		running bool
+		err     error
+	)
 	select {
-	case writeErr := <-writer:
-		err = writeErr
-	case <-time.After(device.WriteTimeout):
-		err = ErrDeviceWriteTimeout
+	case result = <-writer:
+		err = result.err
+	case <-ctx.Done():
+		result, running, err = scheduler.awaitCancelledWrite(ctx, device, writer, wlog)
+	}
+
+	device.writeStats.record(start, err)
+
+	// A write may change the device's readings, so if its reads have backed off,
+	// the device is read at its base interval again.
+	device.poller.reset()
+	if breaker != nil {
+		if err == nil {
+			breaker.success()
+		} else if isDeviceFailure(err) {
+			breaker.failure(err)
+		}
 	}
 
 	if err != nil {
-		wlog.WithField("error", err).Error("[scheduler] failed to write to device")
+		wlog.WithFields(log.Fields{
+			"error":    err,
+			"attempts": result.attempts,
+		}).Error("[scheduler] failed to write to device")
+		writeCtx.transaction.message = result.annotate(err.Error())
 		writeCtx.transaction.setStatusError()
-		writeCtx.transaction.message = err.Error()
+
+		if running {
+			scheduler.awaitOverrunWrite(writer, unlock, wlog)
+			unlock = func() {}
+		}
 		return
 	}
+	writeCtx.transaction.message = result.annotate("")
 	wlog.Debug("[scheduler] successfully wrote to device")
 	writeCtx.transaction.setStatusDone()
 
 	// If a write delay is configured, wait for that period of time before continuing
-	// (and relinquishing the lock, if in serial mode).
+	// (and relinquishing the lock, if held).
 	if delay != 0 {
 		time.Sleep(delay)
 	}
 }
 
-// listen listens to devices to collect readings using a device's Listen function.
+// writeContext creates the context for a device write. The context is cancelled
+// once the given timeout elapses or when the scheduler is stopped, whichever
+// happens first.
+func (scheduler *scheduler) writeContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	go func() {
+		select {
+		case <-scheduler.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// writeResult is the outcome of a device write, including any retries.
+type writeResult struct {
+	// err is the error of the final write attempt.
+	err error
+
+	// attempts is the number of times the device write handler was called.
+	attempts int
+
+	// lastErr is the most recent error returned by the device write handler,
+	// even if a subsequent attempt succeeded.
+	lastErr error
+}
+
+// annotate adds the retry count and the last handler error to the given
+// transaction message, if the write was retried.
+func (result writeResult) annotate(msg string) string {
+	if result.attempts <= 1 {
+		return msg
+	}
+
+	info := fmt.Sprintf("retries: %d", result.attempts-1)
+	if result.lastErr != nil && result.lastErr != result.err {
+		info = fmt.Sprintf("%s, last error: %v", info, result.lastErr)
+	}
+	if msg == "" {
+		return info
+	}
+	return fmt.Sprintf("%s (%s)", msg, info)
+}
+
+// writeRetryPolicy gets the write retry policy for the device. Any fields set
+// on the device's policy override those of the plugin's write retry settings.
+func (scheduler *scheduler) writeRetryPolicy(device *Device) config.RetrySettings {
+	var policy config.RetrySettings
+	if scheduler.config.Write != nil && scheduler.config.Write.Retry != nil {
+		policy = *scheduler.config.Write.Retry
+	}
+	device.WriteRetry.Apply(&policy)
+	if policy.MaxAttempts < 1 {
+		policy.MaxAttempts = 1
+	}
+	return policy
+}
+
+// writeRetryBackoff gets the time to wait before the nth retry of a write,
+// where n starts at 1. The backoff doubles for each retry up to the policy's
+// max backoff, and is then varied by the policy's jitter.
+func writeRetryBackoff(policy config.RetrySettings, n int) time.Duration {
+	backoff := exponentialBackoff(policy.Backoff, policy.MaxBackoff, n)
+
+	jitter := math.Min(math.Max(policy.Jitter, 0), 1)
+	if jitter > 0 {
+		backoff += time.Duration((2*rand.Float64() - 1) * jitter * float64(backoff)) // nolint: gosec
+	}
+	return backoff
+}
+
+// isRetryableWriteError checks whether a failed device write should be retried.
+//
+// Only errors which the handler marked as retryable (see errors.Retryable) are
+// retried, since the SDK can not know whether retrying any other failed write
+// is safe. An error marked as fatal is never retried, even if it is also marked
+// as retryable.
+func isRetryableWriteError(err error) bool {
+	return sdkError.IsRetryable(err) && !sdkError.IsFatal(err)
+}
+
+// writeWithRetry writes to the device, retrying failed writes according to the
+// device's write retry policy. Retries only happen within the lifetime of the
+// write context: if the context would be done before the next retry could start,
+// the write fails with the error of its last attempt.
+func (scheduler *scheduler) writeWithRetry(ctx context.Context, device *Device, data *WriteData, wlog *log.Entry) writeResult {
+	policy := scheduler.writeRetryPolicy(device)
+
+	var result writeResult
+	for {
+		result.attempts++
+		result.err = device.WriteContext(ctx, data)
+		if result.err == nil {
+			return result
+		}
+		if ctx.Err() == nil {
+			result.lastErr = result.err
+		}
+
+		if result.attempts >= policy.MaxAttempts || ctx.Err() != nil || !isRetryableWriteError(result.err) {
+			return result
+		}
+
+		backoff := writeRetryBackoff(policy, result.attempts)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < backoff {
+			wlog.WithField("backoff", backoff).Debug("[scheduler] not enough time remaining to retry device write")
+			return result
+		}
+
+		wlog.WithFields(log.Fields{
+			"error":   result.err,
+			"attempt": result.attempts,
+			"backoff": backoff,
+		}).Warn("[scheduler] device write failed, retrying")
+
+		select {
+		case <-ctx.Done():
+			result.err = ctx.Err()
+			return result
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// awaitCancelledWrite is called when a device write's context is done before
+// the write completes. It determines whether the handler acknowledged the
+// cancellation, by returning the context error within writeCancelGracePeriod,
+// or whether it overran the deadline, and returns the corresponding error to
+// record for the write transaction. It also returns whether the handler is
+// still running, in which case the caller must wait for it to return (see
+// awaitOverrunWrite).
+//
+// Handlers which do not define a WriteContext function can not observe the
+// cancellation, so they are considered to have overrun without waiting.
+func (scheduler *scheduler) awaitCancelledWrite(ctx context.Context, device *Device, writer <-chan writeResult, wlog *log.Entry) (writeResult, bool, error) {
+	cause := ErrDeviceWriteTimeout
+	if ctx.Err() == context.Canceled {
+		cause = ErrDeviceWriteCancelled
+	}
+
+	if device.handler.WriteContext != nil {
+		select {
+		case result := <-writer:
+			if result.err != nil && (errors.Is(result.err, context.DeadlineExceeded) || errors.Is(result.err, context.Canceled)) {
+				wlog.Info("[scheduler] device write handler acknowledged cancellation")
+				return result, false, fmt.Errorf("%w: %s", cause, msgWriteAcknowledged)
+			}
+			// The handler returned, but did not acknowledge the cancellation, so
+			// it ran to completion (or failure) past its deadline.
+			wlog.WithField("result", result.err).Warn("[scheduler] device write completed after its deadline")
+			return result, false, fmt.Errorf("%w: %s", cause, msgWriteOverrun)
+
+		case <-time.After(writeCancelGracePeriod):
+		}
+	}
+
+	wlog.Warn("[scheduler] device write handler overran its deadline")
+	return writeResult{}, true, fmt.Errorf("%w: %s", cause, msgWriteOverrun)
+}
+
+// awaitOverrunWrite waits for a device write handler which overran its deadline
+// to return, then releases the write's lock groups using the given function.
+//
+// As the handler may still be writing to the device, the device's lock groups,
+// and its write worker, are held until it returns, so the next write for the
+// device, or for a device in its lock groups, does not start while it is still
+// running. If the scheduler is stopped first, this stops waiting, so the write
+// workers can finish, but the lock groups are still held until the handler
+// returns.
+func (scheduler *scheduler) awaitOverrunWrite(writer <-chan writeResult, unlock func(), wlog *log.Entry) {
+	returned := func(result writeResult) {
+		// Log the handler's eventual result, since the write may still have
+		// taken effect on the device.
+		wlog.WithField("result", result.err).Warn("[scheduler] overrunning device write completed")
+		unlock()
+	}
+
+	select {
+	case result := <-writer:
+		returned(result)
+	case <-scheduler.stop:
+		go func() {
+			returned(<-writer)
+		}()
+	}
+}
+
+// listen listens to devices to collect readings using a device's Subscribe or
+// Listen function. Failed listeners are restarted with backoff until they are
+// stopped or exceed the configured maximum number of restarts.
 func (scheduler *scheduler) listen(listenerCtx *ListenerCtx) {
 	llog := log.WithFields(log.Fields{
 		"handler": listenerCtx.handler.Name,
@@ -767,31 +1821,120 @@ func (scheduler *scheduler) listen(listenerCtx *ListenerCtx) {
 
 	llog.Info("[scheduler] starting listener for device")
 
+	// failures is the number of consecutive times the listener has failed.
+	var failures int
 	for {
-		// Run the listener fore the device. Pass in the state manager's read channel,
-		// as the listener is really just collecting readings.
-		err := listenerCtx.handler.Listen(
-			listenerCtx.device,
-			scheduler.stateManager.readChan,
-		)
-		if err != nil {
-			// Increment the number of restarts.
-			listenerCtx.restarts++
+		listenerCtx.check.Report("listening", nil)
+		started := time.Now()
+		err := scheduler.runListener(listenerCtx)
 
-			// If a listener function results in error, we want to restart it to try and
-			// keep listening. Log the error and re-try listening.
-			llog.WithFields(log.Fields{
-				"restarts": listenerCtx.restarts,
-				"error":    err,
-			}).Error("[scheduler] listener failed, will restart and try again")
-			continue
+		// If the listener was stopped while it was running, do not restart it.
+		select {
+		case <-listenerCtx.stop:
+			llog.Info("[scheduler] listener stopped, ending device listen")
+			return
+		default:
+		}
 
-		} else {
+		if err == nil {
 			// If the listener ended without any error, we take this to mean
 			// that it terminated in a way that is considered ok, so we do not
 			// want to try and restart. Instead, just stop listening.
 			llog.Info("[scheduler] listener completed without error, ending device listen")
+			listenerCtx.check.Report("listener completed", nil)
 			return
 		}
+
+		// If a listener function results in error, we want to restart it to try and
+		// keep listening. A listener which ran for a while before failing is taken
+		// to have recovered, so its backoff starts over.
+		conf := scheduler.listenSettings()
+		if conf.MaxBackoff > 0 && time.Since(started) >= conf.MaxBackoff {
+			failures = 0
+		}
+		failures++
+
+		if conf.MaxRestarts > 0 && failures > conf.MaxRestarts {
+			llog.WithFields(log.Fields{
+				"restarts": listenerCtx.restarts,
+				"error":    err,
+			}).Error("[scheduler] listener failed too many times, will not restart")
+			listenerCtx.check.Report("", fmt.Errorf(
+				"listener failed %d consecutive times, not restarting: %v", failures, err,
+			))
+			return
+		}
+
+		listenerCtx.restarts++
+		backoff := listenBackoff(conf, failures)
+		llog.WithFields(log.Fields{
+			"restarts": listenerCtx.restarts,
+			"backoff":  backoff,
+			"error":    err,
+		}).Error("[scheduler] listener failed, will restart and try again")
+		listenerCtx.check.Report("", fmt.Errorf(
+			"listener failed, restarting in %s (restarts: %d): %v", backoff, listenerCtx.restarts, err,
+		))
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-listenerCtx.stop:
+			timer.Stop()
+			llog.Info("[scheduler] listener stopped, ending device listen")
+			return
+		case <-timer.C:
+		}
 	}
 }
+
+// runListener runs the listener function for the device once, returning when the
+// listener function returns. Subscribe handlers are preferred over Listen.
+func (scheduler *scheduler) runListener(listenerCtx *ListenerCtx) error {
+	if listenerCtx.handler.Subscribe != nil {
+		emit := scheduler.emitter(listenerCtx.ctx, listenerCtx.device)
+		return listenerCtx.handler.Subscribe(listenerCtx.ctx, listenerCtx.device, emit)
+	}
+
+	// Run the listener for the device. Pass in the state manager's read channel,
+	// as the listener is really just collecting readings.
+	return listenerCtx.handler.Listen(
+		listenerCtx.device,
+		scheduler.stateManager.readChan,
+	)
+}
+
+// emitter creates the Emitter for a device's Subscribe handler. Emitted readings
+// are finalized and passed to the state manager, as they would be for a read.
+func (scheduler *scheduler) emitter(ctx context.Context, device *Device) Emitter {
+	return func(readings ...*output.Reading) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		response := NewReadContext(device, readings)
+		if err := finalizeReadings(device, response); err != nil {
+			return err
+		}
+
+		select {
+		case scheduler.stateManager.readChan <- response:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// listenSettings gets the plugin's listen settings.
+func (scheduler *scheduler) listenSettings() config.ListenSettings {
+	if scheduler.config == nil || scheduler.config.Listen == nil {
+		return config.ListenSettings{}
+	}
+	return *scheduler.config.Listen
+}
+
+// listenBackoff gets the time to wait before restarting a listener which has
+// failed the given number of consecutive times.
+func listenBackoff(conf config.ListenSettings, failures int) time.Duration {
+	return exponentialBackoff(conf.Backoff, conf.MaxBackoff, failures)
+}
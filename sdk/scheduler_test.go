@@ -17,14 +17,17 @@
 package sdk
 
 import (
+	"context"
 	"fmt"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/patrickmn/go-cache"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/vapor-ware/synse-sdk/sdk/config"
+	sdkError "github.com/vapor-ware/synse-sdk/sdk/errors"
 	"github.com/vapor-ware/synse-sdk/sdk/funcs"
 	"github.com/vapor-ware/synse-sdk/sdk/health"
 	"github.com/vapor-ware/synse-sdk/sdk/output"
@@ -122,13 +125,139 @@ func TestScheduler_Stop(t *testing.T) {
 		stop: make(chan struct{}),
 	}
 
-	err := s.Stop()
+	err := s.Stop(context.Background())
 	assert.NoError(t, err)
 
 	_, isOpen := <-s.stop
 	assert.False(t, isOpen)
 }
 
+func TestScheduler_Stop_twice(t *testing.T) {
+	s := scheduler{
+		stop: make(chan struct{}),
+	}
+
+	err := s.Stop(context.Background())
+	assert.NoError(t, err)
+
+	// Stopping an already stopped scheduler should not panic.
+	err = s.Stop(context.Background())
+	assert.NoError(t, err)
+}
+
+func TestScheduler_Stop_failsQueuedWrites(t *testing.T) {
+	s := scheduler{
+		stop:      make(chan struct{}),
+		writeChan: make(chan *WriteContext, 2),
+	}
+
+	txn1 := newTransaction(time.Minute, "")
+	txn2 := newTransaction(time.Minute, "")
+	s.writeChan <- &WriteContext{transaction: txn1}
+	s.writeChan <- &WriteContext{transaction: txn2}
+
+	err := s.Stop(context.Background())
+	assert.NoError(t, err)
+
+	assert.Empty(t, s.writeChan)
+	assert.Equal(t, statusError, txn1.status)
+	assert.Equal(t, msgWriteCancelled, txn1.message)
+	assert.Equal(t, statusError, txn2.status)
+	assert.Equal(t, msgWriteCancelled, txn2.message)
+}
+
+func TestScheduler_Stop_contextDone(t *testing.T) {
+	s := scheduler{
+		stop: make(chan struct{}),
+	}
+
+	// Simulate a read/write loop which does not finish.
+	s.running.Add(1)
+	defer s.running.Done()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := s.Stop(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestScheduler_queueWrites_stopped(t *testing.T) {
+	s := scheduler{
+		stop:      make(chan struct{}),
+		writeChan: make(chan *WriteContext, 1),
+		stopped:   true,
+	}
+
+	txn := newTransaction(time.Minute, "")
+	err := s.queueWrites(&WriteContext{transaction: txn})
+	assert.Equal(t, ErrSchedulerStopped, err)
+
+	// Writes which are not queued do not stay pending.
+	assert.Empty(t, s.writeChan)
+	assert.Equal(t, statusError, txn.status)
+	assert.Equal(t, msgWriteCancelled, txn.message)
+}
+
+func TestScheduler_queueWrites_stoppedWhileQueueFull(t *testing.T) {
+	s := scheduler{
+		stop:      make(chan struct{}),
+		writeChan: make(chan *WriteContext, 1),
+	}
+
+	txn1 := newTransaction(time.Minute, "")
+	txn2 := newTransaction(time.Minute, "")
+	errs := make(chan error, 1)
+	go func() {
+		errs <- s.queueWrites(&WriteContext{transaction: txn1}, &WriteContext{transaction: txn2})
+	}()
+
+	// The second write blocks on the full queue; stopping the scheduler must
+	// not wait on it.
+	assert.Eventually(t, func() bool { return len(s.writeChan) == 1 }, time.Second, time.Millisecond)
+	assert.NoError(t, s.Stop(context.Background()))
+
+	assert.Equal(t, ErrSchedulerStopped, <-errs)
+	assert.Equal(t, statusError, txn1.status)
+	assert.Equal(t, statusError, txn2.status)
+}
+
+func TestScheduler_Write_stopped(t *testing.T) {
+	s := &scheduler{
+		stopped: true,
+	}
+	dev := &Device{
+		handler: &DeviceHandler{
+			Write: func(device *Device, data *WriteData) error {
+				return nil
+			},
+		},
+	}
+
+	resp, err := s.Write(dev, []*synse.V3WriteData{{Action: "test"}})
+	assert.Error(t, err)
+	assert.Equal(t, ErrSchedulerStopped, err)
+	assert.Nil(t, resp)
+}
+
+func TestScheduler_WriteAndWait_stopped(t *testing.T) {
+	s := &scheduler{
+		stopped: true,
+	}
+	dev := &Device{
+		handler: &DeviceHandler{
+			Write: func(device *Device, data *WriteData) error {
+				return nil
+			},
+		},
+	}
+
+	resp, err := s.WriteAndWait(dev, []*synse.V3WriteData{{Action: "test"}})
+	assert.Error(t, err)
+	assert.Equal(t, ErrSchedulerStopped, err)
+	assert.Nil(t, resp)
+}
+
 func TestScheduler_Write_nilDevice(t *testing.T) {
 	s := &scheduler{}
 
@@ -345,6 +474,308 @@ func TestScheduler_scheduleReads(t *testing.T) {
 	assert.Equal(t, s.deviceManager.GetDevice("123"), reading.Device)
 }
 
+// Devices with different read intervals are read on independent schedules, so a
+// slow device does not hold up reads of other devices.
+func TestScheduler_scheduleReads_independentIntervals(t *testing.T) {
+	slowHandler := &DeviceHandler{
+		Name: "slow",
+		Read: func(device *Device) ([]*output.Reading, error) {
+			time.Sleep(300 * time.Millisecond)
+			return []*output.Reading{{Value: "slow"}}, nil
+		},
+		ReadInterval: time.Hour,
+	}
+	fastHandler := &DeviceHandler{
+		Name: "fast",
+		Read: func(device *Device) ([]*output.Reading, error) {
+			return []*output.Reading{{Value: "fast"}}, nil
+		},
+	}
+
+	s := scheduler{
+		config: &config.PluginSettings{
+			Mode: modeParallel,
+			Read: &config.ReadSettings{
+				Interval: time.Hour,
+			},
+		},
+		deviceManager: &deviceManager{
+			handlers: map[string]*DeviceHandler{
+				"slow": slowHandler,
+				"fast": fastHandler,
+			},
+			devices: map[string]*Device{
+				"1": {id: "1", Handler: "slow", handler: slowHandler},
+				"2": {id: "2", Handler: "fast", handler: fastHandler, ReadInterval: 10 * time.Millisecond},
+			},
+		},
+		stateManager: &stateManager{
+			readChan: make(chan *ReadContext, 100),
+		},
+		stop:       make(chan struct{}),
+		serialLock: &sync.Mutex{},
+	}
+
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		close(s.stop)
+	}()
+	s.scheduleReads()
+
+	close(s.stateManager.readChan)
+	counts := map[string]int{}
+	for ctx := range s.stateManager.readChan {
+		counts[ctx.Reading[0].Value.(string)]++
+	}
+
+	// The slow device is read once, while the fast device is read many times
+	// during the slow device's read.
+	assert.Equal(t, 1, counts["slow"])
+	assert.Greater(t, counts["fast"], 5)
+}
+
+func TestScheduler_readInterval(t *testing.T) {
+	s := scheduler{
+		config: &config.PluginSettings{
+			Read: &config.ReadSettings{
+				Interval: 1 * time.Second,
+			},
+		},
+	}
+
+	// Global interval.
+	device := &Device{handler: &DeviceHandler{}}
+	assert.Equal(t, 1*time.Second, s.readInterval(device))
+
+	// Handler interval.
+	device.handler.ReadInterval = 2 * time.Second
+	assert.Equal(t, 2*time.Second, s.readInterval(device))
+
+	// Device interval.
+	device.ReadInterval = 3 * time.Second
+	assert.Equal(t, 3*time.Second, s.readInterval(device))
+}
+
+func TestScheduler_readOffset(t *testing.T) {
+	s := scheduler{
+		config: &config.PluginSettings{
+			Read: &config.ReadSettings{Schedule: scheduleStaggered},
+		},
+	}
+
+	// Offsets are deterministic and within the interval.
+	offset := s.readOffset("device/123", time.Second)
+	assert.Equal(t, offset, s.readOffset("device/123", time.Second))
+	assert.GreaterOrEqual(t, int64(offset), int64(0))
+	assert.Less(t, int64(offset), int64(time.Second))
+	assert.NotEqual(t, offset, s.readOffset("device/456", time.Second))
+
+	// Offsets are spread evenly across the interval.
+	buckets := make([]int, 10)
+	for i := 0; i < 1000; i++ {
+		offset := s.readOffset(fmt.Sprintf("device/%d", i), time.Second)
+		buckets[offset/(100*time.Millisecond)]++
+	}
+	for i, n := range buckets {
+		assert.InDelta(t, 100, n, 50, fmt.Sprintf("bucket %d", i))
+	}
+
+	assert.Equal(t, time.Duration(0), s.readOffset("device/123", 0))
+}
+
+func TestScheduler_readOffset_immediate(t *testing.T) {
+	s := scheduler{
+		config: &config.PluginSettings{
+			Read: &config.ReadSettings{Schedule: scheduleImmediate},
+		},
+	}
+	assert.Equal(t, time.Duration(0), s.readOffset("device/123", time.Second))
+}
+
+func TestReadJitter_apply(t *testing.T) {
+	assert.Equal(t, time.Second, newReadJitter("device/123", 0).apply(time.Second))
+
+	jitter := newReadJitter("device/123", 0.1)
+	var varied bool
+	for i := 0; i < 100; i++ {
+		d := jitter.apply(time.Second)
+		assert.GreaterOrEqual(t, int64(d), int64(900*time.Millisecond))
+		assert.LessOrEqual(t, int64(d), int64(1100*time.Millisecond))
+		varied = varied || d != time.Second
+	}
+	assert.True(t, varied)
+
+	// Jitter is clamped to at most the interval.
+	assert.Equal(t, 1.0, newReadJitter("device/123", 5).jitter)
+}
+
+func TestScheduler_readLoop_staggered(t *testing.T) {
+	s := scheduler{
+		config: &config.PluginSettings{
+			Read: &config.ReadSettings{Schedule: scheduleStaggered},
+		},
+		stop: make(chan struct{}),
+	}
+
+	interval := 200 * time.Millisecond
+	offset := s.readOffset("device/123", interval)
+
+	stop := make(chan struct{})
+	start := time.Now()
+	var first time.Duration
+	s.readLoop("device/123", interval, nil, stop, func() {
+		first = time.Since(start)
+		close(stop)
+	})
+	assert.GreaterOrEqual(t, int64(first), int64(offset))
+}
+
+func TestScheduler_startReader_notReading(t *testing.T) {
+	handler := &DeviceHandler{
+		Name: "test",
+		Read: func(device *Device) ([]*output.Reading, error) {
+			return []*output.Reading{{Value: 1}}, nil
+		},
+	}
+	s := scheduler{}
+
+	s.startReader(&Device{id: "123", handler: handler})
+	assert.Empty(t, s.readers)
+}
+
+func TestScheduler_startReader_notReadable(t *testing.T) {
+	s := scheduler{isReading: true}
+
+	s.startReader(&Device{id: "123", handler: &DeviceHandler{Name: "test"}})
+	assert.Empty(t, s.readers)
+}
+
+func TestScheduler_startReader_stopReader(t *testing.T) {
+	handler := &DeviceHandler{
+		Name: "test",
+		Read: func(device *Device) ([]*output.Reading, error) {
+			return []*output.Reading{{Value: 1}}, nil
+		},
+	}
+	device := &Device{id: "123", handler: handler}
+
+	s := scheduler{
+		config: &config.PluginSettings{
+			Mode: modeParallel,
+			Read: &config.ReadSettings{
+				Interval: 10 * time.Millisecond,
+			},
+		},
+		stateManager: &stateManager{
+			readChan: make(chan *ReadContext),
+		},
+		stop:      make(chan struct{}),
+		isReading: true,
+	}
+	defer close(s.stop)
+
+	s.startReader(device)
+	assert.Len(t, s.readers, 1)
+
+	// Starting the reader again does not start another read loop.
+	s.startReader(device)
+	assert.Len(t, s.readers, 1)
+
+	reading := <-s.stateManager.readChan
+	assert.Equal(t, device, reading.Device)
+
+	// Stopping a reader for a different instance of the device does nothing.
+	s.stopReader(&Device{id: "123", handler: handler})
+	assert.Len(t, s.readers, 1)
+
+	s.stopReader(device)
+	assert.Empty(t, s.readers)
+
+	// Drain any read which was in progress when the reader was stopped; the
+	// read loop then exits.
+	done := make(chan struct{})
+	go func() {
+		s.readLoops.Wait()
+		close(done)
+	}()
+	for {
+		select {
+		case <-s.stateManager.readChan:
+			continue
+		case <-done:
+		}
+		break
+	}
+}
+
+func TestScheduler_startReader_stopReader_bulkRead(t *testing.T) {
+	handler := &DeviceHandler{
+		Name: "test",
+		BulkRead: func(devices []*Device) ([]*ReadContext, error) {
+			var ctxs []*ReadContext
+			for _, d := range devices {
+				ctxs = append(ctxs, &ReadContext{Device: d, Reading: []*output.Reading{{Value: 1}}})
+			}
+			return ctxs, nil
+		},
+	}
+	d1 := &Device{id: "1", Handler: "test", handler: handler}
+	d2 := &Device{id: "2", Handler: "test", handler: handler}
+
+	s := scheduler{
+		config: &config.PluginSettings{
+			Mode: modeParallel,
+			Read: &config.ReadSettings{
+				Interval: 10 * time.Millisecond,
+			},
+		},
+		deviceManager: &deviceManager{
+			devices: map[string]*Device{"1": d1, "2": d2},
+		},
+		stateManager: &stateManager{
+			readChan: make(chan *ReadContext),
+		},
+		stop:      make(chan struct{}),
+		isReading: true,
+	}
+	defer close(s.stop)
+
+	// A single read loop is started for the handler, however many of its
+	// devices are attached.
+	s.startReader(d1)
+	s.startReader(d2)
+	assert.Empty(t, s.readers)
+	assert.Len(t, s.bulkReaders, 1)
+
+	reading := <-s.stateManager.readChan
+	assert.Equal(t, "test", reading.Device.Handler)
+
+	// The read loop keeps running while the handler has devices.
+	delete(s.deviceManager.devices, "1")
+	s.stopReader(d1)
+	assert.Len(t, s.bulkReaders, 1)
+
+	delete(s.deviceManager.devices, "2")
+	s.stopReader(d2)
+	assert.Empty(t, s.bulkReaders)
+
+	// Drain any read which was in progress when the reader was stopped; the
+	// read loop then exits.
+	done := make(chan struct{})
+	go func() {
+		s.readLoops.Wait()
+		close(done)
+	}()
+	for {
+		select {
+		case <-s.stateManager.readChan:
+			continue
+		case <-done:
+		}
+		break
+	}
+}
+
 // When configured in serial mode, scheduleReads should execute all reads serially, even
 // if there is a mix of single-read and batch-read handlers.
 //
@@ -451,8 +882,9 @@ func TestScheduler_scheduleReadsSerial(t *testing.T) {
 	// Verify that the execution time matches the expected run time for serial reads.
 	// Individual reads @ 500ms (2 handlers, 2 devices each) = 2s
 	// Bulk reads @ 500ms (2 handlers) = 1s
-	// Total = 2s + 1s + 100ms of overhead for an expected 3100ms
-	assert.InDelta(t, 3100*time.Millisecond, stop.Sub(start), float64(150*time.Millisecond))
+	// Total = 2s + 1s for an expected 3000ms. The read loops stop as soon as their
+	// in-progress read completes, so they do not wait out the read interval.
+	assert.InDelta(t, 3000*time.Millisecond, stop.Sub(start), float64(150*time.Millisecond))
 
 	// Close the read channel so we can iterate over it without blocking.
 	close(s.stateManager.readChan)
@@ -595,8 +1027,9 @@ func TestScheduler_scheduleReadsParallel(t *testing.T) {
 	// Verify that the execution time matches the expected run time for parallel reads.
 	// Individual reads @ 500ms (2 handlers, 2 devices each) ~= 500ms
 	// Bulk reads @ 500ms (2 handlers) ~= 500ms
-	// Total = 500ms + 100ms of overhead for an expected 600ms
-	assert.InDelta(t, 600*time.Millisecond, stop.Sub(start), float64(100*time.Millisecond))
+	// Total = 500ms for an expected 500ms. The read loops stop as soon as their
+	// in-progress read completes, so they do not wait out the read interval.
+	assert.InDelta(t, 500*time.Millisecond, stop.Sub(start), float64(100*time.Millisecond))
 
 	// Close the read channel so we can iterate over it without blocking.
 	close(s.stateManager.readChan)
@@ -875,31 +1308,262 @@ func TestScheduler_scheduleListen(t *testing.T) {
 	assert.Equal(t, s.deviceManager.GetDevice("123"), reading.Device)
 }
 
-func TestScheduler_applyTransformations_NoTransformers(t *testing.T) {
-	device := &Device{
-		Transforms: []Transformer{},
-	}
-	rctx := &ReadContext{
-		Reading: []*output.Reading{
-			{Value: 2},
+func TestScheduler_startListener_notListening(t *testing.T) {
+	handler := &DeviceHandler{
+		Name: "test",
+		Listen: func(device *Device, contexts chan *ReadContext) error {
+			return nil
 		},
 	}
+	s := scheduler{}
 
-	err := finalizeReadings(device, rctx)
-	assert.NoError(t, err)
+	s.startListener(&Device{id: "123", handler: handler})
+	assert.Empty(t, s.listeners)
+}
 
-	// Verify that the reading value did not change.
-	assert.Equal(t, 2, rctx.Reading[0].Value.(int))
+func TestScheduler_startListener_noListenFn(t *testing.T) {
+	s := scheduler{isListening: true}
 
-	// Verify that no additional context was set.
-	assert.Empty(t, rctx.Reading[0].Context)
+	s.startListener(&Device{id: "123", handler: &DeviceHandler{Name: "test"}})
+	assert.Empty(t, s.listeners)
 }
 
-func TestScheduler_applyTransformations_ScaleTransformerOk(t *testing.T) {
-	device := &Device{
-		Transforms: []Transformer{
-			&ScaleTransformer{Factor: 2},
-		},
+func TestScheduler_startListener_stopListener(t *testing.T) {
+	release := make(chan struct{})
+	handler := &DeviceHandler{
+		Name: "test",
+		Listen: func(device *Device, contexts chan *ReadContext) error {
+			contexts <- &ReadContext{Device: device}
+			<-release
+			return fmt.Errorf("listener error")
+		},
+	}
+	device := &Device{id: "123", handler: handler}
+
+	s := scheduler{
+		isListening: true,
+		stateManager: &stateManager{
+			readChan: make(chan *ReadContext),
+		},
+	}
+
+	s.startListener(device)
+	assert.Len(t, s.listeners, 1)
+
+	// Starting the listener again does not start another listener.
+	s.startListener(device)
+	assert.Len(t, s.listeners, 1)
+
+	reading := <-s.stateManager.readChan
+	assert.Equal(t, device, reading.Device)
+
+	// Stopping a listener for a different instance of the device does nothing.
+	s.stopListener(&Device{id: "123", handler: handler})
+	assert.Len(t, s.listeners, 1)
+
+	s.stopListener(device)
+	assert.Empty(t, s.listeners)
+	close(release)
+}
+
+func TestScheduler_listen_stopped(t *testing.T) {
+	var calls int
+	handler := &DeviceHandler{
+		Name: "test",
+		Listen: func(device *Device, contexts chan *ReadContext) error {
+			calls++
+			return fmt.Errorf("listener error")
+		},
+	}
+	ctx := NewListenerCtx(handler, &Device{id: "123", handler: handler})
+	close(ctx.stop)
+
+	s := scheduler{
+		stateManager: &stateManager{
+			readChan: make(chan *ReadContext),
+		},
+	}
+
+	// The listener fails, but is not restarted since it was stopped.
+	s.listen(ctx)
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, 0, ctx.restarts)
+}
+
+func TestScheduler_listen_backoff(t *testing.T) {
+	var calls int
+	handler := &DeviceHandler{
+		Name: "test",
+		Listen: func(device *Device, contexts chan *ReadContext) error {
+			calls++
+			return fmt.Errorf("listener error")
+		},
+	}
+	ctx := NewListenerCtx(handler, &Device{id: "123", handler: handler})
+
+	s := scheduler{
+		config: &config.PluginSettings{
+			Listen: &config.ListenSettings{
+				Backoff:     10 * time.Millisecond,
+				MaxBackoff:  time.Second,
+				MaxRestarts: 2,
+			},
+		},
+		stateManager: &stateManager{
+			readChan: make(chan *ReadContext),
+		},
+	}
+
+	// The listener is restarted with backoff until it exceeds the maximum
+	// number of restarts.
+	start := time.Now()
+	s.listen(ctx)
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, 2, ctx.restarts)
+	assert.GreaterOrEqual(t, int64(time.Since(start)), int64(30*time.Millisecond))
+
+	status := ctx.check.Status()
+	assert.False(t, status.Ok)
+	assert.Contains(t, status.Message, "not restarting")
+	assert.Contains(t, status.Message, "listener error")
+}
+
+func TestScheduler_listen_stoppedDuringBackoff(t *testing.T) {
+	var calls int
+	handler := &DeviceHandler{
+		Name: "test",
+		Listen: func(device *Device, contexts chan *ReadContext) error {
+			calls++
+			return fmt.Errorf("listener error")
+		},
+	}
+	ctx := NewListenerCtx(handler, &Device{id: "123", handler: handler})
+
+	s := scheduler{
+		config: &config.PluginSettings{
+			Listen: &config.ListenSettings{Backoff: time.Minute},
+		},
+		stateManager: &stateManager{
+			readChan: make(chan *ReadContext),
+		},
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		ctx.close()
+	}()
+
+	s.listen(ctx)
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, 1, ctx.restarts)
+}
+
+func TestScheduler_startListener_subscribe(t *testing.T) {
+	stopped := make(chan struct{})
+	handler := &DeviceHandler{
+		Name: "test",
+		Subscribe: func(ctx context.Context, device *Device, emit Emitter) error {
+			if err := emit(&output.Reading{Value: 1}); err != nil {
+				return err
+			}
+			<-ctx.Done()
+			close(stopped)
+			return ctx.Err()
+		},
+	}
+	device := &Device{
+		id:      "123",
+		handler: handler,
+		Context: map[string]string{"foo": "bar"},
+	}
+
+	s := scheduler{
+		isListening: true,
+		config: &config.PluginSettings{
+			Listen: &config.ListenSettings{},
+		},
+		stateManager: &stateManager{
+			readChan: make(chan *ReadContext),
+		},
+		health: health.NewManager(&config.HealthSettings{}),
+	}
+
+	s.startListener(device)
+	assert.Len(t, s.listeners, 1)
+	assert.Equal(t, 1, s.health.Count())
+
+	// Emitted readings are finalized for the device.
+	reading := <-s.stateManager.readChan
+	assert.Equal(t, device, reading.Device)
+	assert.Equal(t, map[string]string{"foo": "bar"}, reading.Reading[0].Context)
+
+	// Stopping the listener cancels the subscription context.
+	s.stopListener(device)
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("subscription was not cancelled")
+	}
+	assert.Empty(t, s.listeners)
+	assert.Equal(t, 0, s.health.Count())
+}
+
+func TestScheduler_emitter_cancelled(t *testing.T) {
+	s := scheduler{
+		stateManager: &stateManager{
+			readChan: make(chan *ReadContext),
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	emit := s.emitter(ctx, &Device{id: "123"})
+
+	// Emitting blocks until the context is cancelled.
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	assert.Equal(t, context.Canceled, emit(&output.Reading{Value: 1}))
+	assert.Equal(t, context.Canceled, emit(&output.Reading{Value: 1}))
+}
+
+func TestListenBackoff(t *testing.T) {
+	conf := config.ListenSettings{
+		Backoff:    time.Second,
+		MaxBackoff: 5 * time.Second,
+	}
+
+	for failures, expected := range []time.Duration{
+		time.Second, time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second,
+	} {
+		assert.Equal(t, expected, listenBackoff(conf, failures), fmt.Sprintf("failures: %d", failures))
+	}
+}
+
+func TestScheduler_applyTransformations_NoTransformers(t *testing.T) {
+	device := &Device{
+		Transforms: []Transformer{},
+	}
+	rctx := &ReadContext{
+		Reading: []*output.Reading{
+			{Value: 2},
+		},
+	}
+
+	err := finalizeReadings(device, rctx)
+	assert.NoError(t, err)
+
+	// Verify that the reading value did not change.
+	assert.Equal(t, 2, rctx.Reading[0].Value.(int))
+
+	// Verify that no additional context was set.
+	assert.Empty(t, rctx.Reading[0].Context)
+}
+
+func TestScheduler_applyTransformations_ScaleTransformerOk(t *testing.T) {
+	device := &Device{
+		Transforms: []Transformer{
+			&ScaleTransformer{Factor: 2},
+		},
 	}
 	rctx := &ReadContext{
 		Reading: []*output.Reading{
@@ -1416,3 +2080,592 @@ func TestScheduler_finalizeReadings_nilReading(t *testing.T) {
 	// Verify that the device context was set.
 	assert.Equal(t, map[string]string{"foo": "bar"}, rctx.Reading[0].Context)
 }
+
+// newTestScheduler creates a scheduler for tests, in parallel mode, whose device
+// manager holds the given devices. Its state manager is from newTestStateManager,
+// and shares its config. Tests set any other settings which they need on the
+// scheduler's config.
+func newTestScheduler(devices ...*Device) *scheduler {
+	sm := newTestStateManager(devices...)
+	return &scheduler{
+		config:        sm.config,
+		deviceManager: sm.deviceManager,
+		stateManager:  sm,
+		serialLock:    &sync.Mutex{},
+		health:        health.NewManager(&config.HealthSettings{}),
+		schedule:      newWriteSchedule(""),
+		writeChan:     make(chan *WriteContext, 10),
+		stop:          make(chan struct{}),
+	}
+}
+
+// newWriteTestContext creates a write context for a device with the given
+// handler and write timeout.
+func newWriteTestContext(handler *DeviceHandler, timeout time.Duration) *WriteContext {
+	return &WriteContext{
+		transaction: newTransaction(timeout, ""),
+		device: &Device{
+			id:           "123",
+			handler:      handler,
+			WriteTimeout: timeout,
+		},
+		data: &synse.V3WriteData{Action: "test"},
+	}
+}
+
+func TestScheduler_write_writeContext(t *testing.T) {
+	s := scheduler{
+		config: &config.PluginSettings{Mode: modeParallel, Write: &config.WriteSettings{}},
+		stop:   make(chan struct{}),
+	}
+
+	var hasDeadline bool
+	w := newWriteTestContext(&DeviceHandler{
+		WriteContext: func(ctx context.Context, device *Device, data *WriteData) error {
+			_, hasDeadline = ctx.Deadline()
+			return nil
+		},
+	}, time.Second)
+
+	s.write(w)
+	assert.True(t, hasDeadline)
+	assert.Equal(t, statusDone, w.transaction.status)
+	assert.Empty(t, w.transaction.message)
+}
+
+func TestScheduler_write_timeoutAcknowledged(t *testing.T) {
+	s := scheduler{
+		config: &config.PluginSettings{Mode: modeParallel, Write: &config.WriteSettings{}},
+		stop:   make(chan struct{}),
+	}
+
+	w := newWriteTestContext(&DeviceHandler{
+		WriteContext: func(ctx context.Context, device *Device, data *WriteData) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}, 10*time.Millisecond)
+
+	s.write(w)
+	assert.Equal(t, statusError, w.transaction.status)
+	assert.Contains(t, w.transaction.message, ErrDeviceWriteTimeout.Error())
+	assert.Contains(t, w.transaction.message, msgWriteAcknowledged)
+}
+
+func TestScheduler_write_timeoutOverrun(t *testing.T) {
+	defer func(grace time.Duration) { writeCancelGracePeriod = grace }(writeCancelGracePeriod)
+	writeCancelGracePeriod = 10 * time.Millisecond
+
+	s := scheduler{
+		config: &config.PluginSettings{Mode: modeParallel, Write: &config.WriteSettings{}},
+		stop:   make(chan struct{}),
+	}
+
+	release := make(chan struct{})
+	defer close(release)
+
+	w := newWriteTestContext(&DeviceHandler{
+		WriteContext: func(ctx context.Context, device *Device, data *WriteData) error {
+			<-release
+			return nil
+		},
+	}, 10*time.Millisecond)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.write(w)
+	}()
+
+	// The write fails once the grace period elapses, but is not done until
+	// the handler returns.
+	w.transaction.wait()
+	assert.Equal(t, statusError, w.transaction.status)
+	assert.Contains(t, w.transaction.message, ErrDeviceWriteTimeout.Error())
+	assert.Contains(t, w.transaction.message, msgWriteOverrun)
+
+	select {
+	case <-done:
+		t.Fatal("write returned before the overrunning handler")
+	case <-time.After(20 * time.Millisecond):
+	}
+	release <- struct{}{}
+	<-done
+}
+
+func TestScheduler_write_timeoutCompletedLate(t *testing.T) {
+	s := scheduler{
+		config: &config.PluginSettings{Mode: modeParallel, Write: &config.WriteSettings{}},
+		stop:   make(chan struct{}),
+	}
+
+	// The handler ignores the context and completes after the deadline,
+	// within the grace period.
+	w := newWriteTestContext(&DeviceHandler{
+		WriteContext: func(ctx context.Context, device *Device, data *WriteData) error {
+			time.Sleep(50 * time.Millisecond)
+			return nil
+		},
+	}, 10*time.Millisecond)
+
+	s.write(w)
+	assert.Equal(t, statusError, w.transaction.status)
+	assert.Contains(t, w.transaction.message, msgWriteOverrun)
+}
+
+func TestScheduler_write_timeoutLegacyHandler(t *testing.T) {
+	s := scheduler{
+		config: &config.PluginSettings{Mode: modeParallel, Write: &config.WriteSettings{}},
+		stop:   make(chan struct{}),
+	}
+
+	release := make(chan struct{})
+	defer close(release)
+
+	w := newWriteTestContext(&DeviceHandler{
+		Write: func(device *Device, data *WriteData) error {
+			<-release
+			return nil
+		},
+	}, 10*time.Millisecond)
+
+	// Handlers without a context can not acknowledge cancellation, so the
+	// write should fail without waiting for the grace period.
+	start := time.Now()
+	go s.write(w)
+	w.transaction.wait()
+	assert.Less(t, int64(time.Since(start)), int64(writeCancelGracePeriod))
+	assert.Equal(t, statusError, w.transaction.status)
+	assert.Contains(t, w.transaction.message, msgWriteOverrun)
+}
+
+func TestScheduler_write_cancelledOnStop(t *testing.T) {
+	s := scheduler{
+		config: &config.PluginSettings{Mode: modeParallel, Write: &config.WriteSettings{}},
+		stop:   make(chan struct{}),
+	}
+
+	started := make(chan struct{})
+	w := newWriteTestContext(&DeviceHandler{
+		WriteContext: func(ctx context.Context, device *Device, data *WriteData) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}, time.Minute)
+
+	go func() {
+		<-started
+		close(s.stop)
+	}()
+
+	s.write(w)
+	assert.Equal(t, statusError, w.transaction.status)
+	assert.Contains(t, w.transaction.message, ErrDeviceWriteCancelled.Error())
+	assert.Contains(t, w.transaction.message, msgWriteAcknowledged)
+}
+
+func TestScheduler_write_retrySucceeds(t *testing.T) {
+	s := scheduler{
+		config: &config.PluginSettings{
+			Mode: modeParallel,
+			Write: &config.WriteSettings{
+				Retry: &config.RetrySettings{MaxAttempts: 3, Backoff: time.Millisecond},
+			},
+		},
+		stop: make(chan struct{}),
+	}
+
+	var calls int
+	w := newWriteTestContext(&DeviceHandler{
+		Write: func(device *Device, data *WriteData) error {
+			calls++
+			if calls < 3 {
+				return sdkError.Retryable(fmt.Errorf("test error %d", calls))
+			}
+			return nil
+		},
+	}, time.Second)
+
+	s.write(w)
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, statusDone, w.transaction.status)
+	assert.Equal(t, "retries: 2, last error: test error 2", w.transaction.message)
+}
+
+func TestScheduler_write_retryExhausted(t *testing.T) {
+	s := scheduler{
+		config: &config.PluginSettings{
+			Mode: modeParallel,
+			Write: &config.WriteSettings{
+				Retry: &config.RetrySettings{MaxAttempts: 3, Backoff: time.Millisecond},
+			},
+		},
+		stop: make(chan struct{}),
+	}
+
+	var calls int
+	w := newWriteTestContext(&DeviceHandler{
+		Write: func(device *Device, data *WriteData) error {
+			calls++
+			return sdkError.Retryable(fmt.Errorf("test error"))
+		},
+	}, time.Second)
+
+	s.write(w)
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, statusError, w.transaction.status)
+	assert.Equal(t, "test error (retries: 2)", w.transaction.message)
+}
+
+func TestScheduler_write_retryFatal(t *testing.T) {
+	s := scheduler{
+		config: &config.PluginSettings{
+			Mode: modeParallel,
+			Write: &config.WriteSettings{
+				Retry: &config.RetrySettings{MaxAttempts: 3, Backoff: time.Millisecond},
+			},
+		},
+		stop: make(chan struct{}),
+	}
+
+	var calls int
+	w := newWriteTestContext(&DeviceHandler{
+		Write: func(device *Device, data *WriteData) error {
+			calls++
+			return sdkError.Fatal(fmt.Errorf("test error"))
+		},
+	}, time.Second)
+
+	s.write(w)
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, statusError, w.transaction.status)
+	assert.Equal(t, "test error", w.transaction.message)
+}
+
+func TestScheduler_write_retryUnmarked(t *testing.T) {
+	s := scheduler{
+		config: &config.PluginSettings{
+			Mode: modeParallel,
+			Write: &config.WriteSettings{
+				Retry: &config.RetrySettings{MaxAttempts: 3, Backoff: time.Millisecond},
+			},
+		},
+		stop: make(chan struct{}),
+	}
+
+	// Errors which are not marked as retryable are not retried.
+	var calls int
+	w := newWriteTestContext(&DeviceHandler{
+		Write: func(device *Device, data *WriteData) error {
+			calls++
+			return fmt.Errorf("test error")
+		},
+	}, time.Second)
+
+	s.write(w)
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, statusError, w.transaction.status)
+	assert.Equal(t, "test error", w.transaction.message)
+}
+
+func TestScheduler_write_retryWithinTimeout(t *testing.T) {
+	s := scheduler{
+		config: &config.PluginSettings{
+			Mode: modeParallel,
+			Write: &config.WriteSettings{
+				Retry: &config.RetrySettings{MaxAttempts: 5, Backoff: 40 * time.Millisecond},
+			},
+		},
+		stop: make(chan struct{}),
+	}
+
+	var calls int
+	w := newWriteTestContext(&DeviceHandler{
+		Write: func(device *Device, data *WriteData) error {
+			calls++
+			return sdkError.Retryable(fmt.Errorf("test error"))
+		},
+	}, 100*time.Millisecond)
+
+	// The first retry happens after 40ms, the second would need to start
+	// after a further 80ms, which is beyond the write timeout.
+	s.write(w)
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, statusError, w.transaction.status)
+	assert.Equal(t, "test error (retries: 1)", w.transaction.message)
+}
+
+func TestScheduler_writeRetryPolicy(t *testing.T) {
+	s := scheduler{
+		config: &config.PluginSettings{
+			Write: &config.WriteSettings{
+				Retry: &config.RetrySettings{MaxAttempts: 3, Backoff: time.Second, MaxBackoff: 5 * time.Second},
+			},
+		},
+	}
+
+	// No device policy, use the plugin settings.
+	policy := s.writeRetryPolicy(&Device{})
+	assert.Equal(t, config.RetrySettings{MaxAttempts: 3, Backoff: time.Second, MaxBackoff: 5 * time.Second}, policy)
+
+	// Device policy fields override the plugin settings.
+	attempts, jitter := 5, 0.5
+	policy = s.writeRetryPolicy(&Device{
+		WriteRetry: &config.DeviceRetrySettings{MaxAttempts: &attempts, Jitter: &jitter},
+	})
+	assert.Equal(t, config.RetrySettings{MaxAttempts: 5, Backoff: time.Second, MaxBackoff: 5 * time.Second, Jitter: 0.5}, policy)
+
+	// Device policy fields may be set to zero.
+	var backoff time.Duration
+	policy = s.writeRetryPolicy(&Device{
+		WriteRetry: &config.DeviceRetrySettings{Backoff: &backoff},
+	})
+	assert.Equal(t, config.RetrySettings{MaxAttempts: 3, MaxBackoff: 5 * time.Second}, policy)
+}
+
+func TestScheduler_writeRetryPolicy_noSettings(t *testing.T) {
+	s := scheduler{
+		config: &config.PluginSettings{},
+	}
+
+	policy := s.writeRetryPolicy(&Device{})
+	assert.Equal(t, 1, policy.MaxAttempts)
+}
+
+func TestWriteRetryBackoff(t *testing.T) {
+	policy := config.RetrySettings{Backoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+
+	assert.Equal(t, 100*time.Millisecond, writeRetryBackoff(policy, 1))
+	assert.Equal(t, 200*time.Millisecond, writeRetryBackoff(policy, 2))
+	assert.Equal(t, 400*time.Millisecond, writeRetryBackoff(policy, 3))
+	assert.Equal(t, 800*time.Millisecond, writeRetryBackoff(policy, 4))
+	assert.Equal(t, time.Second, writeRetryBackoff(policy, 5))
+	assert.Equal(t, time.Second, writeRetryBackoff(policy, 100))
+}
+
+func TestWriteRetryBackoff_jitter(t *testing.T) {
+	policy := config.RetrySettings{Backoff: time.Second, Jitter: 0.2}
+
+	for i := 0; i < 100; i++ {
+		backoff := writeRetryBackoff(policy, 1)
+		assert.GreaterOrEqual(t, int64(backoff), int64(800*time.Millisecond))
+		assert.LessOrEqual(t, int64(backoff), int64(1200*time.Millisecond))
+	}
+}
+
+func TestIsRetryableWriteError(t *testing.T) {
+	cases := []struct {
+		err      error
+		expected bool
+	}{
+		{err: fmt.Errorf("test error"), expected: false},
+		{err: sdkError.Retryable(fmt.Errorf("test error")), expected: true},
+		{err: fmt.Errorf("wrapped: %w", sdkError.Retryable(fmt.Errorf("test error"))), expected: true},
+		{err: sdkError.Fatal(fmt.Errorf("test error")), expected: false},
+		{err: sdkError.Fatal(sdkError.Retryable(fmt.Errorf("test error"))), expected: false},
+		{err: fmt.Errorf("wrapped: %w", sdkError.Fatal(fmt.Errorf("test error"))), expected: false},
+		{err: &sdkError.UnsupportedCommandError{}, expected: false},
+		{err: sdkError.InvalidArgumentErr("test error"), expected: false},
+		{err: context.DeadlineExceeded, expected: false},
+		{err: context.Canceled, expected: false},
+	}
+
+	for i, c := range cases {
+		assert.Equal(t, c.expected, isRetryableWriteError(c.err), i)
+	}
+}
+
+func TestScheduler_readTimeout(t *testing.T) {
+	s := scheduler{
+		config: &config.PluginSettings{
+			Read: &config.ReadSettings{Timeout: 3 * time.Second},
+		},
+	}
+
+	// Global timeout.
+	assert.Equal(t, 3*time.Second, s.readTimeout(&DeviceHandler{}, &Device{}))
+	assert.Equal(t, 3*time.Second, s.readTimeout(&DeviceHandler{}, nil))
+
+	// Handler timeout overrides the global timeout.
+	handler := &DeviceHandler{ReadTimeout: 2 * time.Second}
+	assert.Equal(t, 2*time.Second, s.readTimeout(handler, &Device{}))
+	assert.Equal(t, 2*time.Second, s.readTimeout(handler, nil))
+
+	// Device timeout overrides the handler timeout.
+	assert.Equal(t, time.Second, s.readTimeout(handler, &Device{ReadTimeout: time.Second}))
+}
+
+func TestScheduler_runRead_noTimeout(t *testing.T) {
+	s := scheduler{}
+
+	var called bool
+	_, err := s.runRead("device/123", nil, 0, func() {
+		time.Sleep(10 * time.Millisecond)
+		called = true
+	})
+	assert.NoError(t, err)
+	assert.True(t, called)
+}
+
+func TestScheduler_runRead_completes(t *testing.T) {
+	s := scheduler{}
+
+	var called bool
+	_, err := s.runRead("device/123", nil, time.Second, func() {
+		called = true
+	})
+	assert.NoError(t, err)
+	assert.True(t, called)
+	assert.Empty(t, s.abandoned)
+}
+
+func TestScheduler_runRead_timeout(t *testing.T) {
+	s := scheduler{}
+	abandoned := testutil.ToFloat64(metricAbandonedReads)
+
+	release := make(chan struct{})
+	_, err := s.runRead("device/123", nil, 10*time.Millisecond, func() {
+		<-release
+	})
+	assert.Equal(t, ErrDeviceReadTimeout, err)
+	assert.Equal(t, abandoned+1, testutil.ToFloat64(metricAbandonedReads))
+
+	// While the abandoned read has not returned, new reads for the same key
+	// are not started, but reads for other keys are.
+	var started bool
+	_, err = s.runRead("device/123", nil, 10*time.Millisecond, func() {
+		started = true
+	})
+	assert.Equal(t, ErrDeviceReadHung, err)
+	assert.False(t, started)
+
+	_, err = s.runRead("device/456", nil, 10*time.Millisecond, func() {})
+	assert.NoError(t, err)
+
+	// Once the abandoned read returns, it is no longer tracked.
+	close(release)
+	assert.Eventually(t, func() bool {
+		s.abandonedLock.Lock()
+		defer s.abandonedLock.Unlock()
+		return len(s.abandoned) == 0
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, abandoned, testutil.ToFloat64(metricAbandonedReads))
+
+	_, err = s.runRead("device/123", nil, 10*time.Millisecond, func() {})
+	assert.NoError(t, err)
+}
+
+func TestScheduler_runRead_timeoutHoldsLockGroups(t *testing.T) {
+	s := scheduler{
+		config: &config.PluginSettings{Mode: modeParallel},
+	}
+
+	release := make(chan struct{})
+	unlock, err := s.runRead("device/123", []string{"bus1"}, 10*time.Millisecond, func() {
+		<-release
+	})
+	assert.Equal(t, ErrDeviceReadTimeout, err)
+	unlock()
+
+	// The lock group is held while the abandoned read has not returned, and
+	// reads of other devices in the lock group are not started.
+	_, err = s.runRead("device/456", []string{"bus1"}, 10*time.Millisecond, func() {})
+	assert.Equal(t, ErrDeviceReadHung, err)
+
+	locked := make(chan struct{})
+	go func() {
+		s.lockGroups([]string{"bus1"})()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+		t.Fatal("lock group released before the abandoned read returned")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// Devices in other lock groups are not affected.
+	unlock, err = s.runRead("device/789", []string{"bus2"}, 10*time.Millisecond, func() {})
+	assert.NoError(t, err)
+	unlock()
+
+	// Once the abandoned read returns, the lock group is released.
+	close(release)
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Fatal("lock group not released after the abandoned read returned")
+	}
+	assert.Eventually(t, func() bool {
+		s.abandonedLock.Lock()
+		defer s.abandonedLock.Unlock()
+		return len(s.abandoned) == 0
+	}, time.Second, 5*time.Millisecond)
+
+	unlock, err = s.runRead("device/456", []string{"bus1"}, 10*time.Millisecond, func() {})
+	assert.NoError(t, err)
+	unlock()
+}
+
+func TestScheduler_read_timeout(t *testing.T) {
+	s := scheduler{
+		config: &config.PluginSettings{
+			Read: &config.ReadSettings{Timeout: 10 * time.Millisecond},
+		},
+		stateManager: &stateManager{
+			readChan: make(chan *ReadContext, 10),
+		},
+	}
+
+	release := make(chan struct{})
+	defer close(release)
+
+	device := &Device{
+		id: "123",
+		handler: &DeviceHandler{
+			Name: "hung",
+			Read: func(device *Device) ([]*output.Reading, error) {
+				<-release
+				return []*output.Reading{{Value: 1}}, nil
+			},
+		},
+	}
+
+	// The hung read is abandoned, so it does not block the read from returning.
+	start := time.Now()
+	s.read(device)
+	assert.Less(t, int64(time.Since(start)), int64(time.Second))
+	assert.Empty(t, s.stateManager.readChan)
+}
+
+func TestScheduler_bulkRead_timeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	handler := &DeviceHandler{
+		Name:        "hung",
+		ReadTimeout: 10 * time.Millisecond,
+		BulkRead: func(devices []*Device) ([]*ReadContext, error) {
+			<-release
+			return []*ReadContext{{Device: devices[0]}}, nil
+		},
+	}
+	s := scheduler{
+		config: &config.PluginSettings{
+			Read: &config.ReadSettings{},
+		},
+		deviceManager: &deviceManager{
+			devices: map[string]*Device{
+				"123": {id: "123", Handler: "hung", handler: handler},
+			},
+		},
+		stateManager: &stateManager{
+			readChan: make(chan *ReadContext, 10),
+		},
+	}
+
+	start := time.Now()
+	s.bulkRead(handler)
+	assert.Less(t, int64(time.Since(start)), int64(time.Second))
+	assert.Empty(t, s.stateManager.readChan)
+}
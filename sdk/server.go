@@ -25,7 +25,9 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/vapor-ware/synse-sdk/sdk/config"
@@ -35,6 +37,7 @@ import (
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
+	grpcMetadata "google.golang.org/grpc/metadata"
 )
 
 const (
@@ -57,6 +60,40 @@ var (
 	ErrSelectorRequiresID  = sdkError.InvalidArgumentErr("selector must specify device id")
 	ErrNoDeviceForSelector = sdkError.NotFoundErr("no device found for specified selector")
 	ErrTransactionNotFound = sdkError.NotFoundErr("transaction not found")
+
+	ErrScheduledWriteSync        = sdkError.InvalidArgumentErr("scheduled writes must be written asynchronously")
+	ErrTransactionNotCancellable = sdkError.InvalidArgumentErr("transaction is not a pending scheduled write")
+
+	ErrStreamOverflow = sdkError.ResourceExhaustedErr("read stream disconnected: client did not keep up with readings")
+)
+
+// Request metadata keys for scheduled writes. The Synse gRPC API messages have
+// no fields to schedule a write or to cancel one, so these are passed as gRPC
+// request metadata instead.
+//
+// A WriteAsync request may set either metadataWriteAt, an RFC3339 timestamp at
+// which its writes are run, or metadataWriteDelay, a duration (e.g. "10m") after
+// which its writes are run. A Transaction request which sets metadataCancel to
+// "true" cancels the scheduled write for the transaction.
+const (
+	metadataWriteAt    = "synse-write-at"
+	metadataWriteDelay = "synse-write-delay"
+	metadataCancel     = "synse-cancel"
+)
+
+// Request metadata key to filter the readings returned by ReadCache. The V3Bounds
+// message has no field to select devices, so a ReadCache request may set this to
+// the ID of each device it wants cached readings for.
+const metadataDevice = "synse-device"
+
+// Request metadata keys to configure the read stream of a ReadStream request. The
+// V3StreamRequest message has no fields for these, so a ReadStream request may set
+// metadataStreamBuffer to the number of readings buffered for its stream and
+// metadataStreamOverflow to its overflow policy, overriding the plugin's stream
+// settings (see config.StreamSettings).
+const (
+	metadataStreamBuffer   = "synse-stream-buffer"
+	metadataStreamOverflow = "synse-stream-overflow"
 )
 
 // server implements the Synse Plugin gRPC server. It is used by the
@@ -162,22 +199,37 @@ func (server *server) start() error {
 	return server.grpc.Serve(listener)
 }
 
-// stop stops the gRPC server from serving and immediately terminates all open
-// connections and listeners.
-func (server *server) stop() {
+// stop gracefully stops the gRPC server. It stops accepting new connections and
+// waits for pending RPCs to finish. If the context is done before that happens,
+// the server is stopped forcefully, terminating all open connections and listeners.
+func (server *server) stop(ctx context.Context) {
 	log.Info("[server] stopping")
-	if server.grpc != nil {
+	if server.grpc == nil {
+		return
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		server.grpc.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		log.Debug("[server] stopped gracefully")
+	case <-ctx.Done():
+		log.WithField("error", ctx.Err()).Warn("[server] graceful stop did not complete, forcing stop")
 		server.grpc.Stop()
 	}
 }
 
 // teardown the server post-run. This is called as a PluginAction on plugin
 // termination.
-func (server *server) teardown() error {
+func (server *server) teardown(ctx context.Context) error {
 	log.Debug("[server] tearing down server")
 
 	// Stop the server.
-	server.stop()
+	server.stop(ctx)
 
 	// Perform any other cleanup.
 	switch t := server.conf.Type; t {
@@ -224,7 +276,7 @@ func (server *server) registerActions(plugin *Plugin) {
 	plugin.RegisterPostRunActions(
 		&PluginAction{
 			Name:   "Cleanup gRPC Server",
-			Action: func(plugin *Plugin) error { return server.teardown() },
+			Action: func(plugin *Plugin) error { return server.teardown(plugin.stopContext()) },
 		},
 	)
 }
@@ -435,7 +487,7 @@ func (server *server) Read(request *synse.V3ReadRequest, stream synse.V3Plugin_R
 
 	for _, device := range devices {
 		rlog.WithField("device", device.id).Debug("[grpc] getting reading(s) for device")
-		readings := server.stateManager.GetReadingsForDevice(device.id)
+		readings := server.stateManager.GetFreshReadingsForDevice(device)
 
 		// Encode and stream the readings back to the client.
 		for _, reading := range readings {
@@ -452,21 +504,31 @@ func (server *server) Read(request *synse.V3ReadRequest, stream synse.V3Plugin_R
 	return nil
 }
 
-// ReadCache gets the cached readings from the plugin. If the plugin is not configured
-// to cache its readings, this will return a dump of the entire current readings state.
+// ReadCache gets the cached readings from the plugin, in the order in which they were
+// read. If the plugin is not configured to cache its readings, this will return a dump
+// of the entire current readings state. If the request metadata names any devices
+// (see metadataDevice), only the readings for those devices are returned.
 //
 // It is the handler for the Synse gRPC V3Plugin service's `ReadCache` RPC method.
 func (server *server) ReadCache(request *synse.V3Bounds, stream synse.V3Plugin_ReadCacheServer) error {
+	devices := devicesFromContext(stream.Context())
 	log.WithFields(log.Fields{
-		"start": request.Start,
-		"end":   request.End,
-		"route": "READCACHE",
+		"start":   request.Start,
+		"end":     request.End,
+		"devices": devices,
+		"route":   "READCACHE",
 	}).Info("[grpc] processing request")
 
+	for _, id := range devices {
+		if server.deviceManager.GetDevice(id) == nil {
+			return ErrNoDeviceForSelector
+		}
+	}
+
 	// Create a channel that will be used to collect the cached readings.
 	readings := make(chan *ReadContext, 128)
 
-	go server.stateManager.GetCachedReadings(request.Start, request.End, readings)
+	go server.stateManager.GetCachedReadings(request.Start, request.End, readings, devices...)
 
 	// Encode and stream the readings back to the client.
 	for r := range readings {
@@ -519,7 +581,12 @@ func (server *server) ReadStream(request *synse.V3StreamRequest, stream synse.V3
 		filter = append(filter, id)
 	}
 
-	s := newReadStream(filter)
+	buffer, overflow, err := server.streamSettings(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	s := newReadStream(filter, buffer, overflow)
 	log.WithFields(log.Fields{
 		"id":     s.id,
 		"filter": s.filter,
@@ -532,9 +599,33 @@ func (server *server) ReadStream(request *synse.V3StreamRequest, stream synse.V3
 	go s.listen()
 
 	log.Info("[server] streaming readings from device manager")
-	for r := range s.readings {
+	for {
+		var r *ReadContext
+		select {
+		case reading, open := <-s.readings:
+			if !open {
+				log.Info("[server] done streaming readings")
+				return nil
+			}
+			r = reading
+		case <-s.done:
+			if s.overflowed {
+				log.WithField("id", s.id).Warn("[server] read stream disconnected on overflow")
+				return ErrStreamOverflow
+			}
+			log.Info("[server] done streaming readings")
+			return nil
+		}
+
 		device := server.deviceManager.GetDevice(r.Device.id)
-		for _, data := range r.Reading {
+
+		// Readings may have gone stale while waiting to be streamed, e.g.
+		// if the client is slow to receive them.
+		readings := r.Reading
+		if device != nil {
+			readings = server.stateManager.applyStaleness(device, readings, r.received, time.Now())
+		}
+		for _, data := range readings {
 			reading := data.Encode()
 			if device != nil {
 				reading.Id = device.id
@@ -546,8 +637,6 @@ func (server *server) ReadStream(request *synse.V3StreamRequest, stream synse.V3
 			}
 		}
 	}
-	log.Info("[server] done streaming readings")
-	return nil
 }
 
 // WriteAsync writes data to the specified plugin device. A transaction ID is returned
@@ -573,7 +662,17 @@ func (server *server) WriteAsync(request *synse.V3WritePayload, stream synse.V3P
 		return ErrNoDeviceForSelector
 	}
 
-	transactions, err := server.scheduler.Write(devices[0], request.Data)
+	at, err := writeTimeFromContext(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	var transactions []*synse.V3WriteTransaction
+	if at.IsZero() {
+		transactions, err = server.scheduler.Write(devices[0], request.Data)
+	} else {
+		transactions, err = server.scheduler.WriteAt(devices[0], request.Data, at)
+	}
 	if err != nil {
 		return err
 	}
@@ -609,6 +708,14 @@ func (server *server) WriteSync(request *synse.V3WritePayload, stream synse.V3Pl
 		return ErrNoDeviceForSelector
 	}
 
+	at, err := writeTimeFromContext(stream.Context())
+	if err != nil {
+		return err
+	}
+	if !at.IsZero() {
+		return ErrScheduledWriteSync
+	}
+
 	transactions, err := server.scheduler.WriteAndWait(devices[0], request.Data)
 	if err != nil {
 		return err
@@ -623,7 +730,8 @@ func (server *server) WriteSync(request *synse.V3WritePayload, stream synse.V3Pl
 }
 
 // Transaction gets the status of an asynchronous write via a transaction ID that
-// associated with that action on write.
+// associated with that action on write. If the request metadata asks for it, a
+// scheduled write which is not yet due is cancelled.
 //
 // It is the handler for the Synse gRPC V3Plugin service's `Transaction` RPC method.
 func (server *server) Transaction(ctx context.Context, request *synse.V3TransactionSelector) (*synse.V3TransactionStatus, error) {
@@ -638,6 +746,13 @@ func (server *server) Transaction(ctx context.Context, request *synse.V3Transact
 		rlog.Error("transaction not found")
 		return nil, ErrTransactionNotFound
 	}
+
+	if cancelFromContext(ctx) {
+		if server.scheduler.cancelScheduledWrite(request.Id) == nil {
+			rlog.Error("transaction can not be cancelled")
+			return nil, ErrTransactionNotCancellable
+		}
+	}
 	return t.encode(), nil
 }
 
@@ -660,3 +775,105 @@ func (server *server) Transactions(request *synse.Empty, stream synse.V3Plugin_T
 	}
 	return nil
 }
+
+// writeTimeFromContext gets the time at which the writes of a write request are
+// scheduled to run from the request metadata. If the writes are not scheduled,
+// the zero time is returned.
+func writeTimeFromContext(ctx context.Context) (time.Time, error) {
+	md, ok := grpcMetadata.FromIncomingContext(ctx)
+	if !ok {
+		return time.Time{}, nil
+	}
+
+	at := md.Get(metadataWriteAt)
+	delay := md.Get(metadataWriteDelay)
+	switch {
+	case len(at) > 0 && len(delay) > 0:
+		return time.Time{}, sdkError.InvalidArgumentErr("only one of %s and %s may be set", metadataWriteAt, metadataWriteDelay)
+
+	case len(at) > 0:
+		t, err := time.Parse(time.RFC3339, at[0])
+		if err != nil {
+			return time.Time{}, sdkError.InvalidArgumentErr("invalid %s: %v", metadataWriteAt, err)
+		}
+		return t, nil
+
+	case len(delay) > 0:
+		d, err := time.ParseDuration(delay[0])
+		if err != nil {
+			return time.Time{}, sdkError.InvalidArgumentErr("invalid %s: %v", metadataWriteDelay, err)
+		}
+		if d < 0 {
+			return time.Time{}, sdkError.InvalidArgumentErr("invalid %s: must not be negative", metadataWriteDelay)
+		}
+		return time.Now().Add(d), nil
+	}
+	return time.Time{}, nil
+}
+
+// cancelFromContext checks whether the request metadata asks for a scheduled
+// write to be cancelled.
+func cancelFromContext(ctx context.Context) bool {
+	md, ok := grpcMetadata.FromIncomingContext(ctx)
+	if !ok {
+		return false
+	}
+	values := md.Get(metadataCancel)
+	return len(values) > 0 && values[0] == "true"
+}
+
+// streamSettings gets the buffer size and overflow policy for the read stream of
+// a ReadStream request. These are the plugin's stream settings, unless overridden
+// by the request metadata.
+func (server *server) streamSettings(ctx context.Context) (int, string, error) {
+	var buffer int
+	var overflow string
+	if manager := server.stateManager; manager != nil && manager.config != nil && manager.config.Stream != nil {
+		buffer = manager.config.Stream.Buffer
+		overflow = manager.config.Stream.Overflow
+	}
+
+	md, ok := grpcMetadata.FromIncomingContext(ctx)
+	if !ok {
+		return buffer, overflow, nil
+	}
+	if values := md.Get(metadataStreamBuffer); len(values) > 0 {
+		b, err := strconv.Atoi(values[0])
+		if err != nil || b <= 0 {
+			return 0, "", sdkError.InvalidArgumentErr("invalid %s: must be a positive integer", metadataStreamBuffer)
+		}
+		buffer = b
+	}
+	if values := md.Get(metadataStreamOverflow); len(values) > 0 {
+		switch values[0] {
+		case overflowDropOldest, overflowDropNewest, overflowDisconnect:
+			overflow = values[0]
+		default:
+			return 0, "", sdkError.InvalidArgumentErr(
+				"invalid %s: must be one of %s, %s, %s",
+				metadataStreamOverflow, overflowDropOldest, overflowDropNewest, overflowDisconnect,
+			)
+		}
+	}
+	return buffer, overflow, nil
+}
+
+// devicesFromContext gets the IDs of the devices named in the request metadata
+// (see metadataDevice). Each metadata value may hold one ID or a comma-separated
+// list of IDs.
+func devicesFromContext(ctx context.Context) []string {
+	md, ok := grpcMetadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	var devices []string
+	for _, value := range md.Get(metadataDevice) {
+		for _, id := range strings.Split(value, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				devices = append(devices, id)
+			}
+		}
+	}
+	return devices
+}
@@ -32,6 +32,7 @@ import (
 	"github.com/vapor-ware/synse-sdk/sdk/output"
 	synse "github.com/vapor-ware/synse-server-grpc/go"
 	"google.golang.org/grpc"
+	grpcMetadata "google.golang.org/grpc/metadata"
 )
 
 func Test_newServer(t *testing.T) {
@@ -183,7 +184,7 @@ func TestServer_teardown(t *testing.T) {
 		grpc: grpc.NewServer(),
 	}
 
-	err := s.teardown()
+	err := s.teardown(context.Background())
 	assert.NoError(t, err)
 }
 
@@ -196,7 +197,7 @@ func TestServer_teardown2(t *testing.T) {
 		grpc: grpc.NewServer(),
 	}
 
-	err := s.teardown()
+	err := s.teardown(context.Background())
 	assert.NoError(t, err)
 }
 
@@ -209,7 +210,7 @@ func TestServer_teardown3(t *testing.T) {
 		grpc: grpc.NewServer(),
 	}
 
-	err := s.teardown()
+	err := s.teardown(context.Background())
 	assert.Error(t, err)
 }
 
@@ -952,6 +953,83 @@ func TestServer_ReadCache(t *testing.T) {
 	assert.Equal(t, 3, len(mock.Results))
 }
 
+func TestServer_ReadCache_devices(t *testing.T) {
+	o := output.Output{
+		Name: "test",
+		Type: "foo",
+	}
+	deviceManager := &deviceManager{
+		devices: map[string]*Device{
+			"12345": {id: "12345"},
+			"67890": {id: "67890"},
+			"abcde": {id: "abcde"},
+		},
+	}
+
+	sm := &stateManager{
+		deviceManager: deviceManager,
+		readingsLock:  &sync.RWMutex{},
+		config: &config.PluginSettings{
+			Cache: &config.CacheSettings{
+				Enabled: true,
+			},
+		},
+		readingsCache: newReadingsCache(time.Minute, 10, 0),
+	}
+	for i, id := range []string{"12345", "67890", "abcde", "12345"} {
+		reading, err := o.MakeReading(i)
+		assert.NoError(t, err)
+		sm.readingsCache.add(&ReadContext{Device: deviceManager.devices[id], Reading: []*output.Reading{reading}}, time.Now())
+	}
+
+	s := server{
+		stateManager:  sm,
+		deviceManager: deviceManager,
+	}
+	mock := test.NewMockReadCachedStream()
+	mock.Ctx = grpcMetadata.NewIncomingContext(context.Background(), grpcMetadata.Pairs(
+		metadataDevice, "12345,abcde",
+	))
+	err := s.ReadCache(&synse.V3Bounds{}, mock)
+
+	assert.NoError(t, err)
+	assert.Len(t, mock.Results, 3)
+	assert.Equal(t, "12345", mock.Results[0].Id)
+	assert.Equal(t, "abcde", mock.Results[1].Id)
+	assert.Equal(t, "12345", mock.Results[2].Id)
+	assert.Equal(t, int64(3), mock.Results[2].GetInt64Value())
+}
+
+func TestServer_ReadCache_unknownDevice(t *testing.T) {
+	deviceManager := &deviceManager{
+		devices: map[string]*Device{
+			"12345": {id: "12345"},
+		},
+	}
+
+	s := server{
+		stateManager: &stateManager{
+			deviceManager: deviceManager,
+			readingsLock:  &sync.RWMutex{},
+			config: &config.PluginSettings{
+				Cache: &config.CacheSettings{
+					Enabled: false,
+				},
+			},
+			readings: map[string][]*output.Reading{},
+		},
+		deviceManager: deviceManager,
+	}
+	mock := test.NewMockReadCachedStream()
+	mock.Ctx = grpcMetadata.NewIncomingContext(context.Background(), grpcMetadata.Pairs(
+		metadataDevice, "unknown",
+	))
+	err := s.ReadCache(&synse.V3Bounds{}, mock)
+
+	assert.Equal(t, ErrNoDeviceForSelector, err)
+	assert.Empty(t, mock.Results)
+}
+
 func TestServer_ReadCache_error(t *testing.T) {
 	o := output.Output{
 		Name: "test",
@@ -1096,6 +1174,92 @@ func TestServer_ReadStream_noDeviceMatchTag(t *testing.T) {
 	assert.Equal(t, 0, len(mock.Results))
 }
 
+func TestServer_ReadStream_invalidStreamSettings(t *testing.T) {
+	s := server{
+		stateManager: &stateManager{
+			config: &config.PluginSettings{
+				Stream: &config.StreamSettings{Buffer: 10, Overflow: "dropOldest"},
+			},
+		},
+		deviceManager: &deviceManager{devices: map[string]*Device{}},
+	}
+
+	for _, pairs := range [][]string{
+		{metadataStreamBuffer, "many"},
+		{metadataStreamBuffer, "0"},
+		{metadataStreamOverflow, "block"},
+	} {
+		mock := test.NewMockReadStreamStream()
+		mock.Ctx = grpcMetadata.NewIncomingContext(context.Background(), grpcMetadata.Pairs(pairs...))
+		err := s.ReadStream(&synse.V3StreamRequest{}, mock)
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "InvalidArgument")
+		assert.Contains(t, err.Error(), pairs[0])
+	}
+}
+
+// blockingReadStream is a ReadStream gRPC stream which blocks on Send until it
+// is released, simulating a slow client.
+type blockingReadStream struct {
+	grpc.ServerStream
+	release chan struct{}
+}
+
+func (mock *blockingReadStream) Context() context.Context {
+	return grpcMetadata.NewIncomingContext(context.Background(), grpcMetadata.Pairs(
+		metadataStreamBuffer, "1",
+		metadataStreamOverflow, "disconnect",
+	))
+}
+
+func (mock *blockingReadStream) Send(*synse.V3Reading) error {
+	<-mock.release
+	return nil
+}
+
+func TestServer_ReadStream_overflowDisconnect(t *testing.T) {
+	sm := &stateManager{
+		config:     &config.PluginSettings{},
+		streams:    map[uuid.UUID]*ReadStream{},
+		streamLock: &sync.Mutex{},
+	}
+	s := server{
+		stateManager:  sm,
+		deviceManager: &deviceManager{devices: map[string]*Device{}},
+	}
+
+	mock := &blockingReadStream{release: make(chan struct{})}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- s.ReadStream(&synse.V3StreamRequest{}, mock)
+	}()
+
+	assert.Eventually(t, func() bool {
+		sm.streamLock.Lock()
+		defer sm.streamLock.Unlock()
+		return len(sm.streams) == 1
+	}, time.Second, time.Millisecond)
+
+	// Readings are dispatched without waiting on the client, until the stream's
+	// buffer overflows and it is disconnected.
+	ctx := &ReadContext{Device: &Device{id: "1"}, Reading: []*output.Reading{{Value: 1}}}
+	assert.Eventually(t, func() bool {
+		sm.dispatchToStreams(ctx)
+		sm.streamLock.Lock()
+		defer sm.streamLock.Unlock()
+		return len(sm.streams) == 0
+	}, time.Second, time.Millisecond)
+
+	close(mock.release)
+	select {
+	case err := <-errs:
+		assert.Equal(t, ErrStreamOverflow, err)
+	case <-time.After(time.Second):
+		t.Fatal("read stream was not disconnected")
+	}
+}
+
 func TestServer_WriteAsync(t *testing.T) {
 	handler := DeviceHandler{
 		Write: func(device *Device, data *WriteData) error {
@@ -1576,6 +1740,161 @@ func TestServer_Transaction_oneIDNotExists(t *testing.T) {
 	assert.Nil(t, resp)
 }
 
+func TestServer_WriteAsync_scheduled(t *testing.T) {
+	device := newWritableTestDevice("1234")
+	sched := newTestScheduler(device)
+	sched.deviceManager.aliasCache = NewAliasCache()
+	s := server{
+		deviceManager: sched.deviceManager,
+		stateManager:  sched.stateManager,
+		scheduler:     sched,
+	}
+
+	req := &synse.V3WritePayload{
+		Selector: &synse.V3DeviceSelector{Id: "1234"},
+		Data:     []*synse.V3WriteData{{Action: "foo"}},
+	}
+	mock := test.NewMockWriteAsyncStream()
+	mock.Ctx = grpcMetadata.NewIncomingContext(context.Background(), grpcMetadata.Pairs(metadataWriteDelay, "10m"))
+	err := s.WriteAsync(req, mock)
+
+	assert.NoError(t, err)
+	assert.Len(t, mock.Results, 1)
+	assert.Empty(t, sched.writeChan)
+	assert.Len(t, scheduledIDs(sched.schedule), 1)
+}
+
+func TestServer_WriteAsync_invalidSchedule(t *testing.T) {
+	device := newWritableTestDevice("1234")
+	sched := newTestScheduler(device)
+	sched.deviceManager.aliasCache = NewAliasCache()
+	s := server{
+		deviceManager: sched.deviceManager,
+		stateManager:  sched.stateManager,
+		scheduler:     sched,
+	}
+
+	req := &synse.V3WritePayload{
+		Selector: &synse.V3DeviceSelector{Id: "1234"},
+		Data:     []*synse.V3WriteData{{Action: "foo"}},
+	}
+	mock := test.NewMockWriteAsyncStream()
+	mock.Ctx = grpcMetadata.NewIncomingContext(context.Background(), grpcMetadata.Pairs(metadataWriteAt, "02:00"))
+	err := s.WriteAsync(req, mock)
+
+	assert.Error(t, err)
+	assert.Empty(t, mock.Results)
+	assert.Empty(t, sched.writeChan)
+	assert.Empty(t, scheduledIDs(sched.schedule))
+}
+
+func TestServer_WriteSync_scheduled(t *testing.T) {
+	device := newWritableTestDevice("1234")
+	sched := newTestScheduler(device)
+	sched.deviceManager.aliasCache = NewAliasCache()
+	s := server{
+		deviceManager: sched.deviceManager,
+		stateManager:  sched.stateManager,
+		scheduler:     sched,
+	}
+
+	req := &synse.V3WritePayload{
+		Selector: &synse.V3DeviceSelector{Id: "1234"},
+		Data:     []*synse.V3WriteData{{Action: "foo"}},
+	}
+	mock := test.NewMockWriteSyncStream()
+	mock.Ctx = grpcMetadata.NewIncomingContext(context.Background(), grpcMetadata.Pairs(metadataWriteDelay, "10m"))
+	err := s.WriteSync(req, mock)
+
+	assert.Equal(t, ErrScheduledWriteSync, err)
+	assert.Empty(t, mock.Results)
+	assert.Empty(t, scheduledIDs(sched.schedule))
+}
+
+func TestServer_Transaction_cancel(t *testing.T) {
+	device := newWritableTestDevice("1234")
+	sched := newTestScheduler(device)
+	s := server{
+		stateManager: sched.stateManager,
+		scheduler:    sched,
+	}
+
+	transactions, err := sched.WriteAt(device, []*synse.V3WriteData{{Action: "foo"}}, time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+
+	ctx := grpcMetadata.NewIncomingContext(context.Background(), grpcMetadata.Pairs(metadataCancel, "true"))
+	resp, err := s.Transaction(ctx, &synse.V3TransactionSelector{Id: transactions[0].Id})
+
+	assert.NoError(t, err)
+	assert.Equal(t, synse.WriteStatus_ERROR, resp.Status)
+	assert.Equal(t, msgWriteScheduleCancelled, resp.Message)
+	assert.Empty(t, scheduledIDs(sched.schedule))
+}
+
+func TestServer_Transaction_cancelNotScheduled(t *testing.T) {
+	sched := newTestScheduler()
+	s := server{
+		stateManager: sched.stateManager,
+		scheduler:    sched,
+	}
+
+	txn, err := s.stateManager.newTransaction(1*time.Minute, "")
+	assert.NoError(t, err)
+
+	ctx := grpcMetadata.NewIncomingContext(context.Background(), grpcMetadata.Pairs(metadataCancel, "true"))
+	resp, err := s.Transaction(ctx, &synse.V3TransactionSelector{Id: txn.id})
+
+	assert.Equal(t, ErrTransactionNotCancellable, err)
+	assert.Nil(t, resp)
+	assert.Equal(t, statusPending, txn.status)
+}
+
+func Test_writeTimeFromContext(t *testing.T) {
+	at := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	cases := []struct {
+		md       grpcMetadata.MD
+		expected time.Time
+		err      bool
+	}{
+		{md: nil, expected: time.Time{}},
+		{md: grpcMetadata.Pairs("other", "value"), expected: time.Time{}},
+		{md: grpcMetadata.Pairs(metadataWriteAt, at.Format(time.RFC3339)), expected: at},
+		{md: grpcMetadata.Pairs(metadataWriteAt, "02:00"), err: true},
+		{md: grpcMetadata.Pairs(metadataWriteDelay, "10x"), err: true},
+		{md: grpcMetadata.Pairs(metadataWriteDelay, "-1m"), err: true},
+		{md: grpcMetadata.Pairs(metadataWriteAt, at.Format(time.RFC3339), metadataWriteDelay, "1m"), err: true},
+	}
+
+	for i, c := range cases {
+		ctx := context.Background()
+		if c.md != nil {
+			ctx = grpcMetadata.NewIncomingContext(ctx, c.md)
+		}
+		actual, err := writeTimeFromContext(ctx)
+		if c.err {
+			assert.Error(t, err, i)
+			continue
+		}
+		assert.NoError(t, err, i)
+		assert.True(t, c.expected.Equal(actual), i)
+	}
+}
+
+func Test_writeTimeFromContext_delay(t *testing.T) {
+	ctx := grpcMetadata.NewIncomingContext(context.Background(), grpcMetadata.Pairs(metadataWriteDelay, "10m"))
+	actual, err := writeTimeFromContext(ctx)
+
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(10*time.Minute), actual, time.Second)
+}
+
+func Test_cancelFromContext(t *testing.T) {
+	assert.False(t, cancelFromContext(context.Background()))
+	assert.False(t, cancelFromContext(grpcMetadata.NewIncomingContext(context.Background(), grpcMetadata.Pairs(metadataCancel, "false"))))
+	assert.True(t, cancelFromContext(grpcMetadata.NewIncomingContext(context.Background(), grpcMetadata.Pairs(metadataCancel, "true"))))
+}
+
 func TestServer_Transactions(t *testing.T) {
 	s := server{
 		stateManager: &stateManager{
@@ -0,0 +1,186 @@
+// Synse SDK
+// Copyright (c) 2017-2020 Vapor IO
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package sdk
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/vapor-ware/synse-sdk/sdk/output"
+)
+
+// Actions for stale device readings (see config.StalenessSettings).
+const (
+	stalenessMark = "mark"
+	stalenessDrop = "drop"
+)
+
+const (
+	// defaultStalenessMultiple is the multiple of a device's expected read
+	// interval after which its readings are stale, if not configured.
+	defaultStalenessMultiple = 3
+
+	// staleContextKey is the reading context key which marks a stale reading.
+	// Like the device metadata keys, it is namespaced by metadataPrefix so it
+	// does not clash with the keys of the device context.
+	staleContextKey = metadataPrefix + "stale"
+)
+
+// readIntervalFor gets the interval at which a device should be read. This is the
+// device's own read interval, if set, otherwise its handler's read interval, if
+// set, otherwise the given global read interval. Devices which are read in bulk
+// are read on their handler's read interval, so their own read interval does
+// not apply.
+func readIntervalFor(device *Device, global time.Duration) time.Duration {
+	if device.ReadInterval > 0 && !device.handler.CanBulkRead() {
+		return device.ReadInterval
+	}
+	if device.handler != nil && device.handler.ReadInterval > 0 {
+		return device.handler.ReadInterval
+	}
+	return global
+}
+
+// staleAfter gets the age after which a device's readings are stale. This is a
+// multiple of the interval at which new readings for the device are expected:
+// its read interval (its handler's, if it is read in bulk) or, while adaptive
+// polling has backed off, its current read interval. If the device has no staleness settings, or is read continuously,
+// its readings are never stale and false is returned.
+func (manager *stateManager) staleAfter(device *Device) (time.Duration, bool) {
+	if device == nil || device.Staleness == nil {
+		return 0, false
+	}
+
+	var global time.Duration
+	if manager.config != nil && manager.config.Read != nil {
+		global = manager.config.Read.Interval
+	}
+	interval := readIntervalFor(device, global)
+	if current := device.poller.getCurrent(); current > interval {
+		interval = current
+	}
+	if interval <= 0 {
+		return 0, false
+	}
+
+	multiple := device.Staleness.Multiple
+	if multiple <= 1 {
+		multiple = defaultStalenessMultiple
+	}
+	return time.Duration(float64(interval) * multiple), true
+}
+
+// isStale checks whether readings for a device which were received at the given
+// time are stale. If the time the readings were received is not known, they are
+// not considered stale.
+func (manager *stateManager) isStale(device *Device, received, now time.Time) bool {
+	if received.IsZero() {
+		return false
+	}
+	threshold, ok := manager.staleAfter(device)
+	return ok && now.Sub(received) > threshold
+}
+
+// applyStaleness applies a device's staleness policy to its readings, which were
+// received at the given time. Fresh readings are returned as they are. Stale
+// readings are either dropped, in which case nil is returned, or marked via their
+// context. Stale readings are copied to be marked, so the readings held by the
+// state manager are not modified.
+func (manager *stateManager) applyStaleness(device *Device, readings []*output.Reading, received, now time.Time) []*output.Reading {
+	if len(readings) == 0 || !manager.isStale(device, received, now) {
+		return readings
+	}
+	if device.Staleness.Action == stalenessDrop {
+		return nil
+	}
+
+	marked := make([]*output.Reading, len(readings))
+	for i, r := range readings {
+		if r == nil {
+			continue
+		}
+		stale := *r
+		stale.Context = make(map[string]string, len(r.Context)+1)
+		for k, v := range r.Context {
+			stale.Context[k] = v
+		}
+		stale.Context[staleContextKey] = "true"
+		marked[i] = &stale
+	}
+	return marked
+}
+
+// GetFreshReadingsForDevice gets the current reading(s) for the specified device
+// from the StateManager, with the device's staleness policy applied.
+func (manager *stateManager) GetFreshReadingsForDevice(device *Device) []*output.Reading {
+	manager.readingsLock.RLock()
+	readings := manager.readings[device.id]
+	received := manager.readingTimes[device.id]
+	manager.readingsLock.RUnlock()
+
+	return manager.applyStaleness(device, readings, received, time.Now())
+}
+
+// staleDevices gets the IDs of the devices whose readings are stale, in sorted
+// order. A device which has not been read at all is stale once the time since
+// the state manager started exceeds its staleness threshold.
+func (manager *stateManager) staleDevices(now time.Time) []string {
+	if manager.deviceManager == nil {
+		return nil
+	}
+
+	manager.readingsLock.RLock()
+	defer manager.readingsLock.RUnlock()
+
+	var stale []string
+	for _, device := range manager.deviceManager.GetAllDevices() {
+		received, ok := manager.readingTimes[device.id]
+		if !ok {
+			if manager.started.IsZero() {
+				continue
+			}
+			received = manager.started
+		}
+		if manager.isStale(device, received, now) {
+			stale = append(stale, device.id)
+		}
+	}
+	sort.Strings(stale)
+	return stale
+}
+
+// checkStaleness is the health check for stale devices. It fails if the readings
+// for any devices with a staleness policy are stale.
+func (manager *stateManager) checkStaleness() error {
+	stale := manager.staleDevices(time.Now())
+	if len(stale) == 0 {
+		return nil
+	}
+
+	const maxListed = 10
+	listed := stale
+	if len(listed) > maxListed {
+		listed = listed[:maxListed]
+	}
+	msg := strings.Join(listed, ", ")
+	if len(stale) > maxListed {
+		msg += fmt.Sprintf(" (and %d more)", len(stale)-maxListed)
+	}
+	return fmt.Errorf("%d device(s) have stale readings: %s", len(stale), msg)
+}
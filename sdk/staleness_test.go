@@ -0,0 +1,215 @@
+// Synse SDK
+// Copyright (c) 2017-2020 Vapor IO
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package sdk
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vapor-ware/synse-sdk/sdk/config"
+	"github.com/vapor-ware/synse-sdk/sdk/health"
+	"github.com/vapor-ware/synse-sdk/sdk/output"
+)
+
+func TestStateManager_staleAfter(t *testing.T) {
+	sm := newTestStateManager()
+
+	tests := []struct {
+		name     string
+		device   *Device
+		expected time.Duration
+		ok       bool
+	}{
+		{
+			name:   "no staleness settings",
+			device: &Device{},
+		},
+		{
+			name:     "default multiple",
+			device:   &Device{Staleness: &config.StalenessSettings{}},
+			expected: 3 * time.Second,
+			ok:       true,
+		},
+		{
+			name:     "device read interval",
+			device:   &Device{ReadInterval: 2 * time.Second, Staleness: &config.StalenessSettings{Multiple: 2.5}},
+			expected: 5 * time.Second,
+			ok:       true,
+		},
+		{
+			name: "handler read interval",
+			device: &Device{
+				handler:   &DeviceHandler{ReadInterval: 10 * time.Second},
+				Staleness: &config.StalenessSettings{Multiple: 2},
+			},
+			expected: 20 * time.Second,
+			ok:       true,
+		},
+		{
+			name: "bulk read handler read interval",
+			device: &Device{
+				ReadInterval: 2 * time.Second,
+				handler:      &DeviceHandler{ReadInterval: 10 * time.Second, BulkRead: func([]*Device) ([]*ReadContext, error) { return nil, nil }},
+				Staleness:    &config.StalenessSettings{Multiple: 2},
+			},
+			expected: 20 * time.Second,
+			ok:       true,
+		},
+		{
+			name: "bulk read global read interval",
+			device: &Device{
+				ReadInterval: 2 * time.Second,
+				handler:      &DeviceHandler{BulkRead: func([]*Device) ([]*ReadContext, error) { return nil, nil }},
+				Staleness:    &config.StalenessSettings{Multiple: 2},
+			},
+			expected: 2 * time.Second,
+			ok:       true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			threshold, ok := sm.staleAfter(test.device)
+			assert.Equal(t, test.ok, ok)
+			assert.Equal(t, test.expected, threshold)
+		})
+	}
+}
+
+func TestStateManager_staleAfter_adaptivePolling(t *testing.T) {
+	sm := newTestStateManager()
+	device := &Device{
+		AdaptivePolling: &config.AdaptivePollingSettings{MaxInterval: time.Minute},
+		Staleness:       &config.StalenessSettings{Multiple: 2},
+	}
+	device.poller.start(time.Second)
+	device.poller.observe([]*output.Reading{{Value: 1}}, device.AdaptivePolling)
+	device.poller.observe([]*output.Reading{{Value: 1}}, device.AdaptivePolling)
+
+	// While polling has backed off, readings are expected less often.
+	threshold, ok := sm.staleAfter(device)
+	assert.True(t, ok)
+	assert.Equal(t, 2*device.poller.getCurrent(), threshold)
+	assert.True(t, threshold > 2*time.Second)
+}
+
+func TestStateManager_staleAfter_readContinuously(t *testing.T) {
+	sm := newTestStateManager()
+	sm.config.Read.Interval = 0
+
+	_, ok := sm.staleAfter(&Device{Staleness: &config.StalenessSettings{}})
+	assert.False(t, ok)
+}
+
+func TestStateManager_applyStaleness(t *testing.T) {
+	sm := newTestStateManager()
+	now := time.Now()
+	readings := []*output.Reading{{Value: 1, Context: map[string]string{"zone": "a"}}}
+
+	marking := &Device{Staleness: &config.StalenessSettings{Action: "mark"}}
+	dropping := &Device{Staleness: &config.StalenessSettings{Action: "drop"}}
+
+	// Fresh readings are returned as they are.
+	assert.Equal(t, readings, sm.applyStaleness(marking, readings, now.Add(-2*time.Second), now))
+	assert.Equal(t, readings, sm.applyStaleness(dropping, readings, now.Add(-2*time.Second), now))
+
+	// Readings whose received time is not known are not stale.
+	assert.Equal(t, readings, sm.applyStaleness(marking, readings, time.Time{}, now))
+
+	// Stale readings are marked, without modifying the original readings.
+	marked := sm.applyStaleness(marking, readings, now.Add(-time.Minute), now)
+	assert.Len(t, marked, 1)
+	assert.Equal(t, 1, marked[0].Value)
+	assert.Equal(t, map[string]string{"zone": "a", "synse.stale": "true"}, marked[0].Context)
+	assert.Equal(t, map[string]string{"zone": "a"}, readings[0].Context)
+
+	// Stale readings are dropped.
+	assert.Nil(t, sm.applyStaleness(dropping, readings, now.Add(-time.Minute), now))
+}
+
+func TestStateManager_GetFreshReadingsForDevice(t *testing.T) {
+	device := &Device{id: "1", Staleness: &config.StalenessSettings{Action: "drop"}}
+	sm := newTestStateManager(device)
+
+	sm.setReadings("1", []*output.Reading{{Value: 1}}, time.Now())
+	assert.Len(t, sm.GetFreshReadingsForDevice(device), 1)
+
+	sm.setReadings("1", []*output.Reading{{Value: 1}}, time.Now().Add(-time.Minute))
+	assert.Empty(t, sm.GetFreshReadingsForDevice(device))
+
+	// The current readings are kept.
+	assert.Len(t, sm.GetReadingsForDevice("1"), 1)
+}
+
+func TestStateManager_staleDevices(t *testing.T) {
+	sm := newTestStateManager(
+		&Device{id: "fresh", Staleness: &config.StalenessSettings{}},
+		&Device{id: "stale", Staleness: &config.StalenessSettings{}},
+		&Device{id: "unread", Staleness: &config.StalenessSettings{}},
+		&Device{id: "no-policy"},
+	)
+	now := time.Now()
+	sm.setReadings("fresh", nil, now)
+	sm.setReadings("stale", nil, now.Add(-time.Minute))
+	sm.setReadings("no-policy", nil, now.Add(-time.Minute))
+
+	// Until the state manager is started, devices which have not been read
+	// are not stale.
+	assert.Equal(t, []string{"stale"}, sm.staleDevices(now))
+
+	sm.started = now.Add(-time.Minute)
+	assert.Equal(t, []string{"stale", "unread"}, sm.staleDevices(now))
+
+	sm.removeReadings("stale")
+	sm.started = now
+	assert.Empty(t, sm.staleDevices(now))
+}
+
+func TestStateManager_checkStaleness(t *testing.T) {
+	device := &Device{id: "1", Staleness: &config.StalenessSettings{}}
+	sm := newTestStateManager(device)
+	plugin := &Plugin{
+		health: health.NewManager(&config.HealthSettings{Checks: &config.HealthCheckSettings{}}),
+	}
+	assert.NoError(t, sm.healthChecks(plugin))
+
+	sm.setReadings("1", nil, time.Now())
+	assert.NoError(t, sm.checkStaleness())
+
+	sm.setReadings("1", nil, time.Now().Add(-time.Minute))
+	err := sm.checkStaleness()
+	assert.Error(t, err)
+	assert.Equal(t, "1 device(s) have stale readings: 1", err.Error())
+}
+
+func TestStateManager_updateReadings_receivedTime(t *testing.T) {
+	sm := newTestStateManager()
+	sm.config.Cache = &config.CacheSettings{Enabled: false}
+	sm.readChan = make(chan *ReadContext)
+	sm.streamLock = &sync.Mutex{}
+	go sm.updateReadings()
+
+	ctx := &ReadContext{Device: &Device{id: "1"}, Reading: []*output.Reading{{Value: 1}}}
+	sm.readChan <- ctx
+
+	assert.Eventually(t, func() bool {
+		sm.readingsLock.RLock()
+		defer sm.readingsLock.RUnlock()
+		return !sm.readingTimes["1"].IsZero()
+	}, time.Second, 10*time.Millisecond)
+}
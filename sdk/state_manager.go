@@ -36,12 +36,27 @@ type stateManager struct {
 	deviceManager *deviceManager
 	readChan      chan *ReadContext
 	readings      map[string][]*output.Reading
-	readingsCache *cache.Cache
+	readingTimes  map[string]time.Time
+	readingsCache *readingsCache
 	readingsLock  *sync.RWMutex
 	transactions  *cache.Cache
 
+	// started is the time the state manager was started. Devices which have
+	// not yet been read are considered stale relative to it.
+	started time.Time
+
+	// history is the on-disk readings history, if enabled. Readings restored
+	// from it have their outputs looked up in the outputs registry.
+	history *readingsHistory
+	outputs *output.Registry
+
 	streams    map[uuid.UUID]*ReadStream
 	streamLock *sync.Mutex
+
+	// stop is a channel used to signal that the state manager's background
+	// loops should stop. It is closed once, via Stop.
+	stop     chan struct{}
+	stopOnce sync.Once
 }
 
 // newStateManager creates a new instance of the stateManager.
@@ -53,10 +68,14 @@ func newStateManager(conf *config.PluginSettings, deviceManager *deviceManager)
 		panic("state manager requires a non-nil device manager")
 	}
 
-	var readingsCache *cache.Cache
+	var readingsCache *readingsCache
 	if conf.Cache.Enabled {
-		log.WithField("ttl", conf.Cache.TTL).Debug("[state manager] readings cache enabled")
-		readingsCache = cache.New(conf.Cache.TTL, conf.Cache.TTL*2)
+		log.WithFields(log.Fields{
+			"ttl":      conf.Cache.TTL,
+			"depth":    conf.Cache.Depth,
+			"maxBytes": conf.Cache.MaxBytes,
+		}).Debug("[state manager] readings cache enabled")
+		readingsCache = newReadingsCache(conf.Cache.TTL, conf.Cache.Depth, conf.Cache.MaxBytes)
 	}
 
 	return &stateManager{
@@ -64,6 +83,7 @@ func newStateManager(conf *config.PluginSettings, deviceManager *deviceManager)
 		deviceManager: deviceManager,
 		readChan:      make(chan *ReadContext, conf.Read.QueueSize),
 		readings:      make(map[string][]*output.Reading),
+		readingTimes:  make(map[string]time.Time),
 		transactions: cache.New(
 			conf.Transaction.TTL,
 			conf.Transaction.TTL*2,
@@ -72,13 +92,30 @@ func newStateManager(conf *config.PluginSettings, deviceManager *deviceManager)
 		readingsLock:  &sync.RWMutex{},
 		streams:       make(map[uuid.UUID]*ReadStream),
 		streamLock:    &sync.Mutex{},
+		stop:          make(chan struct{}),
 	}
 }
 
 // Start starts the StateManager.
 func (manager *stateManager) Start() {
 	log.Info("[state manager] starting")
+	manager.readingsLock.Lock()
+	manager.started = time.Now()
+	manager.readingsLock.Unlock()
+
 	go manager.updateReadings()
+	if manager.readingsCache != nil {
+		go manager.sweepReadingsCache()
+	}
+}
+
+// Stop stops the state manager's background loops. It is safe to call Stop
+// more than once.
+func (manager *stateManager) Stop() {
+	manager.stopOnce.Do(func() {
+		log.Info("[state manager] stopping")
+		close(manager.stop)
+	})
 }
 
 // addStream adds a new stream for the stateManager to send reading data to.
@@ -108,9 +145,96 @@ func (manager *stateManager) registerActions(plugin *Plugin) {
 			Name:   "Register default state manager health checks",
 			Action: manager.healthChecks,
 		},
+		&PluginAction{
+			Name:   "Open readings history",
+			Action: manager.openHistory,
+		},
+	)
+
+	// Register post-run actions.
+	plugin.RegisterPostRunActions(
+		&PluginAction{
+			Name:   "Stop state manager",
+			Action: func(p *Plugin) error { manager.Stop(); return nil },
+		},
+		&PluginAction{
+			Name:   "Close read streams",
+			Action: func(p *Plugin) error { manager.closeStreams(); return nil },
+		},
+		&PluginAction{
+			Name:   "Close readings history",
+			Action: func(p *Plugin) error { return manager.closeHistory() },
+		},
 	)
 }
 
+// openHistory opens the on-disk readings history, if the plugin is configured to
+// keep one, and restores the most recent readings for each device from it. This
+// ensures a device's last known readings are available right after a restart,
+// before the device is next read.
+func (manager *stateManager) openHistory(plugin *Plugin) error {
+	if manager.config.Cache == nil || manager.config.Cache.History == nil || !manager.config.Cache.History.Enabled {
+		return nil
+	}
+	conf := manager.config.Cache.History
+
+	history, err := openReadingsHistory(conf)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"dir":   conf.Dir,
+			"error": err,
+		}).Error("[state manager] failed to open readings history")
+		return err
+	}
+	manager.history = history
+	manager.outputs = plugin.outputRegistry()
+
+	latest := history.getLatest()
+
+	manager.readingsLock.Lock()
+	defer manager.readingsLock.Unlock()
+	for id, record := range latest {
+		if _, exists := manager.readings[id]; exists {
+			continue
+		}
+		ctx, err := record.readContext(manager.outputs)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"device": id,
+				"error":  err,
+			}).Warn("[state manager] skipping invalid history record")
+			continue
+		}
+		manager.setReadings(id, ctx.Reading, record.Time)
+	}
+	log.WithFields(log.Fields{
+		"dir":     conf.Dir,
+		"devices": len(latest),
+	}).Info("[state manager] restored readings from history")
+	return nil
+}
+
+// closeHistory closes the on-disk readings history, if it is open.
+func (manager *stateManager) closeHistory() error {
+	if manager.history == nil {
+		return nil
+	}
+	return manager.history.close()
+}
+
+// closeStreams removes and closes all streams connected to the stateManager. This
+// ends any active ReadStream requests so the gRPC server can stop gracefully.
+func (manager *stateManager) closeStreams() {
+	manager.streamLock.Lock()
+	defer manager.streamLock.Unlock()
+
+	for id, stream := range manager.streams {
+		log.WithField("id", id).Debug("[state manager] closing stream")
+		delete(manager.streams, id)
+		stream.close()
+	}
+}
+
 // healthChecks defines and registers the state manager's default health checks with
 // the plugin.
 func (manager *stateManager) healthChecks(plugin *Plugin) error {
@@ -126,7 +250,12 @@ func (manager *stateManager) healthChecks(plugin *Plugin) error {
 		return nil
 	})
 	plugin.health.RegisterDefault(rqh)
-	return nil
+
+	// Devices with stale readings are surfaced via a health check. This is not
+	// a default check, since staleness is only checked for devices which are
+	// configured with a staleness policy.
+	sh := health.NewPeriodicHealthCheck("device staleness", 30*time.Second, manager.checkStaleness)
+	return plugin.health.Register(sh)
 }
 
 func (manager *stateManager) updateReadings() {
@@ -137,46 +266,107 @@ func (manager *stateManager) updateReadings() {
 		id := reading.Device.id
 		readings := reading.Reading
 
-		// Update the reading state.
+		// Update the reading state. Readings for devices which have been removed
+		// are discarded; the check is made under the readings lock so a reading
+		// can not be stored after the device's readings were removed.
 		manager.readingsLock.Lock()
-		manager.readings[id] = readings
+		if reading.Device != nil && reading.Device.isRemoved() {
+			manager.readingsLock.Unlock()
+			log.WithField("device", id).Debug("[state manager] discarding reading for removed device")
+			continue
+		}
+		reading.received = time.Now()
+		manager.setReadings(id, readings, reading.received)
+
+		// Readings within the device's deadband only update the current readings;
+		// they are not cached, recorded or streamed.
+		if !reading.Device.deliverReadings(readings, reading.received) {
+			manager.readingsLock.Unlock()
+			continue
+		}
+
+		// Update the local readings cache, if enabled.
+		manager.addReadingToCache(reading)
 		manager.readingsLock.Unlock()
 
+		// Record the reading in the on-disk history, if enabled.
+		manager.addReadingToHistory(reading)
+
 		// Dispatch the reading to all connected streams.
 		manager.dispatchToStreams(reading)
+	}
+}
 
-		// Update the local readings cache, if enabled.
-		manager.addReadingToCache(reading)
+// setReadings sets the current readings for a device, along with the time they
+// were received. The readings lock should be held when this is called.
+func (manager *stateManager) setReadings(id string, readings []*output.Reading, received time.Time) {
+	manager.readings[id] = readings
+	if manager.readingTimes == nil {
+		manager.readingTimes = make(map[string]time.Time)
 	}
+	manager.readingTimes[id] = received
 }
 
 // dispatchToStreams dispatches the given reading to all streams currently
-// connected to the state manager.
+// connected to the state manager. This does not wait on slow streams: a stream
+// whose buffer is full either drops readings or is disconnected, in which case
+// it is removed from the state manager.
 func (manager *stateManager) dispatchToStreams(reading *ReadContext) {
 	manager.streamLock.Lock()
 	defer manager.streamLock.Unlock()
 
-	for _, stream := range manager.streams {
-		stream.stream <- reading
+	for id, stream := range manager.streams {
+		if !stream.offer(reading) {
+			delete(manager.streams, id)
+		}
 	}
 }
 
 // addReadingToCache adds the given reading to the readingsCache, if the plugin
 // is configured to enable read caching.
 func (manager *stateManager) addReadingToCache(ctx *ReadContext) {
-	if manager.config.Cache.Enabled {
-		now := utils.GetCurrentTime()
-		item, exists := manager.readingsCache.Get(now)
-		if !exists {
-			newCtxs := []*ReadContext{ctx}
-			manager.readingsCache.Set(now, &newCtxs, cache.DefaultExpiration)
-		} else {
-			cached := item.(*[]*ReadContext)
-			*cached = append(*cached, ctx)
+	if manager.config.Cache.Enabled && manager.readingsCache != nil {
+		manager.readingsCache.add(ctx, time.Now())
+	}
+}
+
+// sweepReadingsCache periodically removes the readings which have exceeded the
+// TTL from the readings cache, so the readings of devices which are no longer
+// read do not stay in the cache. The cache is swept once per TTL, until the
+// state manager is stopped.
+func (manager *stateManager) sweepReadingsCache() {
+	if manager.readingsCache.ttl <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(manager.readingsCache.ttl)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-manager.stop:
+			log.Debug("[state manager] stop channel closed, terminating readings cache sweep")
+			return
+		case now := <-ticker.C:
+			if removed := manager.readingsCache.sweep(now); removed > 0 {
+				log.WithField("readings", removed).Debug("[state manager] swept expired readings from cache")
+			}
 		}
 	}
 }
 
+// addReadingToHistory queues the given reading to be appended to the on-disk
+// readings history, if the plugin is configured to keep one. The reading is
+// written in the background, so this does not wait on the disk.
+func (manager *stateManager) addReadingToHistory(ctx *ReadContext) {
+	if manager.history == nil {
+		return
+	}
+	if !manager.history.enqueue(ctx, time.Now()) {
+		log.WithField("device", ctx.Device.GetID()).Warn("[state manager] dropped reading from history: history queue is full or closed")
+	}
+}
+
 // GetReadingsForDevice gets the current reading(s) for the specified device from
 // the StateManager.
 func (manager *stateManager) GetReadingsForDevice(device string) []*output.Reading {
@@ -201,11 +391,31 @@ func (manager *stateManager) GetOutputsForDevice(device string) []*output.Output
 	return outputs
 }
 
-// GetCachedReadings gets the readings in the StateManager's readingsCache. If the plugin
-// is not configured to maintain a readings cache, this will just return a dump of the
-// current reading state. Once the data has been passed through the given channel, this
-// function will close the channel prior to returning.
-func (manager *stateManager) GetCachedReadings(start, end string, readings chan *ReadContext) {
+// removeReadings removes the current readings for the given devices. This is used
+// when devices are removed or replaced so that stale readings are not served.
+func (manager *stateManager) removeReadings(devices ...string) {
+	manager.readingsLock.Lock()
+	defer manager.readingsLock.Unlock()
+
+	for _, id := range devices {
+		delete(manager.readings, id)
+		delete(manager.readingTimes, id)
+	}
+
+	if manager.readingsCache != nil {
+		manager.readingsCache.remove(devices...)
+	}
+}
+
+// GetCachedReadings gets the readings in the StateManager's readingsCache, in the
+// order in which they were read. If the plugin keeps an on-disk readings history,
+// the readings are instead taken from the history, so readings from before the
+// plugin was last restarted are included. If any devices are given, only the readings
+// for those devices are returned. If the plugin is not configured to maintain a
+// readings cache or history, this will just return a dump of the current reading
+// state. Once the data has been passed through the given channel, this function
+// will close the channel prior to returning.
+func (manager *stateManager) GetCachedReadings(start, end string, readings chan *ReadContext, devices ...string) {
 	// Whether we exit the function normally or by error, we want to close the channel
 	// when we complete to signal to the reader that we are done here.
 	defer close(readings)
@@ -228,53 +438,62 @@ func (manager *stateManager) GetCachedReadings(start, end string, readings chan
 		return
 	}
 
-	// If read caching is disabled, dump the current state; otherwise, dump the
-	// reading cache contents.
-	if manager.config.Cache.Enabled {
-		manager.dumpCachedReadings(startTime, endTime, readings)
-	} else {
-		manager.dumpCurrentReadings(readings)
+	// If a readings history is kept, dump its contents. Otherwise, if read caching
+	// is disabled, dump the current state; if enabled, dump the reading cache contents.
+	switch {
+	case manager.history != nil:
+		manager.dumpHistoryReadings(startTime, endTime, readings, devices...)
+	case manager.config.Cache.Enabled && manager.readingsCache != nil:
+		manager.dumpCachedReadings(startTime, endTime, readings, devices...)
+	default:
+		manager.dumpCurrentReadings(readings, devices...)
 	}
-
 }
 
-// dumpCachedReadings dumps the cached reading
-func (manager *stateManager) dumpCachedReadings(start, end time.Time, readings chan *ReadContext) {
-	for timestamp, item := range manager.readingsCache.Items() {
-		ts, err := utils.ParseRFC3339(timestamp)
-		if err != nil {
-			// If we can't parse the timestamp from the cache, an error is logged
-			// and we move on. We should always be using RFC3339 formatted timestamps
-			// as keys when things get inserted, so if we find something in there that
-			// does not conform, it means something is wrong and we should not use it
-			// (data corruption, something added incorrectly, ...)
-			log.Error("[cache] failed to parse RFC3339 timestamp from cache - ignoring")
-			continue
-		}
+// dumpCachedReadings dumps the cached readings within the given bounds out to the
+// provided channel, in the order in which they were read.
+func (manager *stateManager) dumpCachedReadings(start, end time.Time, readings chan *ReadContext, devices ...string) {
+	for _, ctx := range manager.readingsCache.query(devices, start, inclusiveEnd(end), time.Now()) {
+		readings <- ctx
+	}
+}
 
-		// If we have a start bound, check that the cached items are
-		// within that bound. If not, ignore them.
-		if !start.IsZero() && ts.Before(start) {
-			continue
-		}
+// dumpHistoryReadings dumps the readings in the on-disk history within the given
+// bounds out to the provided channel, in the order in which they were read.
+func (manager *stateManager) dumpHistoryReadings(start, end time.Time, readings chan *ReadContext, devices ...string) {
+	err := manager.history.query(manager.outputs, devices, start, inclusiveEnd(end), func(ctx *ReadContext) {
+		readings <- ctx
+	})
+	if err != nil {
+		log.WithField("error", err).Error("[state manager] failed to read readings history")
+	}
+}
 
-		// If we have an end bound, check that the cached items are
-		// within that bound. If not, ignore them.
-		if !end.IsZero() && ts.After(end) {
-			continue
-		}
+// inclusiveEnd gets the end bound of a readings query. An end bound without
+// fractional seconds includes the whole of its second, as readings are made
+// with sub-second precision but RFC3339 bounds are often given to the second.
+func inclusiveEnd(end time.Time) time.Time {
+	if !end.IsZero() && end.Nanosecond() == 0 {
+		return end.Add(time.Second - 1)
+	}
+	return end
+}
 
-		// Pass the read contexts to the channel
-		ctxs := item.Object.(*[]*ReadContext)
-		for _, ctx := range *ctxs {
-			readings <- ctx
+// dumpCurrentReadings dumps the current readings out to the provided channel. If
+// any devices are given, only the readings for those devices are dumped.
+func (manager *stateManager) dumpCurrentReadings(readings chan *ReadContext, devices ...string) {
+	current := manager.GetReadings()
+	if len(devices) > 0 {
+		filtered := make(map[string][]*output.Reading, len(devices))
+		for _, id := range devices {
+			if data, ok := current[id]; ok {
+				filtered[id] = data
+			}
 		}
+		current = filtered
 	}
-}
 
-// dumpCurrentReadings dumps the current readings out to the provided channel.
-func (manager *stateManager) dumpCurrentReadings(readings chan *ReadContext) {
-	for id, data := range manager.GetReadings() {
+	for id, data := range current {
 		device := manager.deviceManager.GetDevice(id)
 		readings <- &ReadContext{
 			Device:  device,
@@ -310,6 +529,21 @@ func (manager *stateManager) newTransaction(timeout time.Duration, customID stri
 	return t, nil
 }
 
+// holdTransaction keeps a transaction in the transaction cache until the given
+// time, after which it expires after the usual TTL. This is used for the
+// transactions of scheduled writes, which may not be due until after the TTL.
+func (manager *stateManager) holdTransaction(t *transaction, until time.Time) {
+	var ttl time.Duration
+	if manager.config != nil && manager.config.Transaction != nil {
+		ttl = manager.config.Transaction.TTL
+	}
+	expiration := time.Until(until) + ttl
+	if expiration <= 0 {
+		expiration = cache.DefaultExpiration
+	}
+	manager.transactions.Set(t.id, t, expiration)
+}
+
 // getTransaction gets the transaction with the specified ID from the transaction cache.
 // If the specified transaction was not found, nil is returned.
 func (manager *stateManager) getTransaction(id string) *transaction {
@@ -21,6 +21,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/patrickmn/go-cache"
 	"github.com/stretchr/testify/assert"
 	"github.com/vapor-ware/synse-sdk/sdk/config"
@@ -28,6 +29,28 @@ import (
 	"github.com/vapor-ware/synse-sdk/sdk/output"
 )
 
+// newTestStateManager creates a state manager for tests, whose device manager
+// holds the given devices. Devices are read every second.
+func newTestStateManager(devices ...*Device) *stateManager {
+	dm := &deviceManager{devices: map[string]*Device{}}
+	for _, d := range devices {
+		dm.devices[d.id] = d
+	}
+	return &stateManager{
+		config: &config.PluginSettings{
+			Mode:  modeParallel,
+			Read:  &config.ReadSettings{Interval: time.Second},
+			Write: &config.WriteSettings{},
+		},
+		deviceManager: dm,
+		readChan:      make(chan *ReadContext, 10),
+		readings:      map[string][]*output.Reading{},
+		readingsLock:  &sync.RWMutex{},
+		transactions:  cache.New(time.Minute, 2*time.Minute),
+		stop:          make(chan struct{}),
+	}
+}
+
 func Test_newStateManager_nilConfig(t *testing.T) {
 	deviceManager := deviceManager{}
 
@@ -116,7 +139,53 @@ func TestStateManager_registerActions(t *testing.T) {
 
 	sm.registerActions(&plugin)
 
-	assert.Len(t, plugin.preRun, 1)
+	assert.Len(t, plugin.preRun, 2)
+	assert.Len(t, plugin.postRun, 3)
+}
+
+func TestStateManager_closeStreams(t *testing.T) {
+	sm := stateManager{
+		streams:    map[uuid.UUID]*ReadStream{},
+		streamLock: &sync.Mutex{},
+	}
+
+	s1 := newReadStream([]string{}, 0, "")
+	s2 := newReadStream([]string{}, 0, "")
+	sm.addStream(s1)
+	sm.addStream(s2)
+	assert.Len(t, sm.streams, 2)
+
+	sm.closeStreams()
+
+	assert.Empty(t, sm.streams)
+	assert.True(t, s1.closed)
+	assert.True(t, s2.closed)
+}
+
+func TestStateManager_sweepReadingsCache(t *testing.T) {
+	sm := newTestStateManager()
+	sm.readingsCache = newReadingsCache(10*time.Millisecond, 10, 0)
+	sm.readingsCache.add(cachedValue("1", 1), time.Now())
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		sm.sweepReadingsCache()
+	}()
+
+	// The expired reading is swept without any new readings being added.
+	assert.Eventually(t, func() bool {
+		return sm.readingsCache.len() == 0
+	}, time.Second, 5*time.Millisecond)
+
+	// The sweep stops once the state manager is stopped.
+	sm.Stop()
+	sm.Stop()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("readings cache sweep did not stop")
+	}
 }
 
 func TestStateManager_healthChecks(t *testing.T) {
@@ -130,7 +199,7 @@ func TestStateManager_healthChecks(t *testing.T) {
 	err := sm.healthChecks(&plugin)
 	assert.NoError(t, err)
 
-	assert.Equal(t, plugin.health.Count(), 1)
+	assert.Equal(t, plugin.health.Count(), 2)
 }
 
 func TestStateManager_addReadingToCache_cacheDisabled(t *testing.T) {
@@ -140,10 +209,10 @@ func TestStateManager_addReadingToCache_cacheDisabled(t *testing.T) {
 				Enabled: false,
 			},
 		},
-		readingsCache: cache.New(1*time.Minute, 2*time.Minute),
+		readingsCache: newReadingsCache(time.Minute, 10, 0),
 	}
 
-	assert.Equal(t, 0, sm.readingsCache.ItemCount())
+	assert.Equal(t, 0, sm.readingsCache.len())
 
 	sm.addReadingToCache(&ReadContext{
 		Device: &Device{
@@ -152,10 +221,7 @@ func TestStateManager_addReadingToCache_cacheDisabled(t *testing.T) {
 		Reading: []*output.Reading{{Value: 1}},
 	})
 
-	assert.Equal(t, 0, sm.readingsCache.ItemCount())
-
-	_, exists := sm.readingsCache.Get("test-1")
-	assert.False(t, exists)
+	assert.Equal(t, 0, sm.readingsCache.len())
 }
 
 func TestStateManager_addReadingToCache_new(t *testing.T) {
@@ -165,10 +231,10 @@ func TestStateManager_addReadingToCache_new(t *testing.T) {
 				Enabled: true,
 			},
 		},
-		readingsCache: cache.New(1*time.Minute, 2*time.Minute),
+		readingsCache: newReadingsCache(time.Minute, 10, 0),
 	}
 
-	assert.Equal(t, 0, sm.readingsCache.ItemCount())
+	assert.Equal(t, 0, sm.readingsCache.len())
 
 	sm.addReadingToCache(&ReadContext{
 		Device: &Device{
@@ -177,7 +243,7 @@ func TestStateManager_addReadingToCache_new(t *testing.T) {
 		Reading: []*output.Reading{{Value: 1}},
 	})
 
-	assert.Equal(t, 1, sm.readingsCache.ItemCount())
+	assert.Equal(t, 1, sm.readingsCache.len())
 }
 
 func TestStateManager_addReadingToCache_twoReadings(t *testing.T) {
@@ -187,10 +253,10 @@ func TestStateManager_addReadingToCache_twoReadings(t *testing.T) {
 				Enabled: true,
 			},
 		},
-		readingsCache: cache.New(1*time.Minute, 2*time.Minute),
+		readingsCache: newReadingsCache(time.Minute, 10, 0),
 	}
 
-	assert.Equal(t, 0, sm.readingsCache.ItemCount())
+	assert.Equal(t, 0, sm.readingsCache.len())
 
 	// Add first reading
 	sm.addReadingToCache(&ReadContext{
@@ -200,17 +266,76 @@ func TestStateManager_addReadingToCache_twoReadings(t *testing.T) {
 		Reading: []*output.Reading{{Value: 1}},
 	})
 
-	assert.Equal(t, 1, sm.readingsCache.ItemCount())
+	assert.Equal(t, 1, sm.readingsCache.len())
 
 	// Add second reading for the device
 	sm.addReadingToCache(&ReadContext{
 		Device: &Device{
 			id: "test-1",
 		},
-		Reading: []*output.Reading{{Value: 1}},
+		Reading: []*output.Reading{{Value: 2}},
 	})
 
-	assert.Equal(t, 1, sm.readingsCache.ItemCount())
+	assert.Equal(t, 2, sm.readingsCache.len())
+}
+
+func TestStateManager_removeReadings(t *testing.T) {
+	sm := stateManager{
+		readings: map[string][]*output.Reading{
+			"123": {{Value: 1}},
+			"456": {{Value: 2}},
+			"789": {{Value: 3}},
+		},
+		readingsLock: &sync.RWMutex{},
+	}
+
+	sm.removeReadings("123", "789", "unknown")
+	assert.Len(t, sm.readings, 1)
+	assert.Contains(t, sm.readings, "456")
+}
+
+func TestStateManager_removeReadings_cache(t *testing.T) {
+	sm := stateManager{
+		readings:      map[string][]*output.Reading{},
+		readingsCache: newReadingsCache(time.Minute, 10, 0),
+		readingsLock:  &sync.RWMutex{},
+	}
+
+	now := time.Now()
+	sm.readingsCache.add(&ReadContext{Device: &Device{id: "123"}}, now)
+	sm.readingsCache.add(&ReadContext{Device: &Device{id: "456"}}, now)
+	sm.readingsCache.add(&ReadContext{Device: &Device{id: "123"}}, now)
+
+	sm.removeReadings("123")
+	assert.Equal(t, 1, sm.readingsCache.len())
+
+	ctxs := sm.readingsCache.query(nil, time.Time{}, time.Time{}, now)
+	assert.Len(t, ctxs, 1)
+	assert.Equal(t, "456", ctxs[0].Device.id)
+}
+
+func TestStateManager_updateReadings_removedDevice(t *testing.T) {
+	sm := stateManager{
+		config: &config.PluginSettings{
+			Cache: &config.CacheSettings{Enabled: false},
+		},
+		readChan:     make(chan *ReadContext),
+		readings:     map[string][]*output.Reading{},
+		readingsLock: &sync.RWMutex{},
+		streamLock:   &sync.Mutex{},
+	}
+	go sm.updateReadings()
+
+	removed := &Device{id: "123"}
+	removed.markRemoved()
+	sm.readChan <- &ReadContext{Device: removed, Reading: []*output.Reading{{Value: 1}}}
+	sm.readChan <- &ReadContext{Device: &Device{id: "456"}, Reading: []*output.Reading{{Value: 2}}}
+
+	// Wait for the second reading to be processed.
+	assert.Eventually(t, func() bool {
+		return sm.GetReadingsForDevice("456") != nil
+	}, time.Second, 10*time.Millisecond)
+	assert.Nil(t, sm.GetReadingsForDevice("123"))
 }
 
 func TestStateManager_GetReadingsForDevice_noDevice(t *testing.T) {
@@ -351,12 +476,12 @@ func TestStateManager_GetCachedReadings_cacheEnabled(t *testing.T) {
 				Enabled: true,
 			},
 		},
-		readingsCache: cache.New(1*time.Minute, 2*time.Minute),
+		readingsCache: newReadingsCache(0, 10, 0),
 	}
 
-	newCtxs := []*ReadContext{{Device: &Device{id: "123"}, Reading: []*output.Reading{{Value: 3}}}}
-	err := sm.readingsCache.Add("2019-03-22T09:48:00Z", &newCtxs, cache.DefaultExpiration)
+	ts, err := time.Parse(time.RFC3339, "2019-03-22T09:48:00Z")
 	assert.NoError(t, err)
+	sm.readingsCache.add(&ReadContext{Device: &Device{id: "123"}, Reading: []*output.Reading{{Value: 3}}}, ts)
 
 	readings := make(chan *ReadContext, 5)
 
@@ -371,6 +496,33 @@ func TestStateManager_GetCachedReadings_cacheEnabled(t *testing.T) {
 	assert.False(t, isOpen)
 }
 
+func TestStateManager_GetCachedReadings_devices(t *testing.T) {
+	sm := stateManager{
+		config: &config.PluginSettings{
+			Cache: &config.CacheSettings{
+				Enabled: true,
+			},
+		},
+		readingsCache: newReadingsCache(0, 10, 0),
+	}
+
+	ts, err := time.Parse(time.RFC3339, "2019-03-22T09:48:00Z")
+	assert.NoError(t, err)
+	for i, id := range []string{"123", "456", "123", "789"} {
+		sm.readingsCache.add(&ReadContext{Device: &Device{id: id}, Reading: []*output.Reading{{Value: i}}}, ts.Add(time.Duration(i)*time.Second))
+	}
+
+	readings := make(chan *ReadContext, 5)
+
+	sm.GetCachedReadings("", "", readings, "123", "789")
+
+	var values []interface{}
+	for rctx := range readings {
+		values = append(values, rctx.Reading[0].Value)
+	}
+	assert.Equal(t, []interface{}{0, 2, 3}, values)
+}
+
 func TestStateManager_GetCachedReadings_cacheDisabled(t *testing.T) {
 	deviceManager := &deviceManager{
 		devices: map[string]*Device{
@@ -411,7 +563,7 @@ func TestStateManager_dumpCachedReadings_noReadings(t *testing.T) {
 				Enabled: true,
 			},
 		},
-		readingsCache: cache.New(1*time.Minute, 2*time.Minute),
+		readingsCache: newReadingsCache(0, 10, 0),
 	}
 
 	readings := make(chan *ReadContext, 5)
@@ -434,13 +586,13 @@ func TestStateManager_dumpCachedReadings_cachedReadingBeforeStart(t *testing.T)
 				Enabled: true,
 			},
 		},
-		readingsCache: cache.New(1*time.Minute, 2*time.Minute),
+		readingsCache: newReadingsCache(0, 10, 0),
 	}
 
 	// Test data setup
-	newCtxs := []*ReadContext{{Device: &Device{id: "123"}, Reading: []*output.Reading{{Value: 3}}}}
-	err := sm.readingsCache.Add("2019-03-22T09:40:00Z", &newCtxs, cache.DefaultExpiration)
+	ts, err := time.Parse(time.RFC3339, "2019-03-22T09:40:00Z")
 	assert.NoError(t, err)
+	sm.readingsCache.add(&ReadContext{Device: &Device{id: "123"}, Reading: []*output.Reading{{Value: 3}}}, ts)
 
 	readings := make(chan *ReadContext, 5)
 	defer close(readings)
@@ -462,13 +614,13 @@ func TestStateManager_dumpCachedReadings_cachedReadingAfterEnd(t *testing.T) {
 				Enabled: true,
 			},
 		},
-		readingsCache: cache.New(1*time.Minute, 2*time.Minute),
+		readingsCache: newReadingsCache(0, 10, 0),
 	}
 
 	// Test data setup
-	newCtxs := []*ReadContext{{Device: &Device{id: "123"}, Reading: []*output.Reading{{Value: 3}}}}
-	err := sm.readingsCache.Add("2019-03-22T09:55:00Z", &newCtxs, cache.DefaultExpiration)
+	ts, err := time.Parse(time.RFC3339, "2019-03-22T09:55:00Z")
 	assert.NoError(t, err)
+	sm.readingsCache.add(&ReadContext{Device: &Device{id: "123"}, Reading: []*output.Reading{{Value: 3}}}, ts)
 
 	readings := make(chan *ReadContext, 5)
 	defer close(readings)
@@ -490,13 +642,13 @@ func TestStateManager_dumpCachedReadings_cachedReadingOk(t *testing.T) {
 				Enabled: true,
 			},
 		},
-		readingsCache: cache.New(1*time.Minute, 2*time.Minute),
+		readingsCache: newReadingsCache(0, 10, 0),
 	}
 
 	// Test data setup
-	newCtxs := []*ReadContext{{Device: &Device{id: "123"}, Reading: []*output.Reading{{Value: 3}}}}
-	err := sm.readingsCache.Add("2019-03-22T09:48:00Z", &newCtxs, cache.DefaultExpiration)
+	ts, err := time.Parse(time.RFC3339, "2019-03-22T09:48:00Z")
 	assert.NoError(t, err)
+	sm.readingsCache.add(&ReadContext{Device: &Device{id: "123"}, Reading: []*output.Reading{{Value: 3}}}, ts)
 
 	readings := make(chan *ReadContext, 5)
 	defer close(readings)
@@ -514,20 +666,20 @@ func TestStateManager_dumpCachedReadings_cachedReadingOk(t *testing.T) {
 	assert.Equal(t, "123", rctx.Device.id)
 }
 
-func TestStateManager_dumpCachedReadings_cachedReadingBadTS(t *testing.T) {
+func TestStateManager_dumpCachedReadings_endOfSecond(t *testing.T) {
 	sm := stateManager{
 		config: &config.PluginSettings{
 			Cache: &config.CacheSettings{
 				Enabled: true,
 			},
 		},
-		readingsCache: cache.New(1*time.Minute, 2*time.Minute),
+		readingsCache: newReadingsCache(0, 10, 0),
 	}
 
-	// Test data setup
-	newCtxs := []*ReadContext{{Device: &Device{id: "123"}, Reading: []*output.Reading{{Value: 3}}}}
-	err := sm.readingsCache.Add("foobar", &newCtxs, cache.DefaultExpiration)
+	// A reading made within the second of the end bound is included.
+	ts, err := time.Parse(time.RFC3339Nano, "2019-03-22T09:50:00.5Z")
 	assert.NoError(t, err)
+	sm.readingsCache.add(&ReadContext{Device: &Device{id: "123"}, Reading: []*output.Reading{{Value: 3}}}, ts)
 
 	readings := make(chan *ReadContext, 5)
 	defer close(readings)
@@ -539,7 +691,7 @@ func TestStateManager_dumpCachedReadings_cachedReadingBadTS(t *testing.T) {
 	assert.NoError(t, err)
 
 	sm.dumpCachedReadings(start, end, readings)
-	assert.Empty(t, readings)
+	assert.Len(t, readings, 1)
 }
 
 func TestStateManager_dumpCurrentReadings_noReadings(t *testing.T) {
@@ -580,6 +732,33 @@ func TestStateManager_dumpCurrentReadings_hasReadings(t *testing.T) {
 	assert.Equal(t, "1", rctx.Device.id)
 }
 
+func TestStateManager_dumpCurrentReadings_devices(t *testing.T) {
+	deviceManager := &deviceManager{
+		devices: map[string]*Device{
+			"1": {id: "1"},
+			"2": {id: "2"},
+		},
+	}
+
+	sm := stateManager{
+		deviceManager: deviceManager,
+		readingsLock:  &sync.RWMutex{},
+		readings: map[string][]*output.Reading{
+			"1": {{Value: 3}},
+			"2": {{Value: 4}},
+		},
+	}
+
+	readings := make(chan *ReadContext, 5)
+	defer close(readings)
+
+	sm.dumpCurrentReadings(readings, "2", "unknown")
+	assert.Len(t, readings, 1)
+
+	rctx := <-readings
+	assert.Equal(t, "2", rctx.Device.id)
+}
+
 func TestStateManager_GetReadings_noReadings(t *testing.T) {
 	sm := stateManager{
 		readingsLock: &sync.RWMutex{},
@@ -667,3 +846,25 @@ func TestStateManager_newTransaction3(t *testing.T) {
 	assert.Nil(t, txn)
 	assert.Equal(t, 1, sm.transactions.ItemCount())
 }
+
+func TestStateManager_dispatchToStreams(t *testing.T) {
+	sm := stateManager{
+		streams:    map[uuid.UUID]*ReadStream{},
+		streamLock: &sync.Mutex{},
+	}
+
+	dropping := newReadStream(nil, 1, overflowDropOldest)
+	disconnecting := newReadStream(nil, 1, overflowDisconnect)
+	sm.addStream(dropping)
+	sm.addStream(disconnecting)
+
+	// Neither stream is listening, so dispatching must not block on them.
+	for i := 0; i < 3; i++ {
+		sm.dispatchToStreams(cachedValue("1", i))
+	}
+
+	assert.Len(t, sm.streams, 1)
+	assert.Contains(t, sm.streams, dropping.id)
+	assert.Equal(t, uint64(2), dropping.droppedReadings())
+	assert.True(t, disconnecting.overflowed)
+}
@@ -0,0 +1,240 @@
+// Synse SDK
+// Copyright (c) 2017-2020 Vapor IO
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package sdk
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// durationBuckets are the upper bounds of the buckets for read and write
+// duration histograms.
+var durationBuckets = []time.Duration{
+	1 * time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	1 * time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// SchedulerStats holds the read and write statistics collected by the plugin's
+// scheduler.
+type SchedulerStats struct {
+	// Devices holds the statistics for each device, keyed by device ID.
+	Devices map[string]*DeviceStats
+
+	// Handlers holds the bulk read statistics for each device handler which
+	// reads its devices in bulk, keyed by handler name.
+	Handlers map[string]*OperationStats
+}
+
+// DeviceStats holds the read and write statistics for a device. Devices which
+// are read in bulk share the statistics of the bulk read for their reads.
+type DeviceStats struct {
+	Read  OperationStats
+	Write OperationStats
+
+	// ReadInterval is the device's effective read interval. This may vary from
+	// its configured read interval if adaptive polling is enabled for the device.
+	// It is 0 for devices which are not read individually.
+	ReadInterval time.Duration
+}
+
+// OperationStats holds the statistics for a device operation, e.g. the reads of
+// a device or the bulk reads of a device handler.
+type OperationStats struct {
+	// LastAttempt is the time at which the operation was last attempted.
+	LastAttempt time.Time
+
+	// LastSuccess is the time at which the operation last succeeded.
+	LastSuccess time.Time
+
+	// LastError is the error of the most recent failed attempt, if any.
+	LastError string
+
+	// ConsecutiveFailures is the number of attempts which have failed since
+	// the operation last succeeded.
+	ConsecutiveFailures int
+
+	// Attempts is the total number of times the operation was attempted.
+	Attempts uint64
+
+	// Failures is the total number of times the operation failed.
+	Failures uint64
+
+	// Duration is the histogram of operation durations.
+	Duration DurationHistogram
+}
+
+// DurationHistogram is a histogram of operation durations.
+type DurationHistogram struct {
+	// Buckets are the upper bounds of the histogram buckets.
+	Buckets []time.Duration
+
+	// Counts holds the number of durations which fell into each bucket, i.e.
+	// were greater than the previous bucket's bound and no greater than the
+	// bucket's bound. It has one more element than Buckets, which counts the
+	// durations greater than the largest bucket bound.
+	Counts []uint64
+
+	// Count is the total number of durations observed.
+	Count uint64
+
+	// Sum is the sum of all durations observed.
+	Sum time.Duration
+
+	// Max is the longest duration observed.
+	Max time.Duration
+}
+
+// Mean gets the mean of the durations observed by the histogram.
+func (histogram *DurationHistogram) Mean() time.Duration {
+	if histogram.Count == 0 {
+		return 0
+	}
+	return histogram.Sum / time.Duration(histogram.Count)
+}
+
+// observe adds a duration to the histogram.
+func (histogram *DurationHistogram) observe(d time.Duration) {
+	if histogram.Counts == nil {
+		histogram.Buckets = durationBuckets
+		histogram.Counts = make([]uint64, len(durationBuckets)+1)
+	}
+
+	i := 0
+	for ; i < len(histogram.Buckets); i++ {
+		if d <= histogram.Buckets[i] {
+			break
+		}
+	}
+	histogram.Counts[i]++
+	histogram.Count++
+	histogram.Sum += d
+	if d > histogram.Max {
+		histogram.Max = d
+	}
+}
+
+// metadata gets the operation statistics as device metadata entries, with
+// keys which are prefixed by the given operation name. Operations which were
+// never attempted have no metadata.
+func (stats *OperationStats) metadata(operation string) map[string]string {
+	if stats.Attempts == 0 {
+		return nil
+	}
+
+	metadata := map[string]string{
+		operation + "_last_attempt":         stats.LastAttempt.UTC().Format(time.RFC3339Nano),
+		operation + "_consecutive_failures": fmt.Sprint(stats.ConsecutiveFailures),
+		operation + "_attempts":             fmt.Sprint(stats.Attempts),
+		operation + "_failures":             fmt.Sprint(stats.Failures),
+		operation + "_duration_mean":        stats.Duration.Mean().String(),
+		operation + "_duration_max":         stats.Duration.Max.String(),
+	}
+	if !stats.LastSuccess.IsZero() {
+		metadata[operation+"_last_success"] = stats.LastSuccess.UTC().Format(time.RFC3339Nano)
+	}
+	if stats.LastError != "" {
+		metadata[operation+"_last_error"] = stats.LastError
+	}
+	return metadata
+}
+
+// statsTracker collects the statistics for a device operation. The zero value
+// is ready to use.
+type statsTracker struct {
+	lock  sync.Mutex
+	stats OperationStats
+}
+
+// record records an attempt of the operation which started at the given time
+// and completed with the given error.
+func (tracker *statsTracker) record(start time.Time, err error) {
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+
+	tracker.stats.LastAttempt = start
+	tracker.stats.Attempts++
+	tracker.stats.Duration.observe(time.Since(start))
+
+	if err != nil {
+		tracker.stats.LastError = err.Error()
+		tracker.stats.ConsecutiveFailures++
+		tracker.stats.Failures++
+	} else {
+		tracker.stats.LastSuccess = start
+		tracker.stats.ConsecutiveFailures = 0
+	}
+}
+
+// snapshot gets a copy of the current statistics.
+func (tracker *statsTracker) snapshot() OperationStats {
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+
+	stats := tracker.stats
+	stats.Duration.Counts = append([]uint64(nil), tracker.stats.Duration.Counts...)
+	return stats
+}
+
+// handlerStats gets the bulk read statistics tracker for a device handler.
+func (scheduler *scheduler) handlerStats(handler string) *statsTracker {
+	scheduler.statsLock.Lock()
+	defer scheduler.statsLock.Unlock()
+
+	if scheduler.bulkStats == nil {
+		scheduler.bulkStats = make(map[string]*statsTracker)
+	}
+	tracker, exists := scheduler.bulkStats[handler]
+	if !exists {
+		tracker = &statsTracker{}
+		scheduler.bulkStats[handler] = tracker
+	}
+	return tracker
+}
+
+// stats gets a snapshot of the scheduler's statistics for all devices and
+// bulk read handlers.
+func (scheduler *scheduler) stats() *SchedulerStats {
+	stats := &SchedulerStats{
+		Devices:  make(map[string]*DeviceStats),
+		Handlers: make(map[string]*OperationStats),
+	}
+
+	if scheduler.deviceManager != nil {
+		for _, device := range scheduler.deviceManager.GetAllDevices() {
+			stats.Devices[device.id] = device.Stats()
+		}
+	}
+
+	scheduler.statsLock.Lock()
+	defer scheduler.statsLock.Unlock()
+	for handler, tracker := range scheduler.bulkStats {
+		s := tracker.snapshot()
+		stats.Handlers[handler] = &s
+	}
+	return stats
+}
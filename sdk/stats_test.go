@@ -0,0 +1,200 @@
+// Synse SDK
+// Copyright (c) 2017-2020 Vapor IO
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package sdk
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vapor-ware/synse-sdk/sdk/config"
+	"github.com/vapor-ware/synse-sdk/sdk/output"
+)
+
+func TestDurationHistogram_observe(t *testing.T) {
+	var h DurationHistogram
+	assert.Equal(t, time.Duration(0), h.Mean())
+
+	h.observe(500 * time.Microsecond)
+	h.observe(1 * time.Millisecond)
+	h.observe(7 * time.Millisecond)
+	h.observe(time.Minute)
+
+	assert.Equal(t, durationBuckets, h.Buckets)
+	assert.Len(t, h.Counts, len(durationBuckets)+1)
+	assert.Equal(t, uint64(2), h.Counts[0])
+	assert.Equal(t, uint64(1), h.Counts[2])
+	assert.Equal(t, uint64(1), h.Counts[len(durationBuckets)])
+	assert.Equal(t, uint64(4), h.Count)
+	assert.Equal(t, time.Minute, h.Max)
+	assert.Equal(t, (time.Minute+8500*time.Microsecond)/4, h.Mean())
+}
+
+func TestStatsTracker_record(t *testing.T) {
+	var tracker statsTracker
+
+	start := time.Now()
+	tracker.record(start, errors.New("test error"))
+	tracker.record(start, errors.New("test error"))
+
+	stats := tracker.snapshot()
+	assert.Equal(t, start, stats.LastAttempt)
+	assert.True(t, stats.LastSuccess.IsZero())
+	assert.Equal(t, "test error", stats.LastError)
+	assert.Equal(t, 2, stats.ConsecutiveFailures)
+	assert.Equal(t, uint64(2), stats.Attempts)
+	assert.Equal(t, uint64(2), stats.Failures)
+	assert.Equal(t, uint64(2), stats.Duration.Count)
+
+	tracker.record(start, nil)
+	stats = tracker.snapshot()
+	assert.Equal(t, start, stats.LastSuccess)
+	assert.Equal(t, "test error", stats.LastError)
+	assert.Equal(t, 0, stats.ConsecutiveFailures)
+	assert.Equal(t, uint64(3), stats.Attempts)
+	assert.Equal(t, uint64(2), stats.Failures)
+}
+
+func TestStatsTracker_snapshot_copy(t *testing.T) {
+	var tracker statsTracker
+	tracker.record(time.Now(), nil)
+
+	stats := tracker.snapshot()
+	stats.Duration.Counts[0] = 100
+	assert.NotEqual(t, uint64(100), tracker.snapshot().Duration.Counts[0])
+}
+
+func TestOperationStats_metadata(t *testing.T) {
+	var stats OperationStats
+	assert.Nil(t, stats.metadata("read"))
+
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	stats = OperationStats{
+		LastAttempt:         start,
+		LastError:           "test error",
+		ConsecutiveFailures: 1,
+		Attempts:            1,
+		Failures:            1,
+	}
+	stats.Duration.observe(time.Second)
+
+	assert.Equal(t, map[string]string{
+		"read_last_attempt":         "2020-01-01T00:00:00Z",
+		"read_last_error":           "test error",
+		"read_consecutive_failures": "1",
+		"read_attempts":             "1",
+		"read_failures":             "1",
+		"read_duration_mean":        "1s",
+		"read_duration_max":         "1s",
+	}, stats.metadata("read"))
+}
+
+func TestScheduler_read_stats(t *testing.T) {
+	s := scheduler{
+		config: &config.PluginSettings{
+			Read: &config.ReadSettings{},
+		},
+		stateManager: &stateManager{
+			readChan: make(chan *ReadContext, 10),
+		},
+	}
+
+	fail := true
+	device := &Device{
+		id: "123",
+		handler: &DeviceHandler{
+			Name: "test",
+			Read: func(device *Device) ([]*output.Reading, error) {
+				if fail {
+					return nil, errors.New("test error")
+				}
+				return []*output.Reading{{Value: 1}}, nil
+			},
+		},
+	}
+
+	s.read(device)
+	stats := device.Stats()
+	assert.Equal(t, uint64(1), stats.Read.Attempts)
+	assert.Equal(t, 1, stats.Read.ConsecutiveFailures)
+	assert.Equal(t, "test error", stats.Read.LastError)
+	assert.True(t, stats.Read.LastSuccess.IsZero())
+	assert.Equal(t, uint64(0), stats.Write.Attempts)
+
+	fail = false
+	s.read(device)
+	stats = device.Stats()
+	assert.Equal(t, uint64(2), stats.Read.Attempts)
+	assert.Equal(t, 0, stats.Read.ConsecutiveFailures)
+	assert.False(t, stats.Read.LastSuccess.IsZero())
+	assert.Equal(t, uint64(2), stats.Read.Duration.Count)
+}
+
+func TestScheduler_bulkRead_stats(t *testing.T) {
+	handler := &DeviceHandler{
+		Name: "bulk",
+		BulkRead: func(devices []*Device) ([]*ReadContext, error) {
+			return nil, errors.New("test error")
+		},
+	}
+	device := &Device{id: "123", Handler: "bulk", handler: handler}
+	s := scheduler{
+		config: &config.PluginSettings{
+			Read: &config.ReadSettings{},
+		},
+		deviceManager: &deviceManager{
+			devices: map[string]*Device{"123": device},
+		},
+	}
+
+	s.bulkRead(handler)
+
+	stats := s.stats()
+	assert.Len(t, stats.Handlers, 1)
+	assert.Equal(t, uint64(1), stats.Handlers["bulk"].Attempts)
+	assert.Equal(t, "test error", stats.Handlers["bulk"].LastError)
+	assert.Len(t, stats.Devices, 1)
+	assert.Equal(t, "test error", stats.Devices["123"].Read.LastError)
+}
+
+func TestScheduler_write_stats(t *testing.T) {
+	s := scheduler{
+		config: &config.PluginSettings{Mode: modeParallel, Write: &config.WriteSettings{}},
+		stop:   make(chan struct{}),
+	}
+
+	w := newWriteTestContext(&DeviceHandler{
+		Write: func(device *Device, data *WriteData) error {
+			return nil
+		},
+	}, time.Second)
+
+	s.write(w)
+	stats := w.device.Stats()
+	assert.Equal(t, uint64(1), stats.Write.Attempts)
+	assert.False(t, stats.Write.LastSuccess.IsZero())
+	assert.Equal(t, uint64(0), stats.Read.Attempts)
+}
+
+func TestPlugin_Stats_noScheduler(t *testing.T) {
+	p := Plugin{}
+
+	stats := p.Stats()
+	assert.Empty(t, stats.Devices)
+	assert.Empty(t, stats.Handlers)
+}
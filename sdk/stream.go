@@ -18,12 +18,28 @@ package sdk
 
 import (
 	"sync"
+	"sync/atomic"
 
 	"github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
 )
 
+// Overflow policies for read streams (see config.StreamSettings).
+const (
+	overflowDropOldest = "dropOldest"
+	overflowDropNewest = "dropNewest"
+	overflowDisconnect = "disconnect"
+)
+
+// defaultStreamBuffer is the number of readings buffered for a stream, if not
+// configured.
+const defaultStreamBuffer = 128
+
 // ReadStream encapsulates a channel which is used to stream data to a client.
+//
+// Readings are offered to the stream without blocking. The stream channel is
+// the stream's buffer; once it is full, the stream's overflow policy decides
+// whether a reading is dropped or the stream is disconnected.
 type ReadStream struct {
 	stream   chan *ReadContext
 	readings chan *ReadContext
@@ -31,6 +47,20 @@ type ReadStream struct {
 	filter   []string
 	closed   bool
 	stopLock sync.Mutex
+
+	// overflow is the overflow policy of the stream.
+	overflow string
+
+	// dropped is the number of readings the stream has dropped because its
+	// buffer was full. It is accessed atomically.
+	dropped uint64
+
+	// done is closed when the stream stops, which unblocks any pending send
+	// to the readings channel. overflowed is set before done is closed if the
+	// stream stopped because it was disconnected on overflow.
+	done       chan struct{}
+	doneOnce   sync.Once
+	overflowed bool
 }
 
 // listen collects all new readings and filters them based on the supplied filter.
@@ -48,46 +78,146 @@ func (s *ReadStream) listen() {
 	}()
 
 	for {
-		if s.closed {
+		var r *ReadContext
+		select {
+		case reading, open := <-s.stream:
+			if !open {
+				return
+			}
+			r = reading
+		case <-s.done:
 			return
 		}
-		r, open := <-s.stream
-		if !open {
+
+		if !s.accepts(r) {
+			continue
+		}
+		log.WithField("device", r.Device).Debug("collecting reading")
+		if !s.send(r) {
 			return
 		}
+	}
+}
 
-		if len(s.filter) == 0 {
-			log.WithField("device", r.Device).Debug("collecting reading")
-			s.stopLock.Lock()
-			if s.closed {
-				return
-			}
-			s.readings <- r
-			s.stopLock.Unlock()
+// send passes a reading to the stream's readings channel. It returns false if
+// the stream has been closed, in which case the reading is not sent.
+func (s *ReadStream) send(r *ReadContext) bool {
+	s.stopLock.Lock()
+	defer s.stopLock.Unlock()
+
+	if s.closed {
+		return false
+	}
+	select {
+	case s.readings <- r:
+		return true
+	case <-s.done:
+		return false
+	}
+}
+
+// accepts checks whether a reading passes the stream's filter.
+func (s *ReadStream) accepts(r *ReadContext) bool {
+	if len(s.filter) == 0 {
+		return true
+	}
+	for _, id := range s.filter {
+		if r.Device != nil && r.Device.id == id {
+			return true
 		}
+	}
+	return false
+}
 
-		for _, id := range s.filter {
-			if r.Device.id == id {
-				log.WithField("device", r.Device.id).Debug("collecting reading")
-				s.stopLock.Lock()
-				if s.closed {
-					return
-				}
-				s.readings <- r
-				s.stopLock.Unlock()
-				break
+// offer passes a reading to the stream without blocking. If the stream's buffer
+// is full, the stream's overflow policy is applied. It returns false if the stream
+// should be disconnected, in which case the stream has been stopped.
+//
+// The caller must ensure that the stream is not closed while a reading is being
+// offered; the state manager does this by only offering readings to the streams
+// it holds, under its stream lock.
+func (s *ReadStream) offer(r *ReadContext) bool {
+	if !s.accepts(r) {
+		return true
+	}
+
+	for {
+		select {
+		case s.stream <- r:
+			return true
+		default:
+		}
+
+		switch s.overflow {
+		case overflowDropNewest:
+			s.drop()
+			return true
+
+		case overflowDisconnect:
+			log.WithField("id", s.id).Warn("[stream] buffer full, disconnecting read stream")
+			metricStreamDisconnects.Inc()
+			s.overflowed = true
+			s.stop()
+			return false
+
+		default:
+			// Drop the oldest buffered reading to make room for the new one. The
+			// buffer may have been drained by the stream's listener in the meantime,
+			// in which case nothing is dropped.
+			select {
+			case <-s.stream:
+				s.drop()
+			default:
 			}
 		}
 	}
 }
 
+// drop records a reading dropped by the stream.
+func (s *ReadStream) drop() {
+	if atomic.AddUint64(&s.dropped, 1) == 1 {
+		log.WithFields(log.Fields{
+			"id":       s.id,
+			"overflow": s.overflow,
+		}).Warn("[stream] buffer full, dropping readings for read stream")
+	}
+	metricStreamDropped.WithLabelValues(s.overflow).Inc()
+}
+
+// droppedReadings gets the number of readings the stream has dropped because its
+// buffer was full.
+func (s *ReadStream) droppedReadings() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// stop signals that the stream has stopped, unblocking any pending send.
+func (s *ReadStream) stop() {
+	s.doneOnce.Do(func() {
+		if s.done != nil {
+			close(s.done)
+		}
+	})
+}
+
 // close the ReadStream.
 func (s *ReadStream) close() {
-	log.WithField("id", s.id).Info("closing read stream")
+	log.WithFields(log.Fields{
+		"id":      s.id,
+		"dropped": s.droppedReadings(),
+	}).Info("closing read stream")
+
+	// Stop the stream before taking the stop lock, as the lock is held by any
+	// pending send, which may be waiting on a client which is no longer receiving.
+	s.stop()
 
 	s.stopLock.Lock()
 	defer s.stopLock.Unlock()
 
+	// The stream may be closed by the state manager on shutdown as well as
+	// by the gRPC handler which owns it, so closing must be idempotent.
+	if s.closed {
+		return
+	}
 	s.closed = true
 	if s.stream != nil {
 		// Drain the channel.
@@ -107,13 +237,28 @@ func (s *ReadStream) close() {
 	}
 }
 
-// newReadStream creates a new ReadStream.
-func newReadStream(filter []string) *ReadStream {
+// newReadStream creates a new ReadStream which buffers the given number of
+// readings and applies the given overflow policy once its buffer is full.
+func newReadStream(filter []string, buffer int, overflow string) *ReadStream {
+	if buffer <= 0 {
+		buffer = defaultStreamBuffer
+	}
+	switch overflow {
+	case overflowDropOldest, overflowDropNewest, overflowDisconnect:
+	default:
+		if overflow != "" {
+			log.WithField("overflow", overflow).Warn("[stream] unknown overflow policy, dropping oldest readings")
+		}
+		overflow = overflowDropOldest
+	}
+
 	return &ReadStream{
-		stream:   make(chan *ReadContext, 128),
-		readings: make(chan *ReadContext, 128),
+		stream:   make(chan *ReadContext, buffer),
+		readings: make(chan *ReadContext),
 		id:       uuid.New(),
 		filter:   filter,
 		stopLock: sync.Mutex{},
+		overflow: overflow,
+		done:     make(chan struct{}),
 	}
 }
@@ -21,12 +21,13 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/vapor-ware/synse-sdk/sdk/output"
 )
 
 func TestNewReadStream(t *testing.T) {
-	s := newReadStream([]string{"foo", "bar"})
+	s := newReadStream([]string{"foo", "bar"}, 0, "")
 
 	assert.NotNil(t, s.stream)
 	assert.NotNil(t, s.readings)
@@ -74,6 +75,17 @@ func TestReadStream_close_nilChannels(t *testing.T) {
 	assert.True(t, s.closed)
 }
 
+func TestReadStream_close_twice(t *testing.T) {
+	s := newReadStream([]string{}, 0, "")
+
+	s.close()
+	assert.True(t, s.closed)
+
+	// Closing an already closed stream should not panic.
+	s.close()
+	assert.True(t, s.closed)
+}
+
 func TestReadStream_listen_withFilter(t *testing.T) {
 	s := ReadStream{
 		stream:   make(chan *ReadContext, 128),
@@ -280,3 +292,93 @@ func TestReadStream_undrainedStreamChannel(t *testing.T) {
 	_, open = <-readingsChan
 	assert.False(t, open)
 }
+
+func TestNewReadStream_settings(t *testing.T) {
+	s := newReadStream(nil, 4, overflowDisconnect)
+	assert.Equal(t, 4, cap(s.stream))
+	assert.Equal(t, overflowDisconnect, s.overflow)
+
+	// Unknown policies and sizes fall back to the defaults.
+	s = newReadStream(nil, -1, "block")
+	assert.Equal(t, defaultStreamBuffer, cap(s.stream))
+	assert.Equal(t, overflowDropOldest, s.overflow)
+}
+
+// streamValues gets the reading values buffered in a stream, in order.
+func streamValues(s *ReadStream) []interface{} {
+	var values []interface{}
+	for len(s.stream) > 0 {
+		r := <-s.stream
+		values = append(values, r.Reading[0].Value)
+	}
+	return values
+}
+
+func TestReadStream_offer_dropOldest(t *testing.T) {
+	s := newReadStream(nil, 2, overflowDropOldest)
+	dropped := testutil.ToFloat64(metricStreamDropped.WithLabelValues(overflowDropOldest))
+
+	for i := 0; i < 5; i++ {
+		assert.True(t, s.offer(cachedValue("1", i)))
+	}
+	assert.Equal(t, uint64(3), s.droppedReadings())
+	assert.Equal(t, []interface{}{3, 4}, streamValues(s))
+	assert.Equal(t, dropped+3, testutil.ToFloat64(metricStreamDropped.WithLabelValues(overflowDropOldest)))
+}
+
+func TestReadStream_offer_dropNewest(t *testing.T) {
+	s := newReadStream(nil, 2, overflowDropNewest)
+	dropped := testutil.ToFloat64(metricStreamDropped.WithLabelValues(overflowDropNewest))
+
+	for i := 0; i < 5; i++ {
+		assert.True(t, s.offer(cachedValue("1", i)))
+	}
+	assert.Equal(t, uint64(3), s.droppedReadings())
+	assert.Equal(t, []interface{}{0, 1}, streamValues(s))
+	assert.Equal(t, dropped+3, testutil.ToFloat64(metricStreamDropped.WithLabelValues(overflowDropNewest)))
+}
+
+func TestReadStream_offer_disconnect(t *testing.T) {
+	s := newReadStream(nil, 2, overflowDisconnect)
+
+	assert.True(t, s.offer(cachedValue("1", 0)))
+	assert.True(t, s.offer(cachedValue("1", 1)))
+	assert.False(t, s.offer(cachedValue("1", 2)))
+
+	assert.True(t, s.overflowed)
+	assert.Equal(t, uint64(0), s.droppedReadings())
+	select {
+	case <-s.done:
+	default:
+		t.Fatal("stream was not stopped")
+	}
+}
+
+func TestReadStream_offer_filtered(t *testing.T) {
+	s := newReadStream([]string{"1"}, 1, overflowDropNewest)
+
+	// Readings for other devices are not buffered, so do not count as dropped.
+	assert.True(t, s.offer(cachedValue("1", 0)))
+	assert.True(t, s.offer(cachedValue("2", 1)))
+	assert.Equal(t, uint64(0), s.droppedReadings())
+	assert.Equal(t, []interface{}{0}, streamValues(s))
+}
+
+func TestReadStream_close_pendingSend(t *testing.T) {
+	s := newReadStream(nil, 1, overflowDropOldest)
+	go s.listen()
+	assert.True(t, s.offer(cachedValue("1", 0)))
+
+	// The listener is blocked sending the reading to a client which is not
+	// receiving; closing the stream must not wait on it.
+	done := make(chan struct{})
+	go func() {
+		s.close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("closing the stream blocked on a pending send")
+	}
+}
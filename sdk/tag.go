@@ -248,6 +248,10 @@ type TagCache struct {
 	// by decomposing the tag into its searchable components and traversing
 	// the cache.
 	cache map[string]map[string]map[string][]*Device
+
+	// lock guards the cache, as devices may be added and removed while the
+	// plugin is running.
+	lock sync.RWMutex
 }
 
 // NewTagCache creates a new TagCache instance.
@@ -274,6 +278,9 @@ func (cache *TagCache) Add(tag *Tag, device *Device) {
 		"device":     device.id,
 	})
 
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
 	annotations, exists := cache.cache[tag.Namespace]
 	if !exists {
 		// If the namespace doesn't exist, add it with the rest of the tag info.
@@ -318,6 +325,53 @@ func (cache *TagCache) Add(tag *Tag, device *Device) {
 	}
 }
 
+// Remove removes a device from the tag cache for the specified tag. If the tag
+// does not have any remaining devices, it is removed from the cache.
+func (cache *TagCache) Remove(tag *Tag, device *Device) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	annotations, exists := cache.cache[tag.Namespace]
+	if !exists {
+		return
+	}
+	labels, exists := annotations[tag.Annotation]
+	if !exists {
+		return
+	}
+	devices, exists := labels[tag.Label]
+	if !exists {
+		return
+	}
+
+	// Build a new slice rather than modifying the existing one in place, since
+	// lookups may have returned the existing slice to a caller.
+	remaining := make([]*Device, 0, len(devices))
+	for _, d := range devices {
+		if d.id != device.id {
+			remaining = append(remaining, d)
+		}
+	}
+
+	// Clean up any part of the tag which no longer has devices associated with it.
+	if len(remaining) > 0 {
+		labels[tag.Label] = remaining
+		return
+	}
+	delete(labels, tag.Label)
+	if len(labels) == 0 {
+		delete(annotations, tag.Annotation)
+	}
+	if len(annotations) == 0 {
+		delete(cache.cache, tag.Namespace)
+	}
+
+	log.WithFields(log.Fields{
+		"tag":    tag.String(),
+		"device": device.id,
+	}).Debug("[tag] removed tag from tag cache")
+}
+
 // GetDevicesFromStrings gets the list of Devices which match the given set
 // of tag strings.
 func (cache *TagCache) GetDevicesFromStrings(tags ...string) ([]*Device, error) {
@@ -334,6 +388,9 @@ func (cache *TagCache) GetDevicesFromStrings(tags ...string) ([]*Device, error)
 
 // GetDevicesFromTags gets the list of Devices which match the given set of tags.
 func (cache *TagCache) GetDevicesFromTags(tags ...*Tag) []*Device {
+	cache.lock.RLock()
+	defer cache.lock.RUnlock()
+
 	var deviceSet filterSet
 
 	for _, tag := range tags {
@@ -364,7 +421,7 @@ func (cache *TagCache) GetDevicesFromTags(tags ...*Tag) []*Device {
 				continue
 			}
 
-			devices = cache.GetDevicesFromNamespace(tag.Namespace)
+			devices = cache.devicesFromNamespace(tag.Namespace)
 			deviceSet.Filter(devices)
 			continue
 		}
@@ -391,6 +448,15 @@ func (cache *TagCache) GetDevicesFromTags(tags ...*Tag) []*Device {
 
 // GetDevicesFromNamespace gets the devices for the specified namespaces.
 func (cache *TagCache) GetDevicesFromNamespace(namespaces ...string) []*Device {
+	cache.lock.RLock()
+	defer cache.lock.RUnlock()
+
+	return cache.devicesFromNamespace(namespaces...)
+}
+
+// devicesFromNamespace gets the devices for the specified namespaces. The cache
+// lock should be held by the caller.
+func (cache *TagCache) devicesFromNamespace(namespaces ...string) []*Device {
 	// Initially, store the devices in a map. This will allow us to remove duplicates
 	// which may be present, as a device can have a tag in multiple namespaces.
 	var deviceMap = make(map[string]*Device)
@@ -541,6 +541,54 @@ func TestTagCache_GetDevicesFromTags_noTags(t *testing.T) {
 	assert.Empty(t, devices)
 }
 
+func TestTagCache_Remove(t *testing.T) {
+	d1 := &Device{id: "123"}
+	d2 := &Device{id: "456"}
+	cache := &TagCache{
+		cache: map[string]map[string]map[string][]*Device{
+			"foo": {
+				"bar": {
+					"baz": {d1, d2},
+				},
+			},
+		},
+	}
+	tag := &Tag{Namespace: "foo", Annotation: "bar", Label: "baz"}
+
+	// Keep a reference to devices returned from the cache; they should not
+	// be modified by the removal.
+	before := cache.GetDevicesFromTags(tag)
+
+	cache.Remove(tag, d1)
+	assert.Equal(t, []*Device{d2}, cache.GetDevicesFromTags(tag))
+	assert.Len(t, before, 2)
+
+	// Removing the last device for the tag removes the tag from the cache.
+	cache.Remove(tag, d2)
+	assert.Empty(t, cache.GetDevicesFromTags(tag))
+	assert.Empty(t, cache.cache)
+}
+
+func TestTagCache_Remove_notCached(t *testing.T) {
+	d1 := &Device{id: "123"}
+	cache := &TagCache{
+		cache: map[string]map[string]map[string][]*Device{
+			"foo": {
+				"bar": {
+					"baz": {d1},
+				},
+			},
+		},
+	}
+
+	cache.Remove(&Tag{Namespace: "a", Annotation: "bar", Label: "baz"}, d1)
+	cache.Remove(&Tag{Namespace: "foo", Annotation: "a", Label: "baz"}, d1)
+	cache.Remove(&Tag{Namespace: "foo", Annotation: "bar", Label: "a"}, d1)
+	cache.Remove(&Tag{Namespace: "foo", Annotation: "bar", Label: "baz"}, &Device{id: "456"})
+
+	assert.Equal(t, []*Device{d1}, cache.cache["foo"]["bar"]["baz"])
+}
+
 func TestTagCache_GetDevicesFromTags_noNsMatch(t *testing.T) {
 	cache := &TagCache{
 		cache: map[string]map[string]map[string][]*Device{
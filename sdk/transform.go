@@ -42,7 +42,13 @@ type ApplyTransformer struct {
 // built-in functions in the 'funcs' package. A plugin may also register its
 // own. Functions are referenced by name.
 func NewApplyTransformer(fn string) (*ApplyTransformer, error) {
-	f := funcs.Get(fn)
+	return newApplyTransformer(fn, funcs.DefaultRegistry())
+}
+
+// newApplyTransformer creates a new apply transformer, looking up the function
+// by name in the provided registry.
+func newApplyTransformer(fn string, registry *funcs.Registry) (*ApplyTransformer, error) {
+	f := registry.Get(fn)
 	if f == nil {
 		log.WithFields(log.Fields{
 			"fn": fn,
@@ -122,6 +128,12 @@ func (t *ScaleTransformer) Name() string {
 // TransformConfig. If the configuration is incorrect or specifies unsupported
 // values, an error is returned.
 func NewTransformer(cfg *config.TransformConfig) (Transformer, error) {
+	return newTransformer(cfg, funcs.DefaultRegistry())
+}
+
+// newTransformer creates a new device reading Transformer from the provided
+// TransformConfig, resolving any referenced functions from the given registry.
+func newTransformer(cfg *config.TransformConfig, registry *funcs.Registry) (Transformer, error) {
 	if cfg == nil {
 		return nil, ErrNilTransformConfig
 	}
@@ -137,7 +149,7 @@ func NewTransformer(cfg *config.TransformConfig) (Transformer, error) {
 	}
 
 	if cfg.Apply != "" {
-		return NewApplyTransformer(cfg.Apply)
+		return newApplyTransformer(cfg.Apply, registry)
 	} else if cfg.Scale != "" {
 		return NewScaleTransformer(cfg.Scale)
 	} else {
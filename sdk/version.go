@@ -51,15 +51,46 @@ var (
 )
 
 func init() {
-	version = &pluginVersion{
+	version = newPluginVersion(VersionInfo{
+		BuildDate:     BuildDate,
+		GitCommit:     GitCommit,
+		GitTag:        GitTag,
+		GoVersion:     GoVersion,
+		PluginVersion: PluginVersion,
+	})
+}
+
+// VersionInfo is the build-time version information for a plugin. It is used
+// to set a plugin's version via the CustomPluginVersion option.
+type VersionInfo struct {
+	// BuildDate is the timestamp for when the build happened.
+	BuildDate string
+
+	// GitCommit is the commit hash at which the plugin was built.
+	GitCommit string
+
+	// GitTag is the git tag at which the plugin was built.
+	GitTag string
+
+	// GoVersion is is the version of Go used to build the plugin.
+	GoVersion string
+
+	// PluginVersion is the canonical version string for the plugin.
+	PluginVersion string
+}
+
+// newPluginVersion creates the pluginVersion for the given version information.
+// Fields which are not set are reported as "-".
+func newPluginVersion(info VersionInfo) *pluginVersion {
+	return &pluginVersion{
 		Arch:          runtime.GOARCH,
 		OS:            runtime.GOOS,
 		SDKVersion:    Version,
-		BuildDate:     setField(BuildDate),
-		GitCommit:     setField(GitCommit),
-		GitTag:        setField(GitTag),
-		GoVersion:     setField(GoVersion),
-		PluginVersion: setField(PluginVersion),
+		BuildDate:     setField(info.BuildDate),
+		GitCommit:     setField(info.GitCommit),
+		GitTag:        setField(info.GitTag),
+		GoVersion:     setField(info.GoVersion),
+		PluginVersion: setField(info.PluginVersion),
 	}
 }
 
@@ -0,0 +1,176 @@
+// Synse SDK
+// Copyright (c) 2017-2020 Vapor IO
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package sdk
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// msgWriteSuperseded is the transaction message format for writes which were
+// superseded by a newer write for the same device and action before they were
+// run (see WriteSettings.Coalesce). The argument is the newer transaction's ID.
+const msgWriteSuperseded = "write superseded by transaction %s before it was processed"
+
+// msgWriteQueueFull is the transaction message set for writes which were not
+// queued because their device's write queue was full.
+const msgWriteQueueFull = "write rejected: device write queue full"
+
+// dispatchWrite adds a write to its device's write queue, starting a worker to
+// run the device's writes if one is not already running.
+//
+// Each device's writes are run one at a time, in the order in which they were
+// queued, while the writes for different devices run in parallel. If the write's
+// action is coalesced, any write for the same action which is still waiting in
+// the device's queue is superseded by this one.
+//
+// The number of writes waiting in each device's queue is bounded by the write
+// queue size. If the device's queue is full, the write is failed rather than
+// queued, so a device which is slow to write does not hold up the writes of
+// other devices.
+func (scheduler *scheduler) dispatchWrite(w *WriteContext) {
+	id := w.device.id
+
+	scheduler.writeQueuesLock.Lock()
+	defer scheduler.writeQueuesLock.Unlock()
+
+	if scheduler.writeQueues == nil {
+		scheduler.writeQueues = map[string][]*WriteContext{}
+	}
+	queue, running := scheduler.writeQueues[id]
+
+	if scheduler.coalesces(w.data.Action) {
+		pending := queue[:0]
+		for _, queued := range queue {
+			if queued.data.Action == w.data.Action {
+				supersedeWrite(queued, w)
+				continue
+			}
+			pending = append(pending, queued)
+		}
+		queue = pending
+	}
+
+	if size := scheduler.config.Write.QueueSize; size > 0 && len(queue) >= size {
+		scheduler.writeQueues[id] = queue
+		log.WithFields(log.Fields{
+			"device":      id,
+			"transaction": w.transaction.id,
+			"size":        size,
+		}).Warn("[scheduler] device write queue full, failing write")
+		w.transaction.message = msgWriteQueueFull
+		w.transaction.setStatusError()
+		return
+	}
+	scheduler.writeQueues[id] = append(queue, w)
+
+	if !running {
+		scheduler.writeWorkers.Add(1)
+		go scheduler.runWrites(id)
+	}
+}
+
+// runWrites runs the writes queued for a device in order until its queue is
+// empty. If the scheduler is stopped, any writes still waiting in the queue
+// are failed rather than run.
+func (scheduler *scheduler) runWrites(id string) {
+	defer scheduler.writeWorkers.Done()
+
+	for {
+		w := scheduler.nextWrite(id)
+		if w == nil {
+			return
+		}
+
+		select {
+		case <-scheduler.stop:
+			w.transaction.message = msgWriteCancelled
+			w.transaction.setStatusError()
+			log.WithFields(log.Fields{
+				"device":      id,
+				"transaction": w.transaction.id,
+			}).Warn("[scheduler] failed queued write on stop")
+		default:
+			scheduler.write(w)
+		}
+	}
+}
+
+// nextWrite removes the next write from a device's write queue. If the queue
+// is empty, it is removed and nil is returned, so the next write dispatched to
+// the device starts a new worker.
+func (scheduler *scheduler) nextWrite(id string) *WriteContext {
+	scheduler.writeQueuesLock.Lock()
+	defer scheduler.writeQueuesLock.Unlock()
+
+	queue := scheduler.writeQueues[id]
+	if len(queue) == 0 {
+		delete(scheduler.writeQueues, id)
+		return nil
+	}
+	scheduler.writeQueues[id] = queue[1:]
+	return queue[0]
+}
+
+// writeQueueUsage gets the usage of the fullest device write queue, as a fraction
+// of the write queue size, along with the ID of its device. If no writes are
+// queued, or the device write queues are unbounded, the usage is 0.
+func (scheduler *scheduler) writeQueueUsage() (string, float64) {
+	size := scheduler.config.Write.QueueSize
+	if size <= 0 {
+		return "", 0
+	}
+
+	scheduler.writeQueuesLock.Lock()
+	defer scheduler.writeQueuesLock.Unlock()
+
+	var (
+		fullest string
+		queued  int
+	)
+	for id, queue := range scheduler.writeQueues {
+		if len(queue) > queued {
+			fullest, queued = id, len(queue)
+		}
+	}
+	return fullest, float64(queued) / float64(size)
+}
+
+// coalesces checks whether queued writes for the given action are coalesced.
+func (scheduler *scheduler) coalesces(action string) bool {
+	for _, a := range scheduler.config.Write.Coalesce {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+// supersedeWrite ends the transaction of a queued write which was superseded by
+// a newer write, without running it.
+func supersedeWrite(superseded, by *WriteContext) {
+	log.WithFields(log.Fields{
+		"device":       superseded.device.id,
+		"action":       superseded.data.Action,
+		"transaction":  superseded.transaction.id,
+		"supersededBy": by.transaction.id,
+	}).Debug("[scheduler] queued write superseded")
+
+	superseded.transaction.message = fmt.Sprintf(msgWriteSuperseded, by.transaction.id)
+	superseded.transaction.setStatusError()
+}
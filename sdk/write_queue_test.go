@@ -0,0 +1,381 @@
+// Synse SDK
+// Copyright (c) 2017-2020 Vapor IO
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package sdk
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vapor-ware/synse-sdk/sdk/config"
+	synse "github.com/vapor-ware/synse-server-grpc/go"
+)
+
+// queuedWrite creates a write for the given device with the given action and data.
+func queuedWrite(device *Device, action, data string) *WriteContext {
+	return &WriteContext{
+		transaction: newTransaction(time.Minute, ""),
+		device:      device,
+		data:        &synse.V3WriteData{Action: action, Data: []byte(data)},
+	}
+}
+
+// recordingWriter is a device write handler which records the data it writes. If
+// a gate is set, the write of the data matching it blocks until the gate is closed.
+type recordingWriter struct {
+	lock    sync.Mutex
+	written []string
+	tracker concurrencyTracker
+
+	gateOn  string
+	gate    chan struct{}
+	entered chan struct{}
+}
+
+func newRecordingWriter(gateOn string) *recordingWriter {
+	return &recordingWriter{
+		gateOn:  gateOn,
+		gate:    make(chan struct{}),
+		entered: make(chan struct{}, 1),
+	}
+}
+
+func (writer *recordingWriter) write(device *Device, data *WriteData) error {
+	defer writer.tracker.enter()()
+
+	if string(data.Data) == writer.gateOn {
+		writer.entered <- struct{}{}
+		<-writer.gate
+	}
+
+	writer.lock.Lock()
+	defer writer.lock.Unlock()
+	writer.written = append(writer.written, fmt.Sprintf("%s:%s", data.Action, data.Data))
+	return nil
+}
+
+func (writer *recordingWriter) getWritten() []string {
+	writer.lock.Lock()
+	defer writer.lock.Unlock()
+	return append([]string{}, writer.written...)
+}
+
+func TestScheduler_dispatchWrite_inOrder(t *testing.T) {
+	s := newTestScheduler()
+	writer := newRecordingWriter("1")
+	device := &Device{id: "1", handler: &DeviceHandler{Write: writer.write}, WriteTimeout: time.Minute}
+
+	var writes []*WriteContext
+	for i := 1; i <= 5; i++ {
+		w := queuedWrite(device, "speed", fmt.Sprint(i))
+		writes = append(writes, w)
+		s.dispatchWrite(w)
+
+		// Hold the first write so that the others are queued behind it.
+		if i == 1 {
+			<-writer.entered
+		}
+	}
+	close(writer.gate)
+
+	for _, w := range writes {
+		w.transaction.wait()
+		assert.Equal(t, statusDone, w.transaction.status, w.transaction.message)
+	}
+	s.writeWorkers.Wait()
+
+	assert.Equal(t, []string{"speed:1", "speed:2", "speed:3", "speed:4", "speed:5"}, writer.getWritten())
+	assert.Equal(t, int32(1), writer.tracker.max)
+	assert.Empty(t, s.writeQueues)
+}
+
+func TestScheduler_dispatchWrite_devicesInParallel(t *testing.T) {
+	s := newTestScheduler()
+	tracker := &concurrencyTracker{}
+	handler := &DeviceHandler{
+		Write: func(device *Device, data *WriteData) error {
+			tracker.run(50 * time.Millisecond)
+			return nil
+		},
+	}
+
+	var writes []*WriteContext
+	for i := 0; i < 3; i++ {
+		device := &Device{id: fmt.Sprint(i), handler: handler, WriteTimeout: time.Minute}
+		for j := 0; j < 2; j++ {
+			w := queuedWrite(device, "speed", fmt.Sprint(j))
+			writes = append(writes, w)
+			s.dispatchWrite(w)
+		}
+	}
+
+	for _, w := range writes {
+		w.transaction.wait()
+		assert.Equal(t, statusDone, w.transaction.status, w.transaction.message)
+	}
+	s.writeWorkers.Wait()
+
+	// Each device writes one at a time, but the devices write in parallel.
+	assert.Equal(t, int32(3), tracker.max)
+}
+
+func TestScheduler_dispatchWrite_coalesce(t *testing.T) {
+	s := newTestScheduler()
+	s.config.Write.Coalesce = []string{"speed"}
+	writer := newRecordingWriter("1")
+	device := &Device{id: "1", handler: &DeviceHandler{Write: writer.write}, WriteTimeout: time.Minute}
+
+	inProgress := queuedWrite(device, "speed", "1")
+	s.dispatchWrite(inProgress)
+	<-writer.entered
+
+	superseded := queuedWrite(device, "speed", "2")
+	other := queuedWrite(device, "mode", "auto")
+	latest := queuedWrite(device, "speed", "3")
+	s.dispatchWrite(superseded)
+	s.dispatchWrite(other)
+	s.dispatchWrite(latest)
+
+	// The superseded write ends without waiting for the device.
+	superseded.transaction.wait()
+	assert.Equal(t, statusError, superseded.transaction.status)
+	assert.Equal(t, fmt.Sprintf(msgWriteSuperseded, latest.transaction.id), superseded.transaction.message)
+
+	close(writer.gate)
+	for _, w := range []*WriteContext{inProgress, other, latest} {
+		w.transaction.wait()
+		assert.Equal(t, statusDone, w.transaction.status, w.transaction.message)
+	}
+	s.writeWorkers.Wait()
+
+	// The write in progress when the newer writes were queued is not superseded.
+	assert.Equal(t, []string{"speed:1", "mode:auto", "speed:3"}, writer.getWritten())
+}
+
+func TestScheduler_dispatchWrite_notCoalesced(t *testing.T) {
+	s := newTestScheduler()
+	s.config.Write.Coalesce = []string{"mode"}
+	writer := newRecordingWriter("1")
+	device := &Device{id: "1", handler: &DeviceHandler{Write: writer.write}, WriteTimeout: time.Minute}
+
+	var writes []*WriteContext
+	for i := 1; i <= 3; i++ {
+		w := queuedWrite(device, "speed", fmt.Sprint(i))
+		writes = append(writes, w)
+		s.dispatchWrite(w)
+		if i == 1 {
+			<-writer.entered
+		}
+	}
+	close(writer.gate)
+
+	for _, w := range writes {
+		w.transaction.wait()
+		assert.Equal(t, statusDone, w.transaction.status, w.transaction.message)
+	}
+	s.writeWorkers.Wait()
+	assert.Equal(t, []string{"speed:1", "speed:2", "speed:3"}, writer.getWritten())
+}
+
+func TestScheduler_dispatchWrite_stopped(t *testing.T) {
+	s := newTestScheduler()
+	writer := newRecordingWriter("1")
+	device := &Device{id: "1", handler: &DeviceHandler{Write: writer.write}, WriteTimeout: time.Minute}
+
+	inProgress := queuedWrite(device, "speed", "1")
+	s.dispatchWrite(inProgress)
+	<-writer.entered
+
+	queued := queuedWrite(device, "speed", "2")
+	s.dispatchWrite(queued)
+
+	close(s.stop)
+	s.writeWorkers.Wait()
+	close(writer.gate)
+
+	// The write in progress is cancelled (see TestScheduler_write_cancelledOnStop),
+	// and the queued write is never run.
+	assert.Equal(t, statusError, inProgress.transaction.status)
+	assert.Equal(t, statusError, queued.transaction.status)
+	assert.Equal(t, msgWriteCancelled, queued.transaction.message)
+	assert.NotContains(t, writer.getWritten(), "speed:2")
+}
+
+func TestScheduler_dispatchWrite_overrunHoldsQueue(t *testing.T) {
+	s := newTestScheduler()
+	writer := newRecordingWriter("1")
+	device := &Device{id: "1", handler: &DeviceHandler{Write: writer.write}, WriteTimeout: 10 * time.Millisecond}
+
+	overrun := queuedWrite(device, "speed", "1")
+	s.dispatchWrite(overrun)
+	<-writer.entered
+	next := queuedWrite(device, "speed", "2")
+	s.dispatchWrite(next)
+
+	// The first write fails once it overruns its timeout, but the next write
+	// for the device does not start until its handler returns.
+	overrun.transaction.wait()
+	assert.Contains(t, overrun.transaction.message, msgWriteOverrun)
+	select {
+	case <-next.transaction.done:
+		t.Fatal("next write ran before the overrunning write returned")
+	case <-time.After(20 * time.Millisecond):
+	}
+	assert.Empty(t, writer.getWritten())
+
+	close(writer.gate)
+	next.transaction.wait()
+	s.writeWorkers.Wait()
+	assert.Equal(t, statusDone, next.transaction.status, next.transaction.message)
+	assert.Equal(t, []string{"speed:1", "speed:2"}, writer.getWritten())
+	assert.Equal(t, int32(1), writer.tracker.max)
+}
+
+func TestScheduler_dispatchWrite_overrunHoldsLockGroup(t *testing.T) {
+	s := newTestScheduler()
+	s.config.LockGroups = &config.LockGroupSettings{DataKey: "bus"}
+	writer := newRecordingWriter("1")
+	handler := &DeviceHandler{Write: writer.write}
+	device1 := &Device{id: "1", handler: handler, WriteTimeout: 10 * time.Millisecond, Data: map[string]interface{}{"bus": 1}}
+	device2 := &Device{id: "2", handler: handler, WriteTimeout: time.Minute, Data: map[string]interface{}{"bus": 1}}
+
+	overrun := queuedWrite(device1, "speed", "1")
+	s.dispatchWrite(overrun)
+	<-writer.entered
+
+	// The write to the other device in the lock group does not start until
+	// the overrunning write's handler returns.
+	overrun.transaction.wait()
+	next := queuedWrite(device2, "speed", "2")
+	s.dispatchWrite(next)
+	select {
+	case <-next.transaction.done:
+		t.Fatal("write in the lock group ran before the overrunning write returned")
+	case <-time.After(20 * time.Millisecond):
+	}
+	assert.Empty(t, writer.getWritten())
+
+	close(writer.gate)
+	next.transaction.wait()
+	s.writeWorkers.Wait()
+	assert.Equal(t, statusDone, next.transaction.status, next.transaction.message)
+	assert.Equal(t, []string{"speed:1", "speed:2"}, writer.getWritten())
+	assert.Equal(t, int32(1), writer.tracker.max)
+}
+
+func TestScheduler_dispatchWrite_queueFull(t *testing.T) {
+	s := newTestScheduler()
+	s.config.Write.QueueSize = 1
+	writer := newRecordingWriter("1")
+	handler := &DeviceHandler{Write: writer.write}
+	device := &Device{id: "1", handler: handler, WriteTimeout: time.Minute}
+
+	// The first write is taken from the queue to be run, and the second fills
+	// the queue.
+	s.dispatchWrite(queuedWrite(device, "speed", "1"))
+	<-writer.entered
+	queued := queuedWrite(device, "speed", "2")
+	s.dispatchWrite(queued)
+
+	// The device's queue is full, so the next write is failed without waiting.
+	rejected := queuedWrite(device, "speed", "3")
+	s.dispatchWrite(rejected)
+	assert.Equal(t, statusError, rejected.transaction.status)
+	assert.Equal(t, msgWriteQueueFull, rejected.transaction.message)
+
+	// Writes to other devices are not held up by the full queue.
+	other := queuedWrite(&Device{id: "2", handler: handler, WriteTimeout: time.Minute}, "speed", "4")
+	s.dispatchWrite(other)
+	other.transaction.wait()
+	assert.Equal(t, statusDone, other.transaction.status, other.transaction.message)
+
+	close(writer.gate)
+	queued.transaction.wait()
+	s.writeWorkers.Wait()
+	assert.Equal(t, statusDone, queued.transaction.status, queued.transaction.message)
+	assert.Equal(t, []string{"speed:4", "speed:1", "speed:2"}, writer.getWritten())
+}
+
+func TestScheduler_dispatchWrite_queueFullCoalesced(t *testing.T) {
+	s := newTestScheduler()
+	s.config.Write.QueueSize = 1
+	s.config.Write.Coalesce = []string{"speed"}
+	writer := newRecordingWriter("1")
+	device := &Device{id: "1", handler: &DeviceHandler{Write: writer.write}, WriteTimeout: time.Minute}
+
+	s.dispatchWrite(queuedWrite(device, "speed", "1"))
+	<-writer.entered
+	superseded := queuedWrite(device, "speed", "2")
+	s.dispatchWrite(superseded)
+
+	// The write supersedes the queued write, so it takes its place in the
+	// full queue.
+	latest := queuedWrite(device, "speed", "3")
+	s.dispatchWrite(latest)
+	assert.Equal(t, statusError, superseded.transaction.status)
+
+	close(writer.gate)
+	latest.transaction.wait()
+	s.writeWorkers.Wait()
+	assert.Equal(t, statusDone, latest.transaction.status, latest.transaction.message)
+	assert.Equal(t, []string{"speed:1", "speed:3"}, writer.getWritten())
+}
+
+func TestScheduler_writeQueueUsage(t *testing.T) {
+	s := newTestScheduler()
+	device, usage := s.writeQueueUsage()
+	assert.Empty(t, device)
+	assert.Equal(t, float64(0), usage)
+
+	s.config.Write.QueueSize = 4
+	s.writeQueues = map[string][]*WriteContext{
+		"1": make([]*WriteContext, 1),
+		"2": make([]*WriteContext, 3),
+		"3": {},
+	}
+	device, usage = s.writeQueueUsage()
+	assert.Equal(t, "2", device)
+	assert.Equal(t, 0.75, usage)
+}
+
+func TestScheduler_checkWriteQueues(t *testing.T) {
+	s := newTestScheduler()
+	s.config.Write.QueueSize = 2
+	assert.NoError(t, s.checkWriteQueues())
+
+	// A full device write queue is unhealthy, even if the write queue is not.
+	s.writeQueues = map[string][]*WriteContext{"1": make([]*WriteContext, 2)}
+	assert.EqualError(t, s.checkWriteQueues(), "write queue usage for device 1 >95%, consider increasing size in configuration")
+
+	s.writeQueues = nil
+	for i := 0; i < cap(s.writeChan); i++ {
+		s.writeChan <- &WriteContext{}
+	}
+	assert.EqualError(t, s.checkWriteQueues(), "write queue usage >95%, consider increasing size in configuration")
+}
+
+func TestScheduler_coalesces(t *testing.T) {
+	s := newTestScheduler()
+	s.config.Write.Coalesce = []string{"speed", "mode"}
+
+	assert.True(t, s.coalesces("speed"))
+	assert.True(t, s.coalesces("mode"))
+	assert.False(t, s.coalesces("color"))
+	assert.False(t, newTestScheduler().coalesces("speed"))
+}
@@ -0,0 +1,410 @@
+// Synse SDK
+// Copyright (c) 2017-2020 Vapor IO
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package sdk
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	synse "github.com/vapor-ware/synse-server-grpc/go"
+)
+
+// Transaction messages for scheduled writes. A scheduled write's transaction
+// stays pending, with msgWriteScheduled as its message, until the write is due.
+const (
+	msgWriteScheduled         = "write scheduled for %s"
+	msgWriteScheduleCancelled = "scheduled write cancelled before it was due"
+)
+
+// scheduledWrite is a device write which is held in the write schedule until
+// it is due. Its exported fields are what is saved to the schedule file.
+type scheduledWrite struct {
+	Transaction string    `json:"transaction"`
+	Device      string    `json:"device"`
+	Action      string    `json:"action"`
+	Data        []byte    `json:"data,omitempty"`
+	At          time.Time `json:"at"`
+
+	write *WriteContext
+}
+
+// writeSchedule holds scheduled writes, ordered by the time they are due. If it
+// has a file path, the schedule is saved to the file whenever it changes, so the
+// writes which are not yet due survive a plugin restart.
+type writeSchedule struct {
+	path string
+
+	lock   sync.Mutex
+	writes []*scheduledWrite
+
+	// wake is signalled when a write is added to the schedule, since it may
+	// be due before the write the scheduler is currently waiting on.
+	wake chan struct{}
+}
+
+// newWriteSchedule creates a new write schedule which is saved to the given
+// file. If the path is empty, the schedule is only held in memory.
+func newWriteSchedule(path string) *writeSchedule {
+	return &writeSchedule{
+		path: path,
+		wake: make(chan struct{}, 1),
+	}
+}
+
+// add adds a write to the schedule. Writes which are due at the same time stay
+// in the order in which they were added. If the schedule could not be saved,
+// the write is not added.
+func (schedule *writeSchedule) add(w *scheduledWrite) error {
+	schedule.lock.Lock()
+	defer schedule.lock.Unlock()
+
+	i := sort.Search(len(schedule.writes), func(i int) bool {
+		return schedule.writes[i].At.After(w.At)
+	})
+	writes := append(schedule.writes[:i:i], w)
+	writes = append(writes, schedule.writes[i:]...)
+
+	previous := schedule.writes
+	schedule.writes = writes
+	if err := schedule.save(); err != nil {
+		schedule.writes = previous
+		return err
+	}
+
+	select {
+	case schedule.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// remove removes the write with the given transaction ID from the schedule,
+// returning it. If no such write is scheduled, nil is returned.
+func (schedule *writeSchedule) remove(id string) *scheduledWrite {
+	schedule.lock.Lock()
+	defer schedule.lock.Unlock()
+
+	for i, w := range schedule.writes {
+		if w.Transaction == id {
+			schedule.writes = append(schedule.writes[:i:i], schedule.writes[i+1:]...)
+			schedule.trySave()
+			return w
+		}
+	}
+	return nil
+}
+
+// due removes and returns the writes which are due at the given time, in the
+// order in which they are due.
+func (schedule *writeSchedule) due(now time.Time) []*scheduledWrite {
+	schedule.lock.Lock()
+	defer schedule.lock.Unlock()
+
+	i := sort.Search(len(schedule.writes), func(i int) bool {
+		return schedule.writes[i].At.After(now)
+	})
+	if i == 0 {
+		return nil
+	}
+	due := schedule.writes[:i:i]
+	schedule.writes = schedule.writes[i:]
+	schedule.trySave()
+	return due
+}
+
+// next gets the time at which the next scheduled write is due. If there are no
+// scheduled writes, false is returned.
+func (schedule *writeSchedule) next() (time.Time, bool) {
+	schedule.lock.Lock()
+	defer schedule.lock.Unlock()
+
+	if len(schedule.writes) == 0 {
+		return time.Time{}, false
+	}
+	return schedule.writes[0].At, true
+}
+
+// load loads the writes saved to the schedule file, in the order in which they
+// are due. If there is no schedule file, no writes are loaded.
+func (schedule *writeSchedule) load() ([]*scheduledWrite, error) {
+	if schedule.path == "" {
+		return nil, nil
+	}
+
+	data, err := ioutil.ReadFile(schedule.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var writes []*scheduledWrite
+	if err := json.Unmarshal(data, &writes); err != nil {
+		return nil, fmt.Errorf("failed to parse write schedule file %s: %w", schedule.path, err)
+	}
+	sort.SliceStable(writes, func(i, j int) bool {
+		return writes[i].At.Before(writes[j].At)
+	})
+	return writes, nil
+}
+
+// save saves the scheduled writes to the schedule file, if it has one. The file
+// is replaced atomically so a failed save does not lose the previous schedule.
+// The schedule lock should be held when this is called.
+func (schedule *writeSchedule) save() error {
+	if schedule.path == "" {
+		return nil
+	}
+
+	writes := schedule.writes
+	if writes == nil {
+		writes = []*scheduledWrite{}
+	}
+	data, err := json.MarshalIndent(writes, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := schedule.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, schedule.path)
+}
+
+// trySave saves the scheduled writes, logging any error. It is used when the
+// schedule changes in a way which can not be undone, such as when writes are
+// removed from the schedule to be run.
+func (schedule *writeSchedule) trySave() {
+	if err := schedule.save(); err != nil {
+		log.WithFields(log.Fields{
+			"file":  schedule.path,
+			"error": err,
+		}).Error("[scheduler] failed to save write schedule")
+	}
+}
+
+// WriteAt schedules a write request to be queued into the scheduler's write
+// queue at the given time. Until then, the transactions for the writes are
+// pending and the writes can be cancelled (see cancelScheduledWrite).
+// If any of the request's writes can not be scheduled, none of them are.
+func (scheduler *scheduler) WriteAt(device *Device, data []*synse.V3WriteData, at time.Time) ([]*synse.V3WriteTransaction, error) {
+	if device == nil {
+		return nil, ErrNilDevice
+	}
+	if data == nil {
+		return nil, ErrNilData
+	}
+	if !device.IsWritable() {
+		return nil, ErrDeviceNotWritable
+	}
+
+	if scheduler.isStopped() {
+		return nil, ErrSchedulerStopped
+	}
+
+	var response []*synse.V3WriteTransaction
+	for _, writeData := range data {
+		t, err := scheduler.stateManager.newTransaction(device.WriteTimeout, writeData.Transaction)
+		if err != nil {
+			scheduler.unscheduleWrites(response, err)
+			return nil, err
+		}
+		t.context = writeData
+		t.message = fmt.Sprintf(msgWriteScheduled, at.Format(time.RFC3339))
+		t.setStatusPending()
+		scheduler.stateManager.holdTransaction(t, at)
+
+		err = scheduler.schedule.add(&scheduledWrite{
+			Transaction: t.id,
+			Device:      device.id,
+			Action:      writeData.Action,
+			Data:        writeData.Data,
+			At:          at,
+			write: &WriteContext{
+				transaction: t,
+				device:      device,
+				data:        writeData,
+			},
+		})
+		if err != nil {
+			t.message = fmt.Sprintf("failed to schedule write: %v", err)
+			t.setStatusError()
+			scheduler.unscheduleWrites(response, err)
+			return nil, err
+		}
+
+		log.WithFields(log.Fields{
+			"device":      device.id,
+			"transaction": t.id,
+			"at":          at,
+		}).Debug("[scheduler] scheduled device write")
+
+		response = append(response, &synse.V3WriteTransaction{
+			Id:      t.id,
+			Device:  device.GetID(),
+			Context: writeData,
+			Timeout: device.WriteTimeout.String(),
+		})
+	}
+	return response, nil
+}
+
+// unscheduleWrites removes the writes of a request which were scheduled before
+// another of its writes failed to be scheduled, so the request is scheduled either
+// in full or not at all. Their transactions are failed with the given error.
+func (scheduler *scheduler) unscheduleWrites(scheduled []*synse.V3WriteTransaction, err error) {
+	for _, txn := range scheduled {
+		w := scheduler.schedule.remove(txn.Id)
+		if w == nil {
+			continue
+		}
+		w.write.transaction.message = fmt.Sprintf("failed to schedule write: %v", err)
+		w.write.transaction.setStatusError()
+	}
+}
+
+// cancelScheduledWrite cancels the scheduled write with the given transaction ID,
+// if it is not yet due. The cancelled transaction is returned. If there is no
+// such scheduled write, nil is returned.
+func (scheduler *scheduler) cancelScheduledWrite(id string) *transaction {
+	w := scheduler.schedule.remove(id)
+	if w == nil {
+		return nil
+	}
+
+	log.WithFields(log.Fields{
+		"device":      w.Device,
+		"transaction": id,
+		"at":          w.At,
+	}).Info("[scheduler] cancelled scheduled device write")
+
+	w.write.transaction.message = msgWriteScheduleCancelled
+	w.write.transaction.setStatusError()
+	return w.write.transaction
+}
+
+// runSchedule queues scheduled writes into the write queue as they come due,
+// until the scheduler is stopped. Any writes restored from the schedule file
+// (see restoreSchedule) which came due while the plugin was not running are
+// queued right away.
+func (scheduler *scheduler) runSchedule() {
+	for {
+		for _, w := range scheduler.schedule.due(time.Now()) {
+			if err := scheduler.queueWrites(w.write); err != nil {
+				// The scheduler is stopping, so keep the write in the schedule
+				// to be run when the plugin is next started.
+				if err := scheduler.schedule.add(w); err != nil {
+					log.WithFields(log.Fields{
+						"transaction": w.Transaction,
+						"error":       err,
+					}).Error("[scheduler] failed to keep scheduled write on stop")
+				}
+				continue
+			}
+			log.WithFields(log.Fields{
+				"device":      w.Device,
+				"transaction": w.Transaction,
+			}).Debug("[scheduler] queued scheduled device write")
+		}
+
+		var timer *time.Timer
+		var fire <-chan time.Time
+		if at, ok := scheduler.schedule.next(); ok {
+			timer = time.NewTimer(time.Until(at))
+			fire = timer.C
+		}
+
+		select {
+		case <-scheduler.stop:
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		case <-scheduler.schedule.wake:
+		case <-fire:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// restoreSchedule restores the writes saved to the schedule file, creating a
+// pending transaction for each. Writes for devices which no longer exist are
+// dropped from the schedule. It is called when the scheduler starts, before any
+// writes can be scheduled.
+func (scheduler *scheduler) restoreSchedule() {
+	writes, err := scheduler.schedule.load()
+	if err != nil {
+		log.WithField("error", err).Error("[scheduler] failed to load write schedule")
+		return
+	}
+
+	var restored []*scheduledWrite
+	for _, w := range writes {
+		wlog := log.WithFields(log.Fields{
+			"device":      w.Device,
+			"transaction": w.Transaction,
+			"at":          w.At,
+		})
+
+		device := scheduler.deviceManager.GetDevice(w.Device)
+		if device == nil {
+			wlog.Warn("[scheduler] dropping scheduled write for unknown device")
+			continue
+		}
+
+		t, err := scheduler.stateManager.newTransaction(device.WriteTimeout, w.Transaction)
+		if err != nil {
+			wlog.WithField("error", err).Warn("[scheduler] dropping scheduled write")
+			continue
+		}
+		data := &synse.V3WriteData{
+			Action:      w.Action,
+			Data:        w.Data,
+			Transaction: w.Transaction,
+		}
+		t.context = data
+		t.message = fmt.Sprintf(msgWriteScheduled, w.At.Format(time.RFC3339))
+		t.setStatusPending()
+		scheduler.stateManager.holdTransaction(t, w.At)
+
+		w.write = &WriteContext{
+			transaction: t,
+			device:      device,
+			data:        data,
+		}
+		restored = append(restored, w)
+	}
+
+	scheduler.schedule.lock.Lock()
+	scheduler.schedule.writes = restored
+	scheduler.schedule.trySave()
+	scheduler.schedule.lock.Unlock()
+
+	if len(restored) > 0 {
+		log.WithField("writes", len(restored)).Info("[scheduler] restored scheduled writes")
+	}
+}
@@ -0,0 +1,285 @@
+// Synse SDK
+// Copyright (c) 2017-2020 Vapor IO
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package sdk
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	synse "github.com/vapor-ware/synse-server-grpc/go"
+)
+
+func newWritableTestDevice(id string) *Device {
+	return &Device{
+		id: id,
+		handler: &DeviceHandler{
+			Write: func(device *Device, data *WriteData) error { return nil },
+		},
+		WriteTimeout: time.Minute,
+	}
+}
+
+// scheduledIDs gets the transaction IDs of the writes in a schedule, in order.
+func scheduledIDs(schedule *writeSchedule) []string {
+	schedule.lock.Lock()
+	defer schedule.lock.Unlock()
+
+	var ids []string
+	for _, w := range schedule.writes {
+		ids = append(ids, w.Transaction)
+	}
+	return ids
+}
+
+func TestWriteSchedule_add(t *testing.T) {
+	schedule := newWriteSchedule("")
+	now := time.Now()
+
+	assert.NoError(t, schedule.add(&scheduledWrite{Transaction: "1", At: now.Add(2 * time.Minute)}))
+	assert.NoError(t, schedule.add(&scheduledWrite{Transaction: "2", At: now.Add(time.Minute)}))
+	assert.NoError(t, schedule.add(&scheduledWrite{Transaction: "3", At: now.Add(3 * time.Minute)}))
+	assert.NoError(t, schedule.add(&scheduledWrite{Transaction: "4", At: now.Add(time.Minute)}))
+
+	// Writes due at the same time stay in the order they were added.
+	assert.Equal(t, []string{"2", "4", "1", "3"}, scheduledIDs(schedule))
+	assert.Len(t, schedule.wake, 1)
+
+	next, ok := schedule.next()
+	assert.True(t, ok)
+	assert.Equal(t, now.Add(time.Minute), next)
+}
+
+func TestWriteSchedule_remove(t *testing.T) {
+	schedule := newWriteSchedule("")
+	now := time.Now()
+	for i := 1; i <= 3; i++ {
+		assert.NoError(t, schedule.add(&scheduledWrite{Transaction: fmt.Sprint(i), At: now.Add(time.Duration(i) * time.Minute)}))
+	}
+
+	w := schedule.remove("2")
+	assert.NotNil(t, w)
+	assert.Equal(t, "2", w.Transaction)
+	assert.Equal(t, []string{"1", "3"}, scheduledIDs(schedule))
+
+	assert.Nil(t, schedule.remove("2"))
+	assert.Nil(t, schedule.remove("4"))
+}
+
+func TestWriteSchedule_due(t *testing.T) {
+	schedule := newWriteSchedule("")
+	now := time.Now()
+	for i := 1; i <= 3; i++ {
+		assert.NoError(t, schedule.add(&scheduledWrite{Transaction: fmt.Sprint(i), At: now.Add(time.Duration(i) * time.Minute)}))
+	}
+
+	assert.Empty(t, schedule.due(now))
+
+	due := schedule.due(now.Add(2 * time.Minute))
+	assert.Len(t, due, 2)
+	assert.Equal(t, "1", due[0].Transaction)
+	assert.Equal(t, "2", due[1].Transaction)
+	assert.Equal(t, []string{"3"}, scheduledIDs(schedule))
+
+	schedule.due(now.Add(time.Hour))
+	_, ok := schedule.next()
+	assert.False(t, ok)
+}
+
+func TestWriteSchedule_saveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedule.json")
+	schedule := newWriteSchedule(path)
+	now := time.Now().Round(0)
+
+	assert.NoError(t, schedule.add(&scheduledWrite{Transaction: "1", Device: "a", Action: "speed", Data: []byte("40"), At: now.Add(time.Hour)}))
+	assert.NoError(t, schedule.add(&scheduledWrite{Transaction: "2", Device: "b", Action: "state", At: now.Add(time.Minute)}))
+
+	loaded, err := newWriteSchedule(path).load()
+	assert.NoError(t, err)
+	assert.Len(t, loaded, 2)
+	assert.Equal(t, "2", loaded[0].Transaction)
+	assert.Equal(t, "1", loaded[1].Transaction)
+	assert.Equal(t, "a", loaded[1].Device)
+	assert.Equal(t, "speed", loaded[1].Action)
+	assert.Equal(t, []byte("40"), loaded[1].Data)
+	assert.True(t, now.Add(time.Hour).Equal(loaded[1].At))
+
+	// Writes removed from the schedule are removed from the file.
+	schedule.remove("1")
+	schedule.due(now.Add(time.Hour))
+	loaded, err = newWriteSchedule(path).load()
+	assert.NoError(t, err)
+	assert.Empty(t, loaded)
+}
+
+func TestWriteSchedule_load_noFile(t *testing.T) {
+	loaded, err := newWriteSchedule(filepath.Join(t.TempDir(), "schedule.json")).load()
+	assert.NoError(t, err)
+	assert.Empty(t, loaded)
+
+	loaded, err = newWriteSchedule("").load()
+	assert.NoError(t, err)
+	assert.Empty(t, loaded)
+}
+
+func TestWriteSchedule_load_invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedule.json")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("not json"), 0600))
+
+	_, err := newWriteSchedule(path).load()
+	assert.Error(t, err)
+}
+
+func TestWriteSchedule_add_saveFails(t *testing.T) {
+	schedule := newWriteSchedule(filepath.Join(t.TempDir(), "missing", "schedule.json"))
+
+	err := schedule.add(&scheduledWrite{Transaction: "1", At: time.Now()})
+	assert.Error(t, err)
+	assert.Empty(t, scheduledIDs(schedule))
+}
+
+func TestScheduler_WriteAt(t *testing.T) {
+	device := newWritableTestDevice("1")
+	s := newTestScheduler(device)
+	at := time.Now().Add(time.Hour)
+
+	transactions, err := s.WriteAt(device, []*synse.V3WriteData{{Action: "speed"}, {Action: "state"}}, at)
+	assert.NoError(t, err)
+	assert.Len(t, transactions, 2)
+	assert.Empty(t, s.writeChan)
+
+	for _, txn := range transactions {
+		txn := s.stateManager.getTransaction(txn.Id)
+		assert.NotNil(t, txn)
+		assert.Equal(t, statusPending, txn.status)
+		assert.Equal(t, fmt.Sprintf(msgWriteScheduled, at.Format(time.RFC3339)), txn.message)
+	}
+	assert.Equal(t, []string{transactions[0].Id, transactions[1].Id}, scheduledIDs(s.schedule))
+}
+
+func TestScheduler_WriteAt_errors(t *testing.T) {
+	device := newWritableTestDevice("1")
+	s := newTestScheduler(device)
+	data := []*synse.V3WriteData{{Action: "speed"}}
+
+	_, err := s.WriteAt(nil, data, time.Now())
+	assert.Equal(t, ErrNilDevice, err)
+
+	_, err = s.WriteAt(device, nil, time.Now())
+	assert.Equal(t, ErrNilData, err)
+
+	_, err = s.WriteAt(&Device{handler: &DeviceHandler{}}, data, time.Now())
+	assert.Equal(t, ErrDeviceNotWritable, err)
+
+	s.stopped = true
+	_, err = s.WriteAt(device, data, time.Now())
+	assert.Equal(t, ErrSchedulerStopped, err)
+}
+
+func TestScheduler_WriteAt_rollback(t *testing.T) {
+	device := newWritableTestDevice("1")
+	s := newTestScheduler(device)
+	data := []*synse.V3WriteData{
+		{Action: "speed", Transaction: "1"},
+		{Action: "state", Transaction: "1"},
+	}
+
+	// The second write can not be scheduled, since its transaction ID is in use,
+	// so the first write is removed from the schedule and its transaction failed.
+	_, err := s.WriteAt(device, data, time.Now().Add(time.Hour))
+	assert.Error(t, err)
+	assert.Empty(t, scheduledIDs(s.schedule))
+
+	txn := s.stateManager.getTransaction("1")
+	assert.NotNil(t, txn)
+	assert.Equal(t, statusError, txn.status)
+}
+
+func TestScheduler_cancelScheduledWrite(t *testing.T) {
+	device := newWritableTestDevice("1")
+	s := newTestScheduler(device)
+
+	transactions, err := s.WriteAt(device, []*synse.V3WriteData{{Action: "speed"}}, time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+
+	txn := s.cancelScheduledWrite(transactions[0].Id)
+	assert.NotNil(t, txn)
+	assert.Equal(t, statusError, txn.status)
+	assert.Equal(t, msgWriteScheduleCancelled, txn.message)
+	assert.Empty(t, scheduledIDs(s.schedule))
+
+	// A write can only be cancelled once.
+	assert.Nil(t, s.cancelScheduledWrite(transactions[0].Id))
+}
+
+func TestScheduler_runSchedule(t *testing.T) {
+	device := newWritableTestDevice("1")
+	s := newTestScheduler(device)
+
+	done := make(chan struct{})
+	go func() {
+		s.runSchedule()
+		close(done)
+	}()
+
+	later, err := s.WriteAt(device, []*synse.V3WriteData{{Action: "later"}}, time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	soon, err := s.WriteAt(device, []*synse.V3WriteData{{Action: "soon"}}, time.Now().Add(50*time.Millisecond))
+	assert.NoError(t, err)
+
+	select {
+	case w := <-s.writeChan:
+		assert.Equal(t, soon[0].Id, w.transaction.id)
+		assert.Equal(t, statusPending, w.transaction.status)
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for scheduled write")
+	}
+	assert.Equal(t, []string{later[0].Id}, scheduledIDs(s.schedule))
+
+	close(s.stop)
+	<-done
+}
+
+func TestScheduler_restoreSchedule(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedule.json")
+	schedule := newWriteSchedule(path)
+	at := time.Now().Add(time.Hour)
+	assert.NoError(t, schedule.add(&scheduledWrite{Transaction: "1", Device: "1", Action: "speed", Data: []byte("40"), At: at}))
+	assert.NoError(t, schedule.add(&scheduledWrite{Transaction: "2", Device: "unknown", Action: "speed", At: at}))
+
+	s := newTestScheduler(newWritableTestDevice("1"))
+	s.schedule = newWriteSchedule(path)
+	s.restoreSchedule()
+
+	// The write for the unknown device is dropped.
+	assert.Equal(t, []string{"1"}, scheduledIDs(s.schedule))
+	loaded, err := newWriteSchedule(path).load()
+	assert.NoError(t, err)
+	assert.Len(t, loaded, 1)
+
+	txn := s.stateManager.getTransaction("1")
+	assert.NotNil(t, txn)
+	assert.Equal(t, statusPending, txn.status)
+	assert.Equal(t, "speed", txn.context.Action)
+	assert.Equal(t, []byte("40"), txn.context.Data)
+
+	// The restored write can be cancelled.
+	assert.NotNil(t, s.cancelScheduledWrite("1"))
+}